@@ -8,6 +8,9 @@ type BasicBenchTaskConfig struct {
 	Group            string
 	MixMode          string
 	UseCase          string
+	Replay           string // 回放的数据文件，指定后UseCase不再生效
+	ReplayTag        string
+	ReplayCopies     int64
 	Workers          int
 	BatchSize        int
 	ScaleVar         int64
@@ -8,14 +8,20 @@ import (
 	"math/rand"
 	"os"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/airq"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/dashboard"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/devops"
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/iot"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/live"
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/metaqueries"
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/replay"
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/schema"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/testscene"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/universal"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/vehicle"
@@ -36,10 +42,15 @@ type BasicBenchTask struct {
 	UseGzip           int
 	WorkerCount       int
 	BatchSize         int
+	BatchBytes        int
 	DBName            string
 	TimeLimit         time.Duration
 	Format            string
 	UseCase           string
+	Schema            string
+	Replay            string
+	ReplayTag         string
+	ReplayCopies      int64
 	ScaleVar          int64
 	ScaleVarOffset    int64
 	SamplingInterval  time.Duration
@@ -57,17 +68,52 @@ type BasicBenchTask struct {
 	Username          string
 	Password          string
 	WithEncryption    bool
+	IngestMode        string
+	PrepareQuery      bool
+	MxgatePort        int
+	QueryLang         string
+	MaxConnsPerHost   int
+	IdleConnTimeout   time.Duration
+	DisableKeepAlive  bool
+	Precision         string
+	MqttTopic         string
+	MqttQos           int
+	MqttPayload       string
+	MqttPerBatch      bool
+	Replicate         bool
+	FieldPresence     float64
+	FieldPresenceBy   string
+	OutageRate        float64
+	OutagePoints      int64
+	OutageFields      string
+	ChurnLifetime     time.Duration
+	ChurnDistribution string
+	Jitter            time.Duration
+	IntervalSpread    float64
+	LateRatio         float64
+	MaxLateness       time.Duration
+	LateDistribution  string
+	DuplicateRatio    float64
 
 	//runtime vars
 	timestampStart  time.Time
 	timestampEnd    time.Time
 	daemonUrls      []string
+	formats         []string // --replicate时每个url对应的数据库类型
 	workerProcess   []Worker
 	databaseNames   []string
 	resultCollector *ResultCollector
 	sqlTemplate     []string
+	sparse          *common.SparseConfig
+	churn           *common.ChurnConfig
+	timing          *common.TimingConfig
+	ingestModes     map[string]string // 每种数据库类型的写入方式
+	measurements    []string          // 测试数据中所有measurement的名称
 }
 
+// minBatchBytes --batch-bytes的最小值
+const minBatchBytes = 1024
+
 func (d *BasicBenchTask) Validate() {
 	if d.Debug {
 		log.SetLevel(log.DebugLevel)
@@ -75,13 +121,29 @@ func (d *BasicBenchTask) Validate() {
 	log.SetFormatter(&log.TextFormatter{TimestampFormat: "2006/01/02 15:04:05", FullTimestamp: true})
 	d.daemonUrls = strings.Split(d.CsvDaemonUrls, ",")
 	d.databaseNames = strings.Split(d.DBName, ",")
-	if !db_client.IsSupportedFormat(d.Format) {
-		log.Fatal("wrong database format, support: ", strings.Join(db_client.SupportedFormat, " "))
+	d.formats = strings.Split(d.Format, ",")
+	for _, format := range d.formats {
+		if !db_client.IsSupportedFormat(format) {
+			log.Fatal("wrong database format, support: ", strings.Join(db_client.SupportedFormat, " "))
+		}
 	}
 	if len(d.daemonUrls) == 0 {
 		log.Fatal("missing 'urls' flag")
 	}
+	if len(d.formats) > 1 {
+		if !d.Replicate {
+			log.Fatal("multiple formats are only supported with replicate")
+		}
+		if len(d.formats) != len(d.daemonUrls) {
+			log.Fatal("the count of formats must be equal to the count of urls")
+		}
+	}
+	// 多个数据库类型时，第一个为主目标，查询只发送到主目标
+	d.Format = d.formats[0]
 	log.Info("daemon URLs: ", d.daemonUrls)
+	if d.Replicate {
+		log.Info("Replicate each batch to all targets: ", strings.Join(d.targetLabels(), ", "))
+	}
 	log.Info("Using mix mode: ", d.MixMode)
 
 	// the default seed is the current timestamp:
@@ -104,6 +166,51 @@ func (d *BasicBenchTask) Validate() {
 	}
 	d.timestampEnd = d.timestampEnd.UTC()
 
+	// 指定schema文件时使用schema场景，use-case不再生效
+	if d.Schema != "" {
+		d.UseCase = common.UseCaseSchema
+		log.Info("Using schema file: ", d.Schema)
+	}
+	// 指定回放的数据文件时使用replay场景
+	if d.Replay != "" {
+		if d.Schema != "" {
+			log.Fatal("--schema and --replay can not be used together")
+		}
+		d.UseCase = common.UseCaseReplay
+		log.Infof("Using replay file: %s, tag: %s, copies: %d", d.Replay, d.ReplayTag, d.ReplayCopies)
+	}
+
+	d.sparse, err = parseSparseConfig(d.FieldPresence, d.FieldPresenceBy, d.OutageRate, d.OutagePoints, d.OutageFields)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if d.sparse.Enabled() {
+		log.Infof("Using field presence: %v %s, outage rate: %v, outage points: %d", d.FieldPresence, d.FieldPresenceBy, d.OutageRate, d.OutagePoints)
+	}
+	d.churn = &common.ChurnConfig{Lifetime: d.ChurnLifetime, Distribution: d.ChurnDistribution, Seed: d.Seed}
+	if err = d.churn.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if d.churn.Enabled() {
+		log.Infof("Using churn lifetime: %s, distribution: %s", d.ChurnLifetime, d.ChurnDistribution)
+	}
+	d.timing = &common.TimingConfig{
+		Jitter:           d.Jitter,
+		IntervalSpread:   d.IntervalSpread,
+		LateRatio:        d.LateRatio,
+		MaxLateness:      d.MaxLateness,
+		LateDistribution: d.LateDistribution,
+		DuplicateRatio:   d.DuplicateRatio,
+		Seed:             d.Seed,
+	}
+	if err = d.timing.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if d.timing.Enabled() {
+		log.Infof("Using timestamp jitter: %s, interval spread: %v, late ratio: %v, max lateness: %s, duplicate ratio: %v",
+			d.Jitter, d.IntervalSpread, d.LateRatio, d.MaxLateness, d.DuplicateRatio)
+	}
+
 	// samplingInterval and gzip
 	if d.SamplingInterval <= 0 {
 		log.Fatal("Invalid sampling interval")
@@ -112,28 +219,132 @@ func (d *BasicBenchTask) Validate() {
 	if d.UseGzip < 0 || d.UseGzip > 9 {
 		log.Fatal("Invalid gzip level, must bu in 0-9")
 	}
+	// 部分格式在BeforeSerializePoints中写入请求头，例如opentsdb的[，batch-bytes过小时没有意义
+	if d.BatchBytes < 0 || (d.BatchBytes > 0 && d.BatchBytes < minBatchBytes) {
+		log.Fatalf("Invalid batch bytes, must be 0 or >= %d", minBatchBytes)
+	}
+	if d.BatchBytes > 0 {
+		log.Infof("Using batch bytes: %d, batch size is ignored when writing", d.BatchBytes)
+	}
 	if d.UseGzip == 0 {
 		log.Info("Close the gzip")
 	} else {
 		log.Info("Using gzip: level", d.UseGzip)
 	}
 
+	if d.PrepareQuery && d.Format != "mysql" {
+		log.Fatal("prepare query only supports mysql format")
+	}
+
+	// mysql和matrixdb的默认写入方式不同，--replicate同时写入两者时分别确定
+	d.ingestModes = make(map[string]string)
+	if d.hasFormat("mysql") {
+		mode := d.IngestMode
+		if mode == "" {
+			mode = db_client.MysqlIngestInsert
+		}
+		switch mode {
+		case db_client.MysqlIngestInsert, db_client.MysqlIngestPrepare, db_client.MysqlIngestLoadData:
+		default:
+			log.Fatal("Invalid mysql ingest mode, must be insert, prepare or load-data")
+		}
+		d.ingestModes["mysql"] = mode
+		log.Infof("Using mysql ingest mode: %s, prepare query: %v", mode, d.PrepareQuery)
+	}
+
+	if d.hasFormat("matrixdb") {
+		mode := d.IngestMode
+		if mode == "" {
+			mode = db_client.MatrixdbIngestMxgate
+		}
+		switch mode {
+		case db_client.MatrixdbIngestMxgate, db_client.MatrixdbIngestCopy, db_client.MatrixdbIngestInsert:
+		default:
+			log.Fatal("Invalid matrixdb ingest mode, must be mxgate, copy or insert")
+		}
+		if d.MxgatePort <= 0 {
+			d.MxgatePort = db_client.DefaultMxgatePort
+		}
+		d.ingestModes["matrixdb"] = mode
+		if mode == db_client.MatrixdbIngestMxgate {
+			log.Infof("Using matrixdb ingest mode: %s, mxgate port: %d", mode, d.MxgatePort)
+		} else {
+			log.Infof("Using matrixdb ingest mode: %s", mode)
+		}
+	}
+
+	for i, daemonUrl := range d.daemonUrls {
+		if strings.HasPrefix(daemonUrl, db_client.UnixSocketPrefix) {
+			switch d.targetFormat(i) {
+			case "fctsdb", "influxdbv2", "opentsdb":
+			default:
+				log.Fatal("unix socket urls only support fctsdb, influxdbv2 and opentsdb format")
+			}
+		}
+	}
+	if d.MaxConnsPerHost < 0 {
+		log.Fatal("Invalid max conns per host, must be >= 0")
+	}
+	if d.DisableKeepAlive {
+		log.Info("Disable http keep-alive, each request uses a new connection")
+	}
+
+	common.TimePrecision = 0
+	if d.Precision != "" {
+		for _, format := range d.formats {
+			if format != "fctsdb" && format != "influxdbv2" {
+				log.Fatal("precision only supports fctsdb and influxdbv2 format")
+			}
+		}
+		common.TimePrecision = db_client.PrecisionDuration(d.Precision)
+		if common.TimePrecision == 0 {
+			log.Fatal("Invalid precision, must be ns, us, ms or s")
+		}
+		log.Info("Using timestamp precision: ", d.Precision)
+	}
+
+	if d.QueryLang == "" {
+		d.QueryLang = db_client.QueryLangInfluxql
+	}
+	switch d.QueryLang {
+	case db_client.QueryLangInfluxql:
+	case db_client.QueryLangFlux:
+		if d.Format != "influxdbv2" {
+			log.Fatal("flux query language only supports influxdbv2 format")
+		}
+		log.Info("Using query language: flux")
+	default:
+		log.Fatal("Invalid query language, must be influxql or flux")
+	}
+
+	if d.hasFormat("mqtt") {
+		if d.MixMode != "write_only" {
+			log.Fatal("mqtt format only supports write")
+		}
+		if d.MqttQos < 0 || d.MqttQos > 2 {
+			log.Fatal("Invalid mqtt qos, must be in 0-2")
+		}
+		if d.MqttPayload != "json" && d.MqttPayload != "line" {
+			log.Fatal("Invalid mqtt payload, must be json or line")
+		}
+		log.Infof("Using mqtt topic: %s, qos: %d, payload: %s, per batch: %v", d.MqttTopic, d.MqttQos, d.MqttPayload, d.MqttPerBatch)
+	}
+
 	// query命令case和id对应相关处理
 	log.Info("Use case: ", d.UseCase)
 	if d.MixMode != "write_only" {
-		var queryCase *queryTemplate.QueryCase
-		switch d.UseCase {
-		case queryTemplate.AirQuality.CaseName:
-			queryCase = queryTemplate.AirQuality
-		case queryTemplate.Vehicle.CaseName:
-			queryCase = queryTemplate.Vehicle
-		default:
+		queryCase := queryTemplate.LookupCase(d.UseCase)
+		if queryCase == nil {
 			log.Fatal("the use-case is unsupported")
 		}
 
 		if d.QueryType > 0 {
 			if d.QueryType <= queryCase.Count {
-				d.sqlTemplate = []string{queryCase.Types[d.QueryType].RawSql}
+				template := queryCase.Types[d.QueryType].Template(d.Format, d.QueryLang)
+				if template == "" {
+					log.Fatalf("the query-type %d does not support format %s", d.QueryType, d.Format)
+				}
+				d.sqlTemplate = []string{template}
 			} else {
 				log.Fatalln("the query-type is out of range")
 			}
@@ -149,19 +360,114 @@ func (d *BasicBenchTask) Validate() {
 	}
 }
 
+// parseSparseConfig 解析字段缺失的参数，presenceBy的格式为field=概率，多个使用逗号分隔，例如pm25=0.5,no2=0.8
+func parseSparseConfig(presence float64, presenceBy string, outageRate float64, outagePoints int64, outageFields string) (*common.SparseConfig, error) {
+	c := &common.SparseConfig{
+		Presence:     presence,
+		OutageRate:   outageRate,
+		OutagePoints: outagePoints,
+	}
+	if presenceBy != "" {
+		c.FieldPresence = make(map[string]float64)
+		for _, item := range strings.Split(presenceBy, ",") {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid field presence %q, the format is field=presence", item)
+			}
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid field presence %q: %v", item, err)
+			}
+			c.FieldPresence[strings.TrimSpace(kv[0])] = v
+		}
+	}
+	if outageFields != "" {
+		c.OutageFields = strings.Split(outageFields, ",")
+	}
+	return c, c.Validate()
+}
+
+func (d *BasicBenchTask) hasFormat(format string) bool {
+	for _, f := range d.formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// targetFormat 第i个url的数据库类型，只指定一个数据库类型时所有url相同
+func (d *BasicBenchTask) targetFormat(i int) string {
+	if len(d.formats) > 1 {
+		return d.formats[i]
+	}
+	return d.Format
+}
+
+// IngestModeOf 数据库类型对应的写入方式，Validate之后可用
+func (d *BasicBenchTask) IngestModeOf(format string) string {
+	if mode, ok := d.ingestModes[format]; ok {
+		return mode
+	}
+	return d.IngestMode
+}
+
+// queryIsStatement 查询体是否为可以拼接的sql语句，elasticsearch的DSL、opentsdb的json、flux等请求体需要原样发送，
+// iotdb的rest接口每个请求只执行一条sql，这些格式每个请求一条
+func (d *BasicBenchTask) queryIsStatement() bool {
+	switch d.Format {
+	case "elasticsearch", "opentsdb", "iotdb":
+		return false
+	case "influxdbv2":
+		return d.QueryLang != db_client.QueryLangFlux
+	}
+	return true
+}
+
+// targetLabels --replicate时每个目标的写入延时统计标签，例如write fctsdb@http://localhost:8086
+func (d *BasicBenchTask) targetLabels() []string {
+	labels := make([]string, len(d.daemonUrls))
+	for i, daemonUrl := range d.daemonUrls {
+		labels[i] = "write " + d.targetFormat(i) + "@" + daemonUrl
+	}
+	return labels
+}
+
 func (d *BasicBenchTask) PrepareWorkers() {
 
 	d.workerProcess = make([]Worker, 0)
 	d.resultCollector = &ResultCollector{}
 
-	// 建一个最小客户端，检查连接和创建数据库
+	// 建一个最小客户端，检查连接和创建数据库，--replicate时每个目标都需要检查
+	targets := 1
+	if d.Replicate {
+		targets = len(d.daemonUrls)
+	}
+	for i := 0; i < targets; i++ {
+		d.prepareTarget(i)
+	}
+
+	// 根据dbName准备workers
+	for _, dbName := range d.databaseNames {
+		d.prepareWorkersOnEachDB(dbName)
+	}
+
+	time.Sleep(time.Second)
+}
+
+func (d *BasicBenchTask) prepareTarget(i int) {
 	var cli db_client.DBClient
 	miniConfig := db_client.ClientConfig{
-		Host:     d.daemonUrls[0],
-		User:     d.Username,
-		Password: d.Password,
+		Host:        d.daemonUrls[i],
+		User:        d.Username,
+		Password:    d.Password,
+		IngestMode:  d.IngestModeOf(d.targetFormat(i)),
+		MxgatePort:  d.MxgatePort,
+		MqttTopic:   d.MqttTopic,
+		MqttQos:     d.MqttQos,
+		MqttPayload: d.MqttPayload,
 	}
-	cli = db_client.NewDBClient(d.Format, miniConfig)
+	cli = db_client.NewDBClient(d.targetFormat(i), miniConfig)
 	if cli == nil {
 		log.Fatal("create database client error")
 	}
@@ -181,13 +487,6 @@ func (d *BasicBenchTask) PrepareWorkers() {
 			}
 		}
 	}
-
-	// 根据dbName准备workers
-	for _, dbName := range d.databaseNames {
-		d.prepareWorkersOnEachDB(dbName)
-	}
-
-	time.Sleep(time.Second)
 }
 
 func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
@@ -196,9 +495,199 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 	workersEachDB := make([]Worker, d.WorkerCount)
 
 	// 每个database共享一个生成器
+	simulator := d.newSimulator()
+
+	// 只测试查询时，需要将模拟器的WrittenPoints设置为最大值，这样保证生成的sql在数据范围内。
+	if d.MixMode == "read_only" {
+		simulator.SetWrittenPoints(simulator.Total())
+	}
+
+	// 创建workers
+	for j := 0; j < len(workersEachDB); j++ {
+
+		worker := Worker{}
+		worker.simulator = simulator // 共享生成器
+
+		// 每个worker绑定一个db client
+		c := db_client.ClientConfig{
+			Host:         d.daemonUrls[j%len(d.daemonUrls)],
+			Database:     dbName,
+			Gzip:         d.UseGzip,
+			User:         d.Username,
+			Password:     d.Password,
+			IngestMode:   d.IngestModeOf(d.Format),
+			PrepareQuery: d.PrepareQuery,
+			MxgatePort:   d.MxgatePort,
+			QueryLang:    d.QueryLang,
+			Precision:    d.Precision,
+			MqttTopic:    d.MqttTopic,
+			MqttQos:      d.MqttQos,
+			MqttPayload:  d.MqttPayload,
+			MqttPerBatch: d.MqttPerBatch,
+
+			MaxConnsPerHost:  d.MaxConnsPerHost,
+			IdleConnTimeout:  d.IdleConnTimeout,
+			DisableKeepAlive: d.DisableKeepAlive,
+		}
+		if d.Replicate {
+			// 每个worker绑定所有目标的db client，第一个为writer，其他为replicas
+			c.Host = d.daemonUrls[0]
+			labels := d.targetLabels()
+			worker.writerLabel = labels[0]
+			for i := 1; i < len(d.daemonUrls); i++ {
+				replicaConfig := c
+				replicaConfig.Host = d.daemonUrls[i]
+				replicaConfig.IngestMode = d.IngestModeOf(d.targetFormat(i))
+				replicaWriter := db_client.NewDBClient(d.targetFormat(i), replicaConfig)
+				if replicaWriter == nil {
+					log.Fatal("create writer failed")
+				}
+				worker.replicas = append(worker.replicas, &replica{writer: replicaWriter, label: labels[i]})
+			}
+		}
+		worker.writer = db_client.NewDBClient(d.Format, c)
+		if worker.writer == nil {
+			log.Fatal("create writer failed")
+		}
+		defer worker.writer.Close()
+		// worker的其他必要参数
+		worker.resultCollector = d.resultCollector
+		worker.Debug = d.Debug
+		worker.UseGzip = d.UseGzip
+		worker.BatchSize = d.BatchSize
+		worker.BatchBytes = d.BatchBytes
+		worker.statement = d.queryIsStatement()
+		switch d.MixMode {
+		case "write_only":
+			worker.Mode = "write"
+		case "read_only":
+			worker.Mode = "query"
+		case "parallel":
+			if j >= d.QueryPercent*d.WorkerCount/100 {
+				worker.Mode = "write"
+			} else {
+				worker.Mode = "query"
+				// 混合测试时，查询的batch size设置为1
+				worker.BatchSize = 1
+			}
+		}
+		workersEachDB[j] = worker
+	}
+
+	// 第一个时间点中每张表的第一个point，用于创建数据表和记录测试数据中的measurement
+	points := firstPoints(simulator)
+	for _, point := range points {
+		d.addMeasurement(string(point.MeasurementName))
+	}
+
+	// mqtt的topic模板中只能使用measurement和数据中的tag名称
+	writers := []db_client.DBClient{workersEachDB[0].writer}
+	for _, r := range workersEachDB[0].replicas {
+		writers = append(writers, r.writer)
+	}
+	for _, writer := range writers {
+		if mqttClient, ok := writer.(*db_client.MqttClient); ok {
+			for _, point := range points {
+				if err := mqttClient.CheckTopic(point); err != nil {
+					log.Fatal(err.Error())
+				}
+			}
+		}
+	}
+
+	// 是否创建数据库和数据表，目前仅实现了不同数据写入的数据都是相同的
+	if d.DoDBCreate {
+		for _, writer := range writers {
+			err := writer.CreateDatabase(dbName, d.WithEncryption)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			for _, point := range points {
+				err := writer.CreateMeasurement(point)
+				if err != nil {
+					log.Fatalln(err)
+				}
+			}
+		}
+	}
+
+	d.workerProcess = append(d.workerProcess, workersEachDB...)
+}
+
+// firstPoints 遍历第一个采样周期的所有point，返回每张表的第一个point，iot等场景的同一张表会在一个时间点内多次出现。
+// 模拟series的场景每个周期中每个series生成一个point，按point数量判断周期，时间戳抖动时同一周期的时间戳不同；
+// 其他场景按时间戳判断
+func firstPoints(simulator common.Simulator) []*common.Point {
+	var points []*common.Point
+	created := make(map[string]bool)
+	point := common.MakeUsablePoint()
+	var roundPoints int64
+	if counter, ok := simulator.(common.SeriesCounter); ok {
+		roundPoints = counter.ActiveSeries()
+	}
+	var firstTimestamp time.Time
+	for {
+		madePoint := simulator.Next(point)
+		if madePoint > simulator.Total() || (roundPoints > 0 && madePoint > roundPoints) {
+			break
+		}
+		if roundPoints == 0 {
+			if firstTimestamp.IsZero() {
+				firstTimestamp = *point.Timestamp
+			} else if !point.Timestamp.Equal(firstTimestamp) {
+				break
+			}
+		}
+		if !created[string(point.MeasurementName)] {
+			created[string(point.MeasurementName)] = true
+			points = append(points, point)
+			point = common.MakeUsablePoint()
+			continue
+		}
+		point.Reset()
+	}
+	simulator.ClearMadePointNum()
+	return points
+}
+
+// addMeasurement 记录测试数据中的measurement，多个database的measurement相同
+func (d *BasicBenchTask) addMeasurement(name string) {
+	for _, m := range d.measurements {
+		if m == name {
+			return
+		}
+	}
+	d.measurements = append(d.measurements, name)
+}
+
+// Measurements 测试数据中所有measurement的名称，PrepareWorkers之后可用
+func (d *BasicBenchTask) Measurements() []string {
+	return d.measurements
+}
+
+// newSimulator 根据UseCase创建数据生成器，UseCase不是内置场景时按universal场景的json定义解析
+func (d *BasicBenchTask) newSimulator() common.Simulator {
 	var simulator common.Simulator
 	switch d.UseCase {
-	case common.UseCaseVehicle:
+	case common.UseCaseScene, common.UseCaseLiveCharge, common.UseCaseDevOps, common.UseCaseIot,
+		common.UseCaseDashboard, common.UseCaseMetaquery, common.UseCaseSchema, common.UseCaseReplay:
+		// 字段缺失和series变化只在vehicle、vehicle-telemetry、air-quality和universal场景中模拟
+		if d.sparse.Enabled() {
+			log.Fatalf("the use case %s does not support field presence and outage", d.UseCase)
+		}
+		if d.churn.Enabled() {
+			log.Fatalf("the use case %s does not support churn", d.UseCase)
+		}
+	}
+	switch d.UseCase {
+	case common.UseCaseDevOps, common.UseCaseIot, common.UseCaseDashboard, common.UseCaseMetaquery, common.UseCaseSchema, common.UseCaseReplay:
+		// 不规则的时间戳在vehicle、air-quality、live、scene和universal场景中模拟
+		if d.timing.Enabled() {
+			log.Fatalf("the use case %s does not support timestamp jitter, late and duplicate points", d.UseCase)
+		}
+	}
+	switch d.UseCase {
+	case common.UseCaseVehicle, common.UseCaseVehicleTelemetry:
 		cfg := vehicle.VehicleSimulatorConfig{
 			Start:            d.timestampStart,
 			End:              d.timestampEnd,
@@ -206,6 +695,10 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			DeviceCount:      d.ScaleVar,
 			DeviceOffset:     d.ScaleVarOffset,
 			SqlTemplates:     d.sqlTemplate,
+			Sparse:           d.sparse,
+			Churn:            d.churn,
+			Timing:           d.timing,
+			Telemetry:        d.UseCase == common.UseCaseVehicleTelemetry,
 		}
 		simulator = cfg.ToSimulator()
 	case common.UseCaseAirQuality:
@@ -216,6 +709,9 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			DeviceCount:      d.ScaleVar,
 			DeviceOffset:     d.ScaleVarOffset,
 			SqlTemplates:     d.sqlTemplate,
+			Sparse:           d.sparse,
+			Churn:            d.churn,
+			Timing:           d.timing,
 		}
 		simulator = cfg.ToSimulator()
 	case common.UseCaseScene:
@@ -226,6 +722,7 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			SeriesCount:      d.ScaleVar,
 			SeriesOffset:     d.ScaleVarOffset,
 			SqlTemplates:     d.sqlTemplate,
+			Timing:           d.timing,
 		}
 		simulator = cfg.ToSimulator()
 	case common.UseCaseLiveCharge:
@@ -236,6 +733,7 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			DeviceCount:      d.ScaleVar,
 			DeviceOffset:     d.ScaleVarOffset,
 			SqlTemplates:     d.sqlTemplate,
+			Timing:           d.timing,
 		}
 		simulator = cfg.ToSimulator()
 	case common.UseCaseDevOps:
@@ -244,8 +742,74 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			Start: d.timestampStart,
 			End:   d.timestampEnd,
 			// SamplingInterval: d.samplingInterval,
-			HostCount:  d.ScaleVar,
-			HostOffset: d.ScaleVarOffset,
+			HostCount:    d.ScaleVar,
+			HostOffset:   d.ScaleVarOffset,
+			SqlTemplates: d.sqlTemplate,
+		}
+		simulator = cfg.ToSimulator()
+	case common.UseCaseIot:
+		iot.EpochDuration = d.SamplingInterval
+		cfg := &iot.IotSimulatorConfig{
+			Start:           d.timestampStart,
+			End:             d.timestampEnd,
+			SmartHomeCount:  d.ScaleVar,
+			SmartHomeOffset: d.ScaleVarOffset,
+			SqlTemplates:    d.sqlTemplate,
+		}
+		simulator = cfg.ToSimulator()
+	case common.UseCaseDashboard:
+		devops.EpochDuration = d.SamplingInterval
+		cfg := &dashboard.DashboardSimulatorConfig{
+			Start:        d.timestampStart,
+			End:          d.timestampEnd,
+			HostCount:    d.ScaleVar,
+			HostOffset:   d.ScaleVarOffset,
+			SqlTemplates: d.sqlTemplate,
+		}
+		simulator = cfg.ToSimulator()
+	case common.UseCaseMetaquery:
+		// metaquery场景共生成scale-var*scale-var个point，平均分布在整个时间范围内，不使用sampling-interval
+		cfg := &metaqueries.MetaquerySimulatorConfig{
+			Start:        d.timestampStart,
+			End:          d.timestampEnd,
+			ScaleFactor:  int(d.ScaleVar),
+			SqlTemplates: d.sqlTemplate,
+		}
+		simulator = cfg.ToSimulator()
+	case common.UseCaseSchema:
+		// schema场景的series数量由配置文件中tag的取值决定，不使用scale-var
+		if d.Schema == "" {
+			log.Fatal("the schema use case requires --schema")
+		}
+		schemaConfig, err := common.NewConfig(d.Schema)
+		if err != nil {
+			log.Fatalf("load schema %s error: %v", d.Schema, err)
+		}
+		cfg := &schema.SchemaSimulatorConfig{
+			Start:            d.timestampStart,
+			End:              d.timestampEnd,
+			SamplingInterval: d.SamplingInterval,
+			Schema:           schemaConfig,
+			SqlTemplates:     d.sqlTemplate,
+		}
+		simulator = cfg.ToSimulator()
+	case common.UseCaseReplay:
+		// replay场景的measurement、tag和时间间隔来自数据文件，使用--replay-copies而不是scale-var扩大设备数量
+		if d.Replay == "" {
+			log.Fatal("the replay use case requires --replay")
+		}
+		copies := d.ReplayCopies
+		if copies == 0 {
+			copies = 1
+		}
+		cfg := &replay.ReplaySimulatorConfig{
+			Start:            d.timestampStart,
+			End:              d.timestampEnd,
+			SamplingInterval: d.SamplingInterval,
+			Path:             d.Replay,
+			Tag:              d.ReplayTag,
+			Copies:           copies,
+			SqlTemplates:     d.sqlTemplate,
 		}
 		simulator = cfg.ToSimulator()
 	default:
@@ -263,80 +827,15 @@ func (d *BasicBenchTask) prepareWorkersOnEachDB(dbName string) {
 			MeasurementCount: ucase.MeasurementCount,
 			TagKeyCount:      ucase.TagKeyCount,
 			FieldsDefine:     ucase.FieldsDefine,
+			Tags:             ucase.Tags,
+			Fields:           ucase.Fields,
+			Sparse:           d.sparse,
+			Churn:            d.churn,
+			Timing:           d.timing,
 		}
 		simulator = cfg.ToSimulator()
 	}
-
-	// 只测试查询时，需要将模拟器的WrittenPoints设置为最大值，这样保证生成的sql在数据范围内。
-	if d.MixMode == "read_only" {
-		simulator.SetWrittenPoints(simulator.Total())
-	}
-
-	// 创建workers
-	for j := 0; j < len(workersEachDB); j++ {
-
-		worker := Worker{}
-		worker.simulator = simulator // 共享生成器
-
-		// 每个worker绑定一个db client
-		c := db_client.ClientConfig{
-			Host:     d.daemonUrls[j%len(d.daemonUrls)],
-			Database: dbName,
-			Gzip:     d.UseGzip,
-			User:     d.Username,
-			Password: d.Password,
-		}
-		worker.writer = db_client.NewDBClient(d.Format, c)
-		if worker.writer == nil {
-			log.Fatal("create writer failed")
-		}
-		defer worker.writer.Close()
-		// worker的其他必要参数
-		worker.resultCollector = d.resultCollector
-		worker.Debug = d.Debug
-		worker.UseGzip = d.UseGzip
-		worker.BatchSize = d.BatchSize
-		switch d.MixMode {
-		case "write_only":
-			worker.Mode = "write"
-		case "read_only":
-			worker.Mode = "query"
-		case "parallel":
-			if j >= d.QueryPercent*d.WorkerCount/100 {
-				worker.Mode = "write"
-			} else {
-				worker.Mode = "query"
-				// 混合测试时，查询的batch size设置为1
-				worker.BatchSize = 1
-			}
-		}
-		workersEachDB[j] = worker
-	}
-
-	// 是否创建数据库和数据表，目前仅实现了不同数据写入的数据都是相同的
-	if d.DoDBCreate {
-		writer := workersEachDB[0].writer
-		err := writer.CreateDatabase(dbName, d.WithEncryption)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		point := common.MakeUsablePoint()
-		createdMeasurement := make(map[string]bool)
-		for {
-			simulator.Next(point)
-			if _, ok := createdMeasurement[string(point.MeasurementName)]; ok {
-				break
-			}
-			err := writer.CreateMeasurement(point)
-			if err != nil {
-				log.Fatalln(err)
-			}
-			createdMeasurement[string(point.MeasurementName)] = true
-		}
-		simulator.ClearMadePointNum()
-	}
-
-	d.workerProcess = append(d.workerProcess, workersEachDB...)
+	return simulator
 }
 
 func (d *BasicBenchTask) Run() {
@@ -422,6 +921,11 @@ func (d *BasicBenchTask) Report() map[string]string {
 	groupResult := d.resultCollector.GetGroupDetail()
 	groupResult.Show()
 	result := groupResult.ToMap()
+	batchResult := d.resultCollector.GetBatchDetail()
+	batchResult.Show()
+	for k, v := range batchResult.ToMap() {
+		result[k] = v
+	}
 	result["PointRate(p/s)"] = fmt.Sprintf("%.2f", pointsRate)
 	result["ValueRate(v/s)"] = fmt.Sprintf("%.2f", valuesRate)
 	result["BytesRate(MB/s)"] = fmt.Sprintf("%.2f", convertedBytesRate)
@@ -429,11 +933,18 @@ func (d *BasicBenchTask) Report() map[string]string {
 	result["UseCase"] = d.UseCase
 	result["Mod"] = d.MixMode
 	result["BatchSize"] = fmt.Sprintf("%d", d.BatchSize)
+	result["BatchBytes"] = fmt.Sprintf("%d", d.BatchBytes)
 	result["Workers"] = fmt.Sprintf("%d", d.WorkerCount)
 	result["QueryPercent"] = fmt.Sprintf("%d", d.QueryPercent)
 	result["Cardinality"] = fmt.Sprintf("%d", d.ScaleVar)
 	result["SamplingTime"] = d.SamplingInterval.String()
 	result["Gzip"] = fmt.Sprintf("%d", d.UseGzip)
+	result["Ingest"] = d.IngestModeOf(d.Format)
+	if d.PrepareQuery {
+		result["QueryMode"] = "prepare"
+	} else if d.QueryLang == db_client.QueryLangFlux {
+		result["QueryMode"] = "flux"
+	}
 
 	// buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	// jsonEncoder := json.NewEncoder(buf)
@@ -442,6 +953,13 @@ func (d *BasicBenchTask) Report() map[string]string {
 	if len(d.sqlTemplate) > 0 {
 		result["Sql"] = d.sqlTemplate[0]
 	}
+	if len(d.workerProcess) > 0 {
+		if counter, ok := d.workerProcess[0].simulator.(common.SeriesCounter); ok {
+			log.Printf("Series: total %d, active %d", counter.TotalSeries(), counter.ActiveSeries())
+			result["TotalSeries"] = fmt.Sprintf("%d", counter.TotalSeries())
+			result["ActiveSeries"] = fmt.Sprintf("%d", counter.ActiveSeries())
+		}
+	}
 	return result
 }
 
@@ -484,6 +1002,11 @@ func (d *BasicBenchTask) SyncShowStatics(status string, ctx context.Context) {
 }
 
 func (d *BasicBenchTask) CleanUp() {
+	for _, worker := range d.workerProcess {
+		for _, r := range worker.replicas {
+			r.writer.Close()
+		}
+	}
 	switch d.Format {
 	case "mysql":
 		for _, worker := range d.workerProcess {
@@ -508,6 +1031,17 @@ type Worker struct {
 	UseGzip         int
 	QueryCount      int64
 	BatchSize       int
+	BatchBytes      int
+	replicas        []*replica // --replicate时同一个batch同时写入的其他目标
+	writerLabel     string     // --replicate时writer的写入延时统计标签
+	statement       bool       // 查询体是否为sql语句，只有sql语句可以补充;并把多条拼接到一个请求中
+}
+
+// replica --replicate时的一个写入目标，每个batch的point按目标的格式分别序列化
+type replica struct {
+	writer db_client.DBClient
+	label  string
+	buf    []byte
 }
 
 func (w *Worker) Prepare(wg *sync.WaitGroup) {
@@ -572,28 +1106,56 @@ func (d *Worker) runBatchAndWrite(batchSize int, useCountLimit bool, serializePo
 	var vaulesWritten int = 0
 	var pointMadeIndex int64
 	buf = d.writer.BeforeSerializePoints(buf, serializePoint)
+	for _, r := range d.replicas {
+		r.buf = r.writer.BeforeSerializePoints(r.buf[:0], serializePoint)
+	}
 
 	var point = common.MakeUsablePoint()
+	// iotdb、mysql等客户端在AfterSerializePoints之前把数据缓存在内部，buf的长度不能反映batch的大小
+	bufferedClient, _ := d.writer.(db_client.BufferedClient)
 
-	// 以simulator.Finished()结束为结束
-	for batchItemCount < batchSize {
+	// 以simulator.Finished()结束为结束，设置了BatchBytes时按序列化后(压缩前)的字节数分批，否则按point个数分批
+	for {
+		if d.BatchBytes > 0 {
+			size := len(buf)
+			if bufferedClient != nil {
+				size += bufferedClient.BufferedBytes()
+			}
+			// 至少写入一个point，避免请求头的大小超过batch-bytes时一直写不出数据
+			if size >= d.BatchBytes && batchItemCount > 0 {
+				break
+			}
+		} else if batchItemCount >= batchSize {
+			break
+		}
 		point.Reset()
 		pointMadeIndex = d.simulator.Next(point)
 		if pointMadeIndex > d.simulator.Total() && useCountLimit { // 以simulator.Finished()结束为结束
 			break
 		}
 		buf = d.writer.SerializeAndAppendPoint(buf, point)
+		for _, r := range d.replicas {
+			r.buf = r.writer.SerializeAndAppendPoint(r.buf, point)
+		}
 		batchItemCount++
-		vaulesWritten += (len(point.FieldValues) + len(point.Int64FiledValues))
+		vaulesWritten += point.ValueCount()
 	}
 
 	if batchItemCount > 0 {
 		buf = d.writer.AfterSerializePoints(buf, serializePoint)
-		err = d.writeToDb(buf)
+		for _, r := range d.replicas {
+			r.buf = r.writer.AfterSerializePoints(r.buf, serializePoint)
+		}
+		if len(d.replicas) > 0 {
+			err = d.writeReplicas(buf)
+		} else {
+			err = d.writeToDb(buf)
+		}
 		if err == nil {
 			d.resultCollector.AddBytes(int64(len(buf)))
 			d.resultCollector.AddValues(int64(vaulesWritten))
 			d.resultCollector.AddPoints(int64(batchItemCount))
+			d.resultCollector.AddBatch(int64(batchItemCount), int64(len(buf)))
 			d.simulator.SetWrittenPoints(pointMadeIndex)
 		}
 	}
@@ -614,18 +1176,63 @@ func (d *Worker) writeToDb(buf []byte) error {
 	return nil
 }
 
+// writeReplicas 把batch同时写入writer和所有replicas，每个目标按自己的标签统计延时，
+// write标签统计最慢目标的延时，任意一个目标写入失败都返回错误
+func (d *Worker) writeReplicas(buf []byte) error {
+	lats := make([]int64, len(d.replicas)+1)
+	errs := make([]error, len(d.replicas)+1)
+	var wg sync.WaitGroup
+	wg.Add(len(lats))
+	go func() {
+		defer wg.Done()
+		lats[0], errs[0] = d.writer.Write(buf)
+	}()
+	for i, r := range d.replicas {
+		go func(i int, r *replica) {
+			defer wg.Done()
+			lats[i+1], errs[i+1] = r.writer.Write(r.buf)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var maxLat int64
+	var failed []string
+	for i := range lats {
+		label := d.writerLabel
+		if i > 0 {
+			label = d.replicas[i-1].label
+		}
+		d.resultCollector.AddOneResponTime(label, lats[i], errs[i] == nil)
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", label, errs[i].Error()))
+		}
+		if lats[i] > maxLat {
+			maxLat = lats[i]
+		}
+	}
+	if len(failed) > 0 {
+		d.resultCollector.AddOneResponTime("write", maxLat, false)
+		return fmt.Errorf("error writing: %s", strings.Join(failed, "; "))
+	}
+	d.resultCollector.AddOneResponTime("write", maxLat, true)
+	return nil
+}
+
 func (d *Worker) runBatchAndQuery(batchSize int, useCountLimit bool) error {
 	var err error
 	var lat int64
 	buf := bufferPool.Get().(*bytes.Buffer)
 	var batchItemCount int = 0
+	if !d.statement {
+		batchSize = 1
+	}
 	for batchItemCount < batchSize {
 		madeSqlCount := d.simulator.NextSql(buf)
 		if madeSqlCount > d.QueryCount && useCountLimit {
 			break
 		}
 		batchItemCount++
-		if buf.Bytes()[buf.Len()-1] != ';' {
+		if d.statement && buf.Bytes()[buf.Len()-1] != ';' {
 			buf.Write([]byte(";"))
 		}
 	}
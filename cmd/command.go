@@ -11,6 +11,7 @@ import (
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
 	data_gen "git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/db_client"
 	"github.com/spf13/cobra"
 )
 
@@ -44,8 +45,14 @@ var (
 var (
 	CaseChoices = []string{
 		data_gen.UseCaseVehicle,
+		data_gen.UseCaseVehicleTelemetry,
 		data_gen.UseCaseAirQuality,
 		data_gen.UseCaseDevOps,
+		data_gen.UseCaseIot,
+		data_gen.UseCaseDashboard,
+		data_gen.UseCaseMetaquery,
+		data_gen.UseCaseLiveCharge,
+		data_gen.UseCaseScene,
 	}
 )
 
@@ -81,6 +88,10 @@ func InitMixed(task *BasicBenchTask, cmd *cobra.Command) {
 	cmdFlags.StringVar(&task.CsvDaemonUrls, "urls", "http://localhost:8086", "*被测数据库的地址")
 	cmdFlags.StringVar(&task.DBName, "db", "benchmark_db", "*数据库的database名称")
 	cmdFlags.StringVar(&task.UseCase, "use-case", CaseChoices[0], fmt.Sprintf("*使用的测试场景(可选场景: %s)", strings.Join(CaseChoices, ", ")))
+	cmdFlags.StringVar(&task.Schema, "schema", "", "使用toml文件描述的measurement、tag和field生成数据，格式参考bonitoo.toml，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.Replay, "replay", "", "回放的数据文件，支持行协议(包括data-gen的输出，.gz结尾时先解压)和带表头的csv，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.ReplayTag, "replay-tag", "", "回放时复制设备改写的tag，为空时使用数据中的第一个tag")
+	cmdFlags.Int64Var(&task.ReplayCopies, "replay-copies", 1, "回放时每条数据复制为多少个设备，第i份数据的replay-tag取值加上后缀_i")
 	cmdFlags.Int64Var(&task.ScaleVar, "scale-var", 1, "*场景的变量，一般情况下是场景中模拟机的数量")
 	cmdFlags.Int64Var(&task.ScaleVarOffset, "scale-var-offset", 0, "*场景偏移量，一般情况下是模拟机的起始MN编号 (default 0)")
 	cmdFlags.DurationVar(&task.SamplingInterval, "sampling-interval", time.Second, "*模拟机的采样时间")
@@ -92,6 +103,7 @@ func InitMixed(task *BasicBenchTask, cmd *cobra.Command) {
 
 	// 运行参数
 	cmdFlags.IntVar(&task.BatchSize, "batch-size", 100, "1个http请求中携带Point个数")
+	cmdFlags.IntVar(&task.BatchBytes, "batch-bytes", 0, "1个http请求中携带数据的字节数，按序列化后gzip压缩前的大小计算，不支持按压缩后的大小分批，>0时按字节数分批(最小1024)，batch-size不再生效")
 	cmdFlags.IntVar(&task.UseGzip, "gzip", 1, "是否使用gzip,level[0-9],小于0表示不使用")
 	cmdFlags.IntVar(&task.WorkerCount, "workers", 1, "并发的http个数")
 	cmdFlags.StringVar(&task.MixMode, "mix-mode", "parallel", "混合模式，支持parallel(按线程比例混合)、request(按请求比例混合)")
@@ -100,11 +112,41 @@ func InitMixed(task *BasicBenchTask, cmd *cobra.Command) {
 	cmdFlags.Int64Var(&task.QueryCount, "query-count", 1000, "生成的查询语句数量")
 	cmdFlags.DurationVar(&task.TimeLimit, "time-limit", -1, "最大测试时间(-1表示不生效)，>0会使参数timestamp-end失效")
 	cmdFlags.BoolVar(&task.Debug, "debug", false, "是否打印详细日志(default false).")
-	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，当前仅支持fctsdb和mysql")
+	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，支持fctsdb、influxdbv2、mysql、matrixdb、elasticsearch、iotdb、opentsdb和mqtt")
 
 	// 高级参数
 	cmdFlags.StringVar(&task.CpuProfile, "cpu-profile", "", "将cpu-profile信息写入文件的地址，用于自测此工具")
 	cmdFlags.BoolVar(&task.DoDBCreate, "do-db-create", true, "是否创建数据库")
+	cmdFlags.IntVar(&task.MaxConnsPerHost, "max-conns-per-host", 0, "每个数据库地址的最大http连接数，0表示不限制，当前fctsdb、influxdbv2、opentsdb生效")
+	cmdFlags.DurationVar(&task.IdleConnTimeout, "idle-conn-timeout", db_client.DefaultIdleConnectionTimeout, "空闲http连接的保持时间")
+	cmdFlags.BoolVar(&task.DisableKeepAlive, "disable-keep-alive", false, "每个请求结束后关闭http连接，用于模拟连接频繁建立的场景")
+	cmdFlags.BoolVar(&task.Replicate, "replicate", false, "每个batch同时写入urls中的所有地址，而不是分散到各个地址，format可以按urls的顺序指定多个数据库类型，例如fctsdb,influxdbv2，查询只发送到第一个地址")
+	cmdFlags.StringVar(&task.Precision, "precision", "", "写入时间戳的精度(ns/us/ms/s)，当前仅支持fctsdb和influxdbv2，查询模板中的时间关键字按同样的精度截断")
+	cmdFlags.StringVar(&task.IngestMode, "ingest-mode", "", "写入方式，mysql支持insert(拼接sql,默认)、prepare(多行prepared statement)、load-data(LOAD DATA LOCAL INFILE)，matrixdb支持mxgate(默认)、copy(COPY FROM STDIN)、insert(拼接sql)")
+	cmdFlags.IntVar(&task.MxgatePort, "mxgate-port", db_client.DefaultMxgatePort, "matrixdb使用mxgate写入时mxgate的http端口")
+	cmdFlags.BoolVar(&task.PrepareQuery, "prepare-query", false, "查询时是否使用服务端prepared statement，当前仅支持mysql")
+	cmdFlags.StringVar(&task.QueryLang, "query-lang", db_client.QueryLangInfluxql, "查询语言，influxdbv2支持influxql(默认)和flux，flux使用查询类型中的Flux模板")
+
+	initSimulationFlags(task, cmd)
+}
+
+// initSimulationFlags 字段缺失、series变化和不规则时间戳的参数，字段缺失和series变化当前vehicle、air-quality和universal场景生效，
+// 不规则时间戳另外支持live和scene场景
+func initSimulationFlags(task *BasicBenchTask, cmd *cobra.Command) {
+	cmdFlags := cmd.Flags()
+	cmdFlags.Float64Var(&task.FieldPresence, "field-presence", 1, "每个字段出现的概率[0-1]，缺失的字段在mysql、matrixdb中写入NULL，其他数据库不写入该字段")
+	cmdFlags.StringVar(&task.FieldPresenceBy, "field-presence-by", "", "按字段名称覆盖field-presence，例如pm25=0.5,no2=0.8")
+	cmdFlags.Float64Var(&task.OutageRate, "outage-rate", 0, "每个point开始一次设备故障的概率[0-1]，0表示不模拟故障")
+	cmdFlags.Int64Var(&task.OutagePoints, "outage-points", 10, "一次设备故障持续的point数量")
+	cmdFlags.StringVar(&task.OutageFields, "outage-fields", "", "设备故障时缺失的字段，逗号分隔，为空表示设备故障时不上报数据")
+	cmdFlags.DurationVar(&task.ChurnLifetime, "churn-lifetime", 0, "设备的平均存活时间(按采样时间计算)，设备下线后由新编号的设备代替，0表示不模拟series变化")
+	cmdFlags.StringVar(&task.ChurnDistribution, "churn-dist", common.ChurnExponential, "设备存活时间的分布(fixed/exponential/uniform)")
+	cmdFlags.DurationVar(&task.Jitter, "jitter", 0, "每个point的时间戳在[-jitter, jitter]之间随机偏移")
+	cmdFlags.Float64Var(&task.IntervalSpread, "interval-spread", 0, "每个设备的采样间隔在sampling-interval*(1±interval-spread)之间均匀分布[0-1)，每个设备的point数量不变")
+	cmdFlags.Float64Var(&task.LateRatio, "late-ratio", 0, "迟到(乱序)的point比例[0-1]，迟到的point的时间戳向前偏移")
+	cmdFlags.DurationVar(&task.MaxLateness, "max-lateness", time.Minute, "point最大的迟到时间")
+	cmdFlags.StringVar(&task.LateDistribution, "late-dist", common.LateUniform, "迟到时间的分布(uniform/exponential)，exponential的均值为max-lateness/4")
+	cmdFlags.Float64Var(&task.DuplicateRatio, "duplicate-ratio", 0, "和设备上一个point时间戳相同的point比例[0-1]，用于测试覆盖写")
 }
 
 func InitWrite(task *BasicBenchTask, cmd *cobra.Command) {
@@ -115,6 +157,10 @@ func InitWrite(task *BasicBenchTask, cmd *cobra.Command) {
 	cmdFlags.StringVar(&task.CsvDaemonUrls, "urls", "http://localhost:8086", "*被测数据库的地址")
 	cmdFlags.StringVar(&task.DBName, "db", "benchmark_db", "*数据库的database名称")
 	cmdFlags.StringVar(&task.UseCase, "use-case", CaseChoices[0], fmt.Sprintf("*使用的测试场景(可选场景: %s)", strings.Join(CaseChoices, ", ")))
+	cmdFlags.StringVar(&task.Schema, "schema", "", "使用toml文件描述的measurement、tag和field生成数据，格式参考bonitoo.toml，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.Replay, "replay", "", "回放的数据文件，支持行协议(包括data-gen的输出，.gz结尾时先解压)和带表头的csv，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.ReplayTag, "replay-tag", "", "回放时复制设备改写的tag，为空时使用数据中的第一个tag")
+	cmdFlags.Int64Var(&task.ReplayCopies, "replay-copies", 1, "回放时每条数据复制为多少个设备，第i份数据的replay-tag取值加上后缀_i")
 	cmdFlags.Int64Var(&task.ScaleVar, "scale-var", 1, "*场景的变量，一般情况下是场景中模拟机的数量")
 	cmdFlags.Int64Var(&task.ScaleVarOffset, "scale-var-offset", 0, "*场景偏移量，一般情况下是模拟机的起始MN编号 (default 0)")
 	cmdFlags.DurationVar(&task.SamplingInterval, "sampling-interval", time.Second, "*模拟机的采样时间")
@@ -126,16 +172,31 @@ func InitWrite(task *BasicBenchTask, cmd *cobra.Command) {
 
 	// 运行参数
 	cmdFlags.IntVar(&task.BatchSize, "batch-size", 100, "1个http请求中携带Point个数")
+	cmdFlags.IntVar(&task.BatchBytes, "batch-bytes", 0, "1个http请求中携带数据的字节数，按序列化后gzip压缩前的大小计算，不支持按压缩后的大小分批，>0时按字节数分批(最小1024)，batch-size不再生效")
 	cmdFlags.IntVar(&task.UseGzip, "gzip", 1, "是否使用gzip,level[0-9],小于0表示不使用")
 	cmdFlags.IntVar(&task.WorkerCount, "workers", 1, "并发的http个数")
 	cmdFlags.DurationVar(&task.TimeLimit, "time-limit", -1, "最大测试时间")
 	cmdFlags.BoolVar(&task.Debug, "debug", false, "是否打印详细日志(default false).")
-	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，当前仅支持fctsdb和mysql")
+	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，支持fctsdb、influxdbv2、mysql、matrixdb、elasticsearch、iotdb、opentsdb和mqtt")
 
 	// 高级参数
 	cmdFlags.StringVar(&task.CpuProfile, "cpu-profile", "", "将cpu-profile信息写入文件的地址，用于自测此工具")
 	cmdFlags.BoolVar(&task.DoDBCreate, "do-db-create", true, "是否创建数据库")
-
+	cmdFlags.IntVar(&task.MaxConnsPerHost, "max-conns-per-host", 0, "每个数据库地址的最大http连接数，0表示不限制，当前fctsdb、influxdbv2、opentsdb生效")
+	cmdFlags.DurationVar(&task.IdleConnTimeout, "idle-conn-timeout", db_client.DefaultIdleConnectionTimeout, "空闲http连接的保持时间")
+	cmdFlags.BoolVar(&task.DisableKeepAlive, "disable-keep-alive", false, "每个请求结束后关闭http连接，用于模拟连接频繁建立的场景")
+	cmdFlags.BoolVar(&task.Replicate, "replicate", false, "每个batch同时写入urls中的所有地址，而不是分散到各个地址，format可以按urls的顺序指定多个数据库类型，例如fctsdb,influxdbv2，查询只发送到第一个地址")
+	cmdFlags.StringVar(&task.Precision, "precision", "", "写入时间戳的精度(ns/us/ms/s)，当前仅支持fctsdb和influxdbv2，查询模板中的时间关键字按同样的精度截断")
+	cmdFlags.StringVar(&task.IngestMode, "ingest-mode", "", "写入方式，mysql支持insert(拼接sql,默认)、prepare(多行prepared statement)、load-data(LOAD DATA LOCAL INFILE)，matrixdb支持mxgate(默认)、copy(COPY FROM STDIN)、insert(拼接sql)")
+	cmdFlags.IntVar(&task.MxgatePort, "mxgate-port", db_client.DefaultMxgatePort, "matrixdb使用mxgate写入时mxgate的http端口")
+
+	// mqtt参数
+	cmdFlags.StringVar(&task.MqttTopic, "mqtt-topic", db_client.DefaultMqttTopic, "format为mqtt时，消息的topic模板，关键字为tag名称或measurement，例如airq/{province}/{site_id}")
+	cmdFlags.IntVar(&task.MqttQos, "mqtt-qos", 0, "format为mqtt时，发布消息的QoS(0/1/2)")
+	cmdFlags.StringVar(&task.MqttPayload, "mqtt-payload", "json", "format为mqtt时，消息的载荷格式(json/line)")
+	cmdFlags.BoolVar(&task.MqttPerBatch, "mqtt-per-batch", false, "format为mqtt时，是否把一个batch中相同topic的point合并为一条消息，默认每个point一条消息")
+
+	initSimulationFlags(task, cmd)
 }
 
 func InitQuery(task *BasicBenchTask, cmd *cobra.Command) {
@@ -146,6 +207,10 @@ func InitQuery(task *BasicBenchTask, cmd *cobra.Command) {
 	cmdFlags.StringVar(&task.CsvDaemonUrls, "urls", "http://localhost:8086", "*被测数据库的地址")
 	cmdFlags.StringVar(&task.DBName, "db", "benchmark_db", "*数据库的database名称")
 	cmdFlags.StringVar(&task.UseCase, "use-case", CaseChoices[0], fmt.Sprintf("*使用的测试场景(可选场景: %s)", strings.Join(CaseChoices, ", ")))
+	cmdFlags.StringVar(&task.Schema, "schema", "", "使用toml文件描述的measurement、tag和field生成数据，格式参考bonitoo.toml，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.Replay, "replay", "", "回放的数据文件，支持行协议(包括data-gen的输出，.gz结尾时先解压)和带表头的csv，指定后use-case和scale-var不再生效")
+	cmdFlags.StringVar(&task.ReplayTag, "replay-tag", "", "回放时复制设备改写的tag，为空时使用数据中的第一个tag")
+	cmdFlags.Int64Var(&task.ReplayCopies, "replay-copies", 1, "回放时每条数据复制为多少个设备，第i份数据的replay-tag取值加上后缀_i")
 	cmdFlags.Int64Var(&task.ScaleVar, "scale-var", 1, "*场景的变量，一般情况下是场景中模拟机的数量")
 	cmdFlags.Int64Var(&task.ScaleVarOffset, "scale-var-offset", 0, "*场景偏移量，一般情况下是模拟机的起始MN编号 (default 0)")
 	cmdFlags.DurationVar(&task.SamplingInterval, "sampling-interval", time.Second, "*模拟机的采样时间")
@@ -163,9 +228,15 @@ func InitQuery(task *BasicBenchTask, cmd *cobra.Command) {
 	cmdFlags.Int64Var(&task.QueryCount, "query-count", 1000, "生成的查询语句数量")
 	cmdFlags.DurationVar(&task.TimeLimit, "time-limit", -1, "最大测试时间(-1表示不生效)，>0会使query-count参数失效")
 	cmdFlags.BoolVar(&task.Debug, "debug", false, "是否打印详细日志(default false).")
-	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，当前仅支持fctsdb和mysql")
+	cmdFlags.StringVar(&task.Format, "format", "fctsdb", "目标数据库类型，支持fctsdb、influxdbv2、mysql、matrixdb、elasticsearch、iotdb、opentsdb和mqtt")
 
 	// 高级参数
 	cmdFlags.StringVar(&task.CpuProfile, "cpu-profile", "", "将cpu-profile信息写入文件的地址，用于自测此工具")
 	cmdFlags.BoolVar(&task.DoDBCreate, "do-db-create", true, "是否创建数据库")
+	cmdFlags.IntVar(&task.MaxConnsPerHost, "max-conns-per-host", 0, "每个数据库地址的最大http连接数，0表示不限制，当前fctsdb、influxdbv2、opentsdb生效")
+	cmdFlags.DurationVar(&task.IdleConnTimeout, "idle-conn-timeout", db_client.DefaultIdleConnectionTimeout, "空闲http连接的保持时间")
+	cmdFlags.BoolVar(&task.DisableKeepAlive, "disable-keep-alive", false, "每个请求结束后关闭http连接，用于模拟连接频繁建立的场景")
+	cmdFlags.StringVar(&task.Precision, "precision", "", "写入时间戳的精度(ns/us/ms/s)，当前仅支持fctsdb和influxdbv2，查询模板中的时间关键字按同样的精度截断")
+	cmdFlags.BoolVar(&task.PrepareQuery, "prepare-query", false, "查询时是否使用服务端prepared statement，当前仅支持mysql")
+	cmdFlags.StringVar(&task.QueryLang, "query-lang", db_client.QueryLangInfluxql, "查询语言，influxdbv2支持influxql(默认)和flux，flux使用查询类型中的Flux模板")
 }
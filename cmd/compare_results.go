@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/db_client"
+	queryTemplate "git.querycap.com/falcontsdb/fctsdb-bench/query_generator"
+	"github.com/spf13/cobra"
+)
+
+type ResultComparer struct {
+	urls              string
+	format            string
+	dbName            string
+	username          string
+	password          string
+	useCase           string
+	scaleVar          int64
+	samplingInterval  time.Duration
+	timestampStartStr string
+	timestampEndStr   string
+	queryType         int
+	queryCount        int
+	seed              int64
+	tolerance         float64
+	maxMismatches     int
+
+	targets        []compareTarget
+	queryCase      *queryTemplate.QueryCase
+	timestampStart time.Time
+	timestampEnd   time.Time
+}
+
+// compareTarget 参与比较的一个数据库
+type compareTarget struct {
+	url     string
+	format  string
+	client  db_client.DBClient
+	querier db_client.RowQuerier
+}
+
+var (
+	resultComparer    = ResultComparer{}
+	compareResultsCmd = &cobra.Command{
+		Use:   "compare-results",
+		Short: "用相同的随机种子生成查询，在两个数据库上执行并比较查询结果是否一致",
+		Run: func(cmd *cobra.Command, args []string) {
+			resultComparer.Validate()
+			passed := resultComparer.Run()
+			resultComparer.Close()
+			if !passed {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	resultComparer.Init(compareResultsCmd)
+}
+
+func (c *ResultComparer) Init(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&c.urls, "urls", "http://localhost:8086,http://localhost:8087", "*两个数据库的地址，使用逗号分隔")
+	flags.StringVar(&c.format, "format", "fctsdb", "数据库类型，指定两个时使用逗号分隔，与urls一一对应，支持fctsdb、influxdbv2、mysql、matrixdb")
+	flags.StringVar(&c.dbName, "db", "benchmark_db", "数据库的database名称")
+	flags.StringVar(&c.username, "username", "", "登录数据库的用户名，influxdbv2需要登录获取token")
+	flags.StringVar(&c.password, "password", "", "登录数据库的用户密码")
+	flags.StringVar(&c.useCase, "use-case", queryTemplate.AirQuality.CaseName, "*使用的场景，必须与写入数据时的场景一致")
+	flags.Int64Var(&c.scaleVar, "scale-var", 1, "*场景的变量，必须与写入数据时一致")
+	flags.DurationVar(&c.samplingInterval, "sampling-interval", time.Second, "*模拟数据的时间间隔，必须与写入数据时一致")
+	flags.StringVar(&c.timestampStartStr, "timestamp-start", common.DefaultDateTimeStart, "*写入数据的开始时间 (RFC3339)")
+	flags.StringVar(&c.timestampEndStr, "timestamp-end", common.DefaultDateTimeEnd, "*写入数据的结束时间 (RFC3339)")
+	flags.IntVar(&c.queryType, "query-type", 0, "比较的查询类型，0表示所有查询类型")
+	flags.IntVar(&c.queryCount, "query-count", 10, "每种查询类型生成的查询数量")
+	flags.Int64Var(&c.seed, "seed", 1, "生成查询参数的随机种子")
+	flags.Float64Var(&c.tolerance, "tolerance", 1e-6, "数值比较允许的相对误差")
+	flags.IntVar(&c.maxMismatches, "max-mismatches", 5, "每种查询类型最多打印的不一致数量")
+}
+
+func (c *ResultComparer) Validate() {
+	var err error
+	if c.timestampStart, err = time.Parse(time.RFC3339, c.timestampStartStr); err != nil {
+		log.Fatal(err)
+	}
+	if c.timestampEnd, err = time.Parse(time.RFC3339, c.timestampEndStr); err != nil {
+		log.Fatal(err)
+	}
+	c.timestampStart, c.timestampEnd = c.timestampStart.UTC(), c.timestampEnd.UTC()
+	if c.queryCount <= 0 {
+		log.Fatal("query-count must be positive")
+	}
+
+	c.queryCase = queryTemplate.LookupCase(c.useCase)
+	if c.queryCase == nil {
+		log.Fatal("the use-case is unsupported")
+	}
+	if c.queryType < 0 || c.queryType > c.queryCase.Count {
+		log.Fatalln("the query-type is out of range")
+	}
+
+	urls := strings.Split(c.urls, ",")
+	if len(urls) != 2 {
+		log.Fatal("compare-results needs exactly two urls")
+	}
+	formats := strings.Split(c.format, ",")
+	if len(formats) == 1 {
+		formats = append(formats, formats[0])
+	}
+	if len(formats) != 2 {
+		log.Fatal("the number of formats must be one or two")
+	}
+	for i := range urls {
+		target := compareTarget{url: urls[i], format: formats[i]}
+		target.client = db_client.NewDBClient(target.format, db_client.ClientConfig{
+			Host:     target.url,
+			Database: c.dbName,
+			User:     c.username,
+			Password: c.password,
+		})
+		if target.client == nil {
+			log.Fatalf("unsupported format %s", target.format)
+		}
+		querier, ok := target.client.(db_client.RowQuerier)
+		if !ok {
+			log.Fatalf("format %s does not support reading query results", target.format)
+		}
+		target.querier = querier
+		if c.username != "" {
+			if err := target.client.LoginUser(); err != nil {
+				log.Fatalf("login %s error: %s", target.url, err.Error())
+			}
+		}
+		c.targets = append(c.targets, target)
+	}
+}
+
+func (c *ResultComparer) Close() {
+	for _, t := range c.targets {
+		t.client.Close()
+	}
+}
+
+// Run 依次比较每种查询类型，所有查询结果都一致时返回true
+func (c *ResultComparer) Run() bool {
+	types := make([]int, 0, len(c.queryCase.Types))
+	for id := range c.queryCase.Types {
+		if c.queryType == 0 || c.queryType == id {
+			types = append(types, id)
+		}
+	}
+	sort.Ints(types)
+
+	passed := true
+	for _, id := range types {
+		if !c.compareType(id, c.queryCase.Types[id]) {
+			passed = false
+		}
+	}
+	return passed
+}
+
+func (c *ResultComparer) compareType(id int, qt *queryTemplate.QueryType) bool {
+	simulators := make([]common.Simulator, len(c.targets))
+	for i, t := range c.targets {
+		template := qt.Template(t.format, db_client.QueryLangInfluxql)
+		if template == "" {
+			log.Printf("type %-3d %-30s SKIP format %s is unsupported", id, qt.Name, t.format)
+			return true
+		}
+		task := &BasicBenchTask{
+			UseCase:          c.useCase,
+			ScaleVar:         c.scaleVar,
+			SamplingInterval: c.samplingInterval,
+			timestampStart:   c.timestampStart,
+			timestampEnd:     c.timestampEnd,
+			sqlTemplate:      []string{template},
+		}
+		simulators[i] = task.newSimulator()
+		// 数据已经写入完成，生成的查询覆盖全部数据范围
+		simulators[i].SetWrittenPoints(simulators[i].Total())
+	}
+
+	var mismatches, errors int
+	var buf bytes.Buffer
+	for n := 0; n < c.queryCount; n++ {
+		queries := make([]string, len(c.targets))
+		results := make([]*db_client.QueryResult, len(c.targets))
+		failed := false
+		for i, t := range c.targets {
+			// 每个查询重置随机种子，两个数据库的查询使用相同的参数
+			rand.Seed(c.seed + int64(n))
+			buf.Reset()
+			simulators[i].NextSql(&buf)
+			queries[i] = strings.TrimSpace(buf.String())
+			result, err := t.querier.QueryRows([]byte(queries[i]))
+			if err != nil {
+				errors++
+				failed = true
+				if errors+mismatches <= c.maxMismatches {
+					log.Printf("\t%s query error: %s\n\t\t%s", t.url, err.Error(), queries[i])
+				}
+				continue
+			}
+			results[i] = result
+		}
+		if failed {
+			continue
+		}
+		if diff := db_client.CompareResults(results[0], results[1], c.tolerance); diff != "" {
+			mismatches++
+			if errors+mismatches <= c.maxMismatches {
+				log.Printf("\tmismatch: %s\n\t\t%s\n\t\t%s", diff, queries[0], queries[1])
+			}
+		}
+	}
+
+	status := "OK  "
+	if mismatches > 0 || errors > 0 {
+		status = "FAIL"
+	}
+	log.Printf("type %-3d %-30s %s %d queries, %d mismatches, %d errors", id, qt.Name, status, c.queryCount, mismatches, errors)
+	return mismatches == 0 && errors == 0
+}
@@ -13,6 +13,7 @@
 // Supported use cases:
 // Devops: scale_var is the number of hosts to simulate, with log messages
 //         every 10 seconds.
+// Other use cases (iot, dashboard, metaquery, ...) are the same as the write command.
 package main
 
 import (
@@ -25,10 +26,7 @@ import (
 	"strings"
 	"time"
 
-	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/airq"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
-	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/devops"
-	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/vehicle"
 	"git.querycap.com/falcontsdb/fctsdb-bench/db_client"
 	"github.com/spf13/cobra"
 )
@@ -39,10 +37,33 @@ var formatChoices = []string{"influx-bulk", "es-bulk", "es-bulk6x", "es-bulk7x",
 type DataGenerator struct {
 	format           string
 	useCase          string
+	schema           string
+	replay           string
+	replayTag        string
+	replayCopies     int64
 	scaleVar         int64
 	scaleVarOffset   int64
 	samplingInterval time.Duration
 
+	fieldPresence   float64
+	fieldPresenceBy string
+	outageRate      float64
+	outagePoints    int64
+	outageFields    string
+	sparse          *common.SparseConfig
+
+	churnLifetime     time.Duration
+	churnDistribution string
+	churn             *common.ChurnConfig
+
+	jitter           time.Duration
+	intervalSpread   float64
+	lateRatio        float64
+	maxLateness      time.Duration
+	lateDistribution string
+	duplicateRatio   float64
+	timing           *common.TimingConfig
+
 	timestampStartStr string
 	timestampEndStr   string
 
@@ -88,7 +109,23 @@ func (g *DataGenerator) Init(cmd *cobra.Command) {
 	dataGenFlag.Int64Var(&g.scaleVar, "scale-var", 1, "Scaling variable specific to the use case.")
 	dataGenFlag.Int64Var(&g.scaleVarOffset, "scale-var-offset", 0, "Scaling variable offset specific to the use case.")
 	dataGenFlag.DurationVar(&g.samplingInterval, "sampling-interval", time.Second, "Simulated sampling interval.")
-	// dataGenFlag.StringVar(&g.configFile, "config-file", "", "Simulator config file in TOML format (experimental)")
+	dataGenFlag.StringVar(&g.schema, "schema", "", "Schema file in TOML format describing measurements, tags and fields (see bonitoo.toml), overrides use-case.")
+	dataGenFlag.StringVar(&g.replay, "replay", "", "Line protocol (optionally .gz) or CSV file with a header to replay, overrides use-case.")
+	dataGenFlag.StringVar(&g.replayTag, "replay-tag", "", "Tag rewritten to make copies of the replayed devices, defaults to the first tag.")
+	dataGenFlag.Int64Var(&g.replayCopies, "replay-copies", 1, "Number of synthetic devices made from each replayed device.")
+	dataGenFlag.Float64Var(&g.fieldPresence, "field-presence", 1, "Probability [0-1] that each field is present, missing fields are written as NULL by sql targets.")
+	dataGenFlag.StringVar(&g.fieldPresenceBy, "field-presence-by", "", "Per-field presence overriding field-presence, e.g. pm25=0.5,no2=0.8")
+	dataGenFlag.Float64Var(&g.outageRate, "outage-rate", 0, "Probability [0-1] that a device outage starts at each point.")
+	dataGenFlag.Int64Var(&g.outagePoints, "outage-points", 10, "Number of points an outage lasts.")
+	dataGenFlag.StringVar(&g.outageFields, "outage-fields", "", "Comma-separated fields missing during an outage, empty means the device reports nothing.")
+	dataGenFlag.DurationVar(&g.churnLifetime, "churn-lifetime", 0, "Mean lifetime of a device before it is replaced by a device with a new id, 0 disables churn.")
+	dataGenFlag.StringVar(&g.churnDistribution, "churn-dist", common.ChurnExponential, "Distribution of device lifetimes (fixed, exponential, uniform).")
+	dataGenFlag.DurationVar(&g.jitter, "jitter", 0, "Random offset of each timestamp within [-jitter, jitter].")
+	dataGenFlag.Float64Var(&g.intervalSpread, "interval-spread", 0, "Per-device sampling interval drawn uniformly from sampling-interval*(1±spread), in [0, 1).")
+	dataGenFlag.Float64Var(&g.lateRatio, "late-ratio", 0, "Fraction [0-1] of late (out-of-order) points.")
+	dataGenFlag.DurationVar(&g.maxLateness, "max-lateness", time.Minute, "Maximum lateness of a late point.")
+	dataGenFlag.StringVar(&g.lateDistribution, "late-dist", common.LateUniform, "Distribution of lateness (uniform, exponential).")
+	dataGenFlag.Float64Var(&g.duplicateRatio, "duplicate-ratio", 0, "Fraction [0-1] of points repeating the previous timestamp of the device.")
 	dataGenFlag.StringVar(&g.timestampStartStr, "timestamp-start", common.DefaultDateTimeStart, "Beginning timestamp (RFC3339).")
 	dataGenFlag.StringVar(&g.timestampEndStr, "timestamp-end", common.DefaultDateTimeEnd, "Ending timestamp (RFC3339).")
 	dataGenFlag.Int64Var(&g.seed, "seed", 12345678, "PRNG seed (default 12345678, or 0, uses the current timestamp).")
@@ -136,6 +173,39 @@ func (g *DataGenerator) Validate() {
 
 	log.Printf("Using sampling interval %v\n", g.samplingInterval)
 
+	if g.schema != "" {
+		g.useCase = common.UseCaseSchema
+		log.Printf("Using schema file %s\n", g.schema)
+	}
+	if g.replay != "" {
+		if g.schema != "" {
+			log.Fatal("--schema and --replay can not be used together")
+		}
+		g.useCase = common.UseCaseReplay
+		log.Printf("Using replay file %s\n", g.replay)
+	}
+
+	g.sparse, err = parseSparseConfig(g.fieldPresence, g.fieldPresenceBy, g.outageRate, g.outagePoints, g.outageFields)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.churn = &common.ChurnConfig{Lifetime: g.churnLifetime, Distribution: g.churnDistribution, Seed: g.seed}
+	if err = g.churn.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	g.timing = &common.TimingConfig{
+		Jitter:           g.jitter,
+		IntervalSpread:   g.intervalSpread,
+		LateRatio:        g.lateRatio,
+		MaxLateness:      g.maxLateness,
+		LateDistribution: g.lateDistribution,
+		DuplicateRatio:   g.duplicateRatio,
+		Seed:             g.seed,
+	}
+	if err = g.timing.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
 }
 
 func timeTrack(start time.Time, name string) {
@@ -157,64 +227,37 @@ func (g *DataGenerator) RunProcess() {
 		defer pprof.StopCPUProfile()
 	}
 
-	// if g.configFile != "" {
-	// 	c, err := common.NewConfig(g.configFile)
-	// 	if err != nil {
-	// 		log.Fatalf("external config error: %v", err)
-	// 	}
-	// 	common.Config = c
-	// 	log.Printf("Using config file %s\n", g.configFile)
-	// }
-
 	//out := bufio.NewWriterSize(os.Stdout, 4<<20) //original buffer size
 	out := bufio.NewWriterSize(os.Stdout, 4<<24) // most potimized size based on inspection via test regression
 	defer out.Flush()
 
-	var sim common.Simulator
-
-	switch g.useCase {
-	case CaseChoices[0]:
-		cfg := &vehicle.VehicleSimulatorConfig{
-			Start:            g.timestampStart,
-			End:              g.timestampEnd,
-			SamplingInterval: g.samplingInterval,
-			DeviceCount:      g.scaleVar,
-			DeviceOffset:     g.scaleVarOffset,
-		}
-		sim = cfg.ToSimulator()
-	case CaseChoices[1]:
-		cfg := &airq.AirqSimulatorConfig{
-			Start:            g.timestampStart,
-			End:              g.timestampEnd,
-			SamplingInterval: g.samplingInterval,
-			DeviceCount:      g.scaleVar,
-			DeviceOffset:     g.scaleVarOffset,
-		}
-		sim = cfg.ToSimulator()
-	case CaseChoices[2]:
-		cfg := &devops.DevopsSimulatorConfig{
-			Start: g.timestampStart,
-			End:   g.timestampEnd,
-
-			HostCount:  g.scaleVar,
-			HostOffset: g.scaleVarOffset,
-		}
-		devops.EpochDuration = g.samplingInterval
-		sim = cfg.ToSimulator()
-	default:
-		log.Fatalln("the case is not supported")
+	task := &BasicBenchTask{
+		UseCase:          g.useCase,
+		Schema:           g.schema,
+		Replay:           g.replay,
+		ReplayTag:        g.replayTag,
+		ReplayCopies:     g.replayCopies,
+		ScaleVar:         g.scaleVar,
+		ScaleVarOffset:   g.scaleVarOffset,
+		SamplingInterval: g.samplingInterval,
+		timestampStart:   g.timestampStart,
+		timestampEnd:     g.timestampEnd,
+		sparse:           g.sparse,
+		churn:            g.churn,
+		timing:           g.timing,
 	}
+	sim := task.newSimulator()
 
 	var serializer db_client.DBClient
 	switch g.format {
 	case "influx-bulk":
 		serializer = db_client.NewFctsdbClient(db_client.ClientConfig{})
-	// case "es-bulk":
-	// serializer = serializers.NewSerializerElastic("5x")
-	// case "es-bulk6x":
-	// serializer = serializers.NewSerializerElastic("6x")
-	// case "es-bulk7x":
-	// serializer = serializers.NewSerializerElastic("7x")
+	case "es-bulk", "es-bulk7x":
+		serializer = db_client.NewElasticsearchClient(db_client.ClientConfig{Database: "benchmark_db"})
+	case "es-bulk6x":
+		esSerializer := db_client.NewElasticsearchClient(db_client.ClientConfig{Database: "benchmark_db"})
+		esSerializer.DocType = "_doc"
+		serializer = esSerializer
 	// case "cassandra":
 	// serializer = serializers.NewSerializerCassandra()
 	// case "mongo":
@@ -238,7 +281,10 @@ func (g *DataGenerator) RunProcess() {
 	n := int64(0)
 	buf := make([]byte, 0, 4*1024)
 	for !sim.Finished() {
-		sim.Next(point)
+		// iot场景最后几个序号可能没有产生point
+		if sim.Next(point) > sim.Total() {
+			break
+		}
 		n++
 		buf = serializer.BeforeSerializePoints(buf, point)
 		buf = serializer.SerializeAndAppendPoint(buf, point)
@@ -254,6 +300,9 @@ func (g *DataGenerator) RunProcess() {
 	err := out.Flush()
 	dur := time.Since(t)
 	log.Printf("Written %d points, %d values, took %0f seconds\n", n, sim.SeenValues(), dur.Seconds())
+	if counter, ok := sim.(common.SeriesCounter); ok {
+		log.Printf("Series: total %d, active %d\n", counter.TotalSeries(), counter.ActiveSeries())
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
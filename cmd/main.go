@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 
+	"git.querycap.com/falcontsdb/fctsdb-bench/util/mqtt"
 	"github.com/spf13/cobra"
 )
 
@@ -24,7 +25,8 @@ var (
 		// helpCommand:       helpCmd,
 	}
 
-	mockCmd = &cobra.Command{
+	mockMqttAddr string
+	mockCmd      = &cobra.Command{
 		Use:   "mock",
 		Short: "模仿海东青数据库，测试本工具能力上限",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -36,6 +38,14 @@ var (
 
 func mockFctsdb() {
 
+	// 内嵌一个最小化的mqtt broker，用于离线测试mqtt写入
+	if mockMqttAddr != "" {
+		go func() {
+			log.Printf("Start mqtt broker %s\n", mockMqttAddr)
+			log.Println(mqtt.NewBroker().ListenAndServe(mockMqttAddr))
+		}()
+	}
+
 	// server := &http.Server{
 	// 	Addr:              "0.0.0.0:9086",
 	// 	Handler:           nil,
@@ -95,6 +105,7 @@ func main() {
 	cobra.EnableCommandSorting = false
 	rootCmd.Flags().BoolP("version", "v", false, "查看版本信息")
 	rootCmd.PersistentFlags().BoolP("help", "h", false, "查看帮助信息")
+	mockCmd.Flags().StringVar(&mockMqttAddr, "mqtt-addr", "", "内嵌mqtt broker的监听地址，例如0.0.0.0:1883，为空表示不启动")
 
 	rootCmd.AddCommand(listQueryCmd)
 	rootCmd.AddCommand(writeCmd)
@@ -103,6 +114,8 @@ func main() {
 	rootCmd.AddCommand(mockCmd)
 	rootCmd.AddCommand(agentCmd)
 	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(validateFormatCmd)
+	rootCmd.AddCommand(compareResultsCmd)
 	// 隐藏命令
 	rootCmd.AddCommand(dataGenCmd)
 	rootCmd.AddCommand(dataLoadCmd)
@@ -37,6 +37,21 @@ type RespTimeResult struct {
 
 type GroupResult []RespTimeResult
 
+// BatchResult 写入请求中每个batch的point个数和字节数(压缩前)的分布
+type BatchResult struct {
+	Batches int
+	Points  Distribution
+	Bytes   Distribution
+}
+
+type Distribution struct {
+	P50 int64
+	P99 int64
+	Min int64
+	Max int64
+	Avg int64
+}
+
 type ResultCollector struct {
 	states    []*RespState
 	startTime time.Time
@@ -46,6 +61,82 @@ type ResultCollector struct {
 	points    int64
 	bytes     int64
 	queries   int64
+
+	batchPoints Histogram // 每个写入成功的batch的point个数
+	batchBytes  Histogram // 每个写入成功的batch的字节数
+}
+
+// Histogram 记录数值分布的直方图，小于histogramLinear的值每个值一个桶，更大的值按对数分桶，
+// 相邻桶的边界相差1%，长时间运行时占用的内存不随记录的数量增长
+type Histogram struct {
+	count   int64
+	sum     int64
+	min     int64
+	max     int64
+	buckets map[int]int64
+}
+
+const (
+	histogramLinear = 128
+	histogramGrowth = 1.01
+)
+
+func histogramBucket(v int64) int {
+	if v < histogramLinear {
+		return int(v)
+	}
+	return histogramLinear + int(math.Log(float64(v)/histogramLinear)/math.Log(histogramGrowth))
+}
+
+// histogramValue 桶中的代表值，对数分桶时为桶的下边界
+func histogramValue(bucket int) int64 {
+	if bucket < histogramLinear {
+		return int64(bucket)
+	}
+	return int64(math.Ceil(histogramLinear * math.Pow(histogramGrowth, float64(bucket-histogramLinear))))
+}
+
+func (h *Histogram) Add(v int64) {
+	if h.buckets == nil {
+		h.buckets = make(map[int]int64)
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.buckets[histogramBucket(v)]++
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+// quantile 返回排序后第q*count个值所在桶的代表值，限制在[min, max]之间
+func (h *Histogram) quantile(keys []int, q float64) int64 {
+	rank := int64(q * float64(h.count))
+	var seen int64
+	for _, k := range keys {
+		seen += h.buckets[k]
+		if seen > rank {
+			v := histogramValue(k)
+			if v < h.min {
+				v = h.min
+			}
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
 }
 
 func NewResponseCollector() *ResultCollector {
@@ -74,6 +165,14 @@ func (c *ResultCollector) AddOneResponTime(label string, lat int64, isPass bool)
 	c.mutex.Unlock()
 }
 
+// AddBatch 记录一个写入成功的batch的point个数和字节数
+func (c *ResultCollector) AddBatch(points, bytes int64) {
+	c.mutex.Lock()
+	c.batchPoints.Add(points)
+	c.batchBytes.Add(bytes)
+	c.mutex.Unlock()
+}
+
 func (c *ResultCollector) AddValues(count int64) {
 	atomic.AddInt64(&c.values, count)
 }
@@ -112,6 +211,8 @@ func (c *ResultCollector) Reset() {
 	c.bytes = 0
 	c.queries = 0
 	c.states = c.states[:0]
+	c.batchPoints.Reset()
+	c.batchBytes.Reset()
 	c.startTime = time.Time{}
 	c.endTime = time.Time{}
 }
@@ -200,6 +301,56 @@ func (c *ResultCollector) GetGroupDetail() (gr GroupResult) {
 	return
 }
 
+func (c *ResultCollector) GetBatchDetail() BatchResult {
+	return BatchResult{
+		Batches: int(c.batchPoints.Count()),
+		Points:  NewDistribution(&c.batchPoints),
+		Bytes:   NewDistribution(&c.batchBytes),
+	}
+}
+
+// NewDistribution 根据直方图计算分位数，分位数的相对误差在1%以内，最小值、最大值和平均值是准确的
+func NewDistribution(h *Histogram) Distribution {
+	if h.count == 0 {
+		return Distribution{}
+	}
+	keys := make([]int, 0, len(h.buckets))
+	for k := range h.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return Distribution{
+		P50: h.quantile(keys, 0.5),
+		P99: h.quantile(keys, 0.99),
+		Min: h.min,
+		Max: h.max,
+		Avg: h.sum / h.count,
+	}
+}
+
+func (b BatchResult) Show() {
+	if b.Batches == 0 {
+		return
+	}
+	fmt.Printf("Batches %d\n", b.Batches)
+	fmt.Printf("Points/batch: P50 %d P99 %d Min %d Max %d Avg %d\n", b.Points.P50, b.Points.P99, b.Points.Min, b.Points.Max, b.Points.Avg)
+	fmt.Printf("Bytes/batch:  P50 %d P99 %d Min %d Max %d Avg %d\n", b.Bytes.P50, b.Bytes.P99, b.Bytes.Min, b.Bytes.Max, b.Bytes.Avg)
+}
+
+func (b BatchResult) ToMap() map[string]string {
+	m := make(map[string]string)
+	if b.Batches == 0 {
+		return m
+	}
+	m["BatchPoints(p50)"] = strconv.FormatInt(b.Points.P50, 10)
+	m["BatchPoints(p99)"] = strconv.FormatInt(b.Points.P99, 10)
+	m["BatchPoints(avg)"] = strconv.FormatInt(b.Points.Avg, 10)
+	m["BatchBytes(p50)"] = strconv.FormatInt(b.Bytes.P50, 10)
+	m["BatchBytes(p99)"] = strconv.FormatInt(b.Bytes.P99, 10)
+	m["BatchBytes(avg)"] = strconv.FormatInt(b.Bytes.Avg, 10)
+	return m
+}
+
 func Round(f float64, bit int) float64 {
 	v, _ := strconv.ParseFloat(fmt.Sprintf("%."+strconv.Itoa(bit)+"f", f), 64)
 	return v
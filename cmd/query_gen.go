@@ -9,15 +9,17 @@ import (
 	"strings"
 	"time"
 
-	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/airq"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
-	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/vehicle"
 	fctsdb "git.querycap.com/falcontsdb/fctsdb-bench/query_generator"
 	"github.com/spf13/cobra"
 )
 
 type QueryGenerator struct {
 	useCase           string
+	schema            string
+	replay            string
+	replayTag         string
+	replayCopies      int64
 	scaleVar          int64
 	scaleVarOffset    int64
 	queryTypeId       int
@@ -68,6 +70,10 @@ func RunGenerateQueries() {
 func (q *QueryGenerator) Init(cmd *cobra.Command) {
 	queryGenFlag := cmd.Flags()
 	queryGenFlag.StringVar(&q.useCase, "use-case", CaseChoices[0], fmt.Sprintf("Use case to model. (choices: %s)", strings.Join(CaseChoices, ", ")))
+	queryGenFlag.StringVar(&q.schema, "schema", "", "Schema file in TOML format describing measurements, tags and fields (see bonitoo.toml), overrides use-case.")
+	queryGenFlag.StringVar(&q.replay, "replay", "", "Line protocol (optionally .gz) or CSV file with a header to replay, overrides use-case.")
+	queryGenFlag.StringVar(&q.replayTag, "replay-tag", "", "Tag rewritten to make copies of the replayed devices, defaults to the first tag.")
+	queryGenFlag.Int64Var(&q.replayCopies, "replay-copies", 1, "Number of synthetic devices made from each replayed device.")
 	queryGenFlag.Int64Var(&q.scaleVar, "scale-var", 1, "Scaling variable specific to the use case.")
 	queryGenFlag.Int64Var(&q.scaleVarOffset, "scale-var-offset", 0, "Scaling variable offset specific to the use case.")
 	queryGenFlag.IntVar(&q.queryTypeId, "query-type", 1, "Scaling variable offset specific to the use case.")
@@ -103,46 +109,46 @@ func (q *QueryGenerator) Validate() {
 	}
 
 	log.Printf("Using sampling interval %v\n", q.samplingInterval)
+
+	if q.schema != "" {
+		q.useCase = common.UseCaseSchema
+		log.Printf("Using schema file %s\n", q.schema)
+	}
+	if q.replay != "" {
+		if q.schema != "" {
+			log.Fatal("--schema and --replay can not be used together")
+		}
+		q.useCase = common.UseCaseReplay
+		log.Printf("Using replay file %s\n", q.replay)
+	}
 }
 
 func (q *QueryGenerator) RunProcess() {
 	out := bufio.NewWriterSize(os.Stdout, 4<<24) // most potimized size based on inspection via test regression
 	defer out.Flush()
 
-	var queryType *fctsdb.QueryType
-	var ok bool
-	var sim common.Simulator
-	switch q.useCase {
-	case fctsdb.AirQuality.CaseName:
-		queryType, ok = fctsdb.AirQuality.Types[q.queryTypeId]
-		if !ok {
-			log.Fatal("the query-type out of range")
-		}
-		cfg := &airq.AirqSimulatorConfig{
-			Start:            q.timestampStart,
-			End:              q.timestampEnd,
-			SamplingInterval: q.samplingInterval,
-			DeviceCount:      q.scaleVar,
-			DeviceOffset:     q.scaleVarOffset,
-			SqlTemplates:     []string{queryType.RawSql},
-		}
-		sim = cfg.ToSimulator()
-
-	case fctsdb.Vehicle.CaseName:
-		queryType, ok = fctsdb.Vehicle.Types[q.queryTypeId]
-		if !ok {
-			log.Fatal("the query-type out of range")
-		}
-		cfg := &vehicle.VehicleSimulatorConfig{
-			Start:            q.timestampStart,
-			End:              q.timestampEnd,
-			SamplingInterval: q.samplingInterval,
-			DeviceCount:      q.scaleVar,
-			DeviceOffset:     q.scaleVarOffset,
-			SqlTemplates:     []string{queryType.RawSql},
-		}
-		sim = cfg.ToSimulator()
+	queryCase := fctsdb.LookupCase(q.useCase)
+	if queryCase == nil {
+		log.Fatal("the use-case is unsupported")
+	}
+	queryType, ok := queryCase.Types[q.queryTypeId]
+	if !ok {
+		log.Fatal("the query-type out of range")
 	}
+	task := &BasicBenchTask{
+		UseCase:          q.useCase,
+		Schema:           q.schema,
+		Replay:           q.replay,
+		ReplayTag:        q.replayTag,
+		ReplayCopies:     q.replayCopies,
+		ScaleVar:         q.scaleVar,
+		ScaleVarOffset:   q.scaleVarOffset,
+		SamplingInterval: q.samplingInterval,
+		timestampStart:   q.timestampStart,
+		timestampEnd:     q.timestampEnd,
+		sqlTemplate:      []string{queryType.RawSql},
+	}
+	sim := task.newSimulator()
 
 	for i := 0; i < int(q.queryCount); i++ {
 		sim.NextSql(out)
@@ -151,15 +157,10 @@ func (q *QueryGenerator) RunProcess() {
 }
 
 func ListQueryTypes() {
-	for i := 1; i <= fctsdb.AirQuality.Count; i++ {
-		qtype := fctsdb.AirQuality.Types[i]
-		caseName := fctsdb.AirQuality.CaseName
-		ShowQueryTypes(qtype, i, caseName)
-	}
-	for i := 1; i <= fctsdb.Vehicle.Count; i++ {
-		qtype := fctsdb.Vehicle.Types[i]
-		caseName := fctsdb.Vehicle.CaseName
-		ShowQueryTypes(qtype, i, caseName)
+	for _, queryCase := range fctsdb.Cases() {
+		for i := 1; i <= queryCase.Count; i++ {
+			ShowQueryTypes(queryCase.Types[i], i, queryCase.CaseName)
+		}
 	}
 }
 
@@ -18,6 +18,7 @@ import (
 	"git.querycap.com/falcontsdb/fctsdb-bench/agent"
 	"git.querycap.com/falcontsdb/fctsdb-bench/buildin_testcase"
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/db_client"
 	"github.com/spf13/cobra"
 )
 
@@ -25,7 +26,9 @@ var (
 	heads = []string{"Group", "Mod", "UseCase", "Cardinality", "Workers", "BatchSize", "QueryPercent", "SamplingTime",
 		"P50(r)", "P90(r)", "P95(r)", "P99(r)", "Min(r)", "Max(r)", "Avg(r)", "Fail(r)", "Total(r)", "Qps(r)",
 		"P50(w)", "P90(w)", "P95(w)", "P99(w)", "Min(w)", "Max(w)", "Avg(w)", "Fail(w)", "Total(w)", "Qps(w)", "PointRate(p/s)", "ValueRate(v/s)", "TotalPoints",
-		"RunSec", "Gzip", "Sql", "Monitor"}
+		"RunSec", "Gzip", "Sql", "Monitor", "Ingest", "QueryMode",
+		"BatchBytes", "BatchPoints(avg)", "BatchPoints(p50)", "BatchPoints(p99)", "BatchBytes(avg)", "BatchBytes(p50)", "BatchBytes(p99)",
+		"TotalSeries", "ActiveSeries"}
 
 	scheduleCmd = &cobra.Command{
 		Use:   "schedule",
@@ -38,6 +41,9 @@ var (
 
 	scheduler = &Scheduler{}
 
+	// 调度器执行的测试任务统一使用的database
+	schedulerDBName = "benchmark_db"
+
 	showCmd = &cobra.Command{
 		Use:   "list",
 		Short: "展示内置的调度器配置",
@@ -90,6 +96,9 @@ type Scheduler struct {
 	username        string
 	password        string
 	withEncryption  bool
+	ingestMode      string
+	mxgatePort      int
+	measurements    map[string]bool // 已经运行的测试写入的measurement，不支持删除database时按measurement删除
 }
 
 func init() {
@@ -98,11 +107,13 @@ func init() {
 	scheduleCmd.Flags().StringVar(&scheduler.configsPath, "config-file", "", "调度器配置文件地址 (默认不使用)")
 	scheduleCmd.Flags().StringSliceVar(&scheduler.agentEndpoints, "agent", nil, "数据库代理服务地址，为空表示不使用 (默认不使用)")
 	scheduleCmd.Flags().StringVar(&scheduler.grafanaEndpoint, "grafana", "", "grafana的dashboard地址，例如: http://124.71.230.36:4000/sources/1/dashboards/4")
-	scheduleCmd.Flags().StringVar(&scheduler.format, "format", "fctsdb", "目标数据库类型，当前仅支持fctsdb、mysql、influxdbv2")
+	scheduleCmd.Flags().StringVar(&scheduler.format, "format", "fctsdb", "目标数据库类型，支持fctsdb、influxdbv2、mysql、matrixdb、elasticsearch、iotdb、opentsdb和mqtt")
 	scheduleCmd.Flags().BoolVar(&scheduler.withEncryption, "withEncryption", false, "是否采用加密数据库进行测试")
 	scheduleCmd.Flags().StringVar(&scheduler.username, "username", "", "用户名")
 	scheduleCmd.Flags().StringVar(&scheduler.password, "password", "", "密码")
 	scheduleCmd.Flags().BoolVar(&scheduler.debug, "debug", false, "是否打印详细日志(default false).")
+	scheduleCmd.Flags().StringVar(&scheduler.ingestMode, "ingest-mode", "", "写入方式，同write命令的ingest-mode参数，matrixdb只有使用mxgate时才会通过agent启动mxgate")
+	scheduleCmd.Flags().IntVar(&scheduler.mxgatePort, "mxgate-port", db_client.DefaultMxgatePort, "matrixdb使用mxgate写入时mxgate的http端口")
 
 	scheduleCmd.AddCommand(showCmd)
 
@@ -240,28 +251,25 @@ func (s *Scheduler) checkConfigsFile() []Action {
 func (s *Scheduler) runBenchTaskByConfig(index int, fileName string, config buildin_testcase.BasicBenchTaskConfig) error {
 	log.Printf("---index %d ------------------------------------------------------------\n", index)
 	if len(s.agentEndpoints) != 0 {
-		for _, agentEndpoint := range s.agentEndpoints {
-			err := agent.StopRemoteDatabase(agentEndpoint)
-			if err != nil {
-				log.Println("request agent error:", err.Error())
-			}
-			log.Println(agentEndpoint, "Stop the fctsdb")
-		}
-		if config.Clean {
-			for _, agentEndpoint := range s.agentEndpoints {
-				err := agent.CleanRemoteDatabase(agentEndpoint)
-				if err != nil {
-					log.Println("request agent error:", err.Error())
+		s.stopRemoteDatabases()
+		s.startRemoteDatabases()
+	}
+	if config.Clean {
+		// 优先通过客户端删除database，不支持或者失败时再通过agent删除数据目录
+		err := s.cleanByClient()
+		if err != nil {
+			log.Println("clean the database by client failed:", err.Error())
+			if len(s.agentEndpoints) != 0 {
+				s.stopRemoteDatabases()
+				for _, agentEndpoint := range s.agentEndpoints {
+					err := agent.CleanRemoteDatabase(agentEndpoint)
+					if err != nil {
+						log.Println("request agent error:", err.Error())
+					}
+					log.Println(agentEndpoint, "Clean the fctsdb data")
 				}
-				log.Println(agentEndpoint, "Clean the fctsdb data")
-			}
-		}
-		for _, agentEndpoint := range s.agentEndpoints {
-			err := agent.StartRemoteDatabase(agentEndpoint)
-			if err != nil {
-				log.Println("request agent error:", err.Error())
+				s.startRemoteDatabases()
 			}
-			log.Println(agentEndpoint, "Start the fctsdb")
 		}
 	}
 
@@ -272,9 +280,15 @@ func (s *Scheduler) runBenchTaskByConfig(index int, fileName string, config buil
 	// result := RunBenchTask(basicBenchTask)
 	basicBenchTask.Validate()
 	basicBenchTask.PrepareWorkers()
-	if s.format == "matrixdb" {
+	if s.format == "matrixdb" && basicBenchTask.IngestModeOf(s.format) == db_client.MatrixdbIngestMxgate && len(s.agentEndpoints) > 0 {
 		http.Get(s.agentEndpoints[0] + "/startMxgate")
 	}
+	if s.measurements == nil {
+		s.measurements = make(map[string]bool)
+	}
+	for _, name := range basicBenchTask.Measurements() {
+		s.measurements[name] = true
+	}
 	basicBenchTask.Run()
 	result := basicBenchTask.Report()
 	basicBenchTask.CleanUp()
@@ -288,6 +302,77 @@ func (s *Scheduler) runBenchTaskByConfig(index int, fileName string, config buil
 	return nil
 }
 
+func (s *Scheduler) stopRemoteDatabases() {
+	for _, agentEndpoint := range s.agentEndpoints {
+		err := agent.StopRemoteDatabase(agentEndpoint)
+		if err != nil {
+			log.Println("request agent error:", err.Error())
+		}
+		log.Println(agentEndpoint, "Stop the fctsdb")
+	}
+}
+
+func (s *Scheduler) startRemoteDatabases() {
+	for _, agentEndpoint := range s.agentEndpoints {
+		err := agent.StartRemoteDatabase(agentEndpoint)
+		if err != nil {
+			log.Println("request agent error:", err.Error())
+		}
+		log.Println(agentEndpoint, "Start the fctsdb")
+	}
+}
+
+// cleanByClient 通过数据库客户端删除测试使用的database，不支持database时删除测试写入的measurement
+func (s *Scheduler) cleanByClient() error {
+	host := strings.Split(s.csvDaemonUrls, ",")[0]
+	cli := db_client.NewDBClient(s.format, db_client.ClientConfig{
+		Host:       host,
+		Database:   schedulerDBName,
+		User:       s.username,
+		Password:   s.password,
+		IngestMode: s.ingestMode,
+		MxgatePort: s.mxgatePort,
+	})
+	if cli == nil {
+		return fmt.Errorf("create %s client failed", s.format)
+	}
+	defer cli.Close()
+	if !cli.CheckConnection(time.Minute) {
+		return fmt.Errorf("can not connect to %s", host)
+	}
+	if s.username != "" {
+		err := cli.LoginUser()
+		if err != nil {
+			return err
+		}
+	}
+	databases, err := cli.ListDatabases()
+	if errors.Is(err, db_client.ErrNotSupported) {
+		// 例如opentsdb没有database的概念，只删除之前的测试写入的measurement
+		for name := range s.measurements {
+			err = cli.DropMeasurement(name)
+			if err != nil {
+				return err
+			}
+			log.Println(host, "Drop the measurement", name)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range databases {
+		if name == schedulerDBName {
+			err = cli.DropDatabase(name)
+			if err != nil {
+				return err
+			}
+			log.Println(host, "Drop the database", name)
+		}
+	}
+	return nil
+}
+
 func (s *Scheduler) writeResultToCsv(fileName string, info map[string]string, writeHead bool) {
 	csvFile, err := os.OpenFile(fileName+".csv", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
@@ -365,6 +450,9 @@ func (s *Scheduler) NewBasicBenchTask(conf buildin_testcase.BasicBenchTaskConfig
 		CsvDaemonUrls:     s.csvDaemonUrls,
 		MixMode:           conf.MixMode,
 		UseCase:           conf.UseCase,
+		Replay:            conf.Replay,
+		ReplayTag:         conf.ReplayTag,
+		ReplayCopies:      conf.ReplayCopies,
 		WorkerCount:       conf.Workers,
 		BatchSize:         conf.BatchSize,
 		ScaleVar:          conf.ScaleVar,
@@ -379,12 +467,14 @@ func (s *Scheduler) NewBasicBenchTask(conf buildin_testcase.BasicBenchTaskConfig
 		QueryPercent:      conf.QueryPercent,
 		QueryCount:        100,
 		Debug:             s.debug,
-		DBName:            "benchmark_db",
+		DBName:            schedulerDBName,
 		NeedPrePare:       conf.NeedPrePare,
 		Format:            s.format,
 		Username:          s.username,
 		Password:          s.password,
 		WithEncryption:    s.withEncryption,
+		IngestMode:        s.ingestMode,
+		MxgatePort:        s.mxgatePort,
 	}, nil
 }
 
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/db_client"
+	"github.com/spf13/cobra"
+)
+
+// 特殊字符注入时追加到tag值和字符串field值后面的内容，覆盖各种格式的分隔符、引号和转义符
+const specialCharsSuffix = ` ,="'\;`
+
+// formatCase 一种需要校验的序列化格式，同一个数据库的不同写入方式和载荷格式分别校验
+type formatCase struct {
+	format      string
+	ingestMode  string
+	mqttPayload string
+}
+
+func (f formatCase) String() string {
+	name := f.format
+	for _, s := range []string{f.ingestMode, f.mqttPayload} {
+		if s != "" {
+			name += "/" + s
+		}
+	}
+	return name
+}
+
+var formatCases = []formatCase{
+	{format: "fctsdb"},
+	{format: "influxdbv2"},
+	{format: "opentsdb"},
+	{format: "elasticsearch"},
+	{format: "iotdb"},
+	{format: "mqtt", mqttPayload: "json"},
+	{format: "mqtt", mqttPayload: "line"},
+	{format: "mysql", ingestMode: db_client.MysqlIngestInsert},
+	{format: "mysql", ingestMode: db_client.MysqlIngestPrepare},
+	{format: "mysql", ingestMode: db_client.MysqlIngestLoadData},
+	{format: "matrixdb", ingestMode: db_client.MatrixdbIngestMxgate},
+	{format: "matrixdb", ingestMode: db_client.MatrixdbIngestCopy},
+	{format: "matrixdb", ingestMode: db_client.MatrixdbIngestInsert},
+}
+
+type FormatValidator struct {
+	useCase          string
+	scaleVar         int64
+	points           int
+	batchSize        int
+	format           string
+	precision        string
+	specialChars     bool
+	samplingInterval time.Duration
+	maxMismatches    int
+}
+
+var (
+	formatValidator   = FormatValidator{}
+	validateFormatCmd = &cobra.Command{
+		Use:   "validate-format",
+		Short: "校验各个数据库客户端的序列化格式，把生成的数据序列化后再解析，比较解析结果和原始数据是否一致",
+		Run: func(cmd *cobra.Command, args []string) {
+			formatValidator.Validate()
+			if !formatValidator.Run() {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	formatValidator.Init(validateFormatCmd)
+}
+
+func (v *FormatValidator) Init(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&v.useCase, "use-case", common.UseCaseAirQuality, "使用的场景，同write命令，默认的air-quality场景包含中文tag")
+	flags.Int64Var(&v.scaleVar, "scale-var", 10, "场景的变量，一般情况为设备数量")
+	flags.IntVar(&v.points, "points", 1000, "每种格式校验的point数量")
+	flags.IntVar(&v.batchSize, "batch-size", 100, "每个batch的point数量")
+	flags.StringVar(&v.format, "format", "all", "校验的格式，可以是数据库类型或者数据库类型/写入方式，例如mysql/load-data、mqtt/line，多个使用逗号分隔")
+	flags.StringVar(&v.precision, "precision", "", "fctsdb和influxdbv2的时间戳精度，可选ns、us、ms、s")
+	flags.BoolVar(&v.specialChars, "special-chars", true, "在tag值和字符串field值后面追加空格、逗号、等号、引号、反斜杠等特殊字符")
+	flags.DurationVar(&v.samplingInterval, "sampling-interval", time.Second, "模拟数据的时间间隔")
+	flags.IntVar(&v.maxMismatches, "max-mismatches", 10, "每种格式最多打印的不一致数量")
+}
+
+func (v *FormatValidator) Validate() {
+	if v.points <= 0 || v.batchSize <= 0 {
+		log.Fatal("points and batch-size must be positive")
+	}
+	if db_client.PrecisionDuration(v.precision) == 0 {
+		log.Fatalf("unsupported precision %s, choices: ns, us, ms, s", v.precision)
+	}
+	if v.format == "all" {
+		return
+	}
+	for _, name := range strings.Split(v.format, ",") {
+		if len(v.selectCases(name)) == 0 {
+			log.Fatalf("unsupported format %s", name)
+		}
+	}
+}
+
+// selectCases 根据--format的一项选择需要校验的格式
+func (v *FormatValidator) selectCases(name string) []formatCase {
+	var cases []formatCase
+	for _, c := range formatCases {
+		if name == "all" || name == c.format || name == c.String() {
+			cases = append(cases, c)
+		}
+	}
+	return cases
+}
+
+// Run 依次校验每种格式，所有格式都一致时返回true
+func (v *FormatValidator) Run() bool {
+	points := v.generatePoints()
+	passed := true
+	for _, name := range strings.Split(v.format, ",") {
+		for _, c := range v.selectCases(name) {
+			if err := v.validate(c, points); err != nil {
+				log.Printf("%-20s FAIL %s", c, err.Error())
+				passed = false
+				continue
+			}
+			log.Printf("%-20s OK   %d points", c, len(points))
+		}
+	}
+	return passed
+}
+
+func (v *FormatValidator) validate(c formatCase, points []*common.Point) error {
+	conf := db_client.ClientConfig{
+		Host:        "localhost",
+		Database:    "benchmark_db",
+		IngestMode:  c.ingestMode,
+		Precision:   v.precision,
+		MqttPayload: c.mqttPayload,
+	}
+	client := db_client.NewDBClient(c.format, conf)
+	if client == nil {
+		return fmt.Errorf("create client failed")
+	}
+	defer client.Close()
+	parser, err := db_client.NewFormatParser(c.format, conf)
+	if err != nil {
+		return err
+	}
+
+	var expected, actual []db_client.Cell
+	var buf []byte
+	for start := 0; start < len(points); start += v.batchSize {
+		end := start + v.batchSize
+		if end > len(points) {
+			end = len(points)
+		}
+		batch := points[start:end]
+		buf = client.BeforeSerializePoints(buf[:0], batch[0])
+		for _, p := range batch {
+			buf = client.SerializeAndAppendPoint(buf, p)
+		}
+		buf = client.AfterSerializePoints(buf, batch[len(batch)-1])
+
+		cells, err := parser.Parse(buf)
+		if err != nil {
+			return fmt.Errorf("parse batch %d error: %s", start/v.batchSize, err.Error())
+		}
+		expected = append(expected, parser.Cells(batch)...)
+		actual = append(actual, cells...)
+	}
+
+	diffs := db_client.CompareCells(expected, actual, v.maxMismatches)
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d cells expected, %d cells parsed, mismatches:\n\t%s", len(expected), len(actual), strings.Join(diffs, "\n\t"))
+	}
+	return nil
+}
+
+// generatePoints 生成校验使用的point，每个point都复制一份，避免模拟器复用内部的缓存
+func (v *FormatValidator) generatePoints() []*common.Point {
+	task := &BasicBenchTask{
+		UseCase:          v.useCase,
+		ScaleVar:         v.scaleVar,
+		SamplingInterval: v.samplingInterval,
+		timestampStart:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		timestampEnd:     time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	simulator := task.newSimulator()
+	points := make([]*common.Point, 0, v.points)
+	for len(points) < v.points && !simulator.Finished() {
+		p := common.MakeUsablePoint()
+		simulator.Next(p)
+		points = append(points, v.copyPoint(p))
+	}
+	return points
+}
+
+func (v *FormatValidator) copyPoint(p *common.Point) *common.Point {
+	suffix := ""
+	if v.specialChars {
+		suffix = specialCharsSuffix
+	}
+	cp := common.MakeUsablePoint()
+	cp.SetMeasurementName(p.MeasurementName)
+	for i := range p.TagKeys {
+		cp.AppendTag(p.TagKeys[i], []byte(string(p.TagValues[i])+suffix))
+	}
+	for i := range p.FieldKeys {
+		switch value := p.FieldValues[i].(type) {
+		case string:
+			cp.AppendField(p.FieldKeys[i], value+suffix)
+		case []byte:
+			cp.AppendField(p.FieldKeys[i], string(value)+suffix)
+		default:
+			cp.AppendField(p.FieldKeys[i], value)
+		}
+	}
+	for i := range p.Int64FiledKeys {
+		cp.AppendInt64Field(p.Int64FiledKeys[i], p.Int64FiledValues[i])
+	}
+	t := *p.Timestamp
+	cp.SetTimestamp(&t)
+	return cp
+}
@@ -59,7 +59,7 @@ func NewAirqDevice(i int, offset int, start time.Time) AirqDevice {
 	tagValues[1] = []byte(region[1])
 	tagValues[2] = []byte(region[2])
 	tagValues[3] = common.RandChoice(SiteTypeChoices)
-	tagValues[4] = []byte(fmt.Sprintf("DEV%09d", i+offset))
+	tagValues[4] = siteID(int64(i + offset))
 	h := AirqDevice{
 		TagValues:             tagValues,
 		SimulatedMeasurements: sm,
@@ -68,6 +68,11 @@ func NewAirqDevice(i int, offset int, start time.Time) AirqDevice {
 	return h
 }
 
+// siteID 站点编号，例如DEV000000001
+func siteID(id int64) []byte {
+	return []byte(fmt.Sprintf("DEV%09d", id))
+}
+
 func (air *AirqDevice) NumMeasurements() int {
 	return len(air.SimulatedMeasurements)
 }
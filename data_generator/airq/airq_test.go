@@ -441,3 +441,41 @@ func TestTimeStamp(t *testing.T) {
 
 	fmt.Println(nowTime.UTC().UnixNano())
 }
+
+func TestSparseAirq(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &AirqSimulatorConfig{
+		Start:            start,
+		End:              start.Add(time.Second * 1000),
+		SamplingInterval: time.Second,
+		DeviceCount:      10,
+		DeviceOffset:     0,
+		Sparse: &common.SparseConfig{
+			Presence:      0.5,
+			FieldPresence: map[string]float64{"aqi": 1},
+			OutageRate:    0.01,
+			OutagePoints:  10,
+		},
+	}
+	sim := cfg.ToSimulator()
+	point := common.MakeUsablePoint()
+	var count, nulls, values int64
+	for sim.Next(point) <= sim.Total() {
+		for i := range point.Int64FiledKeys {
+			if string(point.Int64FiledKeys[i]) == "aqi" && point.Int64FieldIsNull(i) {
+				t.Fatal("aqi should always be present")
+			}
+		}
+		count++
+		nulls += int64(point.NullCount())
+		values += int64(point.ValueCount())
+		point.Reset()
+	}
+	// 故障期间站点不上报数据，写入的point少于Total
+	if count == 0 || count >= sim.Total() || count != sim.SeenPoints() {
+		t.Fatalf("unexpected points %d, total %d, seen %d", count, sim.Total(), sim.SeenPoints())
+	}
+	if nulls == 0 || values == 0 {
+		t.Fatalf("unexpected nulls %d, values %d", nulls, values)
+	}
+}
@@ -19,6 +19,9 @@ type AirqSimulatorConfig struct {
 	DeviceCount      int64
 	DeviceOffset     int64
 	SqlTemplates     []string
+	Sparse           *common.SparseConfig // 模拟字段缺失，为nil时所有字段都存在
+	Churn            *common.ChurnConfig  // 模拟站点上线和下线，为nil时站点一直在线
+	Timing           *common.TimingConfig // 模拟不规则的时间戳，为nil时按SamplingInterval对齐
 }
 
 func (d *AirqSimulatorConfig) ToSimulator() *AirqSimulator {
@@ -27,6 +30,7 @@ func (d *AirqSimulatorConfig) ToSimulator() *AirqSimulator {
 
 	for i := 0; i < len(AirqDevices); i++ {
 		AirqDevices[i] = NewAirqDevice(i, int(d.DeviceOffset), d.Start)
+		AirqDevices[i].SimulatedMeasurements = common.WrapSparse(AirqDevices[i].SimulatedMeasurements, d.Sparse)
 		measNum += int64(AirqDevices[i].NumMeasurements())
 	}
 
@@ -43,6 +47,21 @@ func (d *AirqSimulatorConfig) ToSimulator() *AirqSimulator {
 		SamplingInterval: d.SamplingInterval,
 		TimestampStart:   d.Start,
 		TimestampEnd:     d.End,
+		timing:           common.NewTiming(d.Timing, d.Start, d.SamplingInterval),
+	}
+
+	if d.Churn.Enabled() {
+		initTags := make([][][]byte, len(AirqDevices))
+		for i := range AirqDevices {
+			initTags[i] = AirqDevices[i].TagValues
+		}
+		// 新站点和原来的站点在同一个区县，只有site_id不同
+		dg.churn = common.NewChurn(d.Churn, d.SamplingInterval, initTags, func(slot, id int64) [][]byte {
+			tagValues := make([][]byte, len(AirqTagKeys))
+			copy(tagValues, AirqDevices[slot].TagValues)
+			tagValues[4] = siteID(id + d.DeviceOffset)
+			return tagValues
+		})
 	}
 
 	err := dg.SetSqlTemplate(d.SqlTemplates)
@@ -60,16 +79,44 @@ type AirqSimulator struct {
 	madeValues    int64
 	madeSql       int64
 	writtenPoints int64
+	skippedPoints int64
 
 	Hosts            []AirqDevice
 	SamplingInterval time.Duration
 	TimestampStart   time.Time
 	TimestampEnd     time.Time
 	sqlTemplates     []*common.SqlTemplate
+	churn            *common.Churn
+	timing           *common.Timing
 }
 
 func (s *AirqSimulator) SeenPoints() int64 {
-	return s.madePoints
+	madePoints := atomic.LoadInt64(&s.madePoints)
+	if madePoints > s.maxPoints {
+		madePoints = s.maxPoints
+	}
+	return madePoints - atomic.LoadInt64(&s.skippedPoints)
+}
+
+// TotalSeries 写入过的站点数量
+func (s *AirqSimulator) TotalSeries() int64 {
+	if s.churn != nil {
+		return s.churn.TotalSeries()
+	}
+	return int64(len(s.Hosts))
+}
+
+// ActiveSeries 同时在线的站点数量
+func (s *AirqSimulator) ActiveSeries() int64 {
+	return int64(len(s.Hosts))
+}
+
+// tagValues 第epoch个采样周期时第hostIndex个站点的tag值
+func (s *AirqSimulator) tagValues(hostIndex, epoch int64) [][]byte {
+	if s.churn != nil {
+		return s.churn.Tags(hostIndex, epoch)
+	}
+	return s.Hosts[hostIndex].TagValues
 }
 
 func (s *AirqSimulator) SeenValues() int64 {
@@ -105,30 +152,39 @@ func (s *AirqSimulator) SetSqlTemplate(sqlTemplates []string) error {
 
 func (a *AirqSimulator) ClearMadePointNum() {
 	atomic.StoreInt64(&a.madePoints, 0)
+	atomic.StoreInt64(&a.skippedPoints, 0)
 }
 
 // Next advances a Point to the next state in the generator.
 func (s *AirqSimulator) Next(p *common.Point) int64 {
+	for {
+		madePoint := atomic.AddInt64(&s.madePoints, 1)
+		pointIndex := madePoint - 1
+		hostIndex := pointIndex % int64(len(s.Hosts))
+
+		Airq := &s.Hosts[hostIndex]
+		// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
+		// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
+		epoch := pointIndex / int64(len(s.Hosts))
+		timestamp := s.timing.Timestamp(hostIndex, epoch)
+		p.SetTimestamp(&timestamp)
+
+		// Populate host-specific tags: for example, LSVNV2182E2100001
+		tagValues := s.tagValues(hostIndex, epoch)
+		for i := range AirqTagKeys {
+			p.AppendTag(AirqTagKeys[i], tagValues[i])
+		}
 
-	madePoint := atomic.AddInt64(&s.madePoints, 1)
-	pointIndex := madePoint - 1
-	hostIndex := pointIndex % int64(len(s.Hosts))
-
-	Airq := &s.Hosts[hostIndex]
-	// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
-	// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
-	timestamp := s.TimestampStart.Add(s.SamplingInterval * time.Duration(pointIndex/int64(len(s.Hosts))))
-	p.SetTimestamp(&timestamp)
-
-	// Populate host-specific tags: for example, LSVNV2182E2100001
-	for i := range AirqTagKeys {
-		p.AppendTag(AirqTagKeys[i], Airq.TagValues[i])
+		// Populate measurement-specific tags and fields:
+		// 模拟字段缺失时站点可能不上报数据，直接使用下一个序号
+		if !Airq.SimulatedMeasurements[0].ToPoint(p) && madePoint <= s.maxPoints {
+			p.Reset()
+			atomic.AddInt64(&s.skippedPoints, 1)
+			continue
+		}
+		atomic.AddInt64(&s.madeValues, int64(p.ValueCount()))
+		return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
 	}
-
-	// Populate measurement-specific tags and fields:
-	Airq.SimulatedMeasurements[0].ToPoint(p)
-	atomic.AddInt64(&s.madeValues, int64(len(p.FieldValues)))
-	return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
 }
 
 func (s *AirqSimulator) NextSql(wr io.Writer) int64 {
@@ -155,17 +211,18 @@ func (s *AirqSimulator) NextSql(wr io.Writer) int64 {
 				case string(AirqTagKeys[3]):
 					wr.Write(Airq.TagValues[3])
 				case string(AirqTagKeys[4]):
-					wr.Write(Airq.TagValues[4])
-				case "start":
-					wr.Write([]byte(s.TimestampStart.Format(time.RFC3339)))
-				case "end":
-					wr.Write([]byte(s.TimestampEnd.Format(time.RFC3339)))
-				case "now":
+					// 查询已经写入的最新一个采样周期在线的站点
+					epoch := atomic.LoadInt64(&s.writtenPoints) / int64(len(s.Hosts))
+					if epoch > 0 {
+						epoch--
+					}
+					wr.Write(s.tagValues(int64((randomHostsIndex+k)%len(s.Hosts)), epoch)[4])
+				default:
 					currentTimeInDB := s.TimestampStart.Add(s.SamplingInterval * time.Duration(s.writtenPoints/int64(len(s.Hosts))))
-					wr.Write([]byte(currentTimeInDB.Format(time.RFC3339)))
+					common.WriteTimeKeyword(wr, key, s.TimestampStart, s.TimestampEnd, currentTimeInDB)
 				}
 				if k < repeat-1 {
-					wr.Write([]byte("','"))
+					wr.Write(tmp.KeySep[i])
 				}
 			}
 		}
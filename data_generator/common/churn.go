@@ -0,0 +1,143 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 设备存活时间的分布
+const (
+	ChurnFixed       = "fixed"       // 所有设备的存活时间相同
+	ChurnExponential = "exponential" // 指数分布，例如容器、充电桩的会话
+	ChurnUniform     = "uniform"     // 平均存活时间的0.5~1.5倍之间均匀分布
+)
+
+// ChurnConfig 模拟series的变化：设备存活一段时间后下线，由使用新编号的设备代替，同时在线的设备数量保持为场景的设备数量
+type ChurnConfig struct {
+	Lifetime     time.Duration // 设备的平均存活时间，0表示不模拟
+	Distribution string        // fixed、exponential、uniform，默认exponential
+	Seed         int64
+}
+
+// Enabled 是否需要模拟series的变化
+func (c *ChurnConfig) Enabled() bool {
+	return c != nil && c.Lifetime > 0
+}
+
+func (c *ChurnConfig) Validate() error {
+	if c.Lifetime < 0 {
+		return fmt.Errorf("the churn lifetime must not be negative")
+	}
+	switch c.Distribution {
+	case "", ChurnFixed, ChurnExponential, ChurnUniform:
+	default:
+		return fmt.Errorf("unsupported churn distribution %q", c.Distribution)
+	}
+	return nil
+}
+
+// SeriesCounter 模拟series变化的Simulator实现此接口，用于报告写入过的series数量和同时在线的series数量
+type SeriesCounter interface {
+	TotalSeries() int64
+	ActiveSeries() int64
+}
+
+// Churn 记录每个设备位置(slot)上的设备代次。第g代设备的编号为slot+g*slots，
+// 每一代的存活时间由seed、slot和代次决定，多协程下按任意顺序生成point得到的设备相同
+type Churn struct {
+	config   *ChurnConfig
+	lifetime float64 // 平均存活的采样周期数量
+	slots    []churnSlot
+	newTags  func(slot, id int64) [][]byte
+
+	generations int64 // 所有位置上出现过的设备数量
+}
+
+type churnSlot struct {
+	sync.Mutex
+	ends []int64    // 每一代设备下线的采样周期
+	tags [][][]byte // 每一代设备的tag值，tag值可能包含随机数，生成后保存下来，保证同一代设备的series不变
+}
+
+// NewChurn newTags根据位置和设备编号(不含场景的偏移量)返回设备的tag值，第0代使用initTags，不需要重新生成
+func NewChurn(c *ChurnConfig, samplingInterval time.Duration, initTags [][][]byte, newTags func(slot, id int64) [][]byte) *Churn {
+	lifetime := float64(c.Lifetime) / float64(samplingInterval)
+	if lifetime < 1 {
+		lifetime = 1
+	}
+	ch := &Churn{
+		config:      c,
+		lifetime:    lifetime,
+		slots:       make([]churnSlot, len(initTags)),
+		newTags:     newTags,
+		generations: int64(len(initTags)),
+	}
+	for i := range ch.slots {
+		ch.slots[i].tags = [][][]byte{initTags[i]}
+	}
+	return ch
+}
+
+// Tags 返回第slot个位置在第epoch个采样周期在线的设备的tag值
+func (c *Churn) Tags(slot, epoch int64) [][]byte {
+	s := &c.slots[slot]
+	s.Lock()
+	defer s.Unlock()
+	for len(s.ends) == 0 || s.ends[len(s.ends)-1] <= epoch {
+		var start int64
+		if len(s.ends) > 0 {
+			start = s.ends[len(s.ends)-1]
+		}
+		s.ends = append(s.ends, start+c.lifetimeOf(slot, int64(len(s.ends))))
+	}
+	gen := sort.Search(len(s.ends), func(i int) bool { return s.ends[i] > epoch })
+	for len(s.tags) <= gen {
+		s.tags = append(s.tags, nil)
+	}
+	if s.tags[gen] == nil {
+		s.tags[gen] = c.newTags(slot, c.id(slot, int64(gen)))
+		atomic.AddInt64(&c.generations, 1)
+	}
+	return s.tags[gen]
+}
+
+func (c *Churn) id(slot, gen int64) int64 {
+	return slot + gen*int64(len(c.slots))
+}
+
+// lifetimeOf 第gen代设备存活的采样周期数量，第0代设备在开始时已经运行了一段时间，只存活剩余的部分，避免所有设备同时下线
+func (c *Churn) lifetimeOf(slot, gen int64) int64 {
+	u := float64(mix(c.config.Seed, slot, gen)>>11) / (1 << 53)
+	var lifetime float64
+	switch c.config.Distribution {
+	case ChurnFixed:
+		lifetime = c.lifetime
+	case ChurnUniform:
+		lifetime = c.lifetime * (0.5 + u)
+		u = float64(mix(c.config.Seed+1, slot, gen)>>11) / (1 << 53)
+	default:
+		lifetime = -math.Log(1-u) * c.lifetime
+		u = float64(mix(c.config.Seed+1, slot, gen)>>11) / (1 << 53)
+	}
+	if gen == 0 {
+		lifetime *= u
+	}
+	if lifetime < 1 {
+		return 1
+	}
+	return int64(lifetime)
+}
+
+// TotalSeries 到目前为止出现过的设备数量
+func (c *Churn) TotalSeries() int64 {
+	return atomic.LoadInt64(&c.generations)
+}
+
+// ActiveSeries 同时在线的设备数量，设备下线后立即由新设备代替
+func (c *Churn) ActiveSeries() int64 {
+	return int64(len(c.slots))
+}
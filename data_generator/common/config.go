@@ -1,4 +1,4 @@
-// Incomplete support for schema description and data generation
+// Support for schema description and data generation
 // using TOML format as supported by influx_tools in branch 1.7+
 
 package common
@@ -24,7 +24,7 @@ var DefaultValueGenerator = map[string]interface{}{
 
 func getSourceValue(s *Source, measurementName, itemKey string, itemDefaultValue interface{}) interface{} {
 	switch reflect.Indirect(reflect.ValueOf(s)).Elem().Kind() {
-	case reflect.Array:
+	case reflect.Array, reflect.Slice:
 		array := (*s).([]interface{})
 		return array[rand.Int63n(int64(len(array)))]
 	case reflect.Map:
@@ -32,11 +32,14 @@ func getSourceValue(s *Source, measurementName, itemKey string, itemDefaultValue
 		if reflect.DeepEqual(m, DefaultValueGenerator) {
 			return itemDefaultValue
 		}
-		log.Fatalf("generators are not supported (yet) ['%s/%s']", measurementName, itemKey)
+		g, err := NewValueGenerator(*s, measurementName+"/"+itemKey)
+		if err != nil {
+			log.Fatalf("%v ['%s/%s']", err, measurementName, itemKey)
+		}
+		return g.Value(rand.Int63(), rand.Int63())
 	default: // primitive types
 		return *s
 	}
-	panic("unreachable")
 }
 
 type Tag struct {
@@ -63,6 +66,11 @@ type ExternalConfig struct {
 
 var Config *ExternalConfig
 
+// Measurements 返回配置文件中定义的所有measurement，同名的measurement可以定义多次，分别生成各自的series
+func (c *ExternalConfig) Measurements() []Measurement {
+	return c.measurements
+}
+
 func (c *ExternalConfig) String() string {
 	var buf bytes.Buffer
 	for _, m := range c.measurements {
@@ -138,10 +146,22 @@ func NewConfig(path string) (*ExternalConfig, error) {
 		return nil, fmt.Errorf("config marshall failed: %v", err)
 	}
 	config := ExternalConfig{}
-	err = json.Unmarshal(b, &config.measurements)
+	// 使用json.Number保留toml中整数和浮点数的区别，整数生成int64类型的field
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	err = decoder.Decode(&config.measurements)
 	if err != nil {
 		return nil, fmt.Errorf("config unmarshall failed: %v", err)
 	}
+	for i := range config.measurements {
+		m := &config.measurements[i]
+		for j := range m.Tags {
+			m.Tags[j].Source = normalizeSource(m.Tags[j].Source)
+		}
+		for j := range m.Fields {
+			m.Fields[j].Source = normalizeSource(m.Fields[j].Source)
+		}
+	}
 	return &config, nil
 }
 
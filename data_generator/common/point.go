@@ -18,6 +18,12 @@ type Point struct {
 	Int64FiledKeys   [][]byte
 	Int64FiledValues []int64
 	Timestamp        *time.Time
+
+	// 缺失的字段，NullFields[i]对应FieldValues[i]，NullInt64Fields[i]对应Int64FiledValues[i]，
+	// 缺失字段的值保留原来的类型，sql类数据库写入NULL，其他格式不输出该字段
+	NullFields      []bool
+	NullInt64Fields []bool
+	nullCount       int
 }
 
 // Using these literals prevents the slices from escaping to the heap, saving
@@ -33,6 +39,9 @@ func (p *Point) Reset() {
 	p.Int64FiledKeys = p.Int64FiledKeys[:0]
 	p.Int64FiledValues = p.Int64FiledValues[:0]
 	p.Timestamp = nil
+	p.NullFields = p.NullFields[:0]
+	p.NullInt64Fields = p.NullInt64Fields[:0]
+	p.nullCount = 0
 }
 
 func (p *Point) SetTimestamp(t *time.Time) {
@@ -59,6 +68,46 @@ func (p *Point) AppendInt64Field(key []byte, value int64) {
 	p.Int64FiledValues = append(p.Int64FiledValues, value)
 }
 
+// SetFieldNull 把FieldValues[i]标记为缺失
+func (p *Point) SetFieldNull(i int) {
+	for len(p.NullFields) < len(p.FieldValues) {
+		p.NullFields = append(p.NullFields, false)
+	}
+	if !p.NullFields[i] {
+		p.NullFields[i] = true
+		p.nullCount++
+	}
+}
+
+// SetInt64FieldNull 把Int64FiledValues[i]标记为缺失
+func (p *Point) SetInt64FieldNull(i int) {
+	for len(p.NullInt64Fields) < len(p.Int64FiledValues) {
+		p.NullInt64Fields = append(p.NullInt64Fields, false)
+	}
+	if !p.NullInt64Fields[i] {
+		p.NullInt64Fields[i] = true
+		p.nullCount++
+	}
+}
+
+func (p *Point) FieldIsNull(i int) bool {
+	return i < len(p.NullFields) && p.NullFields[i]
+}
+
+func (p *Point) Int64FieldIsNull(i int) bool {
+	return i < len(p.NullInt64Fields) && p.NullInt64Fields[i]
+}
+
+// NullCount 缺失的字段数量
+func (p *Point) NullCount() int {
+	return p.nullCount
+}
+
+// ValueCount 没有缺失的字段数量
+func (p *Point) ValueCount() int {
+	return len(p.FieldValues) + len(p.Int64FiledValues) - p.nullCount
+}
+
 func MakeUsablePoint() *Point {
 	return &Point{
 		MeasurementName:  nil,
@@ -16,9 +16,12 @@ const (
 	UseCaseBareAggregate        = "bare-agg"
 	UseCaseGroupWindowTranspose = "group-window-transpose"
 	UseCaseVehicle              = "vehicle"
+	UseCaseVehicleTelemetry     = "vehicle-telemetry" // GPS轨迹和关联信号的车辆模型，vehicle场景保留原来的随机数模型
 	UseCaseAirQuality           = "air-quality"
 	UseCaseLiveCharge           = "live"
 	UseCaseScene                = "scene"
+	UseCaseSchema               = "schema" // 使用--schema指定的toml配置文件生成数据
+	UseCaseReplay               = "replay" // 回放--replay指定的数据文件
 )
 
 // Use case choices:
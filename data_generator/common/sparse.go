@@ -0,0 +1,143 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/util/fastrand"
+)
+
+// SparseConfig 模拟字段缺失：每个字段按概率出现，设备可以连续一段时间故障
+type SparseConfig struct {
+	Presence      float64            // 每个字段出现的概率，1表示所有字段都出现
+	FieldPresence map[string]float64 // 按字段名称覆盖Presence
+	OutageRate    float64            // 每个point开始一次故障的概率，0表示不模拟故障
+	OutagePoints  int64              // 一次故障持续的point数量
+	OutageFields  []string           // 故障时缺失的字段，为空表示所有字段，即设备不上报数据
+}
+
+// Enabled 是否需要模拟字段缺失
+func (c *SparseConfig) Enabled() bool {
+	if c == nil {
+		return false
+	}
+	if c.Presence < 1 || c.OutageRate > 0 {
+		return true
+	}
+	for _, presence := range c.FieldPresence {
+		if presence < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *SparseConfig) Validate() error {
+	if c.Presence < 0 || c.Presence > 1 {
+		return fmt.Errorf("the field presence must be in [0, 1]")
+	}
+	for name, presence := range c.FieldPresence {
+		if presence < 0 || presence > 1 {
+			return fmt.Errorf("the presence of field %s must be in [0, 1]", name)
+		}
+	}
+	if c.OutageRate < 0 || c.OutageRate > 1 {
+		return fmt.Errorf("the outage rate must be in [0, 1]")
+	}
+	if c.OutageRate > 0 && c.OutagePoints <= 0 {
+		return fmt.Errorf("the outage points must be positive")
+	}
+	return nil
+}
+
+// WrapSparse 把一个设备的所有SimulatedMeasurement包装为SparseMeasurement，配置不需要模拟缺失时原样返回
+func WrapSparse(sms []SimulatedMeasurement, c *SparseConfig) []SimulatedMeasurement {
+	if !c.Enabled() {
+		return sms
+	}
+	wrapped := make([]SimulatedMeasurement, len(sms))
+	for i := range sms {
+		wrapped[i] = NewSparseMeasurement(sms[i], c)
+	}
+	return wrapped
+}
+
+// SparseMeasurement 包装一个设备的SimulatedMeasurement，在ToPoint之后把部分字段标记为缺失。
+// 所有字段都缺失时ToPoint返回false，该point不写入
+type SparseMeasurement struct {
+	SimulatedMeasurement
+	config       *SparseConfig
+	outageFields map[string]bool
+
+	mu         sync.Mutex
+	outageLeft int64 // 故障剩余的point数量
+}
+
+func NewSparseMeasurement(m SimulatedMeasurement, c *SparseConfig) *SparseMeasurement {
+	s := &SparseMeasurement{SimulatedMeasurement: m, config: c}
+	if len(c.OutageFields) > 0 {
+		s.outageFields = make(map[string]bool, len(c.OutageFields))
+		for _, name := range c.OutageFields {
+			s.outageFields[name] = true
+		}
+	}
+	return s
+}
+
+func (s *SparseMeasurement) ToPoint(p *Point) bool {
+	if !s.SimulatedMeasurement.ToPoint(p) {
+		return false
+	}
+	if s.inOutage() {
+		if s.outageFields == nil {
+			return false
+		}
+		for i := range p.FieldKeys {
+			if s.outageFields[string(p.FieldKeys[i])] {
+				p.SetFieldNull(i)
+			}
+		}
+		for i := range p.Int64FiledKeys {
+			if s.outageFields[string(p.Int64FiledKeys[i])] {
+				p.SetInt64FieldNull(i)
+			}
+		}
+	}
+	for i := range p.FieldKeys {
+		if !s.present(p.FieldKeys[i]) {
+			p.SetFieldNull(i)
+		}
+	}
+	for i := range p.Int64FiledKeys {
+		if !s.present(p.Int64FiledKeys[i]) {
+			p.SetInt64FieldNull(i)
+		}
+	}
+	return p.ValueCount() > 0
+}
+
+// inOutage 返回当前point是否处于故障中，故障按point计数，与时间无关
+func (s *SparseMeasurement) inOutage() bool {
+	if s.config.OutageRate <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outageLeft > 0 {
+		s.outageLeft--
+		return true
+	}
+	if fastrand.Float64() < s.config.OutageRate {
+		s.outageLeft = s.config.OutagePoints - 1
+		return true
+	}
+	return false
+}
+
+func (s *SparseMeasurement) present(key []byte) bool {
+	presence := s.config.Presence
+	if v, ok := s.config.FieldPresence[string(key)]; ok {
+		presence = v
+	}
+	return presence >= 1 || fastrand.Float64() < presence
+}
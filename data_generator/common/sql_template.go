@@ -2,8 +2,15 @@ package common
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"time"
+)
+
+var (
+	singleQuoteSep = []byte("','")
+	doubleQuoteSep = []byte(`","`)
 )
 
 // SqlTemplate对象用于记录sql文本被分割后的内容信息
@@ -11,6 +18,7 @@ type SqlTemplate struct {
 	Base      [][]byte //记录sql文本中不用替换的分段文本
 	KeyWords  []string //记录sql文本中需要替换的关键字
 	KeyRepeat []int    //记录对应关键字需要重复替换的次数
+	KeySep    [][]byte //记录对应关键字重复替换时的分隔符，关键字前为双引号时使用","，否则使用','，也可以在关键字中用:指定
 }
 
 // 根据文本进行分割，生成SqlTemplate对象
@@ -19,41 +27,53 @@ type SqlTemplate struct {
 // 将被分割成base段: "select mean(aqi) as aqi from city_air_quality where city in '"、"' and time >= '"、"'-30d group by time(1d)"三个
 // 关键字: city、now
 // 重复次数: 6、1
+//
+// 只有'{'后紧跟字母或下划线时才认为是关键字的开始，其他的'{'和'}'按普通文本处理，
+// 这样elasticsearch DSL等json格式的模板也可以直接使用，例如：
+// {"query":{"terms":{"site_id":["{site_id*10}"]}}}
+//
+// 重复替换的分隔符可以在重复次数后用:指定，例如opentsdb的literal_or过滤器使用|分隔：
+// {"type":"literal_or","tagk":"site_id","filter":"{site_id*10:|}"}
 func NewSqlTemplate(tql string) (*SqlTemplate, error) {
 	tqlBytes := []byte(tql)
 	tmp := &SqlTemplate{}
 	key := make([]byte, 0)
 	base := make([]byte, 0)
 	record := false
-	for _, b := range tqlBytes {
-		switch b {
-		case '{':
+	for i, b := range tqlBytes {
+		switch {
+		case b == '{' && i+1 < len(tqlBytes) && isKeyWordStart(tqlBytes[i+1]):
 			if !record {
 				record = true
 				tmp.Base = append(tmp.Base, base)
+				if len(base) > 0 && base[len(base)-1] == '"' {
+					tmp.KeySep = append(tmp.KeySep, doubleQuoteSep)
+				} else {
+					tmp.KeySep = append(tmp.KeySep, singleQuoteSep)
+				}
 				base = make([]byte, 0)
 			} else {
 				return nil, fmt.Errorf("can not parse the sql template, repeat {")
 			}
-		case '}':
-			if record {
-				record = false
-				keyMsg := strings.ToLower(string(key))
-				keyIE := strings.Split(keyMsg, "*")
-				if len(keyIE) >= 2 {
-					repeat, err := strconv.Atoi(strings.TrimSpace(keyIE[1]))
-					if err != nil {
-						return nil, fmt.Errorf("can not parse the sql template, %s is incorrect", keyMsg)
-					}
-					tmp.KeyRepeat = append(tmp.KeyRepeat, repeat)
-				} else {
-					tmp.KeyRepeat = append(tmp.KeyRepeat, 1)
+		case b == '}' && record:
+			record = false
+			keyMsg := strings.ToLower(string(key))
+			keyIE := strings.Split(keyMsg, "*")
+			if len(keyIE) >= 2 {
+				if i := strings.IndexByte(keyIE[1], ':'); i >= 0 {
+					tmp.KeySep[len(tmp.KeySep)-1] = []byte(keyIE[1][i+1:])
+					keyIE[1] = keyIE[1][:i]
+				}
+				repeat, err := strconv.Atoi(strings.TrimSpace(keyIE[1]))
+				if err != nil {
+					return nil, fmt.Errorf("can not parse the sql template, %s is incorrect", keyMsg)
 				}
-				tmp.KeyWords = append(tmp.KeyWords, strings.TrimSpace(keyIE[0]))
-				key = make([]byte, 0)
+				tmp.KeyRepeat = append(tmp.KeyRepeat, repeat)
 			} else {
-				return nil, fmt.Errorf("can not parse the sql template, repeat }")
+				tmp.KeyRepeat = append(tmp.KeyRepeat, 1)
 			}
+			tmp.KeyWords = append(tmp.KeyWords, strings.TrimSpace(keyIE[0]))
+			key = make([]byte, 0)
 		default:
 			if record {
 				key = append(key, b)
@@ -62,9 +82,83 @@ func NewSqlTemplate(tql string) (*SqlTemplate, error) {
 			}
 		}
 	}
+	if record {
+		return nil, fmt.Errorf("can not parse the sql template, missing }")
+	}
 	if len(base) > 0 {
 		tmp.Base = append(tmp.Base, base)
 	}
 
 	return tmp, nil
 }
+
+func isKeyWordStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// TimePrecision 写入数据时时间戳的精度，查询模板中的时间关键字按同样的精度截断，0表示不截断并输出到秒
+var TimePrecision time.Duration
+
+// FormatTimeKeyword 处理模板中的时间关键字，start、end、now分别为关键字对应的时间，
+// 关键字可以带+/-偏移量，偏移量支持d(天)和time.ParseDuration支持的单位，以_ms结尾时输出毫秒时间戳，否则输出RFC3339格式，例如：
+// {now-1d_ms}、{start+30d_ms}、{now-12h}
+// 不是时间关键字时返回false
+func FormatTimeKeyword(key string, start, end, now time.Time) (string, bool) {
+	ms := strings.HasSuffix(key, "_ms")
+	key = strings.TrimSuffix(key, "_ms")
+	var offset time.Duration
+	if i := strings.IndexAny(key, "+-"); i > 0 {
+		d, err := parseTimeOffset(key[i+1:])
+		if err != nil {
+			return "", false
+		}
+		if key[i] == '-' {
+			d = -d
+		}
+		offset = d
+		key = key[:i]
+	}
+	var t time.Time
+	switch key {
+	case "start":
+		t = start
+	case "end":
+		t = end
+	case "now":
+		t = now
+	default:
+		return "", false
+	}
+	t = t.Add(offset)
+	if TimePrecision > 0 {
+		t = t.Truncate(TimePrecision)
+	}
+	if ms {
+		return strconv.FormatInt(t.UnixNano()/1e6, 10), true
+	}
+	if TimePrecision > 0 && TimePrecision < time.Second {
+		return t.Format(time.RFC3339Nano), true
+	}
+	return t.Format(time.RFC3339), true
+}
+
+// WriteTimeKeyword 将模板中的时间关键字写入wr，currentTimeInDB为数据库中已写入数据的最新时间，
+// 不是时间关键字时原样保留，交给数据库客户端处理，例如iotdb的{db}
+func WriteTimeKeyword(wr io.Writer, key string, start, end, currentTimeInDB time.Time) {
+	if value, ok := FormatTimeKeyword(key, start, end, currentTimeInDB); ok {
+		wr.Write([]byte(value))
+		return
+	}
+	wr.Write([]byte("{" + key + "}"))
+}
+
+func parseTimeOffset(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
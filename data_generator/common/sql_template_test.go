@@ -0,0 +1,74 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSqlTemplate(t *testing.T) {
+	tmp, err := NewSqlTemplate("select * from vehicle where VIN in ('{vin*10}') and time > '{now}'-1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp.Base) != 3 || len(tmp.KeyWords) != 2 || tmp.KeyRepeat[0] != 10 || string(tmp.KeySep[0]) != "','" {
+		t.Fatalf("parse sql template error: %+v", tmp)
+	}
+
+	// json中的括号不是关键字
+	tmp, err = NewSqlTemplate(`{"query":{"terms":{"VIN":["{vin*10}"]}},"aggs":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp.KeyWords) != 1 || tmp.KeyWords[0] != "vin" || string(tmp.KeySep[0]) != `","` {
+		t.Fatalf("parse dsl template error: %+v", tmp)
+	}
+	if string(tmp.Base[0]) != `{"query":{"terms":{"VIN":["` || string(tmp.Base[1]) != `"]}},"aggs":{}}` {
+		t.Fatalf("parse dsl template base error: %q", tmp.Base)
+	}
+
+	if _, err = NewSqlTemplate("select * from vehicle where VIN = '{vin'"); err == nil {
+		t.Fatal("expect error for unclosed keyword")
+	}
+}
+
+func TestTimeKeyword(t *testing.T) {
+	tmp, err := NewSqlTemplate(`{"filter":"{site_id*10:|}","start":{now-1d_ms}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmp.KeyRepeat[0] != 10 || string(tmp.KeySep[0]) != "|" || tmp.KeyWords[1] != "now-1d_ms" {
+		t.Fatalf("parse keyword separator error: %+v", tmp)
+	}
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(48 * time.Hour)
+	cases := map[string]string{
+		"now-1d_ms":     "1514851200000",
+		"start_ms":      "1514764800000",
+		"start+30d":     "2018-01-31T00:00:00Z",
+		"end-1h30m":     "2018-01-01T22:30:00Z",
+		"now":           "2018-01-03T00:00:00Z",
+		"now-abc":       "",
+		"site_id":       "",
+		"now-1d_second": "",
+	}
+	for key, expect := range cases {
+		value, ok := FormatTimeKeyword(key, start, start.Add(24*time.Hour), now)
+		if value != expect || ok != (expect != "") {
+			t.Fatalf("format time keyword %s error: %s %v", key, value, ok)
+		}
+	}
+
+	defer func() { TimePrecision = 0 }()
+	now = now.Add(1234567891 * time.Nanosecond)
+	precisionCases := map[time.Duration]string{
+		time.Millisecond: "2018-01-03T00:00:01.234Z",
+		time.Second:      "2018-01-03T00:00:01Z",
+	}
+	for precision, expect := range precisionCases {
+		TimePrecision = precision
+		if value, _ := FormatTimeKeyword("now", start, start, now); value != expect {
+			t.Fatalf("format time keyword with precision %s error: %s", precision, value)
+		}
+	}
+}
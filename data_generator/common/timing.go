@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// 迟到时间的分布
+const (
+	LateUniform     = "uniform"     // (0, MaxLateness]之间均匀分布
+	LateExponential = "exponential" // 均值为MaxLateness/4的指数分布，超过MaxLateness时取MaxLateness
+)
+
+// TimingConfig 模拟不规则的时间戳：时间戳抖动、每个设备不同的采样间隔、迟到(乱序)的point和重复的时间戳
+type TimingConfig struct {
+	Jitter           time.Duration // 每个point的时间戳在[-Jitter, Jitter]之间随机偏移
+	IntervalSpread   float64       // 每个设备的采样间隔在SamplingInterval*(1±IntervalSpread)之间均匀分布
+	LateRatio        float64       // 迟到的point比例，迟到的point的时间戳早于同一时刻其他设备的point
+	MaxLateness      time.Duration // 最大的迟到时间
+	LateDistribution string        // uniform、exponential，默认uniform
+	DuplicateRatio   float64       // 和设备上一个point时间戳相同的point比例，写入时覆盖上一个point
+	Seed             int64
+}
+
+// Enabled 是否需要模拟不规则的时间戳
+func (c *TimingConfig) Enabled() bool {
+	return c != nil && (c.Jitter > 0 || c.IntervalSpread > 0 || c.LateRatio > 0 || c.DuplicateRatio > 0)
+}
+
+func (c *TimingConfig) Validate() error {
+	if c.Jitter < 0 {
+		return fmt.Errorf("the timestamp jitter must not be negative")
+	}
+	if c.IntervalSpread < 0 || c.IntervalSpread >= 1 {
+		return fmt.Errorf("the interval spread must be in [0, 1)")
+	}
+	if c.LateRatio < 0 || c.LateRatio > 1 || c.DuplicateRatio < 0 || c.DuplicateRatio > 1 {
+		return fmt.Errorf("the late ratio and duplicate ratio must be in [0, 1]")
+	}
+	if c.LateRatio > 0 && c.MaxLateness <= 0 {
+		return fmt.Errorf("the max lateness must be positive")
+	}
+	switch c.LateDistribution {
+	case "", LateUniform, LateExponential:
+	default:
+		return fmt.Errorf("unsupported lateness distribution %q", c.LateDistribution)
+	}
+	return nil
+}
+
+// Timing 计算每个设备每个采样周期的时间戳，随机数由seed、设备序号和采样序号决定，
+// 多协程下按任意顺序生成point得到的时间戳相同，重复的时间戳也能和上一个point完全一致
+type Timing struct {
+	config   *TimingConfig
+	start    time.Time
+	interval time.Duration
+}
+
+// NewTiming config为nil时按SamplingInterval对齐
+func NewTiming(c *TimingConfig, start time.Time, interval time.Duration) *Timing {
+	if !c.Enabled() {
+		c = nil
+	}
+	return &Timing{config: c, start: start, interval: interval}
+}
+
+// Timestamp 返回第device个设备第epoch个采样周期的时间戳
+func (t *Timing) Timestamp(device, epoch int64) time.Time {
+	if t.config == nil {
+		return t.start.Add(t.interval * time.Duration(epoch))
+	}
+	if t.config.DuplicateRatio > 0 && epoch > 0 && t.uniform(1, device, epoch) < t.config.DuplicateRatio {
+		return t.grid(device, epoch-1)
+	}
+	ts := t.grid(device, epoch)
+	if t.config.LateRatio > 0 && t.uniform(2, device, epoch) < t.config.LateRatio {
+		ts = ts.Add(-t.lateness(device, epoch))
+	}
+	return ts
+}
+
+// grid 加上设备的采样间隔和抖动之后的时间戳
+func (t *Timing) grid(device, epoch int64) time.Time {
+	interval := t.interval
+	if t.config.IntervalSpread > 0 {
+		interval = time.Duration(float64(interval) * (1 + t.config.IntervalSpread*(2*t.uniform(3, device, -1)-1)))
+	}
+	ts := t.start.Add(interval * time.Duration(epoch))
+	if t.config.Jitter > 0 {
+		ts = ts.Add(time.Duration((2*t.uniform(4, device, epoch) - 1) * float64(t.config.Jitter)))
+	}
+	return ts
+}
+
+func (t *Timing) lateness(device, epoch int64) time.Duration {
+	u := t.uniform(5, device, epoch)
+	max := float64(t.config.MaxLateness)
+	var late float64
+	if t.config.LateDistribution == LateExponential {
+		late = math.Min(-math.Log(1-u)*max/4, max)
+	} else {
+		late = (1 - u) * max
+	}
+	if late < 1 {
+		late = 1
+	}
+	return time.Duration(late)
+}
+
+// uniform [0, 1)之间均匀分布的随机数，salt区分不同用途的随机数
+func (t *Timing) uniform(salt, device, epoch int64) float64 {
+	return float64(mix(t.config.Seed+salt, device, epoch)>>11) / (1 << 53)
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	grid := NewTiming(nil, start, time.Second)
+	if ts := grid.Timestamp(3, 10); !ts.Equal(start.Add(10 * time.Second)) {
+		t.Fatalf("unexpected grid timestamp %s", ts)
+	}
+
+	c := &TimingConfig{Jitter: 100 * time.Millisecond, LateRatio: 0.1, MaxLateness: 10 * time.Second, DuplicateRatio: 0.2, Seed: 1}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	timing := NewTiming(c, start, time.Second)
+	var late, duplicate, total int
+	for device := int64(0); device < 10; device++ {
+		prev := timing.Timestamp(device, 0)
+		for epoch := int64(1); epoch < 1000; epoch++ {
+			ts := timing.Timestamp(device, epoch)
+			if !ts.Equal(timing.Timestamp(device, epoch)) {
+				t.Fatal("timestamp is not reproducible")
+			}
+			if ts.Before(start.Add(time.Duration(epoch)*time.Second - 11*time.Second)) {
+				t.Fatalf("timestamp %s of epoch %d is later than max lateness", ts, epoch)
+			}
+			switch {
+			case ts.Equal(prev):
+				duplicate++
+			case ts.Before(prev):
+				late++
+			}
+			prev = ts
+			total++
+		}
+	}
+	if duplicate < total/10 || duplicate > total*3/10 || late < total/20 || late > total*2/10 {
+		t.Fatalf("unexpected duplicate %d, late %d of %d points", duplicate, late, total)
+	}
+
+	// 每个设备的采样间隔不同
+	timing = NewTiming(&TimingConfig{IntervalSpread: 0.5}, start, time.Second)
+	if a, b := timing.Timestamp(0, 100), timing.Timestamp(1, 100); a.Equal(b) || a.Sub(start) < 50*time.Second || a.Sub(start) > 150*time.Second {
+		t.Fatalf("unexpected timestamps %s %s", a, b)
+	}
+}
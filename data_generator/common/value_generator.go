@@ -0,0 +1,311 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+)
+
+// 配置文件中source支持的生成器类型
+const (
+	GeneratorSequence  = "sequence"
+	GeneratorRandFloat = "rand<float>"
+	GeneratorRandInt   = "rand<int>"
+	GeneratorZipfInt   = "zipf<integer>"
+)
+
+// ValueGenerator 根据series序号和采样序号生成tag或field的值，
+// 相同的参数总是生成相同的值，多协程下生成的数据也可以复现
+type ValueGenerator interface {
+	Value(series, index int64) interface{}
+}
+
+// NewValueGenerator 根据配置文件中的source创建生成器，name用于没有指定seed时计算默认的seed，
+// 保证同一个series中不同的field不会生成完全相关的值
+//   - 基础类型：常量
+//   - 数组：枚举，每次随机选择其中一个值
+//   - {type = "sequence", format = "host_%s", start = 0, count = 10}：按采样序号递增，count>0时循环
+//   - {type = "rand<float>", seed = 1, min = 0, max = 1}：[min, max)之间均匀分布的浮点数
+//   - {type = "rand<int>", seed = 1, min = 0, max = 100}：[min, max)之间均匀分布的整数
+//   - {type = "zipf<integer>", seed = 1, s = 2, v = 1, imax = 10}：zipf分布的整数
+func NewValueGenerator(s Source, name string) (ValueGenerator, error) {
+	switch v := s.(type) {
+	case nil:
+		return nil, fmt.Errorf("source is empty")
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("enumeration is empty")
+		}
+		return &enumGenerator{seed: nameSeed(name), values: v}, nil
+	case map[string]interface{}:
+		return newGenerator(v, name)
+	default:
+		return constGenerator{value: v}, nil
+	}
+}
+
+// SourceValues 列举source所有可能的值，用于tag：
+// 基础类型只有一个值，数组的每个元素是一个值，sequence生成count个值，其他生成器不支持
+func SourceValues(s Source) ([]interface{}, error) {
+	switch v := s.(type) {
+	case nil:
+		return nil, fmt.Errorf("source is empty")
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("enumeration is empty")
+		}
+		return v, nil
+	case map[string]interface{}:
+		if t, _ := v["type"].(string); t != GeneratorSequence {
+			return nil, fmt.Errorf("generator %v can not enumerate values, use sequence or array", v["type"])
+		}
+		g, err := newSequenceGenerator(v)
+		if err != nil {
+			return nil, err
+		}
+		if g.count <= 0 {
+			return nil, fmt.Errorf("the count of sequence must be positive")
+		}
+		values := make([]interface{}, g.count)
+		for i := range values {
+			values[i] = g.Value(0, int64(i))
+		}
+		return values, nil
+	default:
+		return []interface{}{v}, nil
+	}
+}
+
+func newGenerator(m map[string]interface{}, name string) (ValueGenerator, error) {
+	t, _ := m["type"].(string)
+	switch t {
+	case GeneratorSequence:
+		return newSequenceGenerator(m)
+	case GeneratorRandFloat:
+		seed, err := intParam(m, "seed", nameSeed(name))
+		if err != nil {
+			return nil, err
+		}
+		min, err := floatParam(m, "min", 0)
+		if err != nil {
+			return nil, err
+		}
+		max, err := floatParam(m, "max", 1)
+		if err != nil {
+			return nil, err
+		}
+		if max <= min {
+			return nil, fmt.Errorf("%s: max must be greater than min", t)
+		}
+		return &randFloatGenerator{seed: seed, min: min, max: max}, nil
+	case GeneratorRandInt, "rand<integer>":
+		seed, err := intParam(m, "seed", nameSeed(name))
+		if err != nil {
+			return nil, err
+		}
+		min, err := intParam(m, "min", 0)
+		if err != nil {
+			return nil, err
+		}
+		max, err := intParam(m, "max", 100)
+		if err != nil {
+			return nil, err
+		}
+		if max <= min {
+			return nil, fmt.Errorf("%s: max must be greater than min", t)
+		}
+		return &randIntGenerator{seed: seed, min: min, max: max}, nil
+	case GeneratorZipfInt:
+		seed, err := intParam(m, "seed", nameSeed(name))
+		if err != nil {
+			return nil, err
+		}
+		s, err := floatParam(m, "s", 2)
+		if err != nil {
+			return nil, err
+		}
+		v, err := floatParam(m, "v", 1)
+		if err != nil {
+			return nil, err
+		}
+		imax, err := intParam(m, "imax", 100)
+		if err != nil {
+			return nil, err
+		}
+		if s <= 1 || v < 1 || imax < 0 {
+			return nil, fmt.Errorf("%s: requires s > 1, v >= 1 and imax >= 0", t)
+		}
+		return &zipfGenerator{seed: seed, s: s, v: v, imax: uint64(imax)}, nil
+	default:
+		return nil, fmt.Errorf("generator %q is not supported", t)
+	}
+}
+
+type constGenerator struct {
+	value interface{}
+}
+
+func (g constGenerator) Value(series, index int64) interface{} {
+	return g.value
+}
+
+type enumGenerator struct {
+	seed   int64
+	values []interface{}
+}
+
+func (g *enumGenerator) Value(series, index int64) interface{} {
+	return g.values[mix(g.seed, series, index)%uint64(len(g.values))]
+}
+
+// sequenceGenerator 没有format时生成int64，有format时把数字格式化为字符串，例如"host_%s"
+type sequenceGenerator struct {
+	format string
+	start  int64
+	count  int64
+}
+
+func newSequenceGenerator(m map[string]interface{}) (*sequenceGenerator, error) {
+	format, _ := m["format"].(string)
+	start, err := intParam(m, "start", 0)
+	if err != nil {
+		return nil, err
+	}
+	count, err := intParam(m, "count", 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sequenceGenerator{format: format, start: start, count: count}, nil
+}
+
+func (g *sequenceGenerator) Value(series, index int64) interface{} {
+	if g.count > 0 {
+		index %= g.count
+	}
+	if g.format == "" {
+		return g.start + index
+	}
+	return fmt.Sprintf(g.format, strconv.FormatInt(g.start+index, 10))
+}
+
+type randFloatGenerator struct {
+	seed     int64
+	min, max float64
+}
+
+func (g *randFloatGenerator) Value(series, index int64) interface{} {
+	return g.min + float64(mix(g.seed, series, index)>>11)/(1<<53)*(g.max-g.min)
+}
+
+type randIntGenerator struct {
+	seed     int64
+	min, max int64
+}
+
+func (g *randIntGenerator) Value(series, index int64) interface{} {
+	return g.min + int64(mix(g.seed, series, index)%uint64(g.max-g.min))
+}
+
+type zipfGenerator struct {
+	seed int64
+	s, v float64
+	imax uint64
+}
+
+func (g *zipfGenerator) Value(series, index int64) interface{} {
+	src := mixSource(mix(g.seed, series, index))
+	return int64(rand.NewZipf(rand.New(&src), g.s, g.v, g.imax).Uint64())
+}
+
+// mixSource 基于splitmix64的rand.Source，状态只有一个uint64，创建的代价很小
+type mixSource uint64
+
+func (s *mixSource) Uint64() uint64 {
+	*s += 0x9e3779b97f4a7c15
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *mixSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *mixSource) Seed(seed int64) {
+	*s = mixSource(seed)
+}
+
+// mix 把seed、series序号和采样序号混合为均匀分布的随机数
+func mix(seed, series, index int64) uint64 {
+	src := mixSource(seed)
+	src = mixSource(src.Uint64() ^ uint64(series))
+	src = mixSource(src.Uint64() ^ uint64(index))
+	return src.Uint64()
+}
+
+// Uniform 由seed、series序号和index决定的[0, 1)之间均匀分布的随机数，多协程下按任意顺序调用结果相同
+func Uniform(seed, series, index int64) float64 {
+	return float64(mix(seed, series, index)>>11) / (1 << 53)
+}
+
+func nameSeed(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func intParam(m map[string]interface{}, key string, def int64) (int64, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return v, nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("%v: %s must be an integer", m["type"], key)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("%v: %s must be an integer", m["type"], key)
+	}
+}
+
+func floatParam(m map[string]interface{}, key string, def float64) (float64, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("%v: %s must be a number", m["type"], key)
+	}
+}
+
+// normalizeSource 把json.Number转换为int64或float64
+func normalizeSource(s Source) Source {
+	switch v := s.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeSource(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeSource(v[k])
+		}
+		return v
+	default:
+		return v
+	}
+}
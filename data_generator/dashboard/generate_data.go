@@ -2,6 +2,8 @@ package dashboard
 
 import (
 	"io"
+	"log"
+	"math/rand"
 	"sync/atomic"
 	"time"
 
@@ -12,18 +14,18 @@ import (
 // A DashboardSimulator generates data similar to telemetry from Telegraf.
 // It fulfills the Simulator interface.
 type DashboardSimulator struct {
-	madePoints int64
-	madeValues int64
-	maxPoints  int64
+	madePoints    int64
+	madeValues    int64
+	maxPoints     int64
+	madeSql       int64
+	writtenPoints int64
 
-	simulatedMeasurementIndex int
-
-	hostIndex int
-	hosts     []Host
+	hosts []Host
 
 	timestampNow   time.Time
 	timestampStart time.Time
 	timestampEnd   time.Time
+	sqlTemplates   []*SqlTemplate
 }
 
 func (g *DashboardSimulator) SeenPoints() int64 {
@@ -39,7 +41,7 @@ func (g *DashboardSimulator) Total() int64 {
 }
 
 func (g *DashboardSimulator) Finished() bool {
-	return g.madePoints >= g.maxPoints
+	return atomic.LoadInt64(&g.madePoints) >= g.maxPoints
 }
 
 // Type DashboardSimulatorConfig is used to create a DashboardSimulator.
@@ -47,11 +49,15 @@ type DashboardSimulatorConfig struct {
 	Start time.Time
 	End   time.Time
 
-	HostCount  int64
-	HostOffset int64
+	HostCount    int64
+	HostOffset   int64
+	SqlTemplates []string
 }
 
 func (d *DashboardSimulatorConfig) ToSimulator() *DashboardSimulator {
+	if d.HostCount <= 0 {
+		log.Fatal("the host count is unavailable")
+	}
 	hostInfos := make([]Host, d.HostCount)
 	for i := 0; i < len(hostInfos); i++ {
 		hostInfos[i] = NewHost(i, int(d.HostOffset), d.Start)
@@ -64,16 +70,17 @@ func (d *DashboardSimulatorConfig) ToSimulator() *DashboardSimulator {
 		madeValues: 0,
 		maxPoints:  maxPoints,
 
-		simulatedMeasurementIndex: 0,
-
-		hostIndex: 0,
-		hosts:     hostInfos,
+		hosts: hostInfos,
 
 		timestampNow:   d.Start,
 		timestampStart: d.Start,
 		timestampEnd:   d.End,
 	}
 
+	err := dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 	return dg
 }
 
@@ -83,20 +90,11 @@ func (d *DashboardSimulator) ClearMadePointNum() {
 
 // Next advances a Point to the next state in the generator.
 func (d *DashboardSimulator) Next(p *Point) int64 {
-	// switch to the next host if needed
-	if d.simulatedMeasurementIndex == NHostSims {
-		d.simulatedMeasurementIndex = 0
-		d.hostIndex++
-	}
-
-	if d.hostIndex == len(d.hosts) {
-		d.hostIndex = 0
-		for i := 0; i < len(d.hosts); i++ {
-			// d.hosts[i].TickAll(devops.EpochDuration)
-		}
-	}
-
-	host := &d.hosts[d.hostIndex]
+	madePoint := atomic.AddInt64(&d.madePoints, 1)
+	pointIndex := madePoint - 1
+	host := &d.hosts[(pointIndex/NHostSims)%int64(len(d.hosts))]
+	// 和devops一样，为了多协程timestamp不混乱，按序号计算时间，不使用TickAll方法
+	timestamp := d.timestampStart.Add(devops.EpochDuration * time.Duration(pointIndex/int64(len(d.hosts))/NHostSims))
 
 	// Populate host-specific tags:
 	p.AppendTag(devops.MachineTagKeys[0], host.Name)
@@ -111,21 +109,62 @@ func (d *DashboardSimulator) Next(p *Point) int64 {
 	p.AppendTag(devops.MachineTagKeys[9], host.ServiceEnvironment)
 
 	// Populate measurement-specific tags and fields:
-	host.SimulatedMeasurements[d.simulatedMeasurementIndex].ToPoint(p)
-
-	d.madePoints++
-	d.simulatedMeasurementIndex++
-	d.madeValues += int64(len(p.FieldValues))
-
-	return d.madePoints
-}
+	host.SimulatedMeasurements[pointIndex%NHostSims].ToPoint(p)
+	// system和status会设置自己的时间戳，这里统一覆盖
+	p.SetTimestamp(&timestamp)
 
-func (d *DashboardSimulator) NextSql(wr io.Writer) int64 {
-	return 0
+	atomic.AddInt64(&d.madeValues, int64(len(p.FieldValues)))
+	return madePoint
 }
 
 func (g *DashboardSimulator) SetWrittenPoints(num int64) {
+	if num > g.writtenPoints {
+		atomic.StoreInt64(&g.writtenPoints, num)
+	}
 }
+
 func (g *DashboardSimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	g.sqlTemplates = templates
 	return nil
 }
+
+func (d *DashboardSimulator) NextSql(wr io.Writer) int64 {
+	madeSql := atomic.AddInt64(&d.madeSql, 1)
+	tmp := d.sqlTemplates[madeSql%int64(len(d.sqlTemplates))]
+
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	randomHostsIndex := rand.Intn(len(d.hosts))
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				host := d.hosts[(randomHostsIndex+k)%len(d.hosts)]
+				key := tmp.KeyWords[i]
+				switch key {
+				case string(devops.MachineTagKeys[0]):
+					wr.Write(host.Name)
+				case string(devops.MachineTagKeys[1]):
+					wr.Write(host.Region)
+				case string(ClusterIdTagkey):
+					wr.Write(host.ClusterId)
+				default:
+					currentTimeInDB := d.timestampStart.Add(devops.EpochDuration * time.Duration(atomic.LoadInt64(&d.writtenPoints)/int64(len(d.hosts))/NHostSims))
+					WriteTimeKeyword(wr, key, d.timestampStart, d.timestampEnd, currentTimeInDB)
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
+}
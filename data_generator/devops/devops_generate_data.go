@@ -2,6 +2,8 @@ package devops
 
 import (
 	"io"
+	"log"
+	"math/rand"
 	"sync/atomic"
 	"time"
 
@@ -11,9 +13,11 @@ import (
 // A DevopsSimulator generates data similar to telemetry from Telegraf.
 // It fulfills the Simulator interface.
 type DevopsSimulator struct {
-	madePoints int64
-	madeValues int64
-	maxPoints  int64
+	madePoints    int64
+	madeValues    int64
+	maxPoints     int64
+	madeSql       int64
+	writtenPoints int64
 
 	simulatedMeasurementIndex int
 
@@ -23,6 +27,7 @@ type DevopsSimulator struct {
 	timestampNow   time.Time
 	timestampStart time.Time
 	timestampEnd   time.Time
+	sqlTemplates   []*SqlTemplate
 }
 
 func (g *DevopsSimulator) SeenPoints() int64 {
@@ -46,8 +51,9 @@ type DevopsSimulatorConfig struct {
 	Start time.Time
 	End   time.Time
 
-	HostCount  int64
-	HostOffset int64
+	HostCount    int64
+	HostOffset   int64
+	SqlTemplates []string
 }
 
 func (d *DevopsSimulatorConfig) ToSimulator() *DevopsSimulator {
@@ -72,6 +78,10 @@ func (d *DevopsSimulatorConfig) ToSimulator() *DevopsSimulator {
 		timestampEnd:   d.End,
 	}
 
+	err := dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 	return dg
 }
 
@@ -127,10 +137,52 @@ func (d *DevopsSimulator) Next(p *Point) int64 {
 }
 
 func (d *DevopsSimulator) NextSql(wr io.Writer) int64 {
-	return 0
+	madeSql := atomic.AddInt64(&d.madeSql, 1)
+	tmp := d.sqlTemplates[madeSql%int64(len(d.sqlTemplates))]
+
+	// 生成数据点时，用fastrand更快速，生成的数据和seed无关联
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	randomHostsIndex := rand.Intn(len(d.hosts))
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				host := d.hosts[(randomHostsIndex+k)%len(d.hosts)]
+				key := tmp.KeyWords[i]
+				switch key {
+				case string(MachineTagKeys[0]):
+					wr.Write(host.Name)
+				case string(MachineTagKeys[1]):
+					wr.Write(host.Region)
+				default:
+					currentTimeInDB := d.timestampStart.Add(EpochDuration * time.Duration(atomic.LoadInt64(&d.writtenPoints)/int64(len(d.hosts))/NHostSims))
+					WriteTimeKeyword(wr, key, d.timestampStart, d.timestampEnd, currentTimeInDB)
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
 }
+
 func (g *DevopsSimulator) SetWrittenPoints(num int64) {
+	if num > g.writtenPoints {
+		atomic.StoreInt64(&g.writtenPoints, num)
+	}
 }
+
 func (g *DevopsSimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	g.sqlTemplates = templates
 	return nil
 }
@@ -1,8 +1,10 @@
 package iot
 
 import (
-	"fmt"
 	"io"
+	"log"
+	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,35 +18,56 @@ type IotSimulatorConfig struct {
 
 	SmartHomeCount  int64
 	SmartHomeOffset int64
+	SqlTemplates    []string
 }
 
 func (d *IotSimulatorConfig) ToSimulator() *IotSimulator {
+	if d.SmartHomeCount <= 0 {
+		log.Fatal("the smart home count is unavailable")
+	}
 	homeInfos := make([]*SmartHome, d.SmartHomeCount)
-	var measNum int64
+	var sensors []*sensor
 
 	for i := 0; i < len(homeInfos); i++ {
 		homeInfos[i] = NewSmartHome(i, int(d.SmartHomeOffset), d.Start)
-		measNum += int64(homeInfos[i].NumMeasurements())
+		sensors = append(sensors, homeInfos[i].sensors()...)
 	}
 
 	epochs := d.End.Sub(d.Start).Nanoseconds() / EpochDuration.Nanoseconds()
-	maxPoints := epochs * measNum
+	maxPoints := epochs * int64(len(sensors))
 	dg := &IotSimulator{
 		madePoints: 0,
 		madeValues: 0,
 		maxPoints:  maxPoints,
 
-		currentHomeIndex: 0,
-		homes:            homeInfos,
+		homes:   homeInfos,
+		sensors: sensors,
 
 		timestampNow:   d.Start,
 		timestampStart: d.Start,
 		timestampEnd:   d.End,
 	}
 
+	err := dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 	return dg
 }
 
+// sensor 一个家庭中的一个传感器，每个周期产生一个point
+type sensor struct {
+	sync.Mutex // 多协程下同一个传感器的Tick和ToPoint需要串行
+	homeId     []byte
+	roomId     []byte // 不属于房间的传感器为nil
+	measure    SimulatedMeasurement
+}
+
+// ticker 传感器的状态随时间变化，例如配置变更、门窗开关
+type ticker interface {
+	Tick(time.Duration)
+}
+
 // A IotSimulator generates data similar to telemetry from Telegraf.
 // It fulfills the Simulator interface.
 type IotSimulator struct {
@@ -52,17 +75,24 @@ type IotSimulator struct {
 	maxPoints     int64
 	madeValues    int64
 	skippedPoints int64
+	madeSql       int64
+	writtenPoints int64
 
-	currentHomeIndex int
-	homes            []*SmartHome
+	homes   []*SmartHome
+	sensors []*sensor
 
 	timestampNow   time.Time
 	timestampStart time.Time
 	timestampEnd   time.Time
+	sqlTemplates   []*SqlTemplate
 }
 
 func (g *IotSimulator) SeenPoints() int64 {
-	return g.madePoints
+	madePoints := atomic.LoadInt64(&g.madePoints)
+	if madePoints > g.maxPoints {
+		madePoints = g.maxPoints
+	}
+	return madePoints - atomic.LoadInt64(&g.skippedPoints)
 }
 
 func (g *IotSimulator) SeenValues() int64 {
@@ -74,61 +104,95 @@ func (g *IotSimulator) Total() int64 {
 }
 
 func (g *IotSimulator) Finished() bool {
-	return (g.madePoints + g.skippedPoints) >= g.maxPoints
+	return atomic.LoadInt64(&g.madePoints) >= g.maxPoints
 }
 
 func (q *IotSimulator) ClearMadePointNum() {
 	atomic.StoreInt64(&q.madePoints, 0)
+	atomic.StoreInt64(&q.skippedPoints, 0)
 }
 
 // Next advances a Point to the next state in the generator.
+// 和devops一样按point的序号计算传感器和时间，所有传感器的一个周期结束后时间增加EpochDuration，
+// 状态没有变化的传感器（例如home_config）不产生point，直接使用下一个序号
 func (g *IotSimulator) Next(p *Point) int64 {
 	for {
-		//find home which has not send measurement
-		homeFound := false
-		homesSeen := 0
-		for homesSeen < len(g.homes) {
-			if g.currentHomeIndex == len(g.homes) {
-				g.currentHomeIndex = 0
-			}
-			if g.homes[g.currentHomeIndex].HasMoreMeasurements() {
-				homeFound = true
-				break
-			}
-			g.currentHomeIndex++
-			homesSeen++
+		madePoint := atomic.AddInt64(&g.madePoints, 1)
+		if madePoint > g.maxPoints {
+			return madePoint
 		}
+		pointIndex := madePoint - 1
+		s := g.sensors[pointIndex%int64(len(g.sensors))]
+		timestamp := g.timestampStart.Add(EpochDuration * time.Duration(pointIndex/int64(len(g.sensors))))
 
-		if !homeFound {
-			for i := 0; i < len(g.homes); i++ {
-				// g.homes[i].TickAll(EpochDuration)
-				g.homes[i].ResetMeasurementCounter()
-			}
-			g.currentHomeIndex = 0
+		if s.roomId != nil {
+			p.AppendTag(RoomTagKey, s.roomId)
 		}
-		sm := g.homes[g.currentHomeIndex].NextMeasurement(p)
-		if sm == nil {
-			panic(fmt.Sprintf("Null point: home %d, room: %d, home measurement: %d", g.currentHomeIndex, g.homes[g.currentHomeIndex].currentRoomIndex, g.homes[g.currentHomeIndex].currentMeasurement))
+		p.AppendTag(SensorHomeTagKeys[1], s.homeId)
+		s.Lock()
+		if t, ok := s.measure.(ticker); ok && pointIndex >= int64(len(g.sensors)) {
+			t.Tick(EpochDuration)
 		}
-		g.currentHomeIndex++
-
-		if !sm.ToPoint(p) {
+		ok := s.measure.ToPoint(p)
+		s.Unlock()
+		if !ok {
 			p.Reset()
-			g.skippedPoints++
+			atomic.AddInt64(&g.skippedPoints, 1)
 			continue
 		}
-		g.madePoints++
-		g.madeValues += int64(len(p.FieldValues))
-		break
+		// 传感器内部的时间戳在多协程下不准确，统一使用序号计算的时间
+		p.SetTimestamp(&timestamp)
+		atomic.AddInt64(&g.madeValues, int64(len(p.FieldValues)))
+		return madePoint
 	}
-	return g.madePoints
 }
 
-func (g *IotSimulator) NextSql(wr io.Writer) int64 {
-	return 0
-}
 func (g *IotSimulator) SetWrittenPoints(num int64) {
+	if num > g.writtenPoints {
+		atomic.StoreInt64(&g.writtenPoints, num)
+	}
 }
+
 func (g *IotSimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	g.sqlTemplates = templates
 	return nil
 }
+
+func (g *IotSimulator) NextSql(wr io.Writer) int64 {
+	madeSql := atomic.AddInt64(&g.madeSql, 1)
+	tmp := g.sqlTemplates[madeSql%int64(len(g.sqlTemplates))]
+
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	randomHomeIndex := rand.Intn(len(g.homes))
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				home := g.homes[(randomHomeIndex+k)%len(g.homes)]
+				key := tmp.KeyWords[i]
+				switch key {
+				case string(SensorHomeTagKeys[1]):
+					wr.Write(home.HomeId)
+				case string(RoomTagKey):
+					wr.Write(home.Rooms[rand.Intn(len(home.Rooms))].RoomId)
+				default:
+					currentTimeInDB := g.timestampStart.Add(EpochDuration * time.Duration(atomic.LoadInt64(&g.writtenPoints)/int64(len(g.sensors))))
+					WriteTimeKeyword(wr, key, g.timestampStart, g.timestampEnd, currentTimeInDB)
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
+}
@@ -0,0 +1,51 @@
+package iot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+func TestIotSimulatorConcurrentNext(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &IotSimulatorConfig{
+		Start:          start,
+		End:            start.Add(EpochDuration * 10),
+		SmartHomeCount: 3,
+	}
+	sim := cfg.ToSimulator()
+
+	var mu sync.Mutex
+	perTimestamp := make(map[int64]int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := common.MakeUsablePoint()
+			for sim.Next(p) <= sim.Total() {
+				mu.Lock()
+				perTimestamp[p.Timestamp.UnixNano()]++
+				mu.Unlock()
+				p.Reset()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(perTimestamp) != 10 {
+		t.Fatalf("expected 10 timestamps, got %d", len(perTimestamp))
+	}
+	total := 0
+	for ts, n := range perTimestamp {
+		if n > len(sim.sensors) || (ts-start.UnixNano())%int64(EpochDuration) != 0 {
+			t.Fatalf("unexpected %d points at %d", n, ts)
+		}
+		total += n
+	}
+	if int64(total) != sim.SeenPoints() {
+		t.Fatalf("generated %d points, SeenPoints %d", total, sim.SeenPoints())
+	}
+}
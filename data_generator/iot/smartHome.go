@@ -25,7 +25,6 @@ var (
 type room struct {
 	RoomId                []byte
 	SimulatedMeasurements []SimulatedMeasurement
-	currentMeasurement    int
 }
 
 // Type Host models a machine being monitored by Telegraf.
@@ -38,10 +37,6 @@ type SmartHome struct {
 	measurementsNum int
 	//last generated room id
 	lastRoomId int64
-	//point generation variables
-	currentRoomIndex       int
-	currentMeasurement     int
-	totalMeasurementsGiven int
 }
 
 var LastSensorId = 0
@@ -59,31 +54,6 @@ func NewSmartHome(id int, offset int, start time.Time) *SmartHome {
 	return h
 }
 
-// TickAll advances all Distributions of a Host.
-func (r *room) TickAll(d time.Duration) {
-	// for _, m := range r.SimulatedMeasurements {
-	// m.Tick(d)
-	// }
-}
-
-func (r *room) ResetMeasurementCounter() {
-	r.currentMeasurement = 0
-}
-
-func (r *room) HasMoreMeasurements() bool {
-	return r.currentMeasurement < len(r.SimulatedMeasurements)
-}
-
-func (r *room) NextMeasurement(p *Point) SimulatedMeasurement {
-	if !r.HasMoreMeasurements() {
-		return nil
-	}
-	p.AppendTag(RoomTagKey, r.RoomId)
-	sm := r.SimulatedMeasurements[r.currentMeasurement]
-	r.currentMeasurement++
-	return sm
-}
-
 func (h *SmartHome) NumMeasurements() int {
 	if h.measurementsNum == 0 {
 		for _, room := range h.Rooms {
@@ -133,43 +103,16 @@ func (h *SmartHome) NewSmartHomeMeasurements(start time.Time) {
 	}
 }
 
-// TickAll advances all Distributions of a Host.
-
-func (h *SmartHome) ResetMeasurementCounter() {
-	h.totalMeasurementsGiven = 0
-	h.currentMeasurement = 0
-	h.currentRoomIndex = 0
+// sensors 按房间、家庭的顺序展开所有传感器
+func (h *SmartHome) sensors() []*sensor {
+	sensors := make([]*sensor, 0, h.NumMeasurements())
 	for _, room := range h.Rooms {
-		room.ResetMeasurementCounter()
-	}
-}
-
-func (h *SmartHome) HasMoreMeasurements() bool {
-	return h.totalMeasurementsGiven < h.NumMeasurements()
-}
-
-func (h *SmartHome) NextMeasurement(p *Point) SimulatedMeasurement {
-	var sm SimulatedMeasurement
-	if !h.HasMoreMeasurements() {
-		return nil
-	}
-	for h.currentRoomIndex < len(h.Rooms) {
-		r := h.Rooms[h.currentRoomIndex]
-		if r.HasMoreMeasurements() {
-			sm = r.NextMeasurement(p)
-			break
-		} else {
-			h.currentRoomIndex++
+		for _, sm := range room.SimulatedMeasurements {
+			sensors = append(sensors, &sensor{homeId: h.HomeId, roomId: room.RoomId, measure: sm})
 		}
-
-	}
-	if h.currentRoomIndex == len(h.Rooms) {
-		sm = h.SimulatedMeasurements[h.currentMeasurement]
-		h.currentMeasurement++
 	}
-	if sm != nil {
-		p.AppendTag(SensorHomeTagKeys[1], h.HomeId)
-		h.totalMeasurementsGiven++
+	for _, sm := range h.SimulatedMeasurements {
+		sensors = append(sensors, &sensor{homeId: h.HomeId, measure: sm})
 	}
-	return sm
+	return sensors
 }
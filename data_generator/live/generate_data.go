@@ -19,6 +19,7 @@ type LiveChargeSimulatorConfig struct {
 	DeviceCount      int64
 	DeviceOffset     int64
 	SqlTemplates     []string
+	Timing           *common.TimingConfig // 模拟不规则的时间戳，为nil时按SamplingInterval对齐
 }
 
 func (d *LiveChargeSimulatorConfig) ToSimulator() *LiveChargeSimulator {
@@ -43,6 +44,7 @@ func (d *LiveChargeSimulatorConfig) ToSimulator() *LiveChargeSimulator {
 		SamplingInterval: d.SamplingInterval,
 		TimestampStart:   d.Start,
 		TimestampEnd:     d.End,
+		timing:           common.NewTiming(d.Timing, d.Start, d.SamplingInterval),
 	}
 
 	err := dg.SetSqlTemplate(d.SqlTemplates)
@@ -66,6 +68,7 @@ type LiveChargeSimulator struct {
 	TimestampStart   time.Time
 	TimestampEnd     time.Time
 	sqlTemplates     []*common.SqlTemplate
+	timing           *common.Timing
 }
 
 func (s *LiveChargeSimulator) SeenPoints() int64 {
@@ -117,7 +120,7 @@ func (s *LiveChargeSimulator) Next(p *common.Point) int64 {
 	Charge := &s.Hosts[hostIndex]
 	// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
 	// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
-	timestamp := s.TimestampStart.Add(s.SamplingInterval * time.Duration(pointIndex/int64(len(s.Hosts))))
+	timestamp := s.timing.Timestamp(hostIndex, pointIndex/int64(len(s.Hosts)))
 	p.SetTimestamp(&timestamp)
 
 	// Populate host-specific tags: for example, LSVNV2182E2100001
@@ -159,18 +162,12 @@ func (s *LiveChargeSimulator) NextSql(wr io.Writer) int64 {
 					wr.Write(Airq.TagValues[2])
 				case string(ChargeTagKeys[3]):
 					wr.Write(Airq.TagValues[3])
-				case string(ChargeTagKeys[4]):
-					wr.Write(Airq.TagValues[4])
-				case "start":
-					wr.Write([]byte(s.TimestampStart.Format(time.RFC3339)))
-				case "end":
-					wr.Write([]byte(s.TimestampEnd.Format(time.RFC3339)))
-				case "now":
+				default:
 					currentTimeInDB := s.TimestampStart.Add(s.SamplingInterval * time.Duration(s.writtenPoints/int64(len(s.Hosts))))
-					wr.Write([]byte(currentTimeInDB.Format(time.RFC3339)))
+					common.WriteTimeKeyword(wr, key, s.TimestampStart, s.TimestampEnd, currentTimeInDB)
 				}
 				if k < repeat-1 {
-					wr.Write([]byte("','"))
+					wr.Write(tmp.KeySep[i])
 				}
 			}
 		}
@@ -3,6 +3,7 @@ package metaqueries
 import (
 	"fmt"
 	"io"
+	"log"
 	"sync/atomic"
 	"time"
 
@@ -26,10 +27,14 @@ type MetaquerySimulatorConfig struct {
 	Start time.Time
 	End   time.Time
 
-	ScaleFactor int
+	ScaleFactor  int
+	SqlTemplates []string
 }
 
 func (d *MetaquerySimulatorConfig) ToSimulator() *MetaquerySimulator {
+	if d.ScaleFactor <= 0 {
+		log.Fatal("the scale factor is unavailable")
+	}
 	dg := &MetaquerySimulator{
 		madePoints: 0,
 		madeValues: 0,
@@ -54,14 +59,20 @@ func (d *MetaquerySimulatorConfig) ToSimulator() *MetaquerySimulator {
 	// the generated data being spread evenly across the provided time range.
 	dg.stepTime = time.Duration(int64(dg.timestampEnd.Sub(dg.timestampStart)) / dg.maxPoints)
 
+	err := dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 	return dg
 }
 
 // MetaquerySimulator fullfills the Simulator interface.
 type MetaquerySimulator struct {
-	madePoints int64
-	maxPoints  int64
-	madeValues int64
+	madePoints    int64
+	maxPoints     int64
+	madeValues    int64
+	madeSql       int64
+	writtenPoints int64
 
 	axis    int
 	TagList map[int][]byte
@@ -70,6 +81,7 @@ type MetaquerySimulator struct {
 	timestampStart time.Time
 	timestampEnd   time.Time
 	stepTime       time.Duration
+	sqlTemplates   []*common.SqlTemplate
 }
 
 func (g *MetaquerySimulator) SeenPoints() int64 {
@@ -85,7 +97,7 @@ func (g *MetaquerySimulator) Total() int64 {
 }
 
 func (g *MetaquerySimulator) Finished() bool {
-	return g.madePoints >= g.maxPoints
+	return atomic.LoadInt64(&g.madePoints) >= g.maxPoints
 }
 
 func (q *MetaquerySimulator) ClearMadePointNum() {
@@ -94,8 +106,11 @@ func (q *MetaquerySimulator) ClearMadePointNum() {
 
 // Next advances a Point to the next state in the generator.
 func (g *MetaquerySimulator) Next(p *common.Point) int64 {
+	madePoint := atomic.AddInt64(&g.madePoints, 1)
+	// 为了多协程下时间不混乱，按序号计算时间
+	timestamp := g.timestampStart.Add(g.stepTime * time.Duration(madePoint-1))
 	p.SetMeasurementName(measKey)
-	p.SetTimestamp(&g.timestampNow)
+	p.SetTimestamp(&timestamp)
 
 	// Tag values are populated based on a pseudo-random selection from the list
 	// of created tags. On a sufficiently large dataset, this will result in each
@@ -108,19 +123,53 @@ func (g *MetaquerySimulator) Next(p *common.Point) int64 {
 
 	p.AppendField(valKey, rand.Float64())
 
-	g.madePoints++
-	g.madeValues++
-	g.timestampNow = g.timestampNow.Add(g.stepTime)
-	return g.madePoints
+	atomic.AddInt64(&g.madeValues, 1)
+	return madePoint
 }
 
 func (g *MetaquerySimulator) NextSql(wr io.Writer) int64 {
-	return 0
+	madeSql := atomic.AddInt64(&g.madeSql, 1)
+	tmp := g.sqlTemplates[madeSql%int64(len(g.sqlTemplates))]
+
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	randomTagIndex := rand.Intn(g.axis)
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				key := tmp.KeyWords[i]
+				switch key {
+				case "x", "y":
+					wr.Write(g.TagList[(randomTagIndex+k)%g.axis])
+				default:
+					currentTimeInDB := g.timestampStart.Add(g.stepTime * time.Duration(atomic.LoadInt64(&g.writtenPoints)))
+					common.WriteTimeKeyword(wr, key, g.timestampStart, g.timestampEnd, currentTimeInDB)
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
 }
 
 func (g *MetaquerySimulator) SetWrittenPoints(num int64) {
+	if num > g.writtenPoints {
+		atomic.StoreInt64(&g.writtenPoints, num)
+	}
 }
 
 func (g *MetaquerySimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*common.SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := common.NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	g.sqlTemplates = templates
 	return nil
 }
@@ -0,0 +1,485 @@
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	protocol "github.com/influxdata/line-protocol"
+)
+
+// 查询模板中的关键字，其他关键字使用数据中的tag名称
+const (
+	measurementKeyword = "measurement" // measurement名称
+	tagKeyKeyword      = "tag_key"     // --replay-tag指定的tag名称
+	tagKeyword         = "tag"         // --replay-tag指定的tag的取值，包含复制出的设备
+)
+
+// Type ReplaySimulatorConfig is used to create a ReplaySimulator.
+type ReplaySimulatorConfig struct {
+	Start            time.Time
+	End              time.Time
+	SamplingInterval time.Duration
+
+	Path   string // 行协议文件(包括data-gen的输出，.gz结尾时先解压)或者带表头的csv文件
+	Tag    string // 复制设备时改写的tag，为空时使用数据中的第一个tag
+	Copies int64  // 每条数据复制为多少个设备，第i(i>0)份数据的tag值加上后缀_i
+
+	SqlTemplates []string
+}
+
+type field struct {
+	key   []byte
+	value interface{} // int64使用AppendInt64Field写入，其他类型使用AppendField
+}
+
+// record 数据文件中的一个point
+type record struct {
+	offset      time.Duration // 相对于数据中最早时间戳的偏移
+	measurement *measurement
+	tagKeys     [][]byte
+	tagValues   [][]byte
+	tagIndex    int      // 复制设备时改写的tag在tagValues中的位置，-1表示没有该tag
+	copies      [][]byte // 改写的tag每一份数据的取值
+	fields      []field
+}
+
+type measurement struct {
+	name      []byte
+	tagValues map[string][][]byte // 每个tag的所有取值，包含复制出的设备，用于生成查询，key为小写的tag名称
+	seen      map[string]bool
+}
+
+func (m *measurement) addTagValue(key string, value []byte) {
+	// 查询模板中的关键字都会转成小写，tag名称也按小写保存
+	key = strings.ToLower(key)
+	if !m.seen[key+"="+string(value)] {
+		m.seen[key+"="+string(value)] = true
+		m.tagValues[key] = append(m.tagValues[key], value)
+	}
+}
+
+func (d *ReplaySimulatorConfig) ToSimulator() *ReplaySimulator {
+	if d.SamplingInterval <= 0 {
+		log.Fatal("the sampling interval is unavailable")
+	}
+	if d.Copies < 1 {
+		log.Fatal("the replay copies must be positive")
+	}
+	dg := &ReplaySimulator{
+		tag:              d.Tag,
+		copies:           d.Copies,
+		samplingInterval: d.SamplingInterval,
+		timestampStart:   d.Start,
+		timestampEnd:     d.End,
+	}
+	err := dg.load(d.Path)
+	if err != nil {
+		log.Fatalf("load replay data %s error: %v", d.Path, err)
+	}
+
+	// 数据循环写入，每一轮的时长为数据的时间跨度加上一个采样间隔，最后一轮只写入--timestamp-end之前的部分
+	last := dg.records[len(dg.records)-1].offset
+	dg.loopDuration = last + d.SamplingInterval
+	span := d.End.Sub(d.Start)
+	if span > 0 {
+		loops := int64(span / dg.loopDuration)
+		remain := span - dg.loopDuration*time.Duration(loops)
+		partial := sort.Search(len(dg.records), func(i int) bool { return dg.records[i].offset >= remain })
+		dg.maxPoints = (loops*int64(len(dg.records)) + int64(partial)) * d.Copies
+	}
+
+	err = dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	return dg
+}
+
+// A ReplaySimulator replays recorded points shifted to the configured time range.
+// It fulfills the Simulator interface.
+type ReplaySimulator struct {
+	madePoints    int64
+	maxPoints     int64
+	madeValues    int64
+	madeSql       int64
+	writtenPoints int64
+
+	records      []record // 按时间戳排序
+	measurements []*measurement
+	tag          string
+	copies       int64
+	loopDuration time.Duration
+
+	samplingInterval time.Duration
+	timestampStart   time.Time
+	timestampEnd     time.Time
+	sqlTemplates     []*common.SqlTemplate
+}
+
+// load 读取数据文件，按时间戳排序，并生成每个point复制出的tag值
+func (s *ReplaySimulator) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	name := filepath.Base(path)
+	if strings.HasSuffix(name, ".gz") {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	type timedRecord struct {
+		ts time.Time
+		record
+	}
+	var records []timedRecord
+	measurements := make(map[string]*measurement)
+	add := func(ts time.Time, name string, tagKeys []string, tagValues []string, fields []field) {
+		m, ok := measurements[name]
+		if !ok {
+			m = &measurement{name: []byte(name), tagValues: make(map[string][][]byte), seen: make(map[string]bool)}
+			measurements[name] = m
+			s.measurements = append(s.measurements, m)
+		}
+		rec := record{measurement: m, tagIndex: -1, fields: fields}
+		for i := range tagKeys {
+			rec.tagKeys = append(rec.tagKeys, []byte(tagKeys[i]))
+			rec.tagValues = append(rec.tagValues, []byte(tagValues[i]))
+		}
+		records = append(records, timedRecord{ts: ts, record: rec})
+	}
+
+	if strings.HasSuffix(name, ".csv") {
+		err = readCsv(r, strings.TrimSuffix(name, ".csv"), add)
+	} else {
+		err = readLineProtocol(r, add)
+	}
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no points")
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].ts.Before(records[j].ts) })
+	if s.tag == "" && len(records[0].tagKeys) > 0 {
+		s.tag = string(records[0].tagKeys[0])
+	}
+	copyValues := make(map[string][][]byte)
+	s.records = make([]record, len(records))
+	for i := range records {
+		rec := records[i].record
+		rec.offset = records[i].ts.Sub(records[0].ts)
+		for j, key := range rec.tagKeys {
+			if string(key) != s.tag {
+				rec.measurement.addTagValue(string(key), rec.tagValues[j])
+				continue
+			}
+			rec.tagIndex = j
+			value := string(rec.tagValues[j])
+			copies, ok := copyValues[string(rec.measurement.name)+"\x00"+value]
+			if !ok {
+				copies = make([][]byte, s.copies)
+				copies[0] = rec.tagValues[j]
+				for c := int64(1); c < s.copies; c++ {
+					copies[c] = []byte(value + "_" + strconv.FormatInt(c, 10))
+				}
+				copyValues[string(rec.measurement.name)+"\x00"+value] = copies
+				for _, v := range copies {
+					rec.measurement.addTagValue(s.tag, v)
+				}
+			}
+			rec.copies = copies
+		}
+		if s.copies > 1 && rec.tagIndex < 0 {
+			return fmt.Errorf("the point of %s at %s has no tag '%s' to make copies", rec.measurement.name, records[i].ts.Format(time.RFC3339Nano), s.tag)
+		}
+		s.records[i] = rec
+	}
+	for _, m := range s.measurements {
+		m.seen = nil
+	}
+	return nil
+}
+
+// readLineProtocol 读取行协议，时间戳精度为ns，没有时间戳的行使用当前时间
+func readLineProtocol(r io.Reader, add func(time.Time, string, []string, []string, []field)) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	metrics, err := protocol.NewParser(protocol.NewMetricHandler()).Parse(body)
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		var tagKeys, tagValues []string
+		for _, tag := range m.TagList() {
+			tagKeys = append(tagKeys, tag.Key)
+			tagValues = append(tagValues, tag.Value)
+		}
+		var fields []field
+		for _, f := range m.FieldList() {
+			value := f.Value
+			if v, ok := value.(uint64); ok {
+				if v > math.MaxInt64 {
+					value = float64(v)
+				} else {
+					value = int64(v)
+				}
+			}
+			fields = append(fields, field{key: []byte(f.Key), value: value})
+		}
+		add(m.Time(), m.Name(), tagKeys, tagValues, fields)
+	}
+	return nil
+}
+
+// readCsv 读取带表头的csv，表头中time列为RFC3339时间或者unix纳秒，measurement列可选(默认使用文件名)，
+// tag:<name>为tag列，其他列为field，可以用<name>:float|int|string|bool指定类型(默认float)，空值表示缺失该字段
+func readCsv(r io.Reader, defaultName string, add func(time.Time, string, []string, []string, []field)) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	timeColumn, measurementColumn := -1, -1
+	var tagColumns, fieldColumns []int
+	var tagKeys, fieldTypes []string
+	var fieldKeys [][]byte
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		switch {
+		case column == "time":
+			timeColumn = i
+		case column == "measurement":
+			measurementColumn = i
+		case strings.HasPrefix(column, "tag:"):
+			tagColumns = append(tagColumns, i)
+			tagKeys = append(tagKeys, strings.TrimPrefix(column, "tag:"))
+		default:
+			name, typ := column, "float"
+			if n := strings.LastIndex(column, ":"); n >= 0 {
+				name, typ = column[:n], column[n+1:]
+			}
+			switch typ {
+			case "float", "int", "string", "bool":
+			default:
+				return fmt.Errorf("unsupported type %s of column %s", typ, name)
+			}
+			fieldColumns = append(fieldColumns, i)
+			fieldKeys = append(fieldKeys, []byte(name))
+			fieldTypes = append(fieldTypes, typ)
+		}
+	}
+	if timeColumn < 0 {
+		return fmt.Errorf("the header has no time column")
+	}
+	if len(fieldColumns) == 0 {
+		return fmt.Errorf("the header has no field column")
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ts, err := parseTime(row[timeColumn])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		name := defaultName
+		if measurementColumn >= 0 {
+			name = row[measurementColumn]
+		}
+		tagValues := make([]string, len(tagColumns))
+		for i, c := range tagColumns {
+			tagValues[i] = row[c]
+		}
+		var fields []field
+		for i, c := range fieldColumns {
+			if row[c] == "" {
+				continue
+			}
+			value, err := parseValue(row[c], fieldTypes[i])
+			if err != nil {
+				return fmt.Errorf("line %d column %s: %v", line, fieldKeys[i], err)
+			}
+			fields = append(fields, field{key: fieldKeys[i], value: value})
+		}
+		// 所有字段都缺失时跳过该行
+		if len(fields) > 0 {
+			add(ts, name, tagKeys, tagValues, fields)
+		}
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if ns, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ns).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func parseValue(s, typ string) (interface{}, error) {
+	switch typ {
+	case "int":
+		return strconv.ParseInt(s, 10, 64)
+	case "string":
+		return s, nil
+	case "bool":
+		return strconv.ParseBool(s)
+	default:
+		return strconv.ParseFloat(s, 64)
+	}
+}
+
+func (s *ReplaySimulator) SeenPoints() int64 {
+	madePoints := atomic.LoadInt64(&s.madePoints)
+	if madePoints > s.maxPoints {
+		madePoints = s.maxPoints
+	}
+	return madePoints
+}
+
+func (s *ReplaySimulator) SeenValues() int64 {
+	return atomic.LoadInt64(&s.madeValues)
+}
+
+func (s *ReplaySimulator) Total() int64 {
+	return s.maxPoints
+}
+
+func (s *ReplaySimulator) Finished() bool {
+	return atomic.LoadInt64(&s.madePoints) >= s.maxPoints
+}
+
+func (s *ReplaySimulator) ClearMadePointNum() {
+	atomic.StoreInt64(&s.madePoints, 0)
+}
+
+// Next advances a Point to the next state in the generator.
+// 按point的序号依次计算轮次、数据中的point和复制的份数，时间戳为--timestamp-start加上point在数据中的偏移和轮次的时长，
+// 超过Total之后继续循环，mixed测试中持续写入--timestamp-prepare之后的数据
+func (s *ReplaySimulator) Next(p *common.Point) int64 {
+	madePoint := atomic.AddInt64(&s.madePoints, 1)
+	pointIndex := madePoint - 1
+	perLoop := int64(len(s.records)) * s.copies
+	loop := pointIndex / perLoop
+	rec := &s.records[pointIndex%perLoop/s.copies]
+	copyIndex := pointIndex % s.copies
+
+	timestamp := s.timestampStart.Add(s.loopDuration*time.Duration(loop) + rec.offset)
+	p.SetTimestamp(&timestamp)
+	p.SetMeasurementName(rec.measurement.name)
+	for i := range rec.tagKeys {
+		if i == rec.tagIndex {
+			p.AppendTag(rec.tagKeys[i], rec.copies[copyIndex])
+		} else {
+			p.AppendTag(rec.tagKeys[i], rec.tagValues[i])
+		}
+	}
+	for i := range rec.fields {
+		if v, ok := rec.fields[i].value.(int64); ok {
+			p.AppendInt64Field(rec.fields[i].key, v)
+		} else {
+			p.AppendField(rec.fields[i].key, rec.fields[i].value)
+		}
+	}
+	atomic.AddInt64(&s.madeValues, int64(len(rec.fields)))
+	return madePoint
+}
+
+func (s *ReplaySimulator) SetWrittenPoints(num int64) {
+	if num > s.writtenPoints {
+		atomic.StoreInt64(&s.writtenPoints, num)
+	}
+}
+
+func (s *ReplaySimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*common.SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := common.NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	s.sqlTemplates = templates
+	return nil
+}
+
+// currentTime 已经写入的最新point的时间戳
+func (s *ReplaySimulator) currentTime() time.Time {
+	written := atomic.LoadInt64(&s.writtenPoints)
+	if written < 1 {
+		return s.timestampStart
+	}
+	if written > s.maxPoints {
+		written = s.maxPoints
+	}
+	pointIndex := written - 1
+	perLoop := int64(len(s.records)) * s.copies
+	return s.timestampStart.Add(s.loopDuration*time.Duration(pointIndex/perLoop) + s.records[pointIndex%perLoop/s.copies].offset)
+}
+
+// NextSql 查询模板中的关键字可以使用{measurement}、{tag_key}、{tag}和数据中的tag名称，例如{hostname}，
+// 同一条查询中的measurement和tag取值来自同一个measurement
+func (s *ReplaySimulator) NextSql(wr io.Writer) int64 {
+	madeSql := atomic.AddInt64(&s.madeSql, 1)
+	tmp := s.sqlTemplates[madeSql%int64(len(s.sqlTemplates))]
+
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	m := s.measurements[rand.Intn(len(s.measurements))]
+	randomIndex := rand.Int()
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				key := tmp.KeyWords[i]
+				if key == tagKeyword {
+					key = strings.ToLower(s.tag)
+				}
+				if key == measurementKeyword {
+					wr.Write(m.name)
+				} else if key == tagKeyKeyword {
+					wr.Write([]byte(s.tag))
+				} else if values, ok := m.tagValues[key]; ok {
+					wr.Write(values[(randomIndex+k)%len(values)])
+				} else {
+					common.WriteTimeKeyword(wr, tmp.KeyWords[i], s.timestampStart, s.timestampEnd, s.currentTime())
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
+}
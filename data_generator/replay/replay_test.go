@@ -0,0 +1,122 @@
+package replay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+const testLines = `cpu,host=h1,region=east usage=0.5,count=3i,msg="ok" 1000000000
+cpu,host=h2,region=east usage=0.7,count=4i 1000000000
+cpu,host=h1,region=east usage=0.6,count=5i,up=true 3000000000
+cpu,host=h2,region=east usage=0.8,count=6i 2000000000
+`
+
+const testCsv = `time,tag:site,pm25,aqi:int,tips:string
+2021-01-01T00:00:00Z,s1,12.5,40,good
+2021-01-01T00:00:10Z,s1,,41,
+2021-01-01T00:00:10Z,s2,13,,bad
+2021-01-01T00:00:20Z,s2,,,
+`
+
+func newTestSimulator(t *testing.T, name, data string, copies int64, end time.Duration, templates ...string) *ReplaySimulator {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &ReplaySimulatorConfig{
+		Start:            start,
+		End:              start.Add(end),
+		SamplingInterval: time.Second,
+		Path:             path,
+		Copies:           copies,
+		SqlTemplates:     templates,
+	}
+	return cfg.ToSimulator()
+}
+
+func TestReplayLineProtocol(t *testing.T) {
+	// 数据跨度2s，每轮3s，7s内完整回放2轮，第3轮只有时间偏移小于1s的2个point
+	sim := newTestSimulator(t, "data.txt", testLines, 3, 7*time.Second,
+		"select * from {measurement} where {tag_key} in ('{tag*3}') and region = '{region}' and time > '{now}'-1m")
+	if sim.Total() != (2*4+2)*3 {
+		t.Fatalf("unexpected total %d", sim.Total())
+	}
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	hosts := make(map[string]int)
+	var prev time.Time
+	p := common.MakeUsablePoint()
+	for sim.Next(p) <= sim.Total() {
+		if p.Timestamp.Before(prev) || !p.Timestamp.Before(start.Add(7*time.Second)) {
+			t.Fatalf("unexpected timestamp %s after %s", p.Timestamp, prev)
+		}
+		prev = *p.Timestamp
+		if string(p.MeasurementName) != "cpu" || string(p.TagKeys[0]) != "host" || string(p.TagValues[1]) != "east" {
+			t.Fatalf("unexpected point %s %s", p.MeasurementName, p.TagValues)
+		}
+		if len(p.Int64FiledValues) != 1 || len(p.FieldValues) < 1 {
+			t.Fatalf("unexpected fields %s %v", p.FieldKeys, p.FieldValues)
+		}
+		hosts[string(p.TagValues[0])]++
+		p.Reset()
+	}
+	if len(hosts) != 6 || hosts["h1"] != hosts["h2_2"] {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if sim.SeenPoints() != sim.Total() {
+		t.Fatalf("seen %d points of %d", sim.SeenPoints(), sim.Total())
+	}
+
+	sim.SetWrittenPoints(sim.Total())
+	var buf bytes.Buffer
+	sim.NextSql(&buf)
+	sql := buf.String()
+	if !strings.HasPrefix(sql, "select * from cpu where host in ('h") || !strings.Contains(sql, "region = 'east'") ||
+		!strings.Contains(sql, "'2018-01-01T00:00:06Z'-1m") {
+		t.Fatalf("unexpected sql %s", sql)
+	}
+}
+
+func TestReplayCsv(t *testing.T) {
+	sim := newTestSimulator(t, "airq.csv", testCsv, 1, time.Hour)
+	// 最后一行所有字段都缺失，每轮3个point，时长10s+1s，1h内回放327轮，最后一轮只有时间偏移小于3s的1个point
+	if sim.Total() != 327*3+1 {
+		t.Fatalf("unexpected total %d", sim.Total())
+	}
+	p := common.MakeUsablePoint()
+	var values int
+	for i := 0; i < 3; i++ {
+		sim.Next(p)
+		if string(p.MeasurementName) != "airq" || string(p.TagKeys[0]) != "site" {
+			t.Fatalf("unexpected point %s %s", p.MeasurementName, p.TagKeys)
+		}
+		values += len(p.FieldValues) + len(p.Int64FiledValues)
+		p.Reset()
+	}
+	if values != 3+1+2 || sim.SeenValues() != int64(values) {
+		t.Fatalf("unexpected values %d, seen %d", values, sim.SeenValues())
+	}
+	sim.Next(p)
+	if !p.Timestamp.Equal(time.Date(2018, 1, 1, 0, 0, 11, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp of the second loop %s", p.Timestamp)
+	}
+}
+
+func TestReplayTagCase(t *testing.T) {
+	// 模板中的关键字会转成小写，tag名称中有大写字母时也要能匹配
+	sim := newTestSimulator(t, "data.txt", "vehicle,VIN=v1,siteId=s1 speed=1 1000000000\n", 2, time.Second,
+		"select * from {measurement} where {tag_key} = '{tag}' and siteId = '{siteId}'")
+	var buf bytes.Buffer
+	sim.NextSql(&buf)
+	if sql := buf.String(); !strings.HasPrefix(sql, "select * from vehicle where VIN = 'v1") || !strings.HasSuffix(sql, "siteId = 's1'") {
+		t.Fatalf("unexpected sql %s", sql)
+	}
+}
@@ -0,0 +1,309 @@
+package schema
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+// DefaultSample 配置文件中没有指定sample时保留的series比例
+const DefaultSample = 0.5
+
+// measurementKeyword 查询模板中代表measurement名称的关键字，其他关键字使用tag名称
+const measurementKeyword = "measurement"
+
+// Type SchemaSimulatorConfig is used to create a SchemaSimulator.
+type SchemaSimulatorConfig struct {
+	Start            time.Time
+	End              time.Time
+	SamplingInterval time.Duration
+
+	Schema       *common.ExternalConfig
+	SqlTemplates []string
+}
+
+type field struct {
+	key       []byte
+	count     int64 // 每个series最多生成的值的数量，0表示不限制
+	generator common.ValueGenerator
+}
+
+type measurement struct {
+	name     []byte
+	tagKeys  [][]byte
+	fields   []field
+	maxCount int64 // 所有field的count都大于0时，每个series最多生成的point数量
+}
+
+// series measurement中一组tag值的组合
+type series struct {
+	measurement *measurement
+	tagValues   [][]byte
+}
+
+func (d *SchemaSimulatorConfig) ToSimulator() *SchemaSimulator {
+	if d.Schema == nil || len(d.Schema.Measurements()) == 0 {
+		log.Fatal("the schema has no measurements")
+	}
+	if d.SamplingInterval <= 0 {
+		log.Fatal("the sampling interval is unavailable")
+	}
+
+	dg := &SchemaSimulator{
+		tagValues:        make(map[string][][]byte),
+		samplingInterval: d.SamplingInterval,
+		timestampStart:   d.Start,
+		timestampEnd:     d.End,
+	}
+	var maxCount int64
+	unlimited := false
+	seen := make(map[string]bool)
+	for _, m := range d.Schema.Measurements() {
+		meas, ss, err := newMeasurement(m)
+		if err != nil {
+			log.Fatalf("schema measurement '%s': %v", m.Name, err)
+		}
+		dg.measurements = append(dg.measurements, meas)
+		dg.series = append(dg.series, ss...)
+		for _, s := range ss {
+			for i, key := range meas.tagKeys {
+				if !seen[string(key)+"="+string(s.tagValues[i])] {
+					seen[string(key)+"="+string(s.tagValues[i])] = true
+					dg.tagValues[string(key)] = append(dg.tagValues[string(key)], s.tagValues[i])
+				}
+			}
+		}
+		if meas.maxCount == 0 {
+			unlimited = true
+		} else if meas.maxCount > maxCount {
+			maxCount = meas.maxCount
+		}
+	}
+
+	epochs := d.End.Sub(d.Start).Nanoseconds() / d.SamplingInterval.Nanoseconds()
+	// 所有field都指定了count时，超过count的时间范围不再有数据
+	if !unlimited && maxCount < epochs {
+		epochs = maxCount
+	}
+	dg.maxPoints = epochs * int64(len(dg.series))
+
+	err := dg.SetSqlTemplate(d.SqlTemplates)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	return dg
+}
+
+// newMeasurement 按tag的所有取值生成series的笛卡尔积，再按sample保留一部分series
+func newMeasurement(m common.Measurement) (*measurement, []series, error) {
+	if m.Name == "" {
+		return nil, nil, fmt.Errorf("the name is empty")
+	}
+	if len(m.Fields) == 0 {
+		return nil, nil, fmt.Errorf("no fields")
+	}
+	sample := float64(m.Sample)
+	if sample == 0 {
+		sample = DefaultSample
+	}
+	if sample < 0 || sample > 1 {
+		return nil, nil, fmt.Errorf("sample must be in (0, 1]")
+	}
+
+	meas := &measurement{name: []byte(m.Name)}
+	unlimited := false
+	for _, f := range m.Fields {
+		if f.Name == "" {
+			return nil, nil, fmt.Errorf("the field name is empty")
+		}
+		if f.Count < 0 {
+			return nil, nil, fmt.Errorf("field '%s': count must not be negative", f.Name)
+		}
+		g, err := common.NewValueGenerator(f.Source, m.Name+"/"+f.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("field '%s': %v", f.Name, err)
+		}
+		meas.fields = append(meas.fields, field{key: []byte(f.Name), count: int64(f.Count), generator: g})
+		if f.Count == 0 {
+			unlimited = true
+		} else if int64(f.Count) > meas.maxCount {
+			meas.maxCount = int64(f.Count)
+		}
+	}
+	if unlimited {
+		meas.maxCount = 0
+	}
+
+	combinations := [][][]byte{nil}
+	for _, tag := range m.Tags {
+		if tag.Name == "" {
+			return nil, nil, fmt.Errorf("the tag name is empty")
+		}
+		values, err := common.SourceValues(tag.Source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tag '%s': %v", tag.Name, err)
+		}
+		meas.tagKeys = append(meas.tagKeys, []byte(tag.Name))
+		next := make([][][]byte, 0, len(combinations)*len(values))
+		for _, c := range combinations {
+			for _, v := range values {
+				tagValues := make([][]byte, len(c), len(c)+1)
+				copy(tagValues, c)
+				next = append(next, append(tagValues, []byte(fmt.Sprint(v))))
+			}
+		}
+		combinations = next
+	}
+
+	// 按measurement名称固定随机数种子，同一个配置文件每次保留相同的series
+	h := fnv.New64a()
+	h.Write(meas.name)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	var ss []series
+	for _, c := range combinations {
+		if sample >= 1 || r.Float64() < sample {
+			ss = append(ss, series{measurement: meas, tagValues: c})
+		}
+	}
+	if len(ss) == 0 {
+		ss = append(ss, series{measurement: meas, tagValues: combinations[0]})
+	}
+	return meas, ss, nil
+}
+
+// A SchemaSimulator generates data described by a TOML schema file.
+// It fulfills the Simulator interface.
+type SchemaSimulator struct {
+	madePoints    int64
+	maxPoints     int64
+	madeValues    int64
+	skippedPoints int64
+	madeSql       int64
+	writtenPoints int64
+
+	measurements []*measurement
+	series       []series
+	tagValues    map[string][][]byte // 每个tag的所有取值，用于生成查询
+
+	samplingInterval time.Duration
+	timestampStart   time.Time
+	timestampEnd     time.Time
+	sqlTemplates     []*common.SqlTemplate
+}
+
+func (s *SchemaSimulator) SeenPoints() int64 {
+	madePoints := atomic.LoadInt64(&s.madePoints)
+	if madePoints > s.maxPoints {
+		madePoints = s.maxPoints
+	}
+	return madePoints - atomic.LoadInt64(&s.skippedPoints)
+}
+
+func (s *SchemaSimulator) SeenValues() int64 {
+	return atomic.LoadInt64(&s.madeValues)
+}
+
+func (s *SchemaSimulator) Total() int64 {
+	return s.maxPoints
+}
+
+func (s *SchemaSimulator) Finished() bool {
+	return atomic.LoadInt64(&s.madePoints) >= s.maxPoints
+}
+
+func (s *SchemaSimulator) ClearMadePointNum() {
+	atomic.StoreInt64(&s.madePoints, 0)
+	atomic.StoreInt64(&s.skippedPoints, 0)
+}
+
+// Next advances a Point to the next state in the generator.
+// 按point的序号计算series和时间，所有series的一个周期结束后时间增加SamplingInterval，
+// 超过measurement的count的周期不产生point，直接使用下一个序号
+func (s *SchemaSimulator) Next(p *common.Point) int64 {
+	for {
+		madePoint := atomic.AddInt64(&s.madePoints, 1)
+		if madePoint > s.maxPoints {
+			return madePoint
+		}
+		pointIndex := madePoint - 1
+		seriesIndex := pointIndex % int64(len(s.series))
+		epoch := pointIndex / int64(len(s.series))
+		ser := &s.series[seriesIndex]
+		m := ser.measurement
+		if m.maxCount > 0 && epoch >= m.maxCount {
+			atomic.AddInt64(&s.skippedPoints, 1)
+			continue
+		}
+
+		timestamp := s.timestampStart.Add(s.samplingInterval * time.Duration(epoch))
+		p.SetTimestamp(&timestamp)
+		p.SetMeasurementName(m.name)
+		for i := range m.tagKeys {
+			p.AppendTag(m.tagKeys[i], ser.tagValues[i])
+		}
+		for i := range m.fields {
+			f := &m.fields[i]
+			if f.count > 0 && epoch >= f.count {
+				continue
+			}
+			p.AppendField(f.key, f.generator.Value(seriesIndex, epoch))
+		}
+		atomic.AddInt64(&s.madeValues, int64(len(p.FieldValues)))
+		return madePoint
+	}
+}
+
+func (s *SchemaSimulator) SetWrittenPoints(num int64) {
+	if num > s.writtenPoints {
+		atomic.StoreInt64(&s.writtenPoints, num)
+	}
+}
+
+func (s *SchemaSimulator) SetSqlTemplate(sqlTemplates []string) error {
+	templates := make([]*common.SqlTemplate, len(sqlTemplates))
+	for i := range sqlTemplates {
+		temp, err := common.NewSqlTemplate(sqlTemplates[i])
+		if err != nil {
+			return err
+		}
+		templates[i] = temp
+	}
+	s.sqlTemplates = templates
+	return nil
+}
+
+// NextSql 查询模板中的关键字可以使用{measurement}和schema中的tag名称，例如{hostname}
+func (s *SchemaSimulator) NextSql(wr io.Writer) int64 {
+	madeSql := atomic.AddInt64(&s.madeSql, 1)
+	tmp := s.sqlTemplates[madeSql%int64(len(s.sqlTemplates))]
+
+	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
+	randomIndex := rand.Intn(len(s.series))
+	for i := range tmp.Base {
+		wr.Write(tmp.Base[i])
+		if i < len(tmp.KeyWords) {
+			repeat := tmp.KeyRepeat[i]
+			for k := 0; k < repeat; k++ {
+				key := tmp.KeyWords[i]
+				if key == measurementKeyword {
+					wr.Write(s.measurements[(randomIndex+k)%len(s.measurements)].name)
+				} else if values, ok := s.tagValues[key]; ok {
+					wr.Write(values[(randomIndex+k)%len(values)])
+				} else {
+					currentTimeInDB := s.timestampStart.Add(s.samplingInterval * time.Duration(atomic.LoadInt64(&s.writtenPoints)/int64(len(s.series))))
+					common.WriteTimeKeyword(wr, key, s.timestampStart, s.timestampEnd, currentTimeInDB)
+				}
+				if k < repeat-1 {
+					wr.Write(tmp.KeySep[i])
+				}
+			}
+		}
+	}
+	return madeSql
+}
@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+const testSchema = `
+[[measurements]]
+name = "cpu"
+sample = 1.0
+tags = [
+    { name = "cluster_id", source = { type = "sequence", format = "c%s", start = 1, count = 2 } },
+    { name = "hostname",   source = ["h1", "h2", "h3"] },
+    { name = "region",     source = "us-west" },
+]
+fields = [
+    { name = "usage",   count = 5, source = { type = "rand<float>", seed = 10 } },
+    { name = "load",    count = 3, source = { type = "rand<int>", seed = 11, min = 10, max = 20 } },
+    { name = "counter", count = 5, source = { type = "sequence" } },
+]
+
+[[measurements]]
+name = "mem"
+sample = 0.5
+tags = [
+    { name = "hostname", source = { type = "sequence", format = "host_%s", count = 100 } },
+]
+fields = [
+    { name = "free", count = 5, source = [1, 2, 3] },
+]
+`
+
+func newTestSimulator(t *testing.T) *SchemaSimulator {
+	path := filepath.Join(t.TempDir(), "schema.toml")
+	if err := ioutil.WriteFile(path, []byte(testSchema), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	config, err := common.NewConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &SchemaSimulatorConfig{
+		Start:            start,
+		End:              start.Add(time.Hour),
+		SamplingInterval: time.Second,
+		Schema:           config,
+	}
+	return cfg.ToSimulator()
+}
+
+func TestSchemaSimulator(t *testing.T) {
+	sim := newTestSimulator(t)
+
+	points := make(map[string]int)
+	var lines []string
+	p := common.MakeUsablePoint()
+	for sim.Next(p) <= sim.Total() {
+		points[string(p.MeasurementName)]++
+		if string(p.MeasurementName) == "cpu" {
+			for i, key := range p.FieldKeys {
+				switch v := p.FieldValues[i].(type) {
+				case float64:
+					if string(key) != "usage" || v < 0 || v >= 1 {
+						t.Fatalf("unexpected field %s=%v", key, v)
+					}
+				case int64:
+					if string(key) == "load" && (v < 10 || v >= 20) {
+						t.Fatalf("load out of range: %d", v)
+					}
+				default:
+					t.Fatalf("unexpected type of field %s: %T", key, v)
+				}
+			}
+			lines = append(lines, string(p.TagValues[0])+string(p.TagValues[1]))
+		}
+		p.Reset()
+	}
+
+	// count限制每个series最多5个point，cpu有2*3个series
+	if points["cpu"] != 6*5 {
+		t.Fatalf("expected 30 cpu points, got %d", points["cpu"])
+	}
+	// sample=0.5保留一部分series
+	if points["mem"] == 0 || points["mem"] >= 100*5 || points["mem"]%5 != 0 {
+		t.Fatalf("unexpected mem points %d", points["mem"])
+	}
+	if sim.SeenPoints() != int64(points["cpu"]+points["mem"]) {
+		t.Fatalf("seen points %d, generated %d", sim.SeenPoints(), points["cpu"]+points["mem"])
+	}
+	if lines[0] != "c1h1" || lines[5] != "c2h3" {
+		t.Fatalf("unexpected tag values %v", lines[:6])
+	}
+
+	// 相同的配置生成相同的数据
+	other := newTestSimulator(t)
+	a, b := common.MakeUsablePoint(), common.MakeUsablePoint()
+	for sim.ClearMadePointNum(); sim.Next(a) <= sim.Total(); a.Reset() {
+		other.Next(b)
+		for i := range a.FieldValues {
+			if a.FieldValues[i] != b.FieldValues[i] {
+				t.Fatalf("field %s is not reproducible: %v != %v", a.FieldKeys[i], a.FieldValues[i], b.FieldValues[i])
+			}
+		}
+		b.Reset()
+	}
+}
@@ -19,6 +19,7 @@ type SceneConfig struct {
 	SeriesCount      int64
 	SeriesOffset     int64
 	SqlTemplates     []string
+	Timing           *common.TimingConfig // 模拟不规则的时间戳，为nil时按SamplingInterval对齐
 }
 
 func (c *SceneConfig) ToSimulator() *SceneSimulator {
@@ -43,6 +44,7 @@ func (c *SceneConfig) ToSimulator() *SceneSimulator {
 		SamplingInterval: c.SamplingInterval,
 		TimestampStart:   c.Start,
 		TimestampEnd:     c.End,
+		timing:           common.NewTiming(c.Timing, c.Start, c.SamplingInterval),
 	}
 
 	err := dg.SetSqlTemplate(c.SqlTemplates)
@@ -65,6 +67,7 @@ type SceneSimulator struct {
 	TimestampStart   time.Time
 	TimestampEnd     time.Time
 	sqlTemplates     []*common.SqlTemplate
+	timing           *common.Timing
 }
 
 func (s *SceneSimulator) SeenPoints() int64 {
@@ -116,7 +119,7 @@ func (s *SceneSimulator) Next(p *common.Point) int64 {
 	ss := &s.Hosts[hostIndex]
 	// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
 	// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
-	timestamp := s.TimestampStart.Add(s.SamplingInterval * time.Duration(pointIndex/int64(len(s.Hosts))))
+	timestamp := s.timing.Timestamp(hostIndex, pointIndex/int64(len(s.Hosts)))
 	p.SetTimestamp(&timestamp)
 
 	// Populate host-specific tags: for example, LSVNV2182E2100001
@@ -149,20 +152,12 @@ func (s *SceneSimulator) NextSql(wr io.Writer) int64 {
 					wr.Write(scene.TagValues[0])
 				case string(TagKeys[1]):
 					wr.Write(scene.TagValues[1])
-				case string(TagKeys[2]):
-					wr.Write(scene.TagValues[2])
-				case string(TagKeys[3]):
-					wr.Write(scene.TagValues[3])
-				case "start":
-					wr.Write([]byte(s.TimestampStart.Format(time.RFC3339)))
-				case "end":
-					wr.Write([]byte(s.TimestampEnd.Format(time.RFC3339)))
-				case "now":
+				default:
 					currentTimeInDB := s.TimestampStart.Add(s.SamplingInterval * time.Duration(s.writtenPoints/int64(len(s.Hosts))))
-					wr.Write([]byte(currentTimeInDB.Format(time.RFC3339)))
+					common.WriteTimeKeyword(wr, key, s.TimestampStart, s.TimestampEnd, currentTimeInDB)
 				}
 				if k < repeat-1 {
-					wr.Write([]byte("','"))
+					wr.Write(tmp.KeySep[i])
 				}
 			}
 		}
@@ -3,12 +3,55 @@ package universal
 import (
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
 	"git.querycap.com/falcontsdb/fctsdb-bench/util/fastrand"
 )
 
+// 字段类型
+const (
+	FieldTypeInt    = "int"
+	FieldTypeFloat  = "float"
+	FieldTypeString = "string"
+	FieldTypeBool   = "bool"
+)
+
+// 字段取值的分布，对应common中的Distribution
+const (
+	DistUniform    = "uniform"
+	DistNormal     = "nd"
+	DistRandomWalk = "random-walk"
+	DistClamped    = "clamped"
+	DistConstant   = "constant"
+	DistTwoState   = "two-state"
+)
+
+// DefaultStringLength string字段默认的长度
+const DefaultStringLength = 10
+
+// TagDefine 定义一个tag key的取值
+type TagDefine struct {
+	Key         string
+	Cardinality int64  // tag取值的数量，设备按编号依次组合各个tag的取值，0表示每个设备一个取值
+	Value       string // 固定取值，所有设备相同，设置后Cardinality不生效
+}
+
+// FieldDefine 定义一组字段的类型和取值分布
+type FieldDefine struct {
+	Name         string // 字段名称，设置Count时追加序号，例如speed_0、speed_1
+	Type         string // int、float、string、bool
+	Count        int64  // 相同定义的字段数量，默认1
+	Distribution string // uniform、nd、random-walk、clamped、constant、two-state，不设置时使用快速的均匀分布
+	Mean         float64
+	StdDev       float64 // nd的均值和标准差，random-walk、clamped的步长服从ND(Mean, StdDev)
+	Min          float64
+	Max          float64 // uniform的范围、clamped的边界、two-state的两个取值
+	Start        float64 // random-walk、clamped的初始值，constant的取值
+	Length       int64   // string字段的长度，默认10
+}
+
 // Type Host models a machine being monitored by Telegraf.
 type Device struct {
 	SimulatedMeasurements []common.SimulatedMeasurement
@@ -19,24 +62,34 @@ type Device struct {
 	TagValues [][]byte
 }
 
-func NewDeviceMeasurements(fieldDefine [3]int64, count int) []common.SimulatedMeasurement {
+func NewDeviceMeasurements(fields []FieldDefine, count int) []common.SimulatedMeasurement {
 	sm := []common.SimulatedMeasurement{}
 
 	for i := 0; i < count; i++ {
-		sm = append(sm, NewMeasurement(fmt.Sprintf("table_%d", i), fieldDefine))
+		sm = append(sm, NewMeasurement(fmt.Sprintf("table_%d", i), fields))
 	}
 	return sm
 }
 
-func NewDevice(id int64, measurementCount, tagKeyCount int64, fieldDefine [3]int64) Device {
-	sm := NewDeviceMeasurements(fieldDefine, int(measurementCount))
+func NewDevice(id int64, measurementCount int64, tags []TagDefine, fields []FieldDefine) Device {
+	sm := NewDeviceMeasurements(fields, int(measurementCount))
 	d := Device{
 		SimulatedMeasurements: sm,
 	}
 
-	for i := 0; i < int(tagKeyCount); i++ {
-		d.TagKeys = append(d.TagKeys, []byte("key_"+strconv.Itoa(i)))
-		d.TagValues = append(d.TagValues, strconv.AppendInt(fastrand.RandomNormalBytes(4), id, 10))
+	// 有取值数量的tag按设备编号进位组合，例如region有2个取值、rack有3个取值时，前6个设备的组合各不相同
+	rest := id
+	for _, tag := range tags {
+		d.TagKeys = append(d.TagKeys, []byte(tag.Key))
+		switch {
+		case tag.Value != "":
+			d.TagValues = append(d.TagValues, []byte(tag.Value))
+		case tag.Cardinality > 0:
+			d.TagValues = append(d.TagValues, []byte(tag.Key+"_"+strconv.FormatInt(rest%tag.Cardinality, 10)))
+			rest /= tag.Cardinality
+		default:
+			d.TagValues = append(d.TagValues, strconv.AppendInt(fastrand.RandomNormalBytes(4), id, 10))
+		}
 	}
 
 	return d
@@ -46,25 +99,116 @@ func (air *Device) NumMeasurements() int {
 	return len(air.SimulatedMeasurements)
 }
 
+// DefaultTags 兼容TagKeyCount的定义，每个tag都是每个设备一个取值
+func DefaultTags(tagKeyCount int64) []TagDefine {
+	tags := make([]TagDefine, tagKeyCount)
+	for i := range tags {
+		tags[i].Key = "key_" + strconv.Itoa(i)
+	}
+	return tags
+}
+
+// DefaultFields 兼容FieldsDefine的定义，[3]int64分别为int、float、string字段的数量
+func DefaultFields(fieldsDefine [3]int64) []FieldDefine {
+	var fields []FieldDefine
+	for i, typ := range []string{FieldTypeInt, FieldTypeFloat, FieldTypeString} {
+		if fieldsDefine[i] > 0 {
+			fields = append(fields, FieldDefine{Name: typ, Type: typ, Count: fieldsDefine[i]})
+		}
+	}
+	return fields
+}
+
+// ValidateFields 检查字段定义，在创建设备之前调用，避免每个设备重复报错
+func ValidateFields(fields []FieldDefine) error {
+	for _, f := range fields {
+		switch f.Type {
+		case FieldTypeInt, FieldTypeFloat, FieldTypeString, FieldTypeBool:
+		default:
+			return fmt.Errorf("field %s: unsupported type %q", f.Name, f.Type)
+		}
+		if f.Count < 0 || f.Length < 0 {
+			return fmt.Errorf("field %s: count and length must not be negative", f.Name)
+		}
+		if f.Type == FieldTypeString && f.Distribution != "" {
+			return fmt.Errorf("field %s: string fields do not support distribution", f.Name)
+		}
+		if _, err := newDistribution(f); err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// newDistribution 返回nil时使用fastrand生成均匀分布的值，和之前的universal场景一致
+func newDistribution(f FieldDefine) (common.Distribution, error) {
+	switch f.Distribution {
+	case "":
+		if f.Type == FieldTypeBool {
+			return common.TSD(0, 1, 0), nil
+		}
+		return nil, nil
+	case DistUniform:
+		if f.Max <= f.Min {
+			return nil, fmt.Errorf("uniform requires Max > Min")
+		}
+		return common.UD(f.Min, f.Max), nil
+	case DistNormal:
+		return common.ND(f.Mean, f.StdDev), nil
+	case DistRandomWalk:
+		return common.WD(common.ND(f.Mean, f.StdDev), f.Start), nil
+	case DistClamped:
+		if f.Max <= f.Min {
+			return nil, fmt.Errorf("clamped requires Max > Min")
+		}
+		return common.CWD(common.ND(f.Mean, f.StdDev), f.Min, f.Max, f.Start), nil
+	case DistConstant:
+		return &common.ConstantDistribution{State: f.Start}, nil
+	case DistTwoState:
+		return common.TSD(f.Min, f.Max, f.Min), nil
+	default:
+		return nil, fmt.Errorf("unsupported distribution %q", f.Distribution)
+	}
+}
+
+type field struct {
+	key    []byte
+	typ    string
+	dist   common.Distribution
+	length int
+}
+
 type Measurement struct {
+	sync.Mutex // 有状态的分布(例如random-walk)在多协程下需要串行
 	name       []byte
-	intFiled   [][]byte
-	floatField [][]byte
-	strField   [][]byte
-	// rand      rand.RNG
+	fields     []field
+	stateful   bool
 }
 
-func NewMeasurement(name string, fieldDefine [3]int64) *Measurement {
+func NewMeasurement(name string, fields []FieldDefine) *Measurement {
 	m := &Measurement{name: []byte(name)}
 
-	for j := 0; j < int(fieldDefine[0]); j++ {
-		m.intFiled = append(m.intFiled, []byte("int_"+strconv.Itoa(j)))
-	}
-	for j := 0; j < int(fieldDefine[1]); j++ {
-		m.floatField = append(m.floatField, []byte("float_"+strconv.Itoa(j)))
-	}
-	for j := 0; j < int(fieldDefine[2]); j++ {
-		m.strField = append(m.strField, []byte("string_"+strconv.Itoa(j)))
+	for _, def := range fields {
+		count := def.Count
+		if count == 0 {
+			count = 1
+		}
+		length := int(def.Length)
+		if length == 0 {
+			length = DefaultStringLength
+		}
+		for j := 0; j < int(count); j++ {
+			key := def.Name
+			if def.Count > 0 {
+				key += "_" + strconv.Itoa(j)
+			}
+			// 字段定义已经由ValidateFields检查过
+			dist, _ := newDistribution(def)
+			if dist != nil {
+				m.stateful = true
+			}
+			m.fields = append(m.fields, field{key: []byte(key), typ: def.Type, dist: dist, length: length})
+		}
 	}
 
 	return m
@@ -75,14 +219,32 @@ func (m *Measurement) Tick(d time.Duration) {
 
 func (m *Measurement) ToPoint(p *common.Point) bool {
 	p.SetMeasurementName(m.name)
-	for _, f := range m.intFiled {
-		p.AppendInt64Field(f, int64(fastrand.Uint32n(100000000)))
-	}
-	for _, f := range m.floatField {
-		p.AppendField(f, fastrand.Float64())
+	if m.stateful {
+		m.Lock()
+		defer m.Unlock()
 	}
-	for _, f := range m.strField {
-		p.AppendField(f, fastrand.RandomNormalBytes(10))
+	for i := range m.fields {
+		f := &m.fields[i]
+		if f.dist == nil {
+			switch f.typ {
+			case FieldTypeInt:
+				p.AppendInt64Field(f.key, int64(fastrand.Uint32n(100000000)))
+			case FieldTypeFloat:
+				p.AppendField(f.key, fastrand.Float64())
+			case FieldTypeString:
+				p.AppendField(f.key, fastrand.RandomNormalBytes(f.length))
+			}
+			continue
+		}
+		f.dist.Advance()
+		switch f.typ {
+		case FieldTypeInt:
+			p.AppendInt64Field(f.key, int64(f.dist.Get()))
+		case FieldTypeFloat:
+			p.AppendField(f.key, f.dist.Get())
+		case FieldTypeBool:
+			p.AppendField(f.key, f.dist.Get() != 0)
+		}
 	}
 	return true
 }
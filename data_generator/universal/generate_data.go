@@ -2,6 +2,7 @@ package universal
 
 import (
 	"io"
+	"log"
 	"sync/atomic"
 	"time"
 
@@ -19,20 +20,49 @@ type UniversalSimulatorConfig struct {
 	MeasurementCount int64
 	TagKeyCount      int64
 	FieldsDefine     [3]int64
+	Tags             []TagDefine
+	Fields           []FieldDefine
+	Sparse           *common.SparseConfig // 模拟字段缺失，为nil时所有字段都存在
+	Churn            *common.ChurnConfig  // 模拟设备上线和下线，为nil时设备一直在线
+	Timing           *common.TimingConfig // 模拟不规则的时间戳，为nil时按SamplingInterval对齐
 }
 
+// UniversalCase 使用json定义的universal场景，例如
+// {"MeasurementCount":1,"Tags":[{"Key":"region","Cardinality":4},{"Key":"host"}],"Fields":[{"Name":"usage","Type":"float","Distribution":"clamped","StdDev":1,"Max":100,"Count":4}]}
+// Tags和Fields不为空时代替TagKeyCount和FieldsDefine
 type UniversalCase struct {
 	MeasurementCount int64
 	TagKeyCount      int64
 	FieldsDefine     [3]int64
+	Tags             []TagDefine
+	Fields           []FieldDefine
 }
 
 func (d *UniversalSimulatorConfig) ToSimulator() *UniversalSimulator {
+	tags, fields := d.Tags, d.Fields
+	if len(tags) == 0 {
+		tags = DefaultTags(d.TagKeyCount)
+	}
+	if len(fields) == 0 {
+		fields = DefaultFields(d.FieldsDefine)
+	}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if tag.Key == "" || seen[tag.Key] {
+			log.Fatalf("the tag key '%s' is empty or duplicated", tag.Key)
+		}
+		seen[tag.Key] = true
+	}
+	if err := ValidateFields(fields); err != nil {
+		log.Fatal(err)
+	}
+
 	devices := make([]Device, d.DeviceCount)
 	var measNum int64
 
 	for i := 0; i < len(devices); i++ {
-		devices[i] = NewDevice(d.DeviceOffset+int64(i), d.MeasurementCount, d.TagKeyCount, d.FieldsDefine)
+		devices[i] = NewDevice(d.DeviceOffset+int64(i), d.MeasurementCount, tags, fields)
+		devices[i].SimulatedMeasurements = common.WrapSparse(devices[i].SimulatedMeasurements, d.Sparse)
 		measNum += int64(devices[i].NumMeasurements())
 	}
 
@@ -50,6 +80,17 @@ func (d *UniversalSimulatorConfig) ToSimulator() *UniversalSimulator {
 		SamplingInterval: d.SamplingInterval,
 		TimestampStart:   d.Start,
 		TimestampEnd:     d.End,
+		timing:           common.NewTiming(d.Timing, d.Start, d.SamplingInterval),
+	}
+	if d.Churn.Enabled() {
+		initTags := make([][][]byte, len(devices))
+		for i := range devices {
+			initTags[i] = devices[i].TagValues
+		}
+		// 新设备按编号重新计算tag值，所有tag都有Cardinality时新设备可能和原来的设备属于相同的series
+		dg.churn = common.NewChurn(d.Churn, d.SamplingInterval, initTags, func(slot, id int64) [][]byte {
+			return NewDevice(d.DeviceOffset+id, 0, tags, nil).TagValues
+		})
 	}
 	return dg
 }
@@ -62,6 +103,7 @@ type UniversalSimulator struct {
 	madeValues       int64
 	madeSql          int64
 	writtenPoints    int64
+	skippedPoints    int64
 	measurementCount int64
 
 	Hosts            []Device
@@ -69,10 +111,29 @@ type UniversalSimulator struct {
 	TimestampStart   time.Time
 	TimestampEnd     time.Time
 	sqlTemplates     []*common.SqlTemplate
+	churn            *common.Churn
+	timing           *common.Timing
 }
 
 func (s *UniversalSimulator) SeenPoints() int64 {
-	return s.madePoints
+	madePoints := atomic.LoadInt64(&s.madePoints)
+	if madePoints > s.maxPoints {
+		madePoints = s.maxPoints
+	}
+	return madePoints - atomic.LoadInt64(&s.skippedPoints)
+}
+
+// TotalSeries 写入过的series数量，每个设备的每个measurement是一个series
+func (s *UniversalSimulator) TotalSeries() int64 {
+	if s.churn != nil {
+		return s.churn.TotalSeries() * s.measurementCount
+	}
+	return int64(len(s.Hosts)) * s.measurementCount
+}
+
+// ActiveSeries 同时在线的series数量
+func (s *UniversalSimulator) ActiveSeries() int64 {
+	return int64(len(s.Hosts)) * s.measurementCount
 }
 
 func (s *UniversalSimulator) SeenValues() int64 {
@@ -108,29 +169,41 @@ func (s *UniversalSimulator) SetSqlTemplate(sqlTemplates []string) error {
 
 func (s *UniversalSimulator) ClearMadePointNum() {
 	atomic.StoreInt64(&s.madePoints, 0)
+	atomic.StoreInt64(&s.skippedPoints, 0)
 }
 
 // Next advances a Point to the next state in the generator.
 func (s *UniversalSimulator) Next(p *common.Point) int64 {
+	for {
+		madePoint := atomic.AddInt64(&s.madePoints, 1)
+		pointIndex := madePoint - 1
+		hostIndex := pointIndex / s.measurementCount % int64(len(s.Hosts))
 
-	madePoint := atomic.AddInt64(&s.madePoints, 1)
-	pointIndex := madePoint - 1
-	hostIndex := pointIndex / s.measurementCount % int64(len(s.Hosts))
+		host := &s.Hosts[hostIndex]
 
-	host := &s.Hosts[hostIndex]
+		// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
+		epoch := pointIndex / int64(len(s.Hosts)) / s.measurementCount
+		timestamp := s.timing.Timestamp(hostIndex, epoch)
+		p.SetTimestamp(&timestamp)
 
-	// 为了多协程下不混乱, 且由于这里只有一张表，这里不使用Tick方法
-	timestamp := s.TimestampStart.Add(s.SamplingInterval * time.Duration(pointIndex/int64(len(s.Hosts))/s.measurementCount))
-	p.SetTimestamp(&timestamp)
+		tagValues := host.TagValues
+		if s.churn != nil {
+			tagValues = s.churn.Tags(hostIndex, epoch)
+		}
+		for i := range host.TagKeys {
+			p.AppendTag(host.TagKeys[i], tagValues[i])
+		}
 
-	for i := range host.TagKeys {
-		p.AppendTag(host.TagKeys[i], host.TagValues[i])
+		// Populate measurement-specific tags and fields:
+		// 模拟字段缺失时设备可能不上报数据，直接使用下一个序号
+		if !host.SimulatedMeasurements[pointIndex%int64(len(host.SimulatedMeasurements))].ToPoint(p) && madePoint <= s.maxPoints {
+			p.Reset()
+			atomic.AddInt64(&s.skippedPoints, 1)
+			continue
+		}
+		atomic.AddInt64(&s.madeValues, int64(p.ValueCount()))
+		return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
 	}
-
-	// Populate measurement-specific tags and fields:
-	host.SimulatedMeasurements[pointIndex%int64(len(host.SimulatedMeasurements))].ToPoint(p)
-	atomic.AddInt64(&s.madeValues, int64(len(p.FieldValues)))
-	return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
 }
 
 func (s *UniversalSimulator) NextSql(wr io.Writer) int64 {
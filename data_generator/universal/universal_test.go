@@ -2,6 +2,7 @@ package universal
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -63,3 +64,110 @@ func BenchmarkNewPointDevopsEasy(b *testing.B) {
 		point.Reset()
 	}
 }
+
+func TestUniversalTagAndFieldDefine(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &UniversalSimulatorConfig{
+		Start:            start,
+		End:              start.Add(time.Minute),
+		SamplingInterval: time.Second,
+		DeviceCount:      6,
+		MeasurementCount: 1,
+		Tags: []TagDefine{
+			{Key: "region", Cardinality: 2},
+			{Key: "rack", Cardinality: 3},
+			{Key: "dc", Value: "virginia"},
+		},
+		Fields: []FieldDefine{
+			{Name: "usage", Type: FieldTypeFloat, Distribution: DistClamped, StdDev: 10, Min: 0, Max: 100, Start: 50},
+			{Name: "cores", Type: FieldTypeInt, Distribution: DistConstant, Start: 8},
+			{Name: "up", Type: FieldTypeBool},
+			{Name: "label", Type: FieldTypeString, Length: 3, Count: 2},
+		},
+	}
+	sim := cfg.ToSimulator()
+
+	series := make(map[string]bool)
+	p := common.MakeUsablePoint()
+	for sim.Next(p) <= sim.Total() {
+		if string(p.TagValues[2]) != "virginia" {
+			t.Fatalf("unexpected fixed tag value %s", p.TagValues[2])
+		}
+		series[string(p.TagValues[0])+","+string(p.TagValues[1])] = true
+		for i, key := range p.FieldKeys {
+			switch string(key) {
+			case "usage":
+				if v := p.FieldValues[i].(float64); v < 0 || v > 100 {
+					t.Fatalf("usage out of range: %v", v)
+				}
+			case "up":
+				if _, ok := p.FieldValues[i].(bool); !ok {
+					t.Fatalf("up is not bool: %T", p.FieldValues[i])
+				}
+			case "label_0", "label_1":
+				if v := p.FieldValues[i].([]byte); len(v) != 3 {
+					t.Fatalf("unexpected string length %d", len(v))
+				}
+			default:
+				t.Fatalf("unexpected field %s", key)
+			}
+		}
+		if len(p.Int64FiledKeys) != 1 || p.Int64FiledValues[0] != 8 {
+			t.Fatalf("unexpected int fields %s %v", p.Int64FiledKeys, p.Int64FiledValues)
+		}
+		p.Reset()
+	}
+	// 6个设备正好覆盖region和rack的所有组合
+	if len(series) != 6 {
+		t.Fatalf("expected 6 series, got %d", len(series))
+	}
+}
+
+func TestUniversalChurn(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &UniversalSimulatorConfig{
+		Start:            start,
+		End:              start.Add(time.Minute * 10),
+		SamplingInterval: time.Second,
+		DeviceCount:      20,
+		MeasurementCount: 2,
+		Tags:             []TagDefine{{Key: "region", Value: "east"}, {Key: "host"}},
+		Fields:           []FieldDefine{{Name: "usage", Type: FieldTypeFloat}},
+		Churn:            &common.ChurnConfig{Lifetime: time.Minute, Seed: 1},
+	}
+	sim := cfg.ToSimulator()
+
+	// 多协程生成，每个采样周期的series数量等于同时在线的数量
+	var mu sync.Mutex
+	series := make(map[string]bool)
+	epochs := make(map[int64]map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := common.MakeUsablePoint()
+			for sim.Next(p) <= sim.Total() {
+				key := string(p.MeasurementName) + "," + string(p.TagValues[0]) + "," + string(p.TagValues[1])
+				mu.Lock()
+				series[key] = true
+				if epochs[p.Timestamp.Unix()] == nil {
+					epochs[p.Timestamp.Unix()] = make(map[string]bool)
+				}
+				epochs[p.Timestamp.Unix()][key] = true
+				mu.Unlock()
+				p.Reset()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sim.ActiveSeries() != 40 || int64(len(series)) != sim.TotalSeries() || sim.TotalSeries() <= sim.ActiveSeries() {
+		t.Fatalf("unexpected series: generated %d, total %d, active %d", len(series), sim.TotalSeries(), sim.ActiveSeries())
+	}
+	for ts, keys := range epochs {
+		if int64(len(keys)) != sim.ActiveSeries() {
+			t.Fatalf("%d series at %d, expected %d", len(keys), ts, sim.ActiveSeries())
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -18,6 +19,10 @@ type VehicleSimulatorConfig struct {
 	DeviceCount      int64
 	DeviceOffset     int64
 	SqlTemplates     []string
+	Sparse           *common.SparseConfig // 模拟字段缺失，为nil时所有字段都存在
+	Churn            *common.ChurnConfig  // 模拟车辆上线和下线，为nil时车辆一直在线
+	Timing           *common.TimingConfig // 模拟不规则的时间戳，为nil时按SamplingInterval对齐
+	Telemetry        bool                 // 使用GPS轨迹和关联信号的telemetry模型，false时使用value1~value60的随机数模型
 }
 
 func (d *VehicleSimulatorConfig) ToSimulator() *VehicleSimulator {
@@ -25,10 +30,17 @@ func (d *VehicleSimulatorConfig) ToSimulator() *VehicleSimulator {
 		log.Fatal("the vehicle count is unavailable")
 	}
 	vehicleInfos := make([]Vehicle, d.DeviceCount)
+	var profiles []*telemetryProfile
 	var measNum int64
 
 	for i := 0; i < len(vehicleInfos); i++ {
-		vehicleInfos[i] = NewVehicle(i, int(d.DeviceOffset), d.Start)
+		if d.Telemetry {
+			vehicleInfos[i] = NewTelemetryVehicle(i, int(d.DeviceOffset), d.Start)
+			profiles = append(profiles, vehicleInfos[i].SimulatedMeasurements[0].(*telemetryMeasurement).profile)
+		} else {
+			vehicleInfos[i] = NewVehicle(i, int(d.DeviceOffset), d.Start)
+		}
+		vehicleInfos[i].SimulatedMeasurements = common.WrapSparse(vehicleInfos[i].SimulatedMeasurements, d.Sparse)
 		measNum += int64(vehicleInfos[i].NumMeasurements())
 	}
 
@@ -45,6 +57,18 @@ func (d *VehicleSimulatorConfig) ToSimulator() *VehicleSimulator {
 		SamplingInterval: d.SamplingInterval,
 		TimestampStart:   d.Start,
 		TimestampEnd:     d.End,
+		timing:           common.NewTiming(d.Timing, d.Start, d.SamplingInterval),
+		profiles:         profiles,
+	}
+
+	if d.Churn.Enabled() {
+		initTags := make([][][]byte, len(vehicleInfos))
+		for i := range vehicleInfos {
+			initTags[i] = [][]byte{vehicleInfos[i].Name}
+		}
+		dg.churn = common.NewChurn(d.Churn, d.SamplingInterval, initTags, func(slot, id int64) [][]byte {
+			return [][]byte{vehicleName(id + d.DeviceOffset)}
+		})
 	}
 
 	err := dg.SetSqlTemplate(d.SqlTemplates)
@@ -62,15 +86,44 @@ type VehicleSimulator struct {
 	madeValues       int64
 	madeSql          int64
 	writtenPoints    int64
+	skippedPoints    int64
 	Hosts            []Vehicle
 	SamplingInterval time.Duration
 	TimestampStart   time.Time
 	TimestampEnd     time.Time
 	sqlTemplates     []*common.SqlTemplate
+	churn            *common.Churn
+	timing           *common.Timing
+	profiles         []*telemetryProfile // telemetry模型中每辆车的属性，用于生成查询
 }
 
 func (g *VehicleSimulator) SeenPoints() int64 {
-	return g.madePoints
+	madePoints := atomic.LoadInt64(&g.madePoints)
+	if madePoints > g.maxPoints {
+		madePoints = g.maxPoints
+	}
+	return madePoints - atomic.LoadInt64(&g.skippedPoints)
+}
+
+// TotalSeries 写入过的车辆数量
+func (g *VehicleSimulator) TotalSeries() int64 {
+	if g.churn != nil {
+		return g.churn.TotalSeries()
+	}
+	return int64(len(g.Hosts))
+}
+
+// ActiveSeries 同时在线的车辆数量
+func (g *VehicleSimulator) ActiveSeries() int64 {
+	return int64(len(g.Hosts))
+}
+
+// vin 第epoch个采样周期时第hostIndex辆车的VIN
+func (g *VehicleSimulator) vin(hostIndex, epoch int64) []byte {
+	if g.churn != nil {
+		return g.churn.Tags(hostIndex, epoch)[0]
+	}
+	return g.Hosts[hostIndex].Name
 }
 
 func (g *VehicleSimulator) SeenValues() int64 {
@@ -106,29 +159,39 @@ func (g *VehicleSimulator) SetSqlTemplate(sqlTemplates []string) error {
 
 func (q *VehicleSimulator) ClearMadePointNum() {
 	atomic.StoreInt64(&q.madePoints, 0)
+	atomic.StoreInt64(&q.skippedPoints, 0)
 }
 
 // Next advances a Point to the next state in the generator.
 func (g *VehicleSimulator) Next(p *common.Point) int64 {
-	// switch to the next metric if needed
-	madePoint := atomic.AddInt64(&g.madePoints, 1)
-	pointIndex := madePoint - 1 //保证在next方法中被使用时的初始值是0
-	hostIndex := pointIndex % int64(len(g.Hosts))
-
-	vehicle := &g.Hosts[hostIndex]
-	// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
-	// 为了多协程不混乱，这里不使用Tick方法
-	timestamp := g.TimestampStart.Add(g.SamplingInterval * time.Duration(pointIndex/int64(len(g.Hosts))))
-	p.SetTimestamp(&timestamp)
-
-	// Populate host-specific tags: for example, LSVNV2182E2100001
-	p.AppendTag([]byte("VIN"), vehicle.Name)
-
-	// Populate measurement-specific tags and fields:
-	vehicle.SimulatedMeasurements[0].ToPoint(p)
+	for {
+		// switch to the next metric if needed
+		madePoint := atomic.AddInt64(&g.madePoints, 1)
+		pointIndex := madePoint - 1 //保证在next方法中被使用时的初始值是0
+		hostIndex := pointIndex % int64(len(g.Hosts))
+
+		vehicle := &g.Hosts[hostIndex]
+		// vehicle.SimulatedMeasurements[0].Tick(v.SamplingInterval)
+		// 为了多协程不混乱，这里不使用Tick方法
+		epoch := pointIndex / int64(len(g.Hosts))
+		timestamp := g.timing.Timestamp(hostIndex, epoch)
+		p.SetTimestamp(&timestamp)
+
+		// Populate host-specific tags: for example, LSVNV2182E2100001
+		// 模拟车辆上线和下线时，同一个位置上的车辆按采样周期替换为新的VIN
+		p.AppendTag([]byte("VIN"), g.vin(hostIndex, epoch))
+
+		// Populate measurement-specific tags and fields:
+		// 模拟字段缺失时车辆可能不上报数据，直接使用下一个序号
+		if !vehicle.SimulatedMeasurements[0].ToPoint(p) && madePoint <= g.maxPoints {
+			p.Reset()
+			atomic.AddInt64(&g.skippedPoints, 1)
+			continue
+		}
 
-	atomic.AddInt64(&g.madeValues, int64(len(p.FieldValues)+len(p.Int64FiledValues)))
-	return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
+		atomic.AddInt64(&g.madeValues, int64(p.ValueCount()))
+		return madePoint //方便另一种线程安全的结束方式，for sim.next(point) <= sim.total() {...} 保证产生的总点数正确，注意最后一次{...}里面的代码不执行
+	}
 }
 
 func (g *VehicleSimulator) NextSql(wr io.Writer) int64 {
@@ -138,26 +201,52 @@ func (g *VehicleSimulator) NextSql(wr io.Writer) int64 {
 	// 生成数据点时，用fastrand更快速，生成的数据和seed无关联
 	// 生成sql时，为了保证每次生成sql一致性，采用rand库，使用全局seed
 	randomHostsIndex := rand.Intn(len(g.Hosts))
+	// 一条查询中的经纬度范围相同，为某辆车所在城市中心附近约6km见方的区域
+	var bbox [4]float64
+	if g.profiles != nil {
+		center := cityCenters[g.profiles[randomHostsIndex].city]
+		bbox = [4]float64{center[0] - 0.03, center[0] + 0.03, center[1] - 0.03, center[1] + 0.03}
+	}
 	for i := range tmp.Base {
 		wr.Write(tmp.Base[i])
 		if i < len(tmp.KeyWords) {
 			repeat := tmp.KeyRepeat[i]
 			for k := 0; k < repeat; k++ {
-				vehicle := g.Hosts[(randomHostsIndex+k)%len(g.Hosts)]
+				hostIndex := int64((randomHostsIndex + k) % len(g.Hosts))
 				key := tmp.KeyWords[i]
 				switch key {
 				case "vin":
-					wr.Write(vehicle.Name)
-				case "start":
-					wr.Write([]byte(g.TimestampStart.Format(time.RFC3339)))
-				case "end":
-					wr.Write([]byte(g.TimestampEnd.Format(time.RFC3339)))
-				case "now":
+					// 查询已经写入的最新一个采样周期在线的车辆
+					epoch := atomic.LoadInt64(&g.writtenPoints) / int64(len(g.Hosts))
+					if epoch > 0 {
+						epoch--
+					}
+					wr.Write(g.vin(hostIndex, epoch))
+				case "brand", "model", "lat_min", "lat_max", "lon_min", "lon_max":
+					if g.profiles == nil {
+						wr.Write([]byte("{" + key + "}"))
+						break
+					}
+					switch key {
+					case "brand":
+						wr.Write(g.profiles[hostIndex].model.brand)
+					case "model":
+						wr.Write(g.profiles[hostIndex].model.model)
+					case "lat_min":
+						wr.Write([]byte(strconv.FormatFloat(bbox[0], 'f', 4, 64)))
+					case "lat_max":
+						wr.Write([]byte(strconv.FormatFloat(bbox[1], 'f', 4, 64)))
+					case "lon_min":
+						wr.Write([]byte(strconv.FormatFloat(bbox[2], 'f', 4, 64)))
+					case "lon_max":
+						wr.Write([]byte(strconv.FormatFloat(bbox[3], 'f', 4, 64)))
+					}
+				default:
 					currentTimeInDB := g.TimestampStart.Add(g.SamplingInterval * time.Duration(g.writtenPoints/int64(len(g.Hosts))))
-					wr.Write([]byte(currentTimeInDB.Format(time.RFC3339)))
+					common.WriteTimeKeyword(wr, key, g.TimestampStart, g.TimestampEnd, currentTimeInDB)
 				}
 				if k < repeat-1 {
-					wr.Write([]byte("','"))
+					wr.Write(tmp.KeySep[i])
 				}
 			}
 		}
@@ -0,0 +1,325 @@
+package vehicle
+
+import (
+	"math"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+// telemetry模型：每辆车有固定的品牌、车型和住址，每天在07:00~21:00之间往返1~2个目的地，
+// 行程中走走停停，里程、油量(电量)随行驶距离变化，夜间加油(充电)。车辆的状态只由车辆编号和时间戳决定，
+// 多协程下按任意顺序生成point得到的数据相同
+var (
+	TelemetryByteString = []byte("vehicle_telemetry")
+
+	TelemetryTagKeys = [][]byte{
+		[]byte("brand"),
+		[]byte("model"),
+	}
+
+	TelemetryFieldKeys = [][]byte{
+		[]byte("lat"),
+		[]byte("lon"),
+		[]byte("speed"),
+		[]byte("heading"),
+		[]byte("odometer"),
+		[]byte("fuel_level"),
+		[]byte("soc"),
+		[]byte("voltage"),
+	}
+
+	TelemetryInt64FieldKeys = [][]byte{
+		[]byte("engine_state"),
+		[]byte("rpm"),
+	}
+)
+
+// 发动机(电机)状态
+const (
+	EngineOff     = 0
+	EngineIdle    = 1
+	EngineDriving = 2
+)
+
+const (
+	telemetrySeed = 20180101
+	localOffset   = 8 * time.Hour // 按东八区计算每天的行程
+	secondsPerDay = 86400
+	dayStart      = 7 * 3600  // 第一个行程最早开始的时间
+	dayWindow     = 14 * 3600 // 行程分布的时间范围
+	stopInterval  = 4.0       // 行驶中平均每4分钟停车一次(红绿灯)
+	minLevel      = 10.0      // 油量(电量)低于该值之前加油(充电)
+	maxLevel      = 90.0      // 加油(充电)后的油量(电量)
+)
+
+type vehicleModel struct {
+	brand    []byte
+	model    []byte
+	electric bool
+	capacity float64 // 电池容量kWh或者油箱容量L
+	usage    float64 // 每公里的电耗kWh或者油耗L
+}
+
+var vehicleModels = []vehicleModel{
+	{[]byte("Tesla"), []byte("Model3"), true, 60, 0.13},
+	{[]byte("Tesla"), []byte("ModelY"), true, 78, 0.15},
+	{[]byte("BYD"), []byte("Han"), true, 76.9, 0.16},
+	{[]byte("NIO"), []byte("ES6"), true, 75, 0.18},
+	{[]byte("Volkswagen"), []byte("Lavida"), false, 50, 0.065},
+	{[]byte("Toyota"), []byte("Corolla"), false, 50, 0.06},
+	{[]byte("Honda"), []byte("Accord"), false, 56, 0.07},
+	{[]byte("Geely"), []byte("Emgrand"), false, 50, 0.068},
+}
+
+// 城市中心的经纬度，车辆的住址和目的地分布在城市中心附近
+var cityCenters = [][2]float64{
+	{30.6586, 104.0647}, // 成都
+	{39.9042, 116.4074}, // 北京
+	{31.2304, 121.4737}, // 上海
+	{23.1291, 113.2644}, // 广州
+	{22.5431, 114.0579}, // 深圳
+	{30.2741, 120.1551}, // 杭州
+}
+
+// telemetryProfile 车辆不随时间变化的属性
+type telemetryProfile struct {
+	id       int64
+	model    *vehicleModel
+	city     int
+	home     [2]float64
+	daily    float64 // 平均每天行驶的公里数
+	perKm    float64 // 每公里消耗的油量(电量)百分比
+	cycle    float64 // 两次加油(充电)之间行驶的公里数
+	phase    float64 // 第一天加油(充电)周期的相位
+	baseOdo  float64 // 开始时的里程
+	startDay int64
+}
+
+func newTelemetryProfile(id int64, start time.Time) *telemetryProfile {
+	u := func(salt int64) float64 { return common.Uniform(telemetrySeed+salt, id, -1) }
+	p := &telemetryProfile{
+		id:       id,
+		model:    &vehicleModels[int(u(1)*float64(len(vehicleModels)))],
+		city:     int(u(2) * float64(len(cityCenters))),
+		daily:    30 + 50*u(3),
+		baseOdo:  math.Floor(1000 + 80000*u(4)),
+		startDay: localDay(start),
+	}
+	center := cityCenters[p.city]
+	p.home = [2]float64{center[0] + (u(5)-0.5)*0.2, center[1] + (u(6)-0.5)*0.2}
+	p.perKm = p.model.usage / p.model.capacity * 100
+	// 每天最多行驶1.5倍的平均距离，夜间加油(充电)后当天不会低于minLevel
+	p.cycle = (maxLevel - minLevel - 1.5*p.daily*p.perKm) / p.perKm
+	p.phase = u(7) * p.cycle
+	return p
+}
+
+func localDay(t time.Time) int64 {
+	return int64(math.Floor(float64(t.Add(localOffset).Unix()) / secondsPerDay))
+}
+
+func (p *telemetryProfile) uniform(salt, day, index int64) float64 {
+	return common.Uniform(telemetrySeed+salt, p.id, day*16+index)
+}
+
+// dayNoise 每天行驶距离的扰动，第d天的距离为daily+noise(d+1)-noise(d)，累计里程不需要逐天求和
+func (p *telemetryProfile) dayNoise(day int64) float64 {
+	return p.daily / 4 * (2*p.uniform(10, day, 0) - 1)
+}
+
+// odometer 第day天开始时的里程
+func (p *telemetryProfile) odometer(day int64) float64 {
+	return p.baseOdo + float64(day-p.startDay)*p.daily + p.dayNoise(day) - p.dayNoise(p.startDay)
+}
+
+// trip 一天中的一个行程，从origin行驶到destination，先向东西方向行驶再向南北方向行驶
+type trip struct {
+	start       float64 // 当天开始怠速的秒数
+	idleBefore  float64
+	duration    float64 // 行驶的秒数
+	idleAfter   float64
+	distance    float64 // km
+	stops       float64 // 行驶中停车的次数
+	origin      [2]float64
+	destination [2]float64
+}
+
+// trips 第day天的行程，去程和返程成对出现
+func (p *telemetryProfile) trips(day int64) []trip {
+	pairs := 1
+	if p.uniform(11, day, 0) < 0.5 {
+		pairs = 2
+	}
+	count := 2 * pairs
+	distance := p.daily + p.dayNoise(day+1) - p.dayNoise(day)
+	weights := make([]float64, count)
+	var sum float64
+	for j := range weights {
+		weights[j] = 0.5 + p.uniform(12, day, int64(j))
+		sum += weights[j]
+	}
+
+	trips := make([]trip, count)
+	slot := float64(dayWindow) / float64(count)
+	for j := range trips {
+		t := &trips[j]
+		t.distance = distance * weights[j] / sum
+		speed := 25 + 25*p.uniform(13, day, int64(j)) // 平均车速km/h
+		t.duration = t.distance / speed * 3600
+		t.idleBefore = 60 + 120*p.uniform(14, day, int64(j))
+		t.idleAfter = 30 + 60*p.uniform(15, day, int64(j))
+		t.start = dayStart + float64(j)*slot + p.uniform(16, day, int64(j))*math.Max(0, slot-t.idleBefore-t.duration-t.idleAfter)
+		t.stops = math.Max(1, math.Round(t.duration/60/stopInterval))
+
+		k := int64(j / 2)
+		center := p.home
+		place := [2]float64{center[0] + (p.uniform(17, day, k)-0.5)*0.16, center[1] + (p.uniform(18, day, k)-0.5)*0.16}
+		if j%2 == 0 {
+			t.origin, t.destination = p.home, place
+		} else {
+			t.origin, t.destination = place, p.home
+		}
+	}
+	return trips
+}
+
+// travelled 行驶elapsed秒后的距离和车速，每次停车之间车速为V*(1-cos)，平均车速V
+func (t *trip) travelled(elapsed float64) (distance, speed float64) {
+	v := t.distance / t.duration // km/s
+	w := 2 * math.Pi * t.stops / t.duration
+	return v * (elapsed - math.Sin(w*elapsed)/w), v * (1 - math.Cos(w*elapsed)) * 3600
+}
+
+// position 沿着先东西后南北的路线行驶了fraction比例时的经纬度和方向
+func (t *trip) position(fraction float64) (lat, lon, heading float64) {
+	dLon := t.destination[1] - t.origin[1]
+	dLat := t.destination[0] - t.origin[0]
+	// 经度方向的距离按纬度缩放
+	scale := math.Cos(t.origin[0] * math.Pi / 180)
+	first := math.Abs(dLon) * scale
+	total := first + math.Abs(dLat)
+	covered := fraction * total
+	if covered < first {
+		heading = 90
+		if dLon < 0 {
+			heading = 270
+		}
+		return t.origin[0], t.origin[1] + dLon*covered/first, heading
+	}
+	heading = 0
+	if dLat < 0 {
+		heading = 180
+	}
+	if total == first {
+		return t.destination[0], t.destination[1], heading
+	}
+	return t.origin[0] + dLat*(covered-first)/(total-first), t.destination[1], heading
+}
+
+// telemetryState 某个时刻车辆的状态
+type telemetryState struct {
+	lat, lon, speed, heading, odometer, level float64
+	engine                                    int64
+}
+
+func (p *telemetryProfile) state(ts time.Time) telemetryState {
+	day := localDay(ts)
+	local := ts.Add(localOffset)
+	seconds := float64(local.Unix()-day*secondsPerDay) + float64(local.Nanosecond())/1e9
+
+	odoDay := p.odometer(day)
+	s := telemetryState{lat: p.home[0], lon: p.home[1], odometer: odoDay}
+	var travelled float64
+	for _, t := range p.trips(day) {
+		if seconds < t.start {
+			break
+		}
+		drive := t.start + t.idleBefore
+		arrive := drive + t.duration
+		switch {
+		case seconds < drive:
+			s.lat, s.lon = t.origin[0], t.origin[1]
+			s.engine = EngineIdle
+		case seconds < arrive:
+			distance, speed := t.travelled(seconds - drive)
+			s.lat, s.lon, s.heading = t.position(distance / t.distance)
+			s.speed = speed
+			s.engine = EngineDriving
+			travelled += distance
+		default:
+			s.lat, s.lon, s.heading = t.position(1)
+			s.engine = EngineOff
+			if seconds < arrive+t.idleAfter {
+				s.engine = EngineIdle
+			}
+			travelled += t.distance
+		}
+		if s.engine != EngineOff {
+			break
+		}
+	}
+	s.odometer = odoDay + travelled
+
+	// 夜间加油(充电)，每天开始时的油量(电量)按累计里程在加油周期中的位置计算
+	used := math.Mod(odoDay-p.baseOdo+p.phase, p.cycle)
+	if used < 0 {
+		used += p.cycle
+	}
+	s.level = maxLevel - (used+travelled)*p.perKm
+	return s
+}
+
+type telemetryMeasurement struct {
+	profile *telemetryProfile
+}
+
+// NewTelemetryVehicle 使用telemetry模型的车辆，VIN与NewVehicle相同
+func NewTelemetryVehicle(i int, offset int, start time.Time) Vehicle {
+	return Vehicle{
+		Name:                  vehicleName(int64(i + offset)),
+		SimulatedMeasurements: []common.SimulatedMeasurement{&telemetryMeasurement{profile: newTelemetryProfile(int64(i+offset), start)}},
+	}
+}
+
+// ToPoint 根据point的时间戳计算车辆状态，电动车的fuel_level和燃油车的soc为缺失的字段
+func (m *telemetryMeasurement) ToPoint(p *common.Point) bool {
+	profile := m.profile
+	s := profile.state(*p.Timestamp)
+	p.SetMeasurementName(TelemetryByteString)
+	p.AppendTag(TelemetryTagKeys[0], profile.model.brand)
+	p.AppendTag(TelemetryTagKeys[1], profile.model.model)
+
+	var rpm int64
+	voltage := 12.4
+	switch {
+	case s.engine == EngineOff:
+	case profile.model.electric:
+		rpm = int64(s.speed * 110)
+		voltage = 13.8
+	default:
+		rpm = 750 + int64(s.speed*25)
+		voltage = 14.1
+	}
+
+	p.AppendField(TelemetryFieldKeys[0], round(s.lat, 1e6))
+	p.AppendField(TelemetryFieldKeys[1], round(s.lon, 1e6))
+	p.AppendField(TelemetryFieldKeys[2], round(s.speed, 10))
+	p.AppendField(TelemetryFieldKeys[3], s.heading)
+	p.AppendField(TelemetryFieldKeys[4], round(s.odometer, 10))
+	p.AppendField(TelemetryFieldKeys[5], round(s.level, 10))
+	p.AppendField(TelemetryFieldKeys[6], round(s.level, 10))
+	p.AppendField(TelemetryFieldKeys[7], voltage)
+	if profile.model.electric {
+		p.SetFieldNull(5)
+	} else {
+		p.SetFieldNull(6)
+	}
+	p.AppendInt64Field(TelemetryInt64FieldKeys[0], s.engine)
+	p.AppendInt64Field(TelemetryInt64FieldKeys[1], rpm)
+	return true
+}
+
+func round(v, scale float64) float64 {
+	return math.Round(v*scale) / scale
+}
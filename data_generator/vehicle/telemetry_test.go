@@ -0,0 +1,81 @@
+package vehicle
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+func TestTelemetryState(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := int64(0); id < 20; id++ {
+		p := newTelemetryProfile(id, start)
+		center := cityCenters[p.city]
+		prev := p.state(start)
+		var driving int
+		for ts := start.Add(10 * time.Second); ts.Before(start.Add(72 * time.Hour)); ts = ts.Add(10 * time.Second) {
+			s := p.state(ts)
+			if s != p.state(ts) {
+				t.Fatal("state is not reproducible")
+			}
+			if s.odometer < prev.odometer-1e-6 {
+				t.Fatalf("vehicle %d odometer decreases at %s: %v -> %v", id, ts, prev.odometer, s.odometer)
+			}
+			// 只在每天开始时加油(充电)
+			if s.level > prev.level && localDay(ts) == localDay(ts.Add(-10*time.Second)) {
+				t.Fatalf("vehicle %d refuels while driving at %s", id, ts)
+			}
+			if s.level < minLevel || s.level > maxLevel {
+				t.Fatalf("vehicle %d level out of range: %v", id, s.level)
+			}
+			if (s.speed > 0) != (s.engine == EngineDriving) && s.speed > 1e-6 {
+				t.Fatalf("vehicle %d speed %v in engine state %d", id, s.speed, s.engine)
+			}
+			if s.speed > 100+1e-6 || math.Abs(s.lat-center[0]) > 0.2 || math.Abs(s.lon-center[1]) > 0.2 {
+				t.Fatalf("vehicle %d unexpected state %+v", id, s)
+			}
+			if s.engine == EngineDriving {
+				driving++
+			}
+			prev = s
+		}
+		// 每天行驶15~120km，平均车速25~50km/h，每天行驶0.3~4.8小时
+		if driving < 3*1080/10 || driving > 3*5*3600/10 {
+			t.Fatalf("vehicle %d drives %d points in 3 days", id, driving)
+		}
+	}
+}
+
+func TestTelemetrySimulator(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &VehicleSimulatorConfig{
+		Start:            start,
+		End:              start.Add(24 * time.Hour),
+		SamplingInterval: time.Minute,
+		DeviceCount:      10,
+		Telemetry:        true,
+		SqlTemplates:     []string{"select * from vehicle_telemetry where brand = '{brand}' and lat > {lat_min} and lat < {lat_max} and time > '{now}'-1h"},
+	}
+	sim := cfg.ToSimulator()
+	p := common.MakeUsablePoint()
+	for sim.Next(p) <= sim.Total() {
+		if string(p.MeasurementName) != "vehicle_telemetry" || len(p.TagKeys) != 3 || string(p.TagKeys[1]) != "brand" {
+			t.Fatalf("unexpected point %s %s", p.MeasurementName, p.TagKeys)
+		}
+		// 电动车没有fuel_level，燃油车没有soc
+		if p.NullCount() != 1 || p.FieldIsNull(5) == p.FieldIsNull(6) {
+			t.Fatalf("unexpected null fields %v", p.NullFields)
+		}
+		p.Reset()
+	}
+
+	var buf bytes.Buffer
+	sim.NextSql(&buf)
+	if strings.Contains(buf.String(), "{") || !strings.Contains(buf.String(), "lat > ") {
+		t.Fatalf("unexpected sql %s", buf.String())
+	}
+}
@@ -39,13 +39,18 @@ func NewVehicle(i int, offset int, start time.Time) Vehicle {
 
 	h := Vehicle{
 		// Tag Values that are static throughout the life of a Host:
-		Name:                  []byte(fmt.Sprintf("LSVNV2182E%09d", i+offset)),
+		Name:                  vehicleName(int64(i + offset)),
 		SimulatedMeasurements: sm,
 	}
 
 	return h
 }
 
+// vehicleName 车辆的VIN，例如LSVNV2182E000000001
+func vehicleName(id int64) []byte {
+	return []byte(fmt.Sprintf("LSVNV2182E%09d", id))
+}
+
 func (v *Vehicle) NumMeasurements() int {
 	return len(v.SimulatedMeasurements)
 }
@@ -2,8 +2,13 @@ package db_client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -294,3 +299,561 @@ func BenchmarkOpentsdb(b *testing.B) {
 	// fmt.Println(string(buf))
 
 }
+
+func TestIotdbSerialize(t *testing.T) {
+	ic := NewIotdbClient(ClientConfig{Database: "benchmark_db"})
+	cfg := &vehicle.VehicleSimulatorConfig{
+		Start:            time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:              time.Date(2018, 1, 1, 0, 1, 0, 0, time.UTC),
+		SamplingInterval: time.Second,
+		DeviceCount:      2,
+	}
+	sim := cfg.ToSimulator()
+	point := common.MakeUsablePoint()
+	buf := make([]byte, 0, 4*1024)
+	for i := 0; i < 6; i++ {
+		sim.Next(point)
+		buf = ic.SerializeAndAppendPoint(buf, point)
+		point.Reset()
+	}
+	buf = ic.AfterSerializePoints(buf, point)
+
+	// 2个设备，每个设备一个tablet
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 tablets, got %d: %s", len(lines), buf)
+	}
+	for _, line := range lines {
+		var tablet struct {
+			DeviceId     string
+			Measurements []string
+			DataTypes    []string
+			Timestamps   []int64
+			Values       [][]interface{}
+		}
+		if err := json.Unmarshal([]byte(line), &tablet); err != nil {
+			t.Fatal(err, line)
+		}
+		if !strings.HasPrefix(tablet.DeviceId, "root.benchmark_db.vehicle.`") || len(tablet.Timestamps) != 3 ||
+			len(tablet.Values) != len(tablet.Measurements) || len(tablet.Values[0]) != 3 {
+			t.Fatalf("invalid tablet: %s", line)
+		}
+	}
+
+	// 序列化后清空缓存
+	if buf = ic.AfterSerializePoints(buf[:0], point); len(buf) != 0 {
+		t.Fatalf("tablets are not reset: %s", buf)
+	}
+}
+
+func TestIotdbFieldsChange(t *testing.T) {
+	ic := NewIotdbClient(ClientConfig{Database: "benchmark_db"})
+	ts := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	fields := []map[string]interface{}{
+		{"a": 1.5, "b": int64(2)},
+		{"b": int64(3), "c": "x"},
+		{"a": 2.5},
+	}
+	var buf []byte
+	for i, f := range fields {
+		ts := ts.Add(time.Duration(i) * time.Second)
+		p := common.MakeUsablePoint()
+		p.SetMeasurementName([]byte("t"))
+		p.SetTimestamp(&ts)
+		p.AppendTag([]byte("site_id"), []byte("DEV000000001"))
+		for _, k := range []string{"a", "c"} {
+			if v, ok := f[k]; ok {
+				p.AppendField([]byte(k), v)
+			}
+		}
+		if v, ok := f["b"]; ok {
+			p.AppendInt64Field([]byte("b"), v.(int64))
+		}
+		buf = ic.SerializeAndAppendPoint(buf, p)
+	}
+	buf = ic.AfterSerializePoints(buf, nil)
+
+	// 同一个设备的字段按名称对应列，缺少的字段填null
+	expect := `"measurements":["a","b","c"],"dataTypes":["DOUBLE","INT64","TEXT"],"timestamps":[1514764800000,1514764801000,1514764802000],` +
+		`"values":[[1.5000000000000000,null,2.5000000000000000],[2,3,null],[null,"x",null]]`
+	if !strings.Contains(string(buf), expect) {
+		t.Fatalf("iotdb tablet error: %s", buf)
+	}
+
+	// 不支持的字段类型在Write时返回错误
+	p := common.MakeUsablePoint()
+	p.SetMeasurementName([]byte("t"))
+	p.SetTimestamp(&ts)
+	p.AppendField([]byte("a"), complex(1, 2))
+	buf = ic.AfterSerializePoints(ic.SerializeAndAppendPoint(buf[:0], p), p)
+	if _, err := ic.Write(buf); err == nil {
+		t.Fatal("expect an error for the unsupported field type")
+	}
+}
+
+func TestElasticsearchSerialize(t *testing.T) {
+	ec := NewElasticsearchClient(ClientConfig{Database: "Benchmark_db"})
+	cfg := &vehicle.VehicleSimulatorConfig{
+		Start:            time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:              time.Date(2018, 1, 1, 0, 1, 0, 0, time.UTC),
+		SamplingInterval: time.Second,
+		DeviceCount:      2,
+	}
+	sim := cfg.ToSimulator()
+	point := common.MakeUsablePoint()
+	var points []*common.Point
+	buf := ec.BeforeSerializePoints(nil, point)
+	for i := 0; i < 4; i++ {
+		sim.Next(point)
+		buf = ec.SerializeAndAppendPoint(buf, point)
+		points = append(points, point)
+		point = common.MakeUsablePoint()
+	}
+	buf = ec.AfterSerializePoints(buf, point)
+
+	// 每个point一行action一行文档
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	if len(lines) != 2*len(points) {
+		t.Fatalf("expect %d lines, got %d: %s", 2*len(points), len(lines), buf)
+	}
+	for i, p := range points {
+		var action struct {
+			Index struct {
+				Index string `json:"_index"`
+			} `json:"index"`
+		}
+		if err := json.Unmarshal([]byte(lines[2*i]), &action); err != nil {
+			t.Fatal(err, lines[2*i])
+		}
+		if expect := "benchmark_db-" + strings.ToLower(string(p.MeasurementName)); action.Index.Index != expect {
+			t.Fatalf("expect index %s, got %s", expect, action.Index.Index)
+		}
+
+		doc := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(lines[2*i+1]), &doc); err != nil {
+			t.Fatal(err, lines[2*i+1])
+		}
+		if ms := doc[string(esTimestampField)]; ms != float64(p.Timestamp.UnixNano()/int64(time.Millisecond)) {
+			t.Fatalf("timestamp mismatch: %v %s", ms, lines[2*i+1])
+		}
+		for j, key := range p.TagKeys {
+			if doc[string(key)] != string(p.TagValues[j]) {
+				t.Fatalf("tag %s mismatch: %s", key, lines[2*i+1])
+			}
+		}
+		for j, key := range p.FieldKeys {
+			if v, ok := p.FieldValues[j].(float64); ok && doc[string(key)] != v {
+				t.Fatalf("field %s mismatch: %s", key, lines[2*i+1])
+			}
+		}
+		for j, key := range p.Int64FiledKeys {
+			if doc[string(key)] != float64(p.Int64FiledValues[j]) {
+				t.Fatalf("field %s mismatch: %s", key, lines[2*i+1])
+			}
+		}
+		if len(doc) != 1+len(p.TagKeys)+len(p.FieldKeys)+len(p.Int64FiledKeys) {
+			t.Fatalf("unexpected document: %s", lines[2*i+1])
+		}
+	}
+}
+
+func TestMysqlRows(t *testing.T) {
+	mc := &MysqlClient{ingest: MysqlIngestPrepare, groups: newPointGroups()}
+	point := common.MakeUsablePoint()
+	point.SetMeasurementName([]byte("t"))
+	point.AppendTag([]byte("site_id"), []byte("a\tb\\c"))
+	point.AppendField([]byte("tips"), "line1\nline2")
+	point.AppendInt64Field([]byte("aqi"), 23)
+	ts := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	point.SetTimestamp(&ts)
+
+	buf := mc.BeforeSerializePoints(nil, point)
+	buf = mc.SerializeAndAppendPoint(buf, point)
+	buf = mc.SerializeAndAppendPoint(buf, point)
+	buf = mc.AfterSerializePoints(buf, point)
+	table, columns, args, err := parseTsvRows(firstGroup(buf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table != "t" || columns != 4 || len(args) != 8 {
+		t.Fatalf("parse rows error: %s %d %v", table, columns, args)
+	}
+	if args[1] != "a\tb\\c" || args[2] != "line1\nline2" || args[3] != "23" {
+		t.Fatalf("unescape rows error: %q", args)
+	}
+}
+
+func TestParameterizeSql(t *testing.T) {
+	query, args := parameterizeSql("select * from vehicle where VIN in ('a','b''c') and time > '2018-01-01 00:00:00'")
+	if query != "select * from vehicle where VIN in (?,?) and time > ?" {
+		t.Fatalf("parameterize sql error: %s", query)
+	}
+	if len(args) != 3 || args[1] != "b'c" {
+		t.Fatalf("parameterize args error: %q", args)
+	}
+
+	statements := splitSqlStatements("select * from t where a = 'x;y';select 1; ")
+	if len(statements) != 2 || statements[0] != "select * from t where a = 'x;y'" || statements[1] != "select 1" {
+		t.Fatalf("split sql error: %q", statements)
+	}
+}
+
+func TestMatrixdbIngest(t *testing.T) {
+	point := common.MakeUsablePoint()
+	point.SetMeasurementName([]byte("t"))
+	point.AppendTag([]byte("site_id"), []byte("DEV000000001"))
+	point.AppendField([]byte("pm25"), 1.5)
+	point.AppendInt64Field([]byte("aqi"), 23)
+	ts := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	point.SetTimestamp(&ts)
+
+	mc := NewMatrixdbClient(ClientConfig{Host: "localhost", IngestMode: MatrixdbIngestInsert})
+	buf := mc.BeforeSerializePoints(nil, point)
+	buf = mc.SerializeAndAppendPoint(buf, point)
+	buf = mc.AfterSerializePoints(buf, point)
+	if !strings.HasPrefix(string(buf), "insert into public.t values('2018-01-01 00:00:00.000','DEV000000001',1.5") ||
+		!strings.HasSuffix(string(buf), ",23);") {
+		t.Fatalf("serialize insert error: %s", string(buf))
+	}
+
+	mc = NewMatrixdbClient(ClientConfig{Host: "localhost", IngestMode: MatrixdbIngestCopy, MxgatePort: 18086})
+	if string(mc.writeUrl) != "http://localhost:18086/" {
+		t.Fatalf("mxgate url error: %s", string(mc.writeUrl))
+	}
+	buf = mc.BeforeSerializePoints(nil, point)
+	buf = mc.SerializeAndAppendPoint(buf, point)
+	buf = mc.AfterSerializePoints(buf, point)
+	table, columns, args, err := parseTsvRows(firstGroup(buf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table != "public.t" || columns != 4 || args[0] != "2018-01-01 00:00:00.000" {
+		t.Fatalf("serialize copy rows error: %s %d %q", table, columns, args)
+	}
+
+	// mxgate的csv字符串中保留换行，包含空行时不能拆分一张表的数据
+	other := common.MakeUsablePoint()
+	other.SetMeasurementName([]byte("s"))
+	other.SetTimestamp(&ts)
+	other.AppendField([]byte("tips"), "a\n\nb")
+	mc = NewMatrixdbClient(ClientConfig{Host: "localhost", IngestMode: MatrixdbIngestMxgate})
+	buf = mc.BeforeSerializePoints(nil, other)
+	buf = mc.SerializeAndAppendPoint(buf, other)
+	buf = mc.SerializeAndAppendPoint(buf, point)
+	buf = mc.AfterSerializePoints(buf, other)
+	var groups []string
+	if _, err := writeGroups(buf, func(g []byte) (int64, error) {
+		groups = append(groups, string(g))
+		return 0, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || !strings.HasPrefix(groups[0], "public.s\n") || !strings.Contains(groups[0], "\"a\n\nb\"") ||
+		!strings.HasPrefix(groups[1], "public.t\n") {
+		t.Fatalf("mxgate groups error: %q", groups)
+	}
+}
+
+func firstGroup(body []byte) []byte {
+	var group []byte
+	writeGroups(body, func(g []byte) (int64, error) {
+		if group == nil {
+			group = g
+		}
+		return 0, nil
+	})
+	return group
+}
+
+func TestPointGroups(t *testing.T) {
+	points := make([]*common.Point, 0)
+	ts := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"cpu", "mem", "cpu", "mem", "disk"} {
+		point := common.MakeUsablePoint()
+		point.SetMeasurementName([]byte(name))
+		point.AppendTag([]byte("hostname"), []byte("host_0"))
+		point.AppendField([]byte(name+"_usage"), 1.5)
+		point.SetTimestamp(&ts)
+		points = append(points, point)
+	}
+
+	mc := &MysqlClient{ingest: MysqlIngestInsert, groups: newPointGroups()}
+	buf := mc.BeforeSerializePoints(nil, points[0])
+	for _, point := range points {
+		buf = mc.SerializeAndAppendPoint(buf, point)
+	}
+	if len(buf) != 0 || mc.BufferedBytes() == 0 {
+		t.Fatalf("points are not buffered: %s %d", buf, mc.BufferedBytes())
+	}
+	buf = mc.AfterSerializePoints(buf, points[0])
+	statements := strings.Split(strings.TrimSuffix(string(buf), ";"), ";")
+	if len(statements) != 3 || !strings.HasPrefix(statements[0], "insert into cpu values") ||
+		strings.Count(statements[0], "),(") != 1 || !strings.HasPrefix(statements[2], "insert into disk values") {
+		t.Fatalf("group insert statements error: %s", buf)
+	}
+
+	mc = &MysqlClient{ingest: MysqlIngestLoadData, groups: newPointGroups()}
+	for _, point := range points {
+		buf = mc.SerializeAndAppendPoint(buf[:0], point)
+	}
+	buf = mc.AfterSerializePoints(buf, points[0])
+	tables := make([]string, 0)
+	rows := 0
+	writeGroups(buf, func(group []byte) (int64, error) {
+		table, columns, args, err := parseTsvRows(group, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+		rows += len(args) / columns
+		return 1, nil
+	})
+	if strings.Join(tables, ",") != "cpu,mem,disk" || rows != 5 || mc.BufferedBytes() != 0 {
+		t.Fatalf("group rows error: %v %d", tables, rows)
+	}
+}
+
+func TestCountFluxRows(t *testing.T) {
+	body := []byte("#datatype,string,long,dateTime:RFC3339,double\r\n#group,false,false,false,false\r\n#default,_result,,,\r\n,result,table,_time,_value\r\n,,0,2018-01-01T00:00:00Z,1.5\r\n,,0,2018-01-01T00:00:01Z,2.5\r\n\r\n" +
+		"#datatype,string,long,dateTime:RFC3339,double\r\n#group,false,false,false,false\r\n#default,_result,,,\r\n,result,table,_time,_value\r\n,,1,2018-01-01T00:00:00Z,3.5\r\n\r\n")
+	rows, err := countFluxRows(body)
+	if err != nil || rows != 3 {
+		t.Fatalf("count flux rows error: %d %v", rows, err)
+	}
+	rows, err = countFluxRows([]byte("#datatype,string,string\r\n#group,true,true\r\n#default,,\r\n,error,reference\r\n,failed to execute query,\r\n"))
+	if err == nil || rows != 0 {
+		t.Fatalf("flux error is not detected: %d %v", rows, err)
+	}
+}
+
+func TestOpentsdbAscii(t *testing.T) {
+	value := "渭南市-A1"
+	expect := strings.ReplaceAll(strconv.QuoteToASCII(value), "\\", "")
+	got := `"` + string(appendOpentsdbAscii(nil, []byte(value))) + `"`
+	if got != expect {
+		t.Fatalf("opentsdb ascii error: %s, expect %s", got, expect)
+	}
+}
+
+func TestInfluxManage(t *testing.T) {
+	sql := influxRetentionPolicySql("rp_7d", "benchmark_db", 7*24*time.Hour, true)
+	if sql != `CREATE RETENTION POLICY "rp_7d" ON "benchmark_db" DURATION 604800s REPLICATION 1 DEFAULT` {
+		t.Fatalf("retention policy sql error: %s", sql)
+	}
+	count, err := sumInfluxValues([]byte(`{"results":[{"statement_id":0,"series":[{"name":"vehicle","columns":["count"],"values":[[1000]]},{"name":"airq","columns":["count"],"values":[[24]]}]}]}`))
+	if err != nil || count != 1024 {
+		t.Fatalf("sum influx values error: %d %v", count, err)
+	}
+	_, err = sumInfluxValues([]byte(`{"results":[{"statement_id":0,"error":"database not found: benchmark_db"}]}`))
+	if err == nil {
+		t.Fatal("influx error is not detected")
+	}
+}
+
+func TestUnixSocketClient(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fctsdb.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/write" && ctx.Request.ConnectionClose() {
+			ctx.SetStatusCode(fasthttp.StatusNoContent)
+		} else {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		}
+	})
+
+	cli := NewFctsdbClient(ClientConfig{Host: UnixSocketPrefix + socketPath, Database: "benchmark_db", DisableKeepAlive: true})
+	if string(cli.writeUrl) != "http://localhost/write?db=benchmark_db" {
+		t.Fatalf("write url error: %s", cli.writeUrl)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cli.Write([]byte("cpu value=1 0\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	ts := time.Date(2018, 1, 1, 0, 0, 1, 234567891, time.UTC)
+	p := common.MakeUsablePoint()
+	p.SetMeasurementName([]byte("vehicle"))
+	p.SetTimestamp(&ts)
+	p.AppendField([]byte("value1"), 1.5)
+
+	cli := NewFctsdbClient(ClientConfig{Host: "http://localhost:8086", Database: "benchmark_db", Precision: PrecisionMicrosecond})
+	if !strings.Contains(string(cli.writeUrl), "&precision=u") {
+		t.Fatalf("fctsdb write url error: %s", cli.writeUrl)
+	}
+	if line := string(cli.SerializeAndAppendPoint(nil, p)); !strings.HasSuffix(line, " 1514764801234567\n") {
+		t.Fatalf("fctsdb serialize error: %s", line)
+	}
+
+	v2 := NewInfluxdbV2Client(ClientConfig{Host: "http://localhost:8086", Database: "benchmark_db", Precision: PrecisionSecond})
+	if !strings.HasSuffix(string(v2.writeUrl), "&precision=s") {
+		t.Fatalf("influxdbv2 write url error: %s", v2.writeUrl)
+	}
+	if line := string(v2.SerializeAndAppendPoint(nil, p)); !strings.HasSuffix(line, " 1514764801\n") {
+		t.Fatalf("influxdbv2 serialize error: %s", line)
+	}
+
+	// 不支持的精度按纳秒处理
+	cli = NewFctsdbClient(ClientConfig{Host: "http://localhost:8086", Database: "benchmark_db", Precision: "m"})
+	if !strings.Contains(string(cli.writeUrl), "&precision=ns") {
+		t.Fatalf("fctsdb write url error: %s", cli.writeUrl)
+	}
+	if line := string(cli.SerializeAndAppendPoint(nil, p)); !strings.HasSuffix(line, " 1514764801234567891\n") {
+		t.Fatalf("fctsdb serialize error: %s", line)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	ts := time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC)
+	p := common.MakeUsablePoint()
+	p.SetMeasurementName([]byte("air quality"))
+	p.SetTimestamp(&ts)
+	p.AppendTag([]byte("site id"), []byte(`西安 a,b="c'd\e`))
+	p.AppendField([]byte("tips"), `say "hi", it's a\b`)
+	p.AppendInt64Field([]byte("aqi"), 23)
+
+	line := string(appendLineProtocol(nil, p, ""))
+	expect := `air\ quality,site\ id=西安\ a\,b\="c'd\e tips="say \"hi\", it's a\\b",aqi=23i 1514764801000000000` + "\n"
+	if line != expect {
+		t.Fatalf("line protocol escape error: %s", line)
+	}
+	if name := string(appendOpentsdbName(nil, []byte("a b/西"))); name != "au0020b/u897f" {
+		t.Fatalf("opentsdb name error: %s", name)
+	}
+
+	checkFormats(t, p)
+}
+
+func TestLineNewline(t *testing.T) {
+	ts := time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC)
+	p := common.MakeUsablePoint()
+	p.SetMeasurementName([]byte("t"))
+	p.SetTimestamp(&ts)
+	p.AppendTag([]byte("site_id"), []byte("a\nb"))
+	p.AppendField([]byte("tips"), "line1\r\nline2")
+
+	// 换行符替换为空格，一个point只占一行
+	line := string(appendLineProtocol(nil, p, ""))
+	if line != `t,site_id=a\ b tips="line1  line2" 1514764801000000000`+"\n" {
+		t.Fatalf("line protocol newline error: %s", line)
+	}
+
+	// mqtt的line载荷为topic和payload两行
+	cli := NewDBClient("mqtt", ClientConfig{MqttPayload: "line", MqttTopic: "t/{site_id}"})
+	defer cli.Close()
+	buf := cli.SerializeAndAppendPoint(nil, p)
+	if lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n"); len(lines) != 2 || lines[0] != "t/a_b" {
+		t.Fatalf("mqtt line payload error: %q", buf)
+	}
+
+	// topic中的关键字不是measurement也不是tag时报错，不生成空的层级
+	mc := cli.(*MqttClient)
+	if err := mc.CheckTopic(p); err != nil {
+		t.Fatal(err)
+	}
+	mc, _ = NewMqttClient(ClientConfig{MqttTopic: "t/{site}"})
+	if err := mc.CheckTopic(p); err == nil {
+		t.Fatal("expect unknown topic keyword error")
+	}
+	buf = mc.SerializeAndAppendPoint(nil, p)
+	if _, err := mc.Write(buf); err == nil || !strings.Contains(err.Error(), "no tag 'site'") {
+		t.Fatalf("expect missing topic tag error, got %v", err)
+	}
+}
+
+func TestNullFields(t *testing.T) {
+	ts := time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC)
+	p := common.MakeUsablePoint()
+	p.SetMeasurementName([]byte("t"))
+	p.SetTimestamp(&ts)
+	p.AppendTag([]byte("site_id"), []byte("DEV000000001"))
+	p.AppendField([]byte("pm25"), 1.5)
+	p.AppendField([]byte("tips"), "ok")
+	p.AppendInt64Field([]byte("aqi"), 23)
+	p.AppendInt64Field([]byte("no2"), 7)
+	p.SetFieldNull(0)
+	p.SetInt64FieldNull(1)
+	if p.ValueCount() != 2 || p.NullCount() != 2 {
+		t.Fatalf("null count error: %d %d", p.ValueCount(), p.NullCount())
+	}
+
+	line := string(appendLineProtocol(nil, p, ""))
+	if line != "t,site_id=DEV000000001 tips=\"ok\",aqi=23i 1514764801000000000\n" {
+		t.Fatalf("line protocol with null fields error: %s", line)
+	}
+	mc := &MysqlClient{ingest: MysqlIngestInsert, groups: newPointGroups()}
+	if row := string(mc.appendInsertRow(nil, p)); !strings.HasSuffix(row, ",NULL,\"ok\",23,NULL),") {
+		t.Fatalf("mysql insert with null fields error: %s", row)
+	}
+
+	checkFormats(t, p)
+}
+
+// checkFormats 按每种格式序列化p，再用对应的解析器解析，和p展开的cell比较
+func checkFormats(t *testing.T, p *common.Point) {
+	cases := []struct {
+		format string
+		c      ClientConfig
+	}{
+		{"fctsdb", ClientConfig{}},
+		{"opentsdb", ClientConfig{}},
+		{"elasticsearch", ClientConfig{Database: "benchmark_db"}},
+		{"iotdb", ClientConfig{Database: "benchmark_db"}},
+		{"mqtt", ClientConfig{MqttPayload: "json", MqttTopic: "bench/{measurement}"}},
+		{"mysql", ClientConfig{IngestMode: MysqlIngestInsert}},
+		{"mysql", ClientConfig{IngestMode: MysqlIngestLoadData}},
+		{"matrixdb", ClientConfig{IngestMode: MatrixdbIngestMxgate}},
+		{"matrixdb", ClientConfig{IngestMode: MatrixdbIngestCopy}},
+		{"matrixdb", ClientConfig{IngestMode: MatrixdbIngestInsert}},
+	}
+	for _, c := range cases {
+		cli := NewDBClient(c.format, c.c)
+		parser, err := NewFormatParser(c.format, c.c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := cli.BeforeSerializePoints(nil, p)
+		buf = cli.SerializeAndAppendPoint(buf, p)
+		buf = cli.AfterSerializePoints(buf, p)
+		cells, err := parser.Parse(buf)
+		if err != nil {
+			t.Fatalf("%s %s parse error: %s\n%s", c.format, c.c.IngestMode, err.Error(), buf)
+		}
+		if diffs := CompareCells(parser.Cells([]*common.Point{p}), cells, 10); len(diffs) > 0 {
+			t.Fatalf("%s %s mismatch: %v\n%s", c.format, c.c.IngestMode, diffs, buf)
+		}
+		cli.Close()
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	influx, err := parseInfluxResult([]byte(`{"results":[{"statement_id":0,"series":[` +
+		`{"name":"air_quality","tags":{"city":"b"},"columns":["time","aqi"],"values":[["2018-01-01T08:00:00Z",2]]},` +
+		`{"name":"air_quality","tags":{"city":"a"},"columns":["time","aqi"],"values":[["2018-01-01T00:00:00Z",1.0000000001]]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := &QueryResult{Series: []ResultSeries{{
+		Columns: []string{"aqi", "city", "time"},
+		Values: [][]interface{}{
+			{int64(1), "a", "2018-01-01 00:00:00"},
+			{"2", "b", time.Date(2018, 1, 1, 16, 0, 0, 0, time.FixedZone("", 8*3600))},
+		},
+	}}}
+	if diff := CompareResults(influx, sql, 1e-6); diff != "" {
+		t.Fatal(diff)
+	}
+	sql.Series[0].Values[0][0] = 1.1
+	if diff := CompareResults(influx, sql, 1e-6); diff == "" {
+		t.Fatal("expected mismatch")
+	}
+	if _, err := parseInfluxResult([]byte(`{"results":[{"statement_id":0,"error":"measurement not found"}]}`)); err == nil {
+		t.Fatal("expected query error")
+	}
+}
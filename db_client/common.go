@@ -1,14 +1,24 @@
 package db_client
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"github.com/valyala/fasthttp"
 )
 
-var SupportedFormat []string = []string{"fctsdb", "mysql", "influxdbv2", "matrixdb", "opentsdb"}
+// UnixSocketPrefix 通过unix domain socket连接数据库时地址的前缀，例如unix:///var/run/fctsdb.sock
+const UnixSocketPrefix = "unix://"
+
+// ErrNotSupported 数据库不支持某个管理操作时返回，调用方可以用errors.Is判断后忽略或者换用其他方式
+var ErrNotSupported = errors.New("operation is not supported")
+
+var SupportedFormat []string = []string{"fctsdb", "mysql", "influxdbv2", "matrixdb", "opentsdb", "elasticsearch", "mqtt", "iotdb"}
 
 type ClientConfig struct {
 	Host     string
@@ -18,6 +28,23 @@ type ClientConfig struct {
 	Password string
 	// Debug label for more informative errors.
 	DebugInfo string
+
+	IngestMode   string // 写入方式，mysql支持insert、prepare、load-data，matrixdb支持mxgate、copy、insert
+	PrepareQuery bool   // 查询时是否使用服务端prepared statement
+	MxgatePort   int    // matrixdb使用mxgate写入时mxgate的http端口
+	QueryLang    string // 查询语言，influxdbv2支持influxql、flux
+	Precision    string // 写入时间戳的精度，fctsdb和influxdbv2支持ns、us、ms、s，默认ns
+
+	// http连接池相关配置，当前fctsdb、influxdbv2、opentsdb生效
+	MaxConnsPerHost  int           // 每个host的最大连接数，0表示使用fasthttp默认值
+	IdleConnTimeout  time.Duration // 空闲连接的保持时间，0表示使用DefaultIdleConnectionTimeout
+	DisableKeepAlive bool          // 每个请求结束后关闭连接，用于模拟连接频繁建立的场景
+
+	// mqtt相关配置
+	MqttTopic    string // topic模板，关键字为tag名称或者measurement，例如airq/{province}/{site_id}
+	MqttQos      int    // 发布消息的QoS，0/1/2
+	MqttPayload  string // 载荷格式，json或者line
+	MqttPerBatch bool   // 是否把一个batch中相同topic的point合并为一条消息
 }
 
 type DBClient interface {
@@ -26,11 +53,21 @@ type DBClient interface {
 
 	InitUser() error
 	LoginUser() error
-	// ListDatabases() ([]string, error)
 	CreateDatabase(name string, withException bool) error
 	CreateMeasurement(p *common.Point) error
 	CheckConnection(timeout time.Duration) bool
 
+	// 数据库生命周期管理和状态查询，数据库不支持的操作返回ErrNotSupported
+	ListDatabases() ([]string, error)
+	DropDatabase(name string) error
+	DropMeasurement(name string) error
+	// 返回当前database中的时间线数量，时间线的定义和数据库一致，例如iotdb中每个物理量为一条时间线
+	SeriesCount() (int64, error)
+	// duration为0表示永久保留，isDefault表示设为database默认的保留策略
+	CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error
+	// 把已写入的数据刷新到磁盘或者使其对查询可见
+	Flush() error
+
 	// 序列化器，序列化一个batch为目标，分为三个阶段。返回结果是append到一个bytes数组中。
 	// 1、准备阶段，添加一些头信息或者类似mysql的列信息
 	BeforeSerializePoints(buf []byte, p *common.Point) []byte
@@ -42,6 +79,12 @@ type DBClient interface {
 	Close()
 }
 
+// BufferedClient 在SerializeAndAppendPoint中把point缓存在客户端内部、由AfterSerializePoints统一输出的客户端，
+// 例如按设备组织tablet的iotdb、按表分组的mysql和matrixdb，BufferedBytes返回已缓存数据的字节数，用于按字节数分批
+type BufferedClient interface {
+	BufferedBytes() int
+}
+
 func NewDBClient(dbclientType string, conf ClientConfig) DBClient {
 	switch dbclientType {
 	case "fctsdb":
@@ -58,6 +101,16 @@ func NewDBClient(dbclientType string, conf ClientConfig) DBClient {
 		return NewMatrixdbClient(conf)
 	case "opentsdb":
 		return NewOpentsdbClient(conf)
+	case "elasticsearch":
+		return NewElasticsearchClient(conf)
+	case "iotdb":
+		return NewIotdbClient(conf)
+	case "mqtt":
+		cli, err := NewMqttClient(conf)
+		if err != nil {
+			return nil
+		}
+		return cli
 	}
 	return nil
 }
@@ -93,6 +146,11 @@ func fastFormatAppend(v interface{}, buf []byte, singleQuotesForString bool) []b
 	}
 }
 
+// notSupported 返回包装了ErrNotSupported的错误
+func notSupported(format, operation string) error {
+	return fmt.Errorf("%s: %s %w", format, operation, ErrNotSupported)
+}
+
 func IsSupportedFormat(format string) bool {
 	for _, f := range SupportedFormat {
 		if format == f {
@@ -101,3 +159,34 @@ func IsSupportedFormat(format string) bool {
 	}
 	return false
 }
+
+// parseHttpHost 解析数据库地址，去掉末尾的'/'。unix socket地址返回占位的http host和socket文件路径，
+// 例如unix:///var/run/fctsdb.sock返回http://localhost和/var/run/fctsdb.sock
+func parseHttpHost(addr string) (host []byte, socketPath string) {
+	if strings.HasPrefix(addr, UnixSocketPrefix) {
+		addr, socketPath = "http://localhost", strings.TrimPrefix(addr, UnixSocketPrefix)
+	}
+	host = []byte(strings.TrimSuffix(addr, "/"))
+	// 限制容量，避免调用方在host后append不同路径时共用底层数组
+	return host[:len(host):len(host)], socketPath
+}
+
+// configureHttpClient 根据ClientConfig设置fasthttp客户端的连接池和拨号方式
+func configureHttpClient(client *fasthttp.Client, c ClientConfig, socketPath string) {
+	client.MaxIdleConnDuration = DefaultIdleConnectionTimeout
+	if c.IdleConnTimeout > 0 {
+		client.MaxIdleConnDuration = c.IdleConnTimeout
+	}
+	if c.MaxConnsPerHost > 0 {
+		client.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.DisableKeepAlive {
+		// 连接存活时间超过MaxConnDuration后，fasthttp会在请求中带上Connection: close并在响应后关闭连接
+		client.MaxConnDuration = time.Nanosecond
+	}
+	if socketPath != "" {
+		client.Dial = func(addr string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package db_client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	put                   = []byte("PUT")
+	del                   = []byte("DELETE")
+	applicationJson       = []byte("application/json")
+	applicationNdjson     = []byte("application/x-ndjson")
+	esTimestampField      = []byte("timestamp")
+	esBulkErrorsFalse     = []byte(`"errors":false`)
+	esResponseMustContain = []byte(`"hits"`)
+)
+
+// ElasticsearchClient 写入和查询elasticsearch/opensearch，
+// 每个measurement对应一个索引，索引名为<database>-<measurement>，
+// 写入使用_bulk接口（NDJSON格式），查询使用Query DSL发送到<database>-*/_search。
+type ElasticsearchClient struct {
+	client    fasthttp.Client
+	c         ClientConfig
+	host      []byte
+	bulkUrl   []byte
+	searchUrl []byte
+	authValue []byte
+	buf       *bytes.Buffer
+
+	// DocType 不为空时，在bulk的action中添加_type，用于兼容elasticsearch 6.x
+	DocType string
+
+	indexNames map[string][]byte
+}
+
+func NewElasticsearchClient(c ClientConfig) *ElasticsearchClient {
+	var host []byte
+	if c.Host != "" {
+		host = []byte(strings.TrimSuffix(c.Host, "/"))
+	}
+	// example: http://localhost:9200/_bulk
+	bulkUrl := make([]byte, 0)
+	bulkUrl = append(bulkUrl, host...)
+	bulkUrl = append(bulkUrl, "/_bulk"...)
+
+	// example: http://localhost:9200/benchmark_db-*/_search
+	searchUrl := make([]byte, 0)
+	searchUrl = append(searchUrl, host...)
+	searchUrl = append(searchUrl, '/')
+	searchUrl = append(searchUrl, strings.ToLower(c.Database)...)
+	searchUrl = append(searchUrl, "-*/_search"...)
+
+	var authValue []byte
+	if c.User != "" {
+		authValue = []byte("Basic " + base64.StdEncoding.EncodeToString([]byte(c.User+":"+c.Password)))
+	}
+
+	return &ElasticsearchClient{
+		client: fasthttp.Client{
+			Name:                "elasticsearch",
+			MaxIdleConnDuration: DefaultIdleConnectionTimeout,
+		},
+		c:          c,
+		host:       host,
+		bulkUrl:    bulkUrl,
+		searchUrl:  searchUrl,
+		authValue:  authValue,
+		buf:        bytes.NewBuffer(make([]byte, 0, 8*1024)),
+		indexNames: make(map[string][]byte),
+	}
+}
+
+func (e *ElasticsearchClient) Write(body []byte) (int64, error) {
+	log.Debug("Write body", string(body))
+	req := fasthttp.AcquireRequest()
+	req.Header.SetContentTypeBytes(applicationNdjson)
+	req.Header.SetMethodBytes(post)
+	req.Header.SetRequestURIBytes(e.bulkUrl)
+	if e.authValue != nil {
+		req.Header.SetBytesV("Authorization", e.authValue)
+	}
+	if e.c.Gzip > 0 {
+		req.Header.Add("Content-Encoding", "gzip")
+		compressedBatch := bytes.NewBuffer(make([]byte, 0, 4*1024*1024))
+		fasthttp.WriteGzipLevel(compressedBatch, body, e.c.Gzip)
+		req.SetBody(compressedBatch.Bytes())
+	} else {
+		req.SetBody(body)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	start := time.Now()
+	err := e.client.Do(req, resp)
+	lat := time.Since(start).Nanoseconds()
+	if err == nil {
+		sc := resp.StatusCode()
+		// bulk接口中单条数据失败时状态码仍然是200，需要检查errors字段
+		if sc != fasthttp.StatusOK || !bytes.Contains(resp.Body(), esBulkErrorsFalse) {
+			err = fmt.Errorf("invalid write response (status %d): %s", sc, string(resp.Body()))
+		}
+	}
+	fasthttp.ReleaseResponse(resp)
+	fasthttp.ReleaseRequest(req)
+
+	return lat, err
+}
+
+func (e *ElasticsearchClient) Query(body []byte) (int64, error) {
+	log.Debug("Query body:", string(body))
+	req := fasthttp.AcquireRequest()
+	req.Header.SetContentTypeBytes(applicationJson)
+	req.Header.SetMethodBytes(post)
+	req.Header.SetRequestURIBytes(e.searchUrl)
+	if e.authValue != nil {
+		req.Header.SetBytesV("Authorization", e.authValue)
+	}
+	if e.c.Gzip > 0 {
+		req.Header.Add("Accept-Encoding", "gzip")
+	}
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	start := time.Now()
+	err := e.client.Do(req, resp)
+	lat := time.Since(start).Nanoseconds()
+	if err == nil {
+		sc := resp.StatusCode()
+		var respBody []byte
+		if string(resp.Header.Peek("Content-Encoding")) == "gzip" {
+			_, err := fasthttp.WriteGunzip(e.buf, resp.Body())
+			if err != nil {
+				log.Errorf("[ParseGzip] NewReader error: %v, maybe data is ungzip\n", err)
+			}
+			respBody = e.buf.Bytes()
+			e.buf.Reset()
+		} else {
+			respBody = resp.Body()
+		}
+
+		log.Debug("Query response body", string(respBody))
+
+		if sc != fasthttp.StatusOK || !bytes.Contains(respBody, esResponseMustContain) {
+			err = fmt.Errorf("invalid query response (status %d, db %s): %s", sc, e.c.Database, string(respBody))
+		}
+	}
+	fasthttp.ReleaseResponse(resp)
+	fasthttp.ReleaseRequest(req)
+
+	return lat, err
+}
+
+func (e *ElasticsearchClient) otherQuery(method []byte, path string, body []byte) (int, []byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetContentTypeBytes(applicationJson)
+	req.Header.SetMethodBytes(method)
+	req.Header.SetRequestURI(string(e.host) + path)
+	if e.authValue != nil {
+		req.Header.SetBytesV("Authorization", e.authValue)
+	}
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	err := e.client.Do(req, resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode(), append([]byte{}, resp.Body()...), nil
+}
+
+func (e *ElasticsearchClient) InitUser() error {
+	return nil
+}
+
+func (e *ElasticsearchClient) LoginUser() error {
+	return nil
+}
+
+// CreateDatabase elasticsearch中没有database的概念，database作为索引名的前缀，
+// 索引在写入时自动创建，索引的mapping由CreateMeasurement创建的索引模板决定。
+func (e *ElasticsearchClient) CreateDatabase(name string, withEncryption bool) error {
+	log.Infof("create database %s, use it as the prefix of the index name", name)
+	if withEncryption {
+		log.Warn("elasticsearch does not support create database with encryption, ignore it")
+	}
+	return nil
+}
+
+// CreateMeasurement 根据point的tag和field创建索引模板，tag映射为keyword类型，
+// field根据值的类型映射为double/float/long/boolean/keyword类型。
+func (e *ElasticsearchClient) CreateMeasurement(p *common.Point) error {
+	index := string(e.indexName(p.MeasurementName))
+	properties := make([]byte, 0, 1024)
+	properties = append(properties, '{')
+	properties = append(properties, `"timestamp":{"type":"date","format":"strict_date_optional_time||epoch_millis"}`...)
+	for _, tagKey := range p.TagKeys {
+		properties = append(properties, ',')
+		properties = appendJsonString(properties, tagKey)
+		properties = append(properties, `:{"type":"keyword"}`...)
+	}
+	for i, fieldKey := range p.FieldKeys {
+		properties = append(properties, ',')
+		properties = appendJsonString(properties, fieldKey)
+		switch p.FieldValues[i].(type) {
+		case float64:
+			properties = append(properties, `:{"type":"double"}`...)
+		case float32:
+			properties = append(properties, `:{"type":"float"}`...)
+		case int, int64:
+			properties = append(properties, `:{"type":"long"}`...)
+		case bool:
+			properties = append(properties, `:{"type":"boolean"}`...)
+		case string, []byte:
+			properties = append(properties, `:{"type":"keyword"}`...)
+		default:
+			return fmt.Errorf("unknown field type for %v", p.FieldValues[i])
+		}
+	}
+	for _, fieldKey := range p.Int64FiledKeys {
+		properties = append(properties, ',')
+		properties = appendJsonString(properties, fieldKey)
+		properties = append(properties, `:{"type":"long"}`...)
+	}
+	properties = append(properties, '}')
+
+	var mappings string
+	if e.DocType != "" {
+		mappings = fmt.Sprintf(`{"%s":{"properties":%s}}`, e.DocType, properties)
+	} else {
+		mappings = fmt.Sprintf(`{"properties":%s}`, properties)
+	}
+	template := fmt.Sprintf(`{"index_patterns":["%s*"],"mappings":%s}`, index, mappings)
+	log.Infof("create index template %s", index)
+	log.Debug(template)
+
+	// 使用legacy template接口，兼容elasticsearch 6.x/7.x和opensearch
+	statusCode, response, err := e.otherQuery(put, "/_template/"+index, []byte(template))
+	if err != nil {
+		return fmt.Errorf("create index template error: %s", err.Error())
+	}
+	if statusCode != fasthttp.StatusOK {
+		return fmt.Errorf("create index template returned status code: %d, body: %s", statusCode, string(response))
+	}
+	return nil
+}
+
+// listIndices 列出匹配pattern的索引名称
+func (e *ElasticsearchClient) listIndices(pattern string) ([]string, error) {
+	statusCode, response, err := e.otherQuery(get, "/_cat/indices/"+pattern+"?h=index&format=json", nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != fasthttp.StatusOK {
+		return nil, fmt.Errorf("list indices returned status code: %d, body: %s", statusCode, string(response))
+	}
+	var listing []struct {
+		Index string `json:"index"`
+	}
+	if err := json.Unmarshal(response, &listing); err != nil {
+		return nil, fmt.Errorf("list indices unmarshal error: %s", err.Error())
+	}
+	indices := make([]string, 0, len(listing))
+	for _, item := range listing {
+		indices = append(indices, item.Index)
+	}
+	return indices, nil
+}
+
+// deleteIndex 删除索引和CreateMeasurement创建的同名索引模板，不存在时忽略
+func (e *ElasticsearchClient) deleteIndex(index string) error {
+	for _, path := range []string{"/" + index, "/_template/" + index} {
+		statusCode, response, err := e.otherQuery(del, path, nil)
+		if err != nil {
+			return err
+		}
+		if statusCode != fasthttp.StatusOK && statusCode != fasthttp.StatusNotFound {
+			return fmt.Errorf("delete %s returned status code: %d, body: %s", path, statusCode, string(response))
+		}
+	}
+	return nil
+}
+
+// ListDatabases 索引名为<database>-<measurement>，返回所有索引名中的database部分
+func (e *ElasticsearchClient) ListDatabases() ([]string, error) {
+	indices, err := e.listIndices("*")
+	if err != nil {
+		return nil, err
+	}
+	databases := make([]string, 0)
+	exist := make(map[string]bool)
+	for _, index := range indices {
+		i := strings.LastIndexByte(index, '-')
+		if strings.HasPrefix(index, ".") || i <= 0 || exist[index[:i]] {
+			continue
+		}
+		exist[index[:i]] = true
+		databases = append(databases, index[:i])
+	}
+	log.Info("The following databases already exist in the data store: ", strings.Join(databases, ", "))
+	return databases, nil
+}
+
+// DropDatabase 逐个删除以<database>-开头的索引，避免依赖action.destructive_requires_name配置
+func (e *ElasticsearchClient) DropDatabase(name string) error {
+	log.Infof("drop database %s", name)
+	indices, err := e.listIndices(strings.ToLower(name) + "-*")
+	if err != nil {
+		return err
+	}
+	for _, index := range indices {
+		if err := e.deleteIndex(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ElasticsearchClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	return e.deleteIndex(string(e.indexName([]byte(name))))
+}
+
+func (e *ElasticsearchClient) SeriesCount() (int64, error) {
+	return 0, notSupported("elasticsearch", "series count")
+}
+
+func (e *ElasticsearchClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	return notSupported("elasticsearch", "retention policy")
+}
+
+// Flush 刷新database下的所有索引，使已写入的数据可以被查询到
+func (e *ElasticsearchClient) Flush() error {
+	statusCode, response, err := e.otherQuery(post, "/"+strings.ToLower(e.c.Database)+"-*/_refresh", nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != fasthttp.StatusOK {
+		return fmt.Errorf("refresh returned status code: %d, body: %s", statusCode, string(response))
+	}
+	return nil
+}
+
+func (e *ElasticsearchClient) CheckConnection(timeout time.Duration) bool {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethodBytes(get)
+	req.Header.SetRequestURI(fmt.Sprintf("%s/", e.host))
+	if e.authValue != nil {
+		req.Header.SetBytesV("Authorization", e.authValue)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second}
+
+	endTime := time.Now().Add(timeout)
+	log.Info("checking connection ")
+	fmt.Print("checking .")
+	defer fmt.Println()
+	for time.Now().Before(endTime) {
+		err := clientWithTimeout.Do(req, resp)
+		if err == nil && resp.StatusCode() == fasthttp.StatusOK {
+			return true
+		}
+		time.Sleep(2 * time.Second)
+		fmt.Print(".")
+	}
+	return false
+}
+
+func (e *ElasticsearchClient) indexName(measurement []byte) []byte {
+	if index, ok := e.indexNames[string(measurement)]; ok {
+		return index
+	}
+	index := []byte(strings.ToLower(e.c.Database + "-" + string(measurement)))
+	e.indexNames[string(measurement)] = index
+	return index
+}
+
+func (e *ElasticsearchClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+// SerializeAndAppendPoint 序列化为bulk接口的NDJSON格式，每个point两行，例如：
+// {"index":{"_index":"benchmark_db-city_air_quality"}}
+// {"timestamp":1514764800000,"site_id":"DEV000000001","aqi":23}
+func (e *ElasticsearchClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+	buf = append(buf, `{"index":{"_index":`...)
+	buf = appendJsonString(buf, e.indexName(p.MeasurementName))
+	if e.DocType != "" {
+		buf = append(buf, `,"_type":"`...)
+		buf = append(buf, e.DocType...)
+		buf = append(buf, '"')
+	}
+	buf = append(buf, "}}\n"...)
+
+	buf = append(buf, '{')
+	buf = appendJsonString(buf, esTimestampField)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, p.Timestamp.UTC().UnixNano()/int64(time.Millisecond), 10)
+	for i := 0; i < len(p.TagKeys); i++ {
+		buf = append(buf, ',')
+		buf = appendJsonString(buf, p.TagKeys[i])
+		buf = append(buf, ':')
+		buf = appendJsonString(buf, p.TagValues[i])
+	}
+	for i := 0; i < len(p.FieldKeys); i++ {
+		if p.FieldIsNull(i) {
+			continue
+		}
+		buf = append(buf, ',')
+		buf = appendJsonString(buf, p.FieldKeys[i])
+		buf = append(buf, ':')
+		switch v := p.FieldValues[i].(type) {
+		case string:
+			buf = appendJsonString(buf, []byte(v))
+		case []byte:
+			buf = appendJsonString(buf, v)
+		default:
+			buf = fastFormatAppend(v, buf, false)
+		}
+	}
+	for i := 0; i < len(p.Int64FiledKeys); i++ {
+		if p.Int64FieldIsNull(i) {
+			continue
+		}
+		buf = append(buf, ',')
+		buf = appendJsonString(buf, p.Int64FiledKeys[i])
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+	}
+	buf = append(buf, "}\n"...)
+	return buf
+}
+
+func (e *ElasticsearchClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+func (e *ElasticsearchClient) Close() {}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJsonString 将s作为json字符串添加到buf中，对引号、反斜杠和控制字符进行转义
+func appendJsonString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	for _, b := range s {
+		switch {
+		case b == '"' || b == '\\':
+			buf = append(buf, '\\', b)
+		case b == '\n':
+			buf = append(buf, '\\', 'n')
+		case b == '\r':
+			buf = append(buf, '\\', 'r')
+		case b == '\t':
+			buf = append(buf, '\\', 't')
+		case b < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+		default:
+			buf = append(buf, b)
+		}
+	}
+	buf = append(buf, '"')
+	return buf
+}
@@ -0,0 +1,173 @@
+package db_client
+
+import (
+	"bytes"
+	"strconv"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+// 各种格式需要转义的字符
+var (
+	lineMeasurementSpecial = []byte(", \n\r")
+	lineKeySpecial         = []byte(",= \n\r")
+	mysqlStringSpecial     = []byte("\"\\\n\r\x00")
+	csvSpecial             = []byte(",\"\n\r")
+)
+
+// 缺失字段在sql语句和LOAD DATA、COPY文本格式中的表示
+var (
+	sqlNull  = []byte("NULL")
+	tsvNull  = []byte("\\N")
+	jsonNull = []byte("null")
+)
+
+// appendLineProtocol 序列化为influxdb行协议，fctsdb、influxdbv2和mqtt的line载荷共用，例如：
+// air\ quality,city=西安,site_id=DEV000000001 aqi=23i,tips="a \"b\"" 1514764800000000000
+func appendLineProtocol(buf []byte, p *common.Point, precision string) []byte {
+	buf = appendLineEscaped(buf, p.MeasurementName, lineMeasurementSpecial)
+	for i := 0; i < len(p.TagKeys); i++ {
+		buf = append(buf, ',')
+		buf = appendLineEscaped(buf, p.TagKeys[i], lineKeySpecial)
+		buf = append(buf, '=')
+		buf = appendLineEscaped(buf, p.TagValues[i], lineKeySpecial)
+	}
+
+	// 缺失的字段不输出
+	sep := byte(' ')
+	for i := 0; i < len(p.FieldKeys); i++ {
+		if p.FieldIsNull(i) {
+			continue
+		}
+		buf = append(buf, sep)
+		sep = ','
+		buf = appendLineEscaped(buf, p.FieldKeys[i], lineKeySpecial)
+		buf = append(buf, '=')
+		switch v := p.FieldValues[i].(type) {
+		case string:
+			buf = appendLineString(buf, []byte(v))
+		case []byte:
+			buf = appendLineString(buf, v)
+		case int, int64:
+			// Influx uses 'i' to indicate integers:
+			buf = fastFormatAppend(v, buf, false)
+			buf = append(buf, 'i')
+		default:
+			buf = fastFormatAppend(v, buf, false)
+		}
+	}
+
+	for i := 0; i < len(p.Int64FiledKeys); i++ {
+		if p.Int64FieldIsNull(i) {
+			continue
+		}
+		buf = append(buf, sep)
+		sep = ','
+		buf = appendLineEscaped(buf, p.Int64FiledKeys[i], lineKeySpecial)
+		buf = append(buf, '=')
+		buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+		buf = append(buf, 'i')
+	}
+
+	buf = append(buf, ' ')
+	buf = appendTimestamp(buf, *p.Timestamp, precision)
+	buf = append(buf, '\n')
+	return buf
+}
+
+// appendLineEscaped 行协议的measurement、tag和field名称使用反斜杠转义special中的字符，
+// 行协议和mqtt的消息都按行分割，换行符替换为空格后转义
+func appendLineEscaped(buf []byte, s []byte, special []byte) []byte {
+	if bytes.IndexAny(s, string(special)) < 0 {
+		return append(buf, s...)
+	}
+	for _, b := range s {
+		if b == '\n' || b == '\r' {
+			b = ' '
+		}
+		if bytes.IndexByte(special, b) >= 0 {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// appendLineString 行协议的字符串field值使用双引号包裹，转义其中的"和\，换行符同样替换为空格
+func appendLineString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	for _, b := range s {
+		switch b {
+		case '"', '\\':
+			buf = append(buf, '\\', b)
+		case '\n', '\r':
+			buf = append(buf, ' ')
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return append(buf, '"')
+}
+
+// appendMysqlString mysql的字符串常量使用双引号包裹，使用反斜杠转义，例如"a \"b\""
+func appendMysqlString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	if bytes.IndexAny(s, string(mysqlStringSpecial)) < 0 {
+		buf = append(buf, s...)
+		return append(buf, '"')
+	}
+	for _, b := range s {
+		switch b {
+		case '"', '\\':
+			buf = append(buf, '\\', b)
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case 0:
+			buf = append(buf, '\\', '0')
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return append(buf, '"')
+}
+
+// appendPgString postgresql的字符串常量使用单引号包裹，单引号写两次，
+// standard_conforming_strings默认开启，反斜杠不需要转义
+func appendPgString(buf []byte, s []byte) []byte {
+	buf = append(buf, '\'')
+	for _, b := range s {
+		if b == '\'' {
+			buf = append(buf, '\'')
+		}
+		buf = append(buf, b)
+	}
+	return append(buf, '\'')
+}
+
+// appendCsvValue 包含分隔符、引号或者换行的值使用双引号包裹，引号写两次
+func appendCsvValue(buf []byte, s []byte) []byte {
+	if bytes.IndexAny(s, string(csvSpecial)) < 0 {
+		return append(buf, s...)
+	}
+	buf = append(buf, '"')
+	for _, b := range s {
+		if b == '"' {
+			buf = append(buf, '"')
+		}
+		buf = append(buf, b)
+	}
+	return append(buf, '"')
+}
+
+// appendSqlValue 按字段类型序列化sql中的值，字符串使用appendString转义
+func appendSqlValue(buf []byte, v interface{}, appendString func([]byte, []byte) []byte) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendString(buf, []byte(v))
+	case []byte:
+		return appendString(buf, v)
+	}
+	return fastFormatAppend(v, buf, false)
+}
@@ -18,6 +18,14 @@ import (
 
 const DefaultIdleConnectionTimeout = 90 * time.Second
 
+// 行协议时间戳的精度
+const (
+	PrecisionNanosecond  = "ns"
+	PrecisionMicrosecond = "us"
+	PrecisionMillisecond = "ms"
+	PrecisionSecond      = "s"
+)
+
 var (
 	post                = []byte("POST")
 	get                 = []byte("GET")
@@ -38,21 +46,28 @@ type FctsdbClient struct {
 
 // NewFctsdbClient returns a new HTTPWriter from the supplied HTTPWriterConfig.
 func NewFctsdbClient(c ClientConfig) *FctsdbClient {
+	c.Precision = checkPrecision(c.Precision)
 	var host []byte
+	var socketPath string
 	writeUrl := make([]byte, 0)
 	queryUrl := make([]byte, 0)
 	manageUrl := make([]byte, 0)
 	if c.Host != "" {
-		if c.Host[len(c.Host)-1] == '/' {
-			host = []byte(c.Host)[:len(c.Host)-1]
-		} else {
-			host = []byte(c.Host)
-		}
+		host, socketPath = parseHttpHost(c.Host)
 
 		// example: http://localhost:8086/write?db=db&u=user&p=password
 		writeUrl = append(writeUrl, host...)
 		writeUrl = append(writeUrl, "/write?db="...)
 		writeUrl = fasthttp.AppendQuotedArg(writeUrl, []byte(c.Database))
+		if c.Precision != "" {
+			// influxdb v1协议中微秒的精度写作u
+			writeUrl = append(writeUrl, "&precision="...)
+			if c.Precision == PrecisionMicrosecond {
+				writeUrl = append(writeUrl, 'u')
+			} else {
+				writeUrl = append(writeUrl, c.Precision...)
+			}
+		}
 		if c.User != "" {
 			writeUrl = append(writeUrl, "&u="...)
 			writeUrl = fasthttp.AppendQuotedArg(writeUrl, []byte(c.User))
@@ -82,10 +97,9 @@ func NewFctsdbClient(c ClientConfig) *FctsdbClient {
 		}
 		manageUrl = append(manageUrl, "q="...)
 	}
-	return &FctsdbClient{
+	cli := &FctsdbClient{
 		client: fasthttp.Client{
-			Name:                "fctsdb",
-			MaxIdleConnDuration: DefaultIdleConnectionTimeout,
+			Name: "fctsdb",
 		},
 		c:         c,
 		queryUrl:  queryUrl,
@@ -94,6 +108,8 @@ func NewFctsdbClient(c ClientConfig) *FctsdbClient {
 		host:      host,
 		buf:       bytes.NewBuffer(make([]byte, 0, 8*1024)),
 	}
+	configureHttpClient(&cli.client, c, socketPath)
+	return cli
 }
 
 // Write writes the given byte slice to the HTTP server described in the Writer's HTTPWriterConfig.
@@ -172,8 +188,29 @@ func (f *FctsdbClient) Query(body []byte) (int64, error) {
 	return lat, err
 }
 
+// QueryRows 执行查询并解析返回的json，用于比较不同数据库的查询结果
+func (f *FctsdbClient) QueryRows(body []byte) (*QueryResult, error) {
+	code, resp, err := f.databaseQuery(body)
+	if err != nil {
+		return nil, err
+	}
+	if code != fasthttp.StatusOK {
+		return nil, fmt.Errorf("invalid query response (status %d, db %s): %s", code, f.c.Database, string(resp))
+	}
+	return parseInfluxResult(resp)
+}
+
 func (f *FctsdbClient) otherQuery(body []byte) (int, []byte, error) {
-	uri := fasthttp.AppendQuotedArg(f.manageUrl, body)
+	return f.doQuery(f.manageUrl, body)
+}
+
+// databaseQuery 在当前database上执行管理语句，例如DROP MEASUREMENT
+func (f *FctsdbClient) databaseQuery(body []byte) (int, []byte, error) {
+	return f.doQuery(f.queryUrl, body)
+}
+
+func (f *FctsdbClient) doQuery(url []byte, body []byte) (int, []byte, error) {
+	uri := fasthttp.AppendQuotedArg(url, body)
 	log.Debug(string(uri))
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
@@ -190,7 +227,7 @@ func (f *FctsdbClient) otherQuery(body []byte) (int, []byte, error) {
 		return 0, nil, err
 	}
 	code := resp.StatusCode()
-	respBody := resp.Body()
+	respBody := append([]byte{}, resp.Body()...)
 
 	return code, respBody, nil
 }
@@ -206,7 +243,7 @@ func (f *FctsdbClient) LoginUser() error {
 func (f *FctsdbClient) CreateDatabase(name string, withEncryption bool) error {
 
 	log.Infof("create database %s", name)
-	existingDatabases, err := f.listDatabases()
+	existingDatabases, err := f.ListDatabases()
 	if err != nil {
 		return err
 	}
@@ -235,8 +272,8 @@ func (f *FctsdbClient) CreateDatabase(name string, withEncryption bool) error {
 	return nil
 }
 
-// listDatabases lists the existing databases in InfluxDB.
-func (f *FctsdbClient) listDatabases() ([]string, error) {
+// ListDatabases lists the existing databases in InfluxDB.
+func (f *FctsdbClient) ListDatabases() ([]string, error) {
 
 	statusCode, response, err := f.otherQuery([]byte("SHOW DATABASES"))
 	if err != nil {
@@ -276,6 +313,133 @@ func (f *FctsdbClient) CreateMeasurement(p *common.Point) error {
 	return nil
 }
 
+func (f *FctsdbClient) DropDatabase(name string) error {
+	log.Infof("drop database %s", name)
+	return f.execManage(f.otherQuery, fmt.Sprintf("DROP DATABASE %s", quoteInfluxIdent(name)))
+}
+
+func (f *FctsdbClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	return f.execManage(f.databaseQuery, fmt.Sprintf("DROP MEASUREMENT %s", quoteInfluxIdent(name)))
+}
+
+// SeriesCount 使用SHOW SERIES EXACT CARDINALITY统计时间线数量，结果按measurement分组时累加
+func (f *FctsdbClient) SeriesCount() (int64, error) {
+	statusCode, response, err := f.databaseQuery([]byte("SHOW SERIES EXACT CARDINALITY"))
+	if err != nil {
+		return 0, err
+	}
+	if statusCode != http.StatusOK {
+		return 0, fmt.Errorf("show series cardinality returned status code: %d, body: %s", statusCode, string(response))
+	}
+	return sumInfluxValues(response)
+}
+
+func (f *FctsdbClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	log.Infof("create retention policy %s on %s, duration %s", name, f.c.Database, duration)
+	return f.execManage(f.otherQuery, influxRetentionPolicySql(name, f.c.Database, duration, isDefault))
+}
+
+// Flush fctsdb写入成功后数据即可查询，不需要额外刷新
+func (f *FctsdbClient) Flush() error {
+	return nil
+}
+
+// execManage 执行管理语句，状态码不是200或者结果中包含error时返回错误
+func (f *FctsdbClient) execManage(query func([]byte) (int, []byte, error), sql string) error {
+	statusCode, response, err := query([]byte(sql))
+	if err != nil {
+		return fmt.Errorf("%s error: %s", sql, err.Error())
+	}
+	if statusCode != http.StatusOK || bytes.Contains(response, []byte(`"error"`)) {
+		return fmt.Errorf("%s returned status code: %d, body: %s", sql, statusCode, string(response))
+	}
+	return nil
+}
+
+// PrecisionDuration 返回时间戳精度对应的时间单位，空字符串为纳秒，不支持的精度返回0
+func PrecisionDuration(precision string) time.Duration {
+	switch precision {
+	case "", PrecisionNanosecond:
+		return time.Nanosecond
+	case PrecisionMicrosecond:
+		return time.Microsecond
+	case PrecisionMillisecond:
+		return time.Millisecond
+	case PrecisionSecond:
+		return time.Second
+	}
+	return 0
+}
+
+// checkPrecision 不支持的精度按纳秒处理，保证写入url和序列化的时间戳精度一致
+func checkPrecision(precision string) string {
+	if PrecisionDuration(precision) == 0 {
+		log.Warnf("unsupported precision %s, use %s", precision, PrecisionNanosecond)
+		return PrecisionNanosecond
+	}
+	return precision
+}
+
+// appendTimestamp 按精度截断时间戳，以整数形式追加到buf中
+func appendTimestamp(buf []byte, t time.Time, precision string) []byte {
+	return strconv.AppendInt(buf, t.UnixNano()/int64(PrecisionDuration(precision)), 10)
+}
+
+// quoteInfluxIdent 为InfluxQL中的标识符添加双引号
+func quoteInfluxIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
+
+func influxRetentionPolicySql(name, database string, duration time.Duration, isDefault bool) string {
+	durationLiteral := "INF"
+	if duration > 0 {
+		durationLiteral = fmt.Sprintf("%ds", int64(duration/time.Second))
+	}
+	sql := fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1", quoteInfluxIdent(name), quoteInfluxIdent(database), durationLiteral)
+	if isDefault {
+		sql += " DEFAULT"
+	}
+	return sql
+}
+
+// sumInfluxValues 累加InfluxQL查询结果中所有series第一列的数值，例如：
+// {"results":[{"statement_id":0,"series":[{"name":"vehicle","columns":["count"],"values":[[1000]]}]}]}
+func sumInfluxValues(response []byte) (int64, error) {
+	var result struct {
+		Results []struct {
+			Error  string
+			Series []struct {
+				Values [][]json.Number
+			}
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return 0, fmt.Errorf("unmarshal result error: %s", err.Error())
+	}
+	var sum int64
+	for _, r := range result.Results {
+		if r.Error != "" {
+			return 0, fmt.Errorf("query error: %s", r.Error)
+		}
+		for _, series := range r.Series {
+			for _, value := range series.Values {
+				if len(value) == 0 {
+					continue
+				}
+				n, err := value[0].Int64()
+				if err != nil {
+					return 0, err
+				}
+				sum += n
+			}
+		}
+	}
+	return sum, nil
+}
+
 func (f *FctsdbClient) CheckConnection(timeout time.Duration) bool {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
@@ -286,7 +450,7 @@ func (f *FctsdbClient) CheckConnection(timeout time.Duration) bool {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second}
+	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second, Dial: f.client.Dial}
 
 	endTime := time.Now().Add(timeout)
 	log.Info("checking connection ")
@@ -316,61 +480,7 @@ func (m *FctsdbClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte
 }
 
 func (s *FctsdbClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
-	// buf := make([]byte, 0, 4*1024)
-	buf = append(buf, p.MeasurementName...)
-
-	for i := 0; i < len(p.TagKeys); i++ {
-		buf = append(buf, ',')
-		buf = append(buf, p.TagKeys[i]...)
-		buf = append(buf, '=')
-		buf = append(buf, p.TagValues[i]...)
-	}
-
-	if len(p.FieldKeys)+len(p.Int64FiledKeys) > 0 {
-		buf = append(buf, ' ')
-	}
-
-	var i int
-	for i = 0; i < len(p.FieldKeys); i++ {
-		buf = append(buf, p.FieldKeys[i]...)
-		buf = append(buf, '=')
-
-		v := p.FieldValues[i]
-		buf = fastFormatAppend(v, buf, false)
-
-		// Influx uses 'i' to indicate integers:
-		switch v.(type) {
-		case int, int64:
-			buf = append(buf, 'i')
-		}
-
-		if i+1 < len(p.FieldKeys) {
-			buf = append(buf, ',')
-		}
-	}
-
-	if i > 0 && len(p.Int64FiledKeys) > 0 {
-		buf = append(buf, ',')
-	}
-
-	for i = 0; i < len(p.Int64FiledKeys); i++ {
-		buf = append(buf, p.Int64FiledKeys[i]...)
-		buf = append(buf, '=')
-
-		v := p.Int64FiledValues[i]
-		buf = strconv.AppendInt(buf, v, 10)
-		// Influx uses 'i' to indicate integers:
-		buf = append(buf, 'i')
-		if i+1 < len(p.Int64FiledKeys) {
-			buf = append(buf, ',')
-		}
-	}
-
-	buf = append(buf, ' ')
-	buf = fastFormatAppend(p.Timestamp.UTC().UnixNano(), buf, true)
-	buf = append(buf, '\n')
-
-	return buf
+	return appendLineProtocol(buf, p, s.c.Precision)
 }
 
 func (m *FctsdbClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
@@ -0,0 +1,671 @@
+package db_client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	protocol "github.com/influxdata/line-protocol"
+)
+
+// Cell 校验序列化格式时比较的最小单元，一个point的每个tag或field展开为一个或多个cell
+type Cell struct {
+	Series string // measurement和tag、表名或者设备路径，取决于格式
+	Field  string
+	Time   int64 // 格式中的时间戳，sql类格式为行号
+	Value  string
+}
+
+func (c Cell) String() string {
+	return fmt.Sprintf("%s %s@%d=%q", c.Series, c.Field, c.Time, c.Value)
+}
+
+// FormatParser 某种序列化格式的解析器，Cells返回一个batch的point应当序列化出的cell，
+// Parse使用独立于序列化代码的方式解析这个batch的请求体，两者比较即可发现转义错误
+type FormatParser interface {
+	Cells(points []*common.Point) []Cell
+	Parse(body []byte) ([]Cell, error)
+}
+
+// NewFormatParser 根据数据库类型和ClientConfig中的写入方式、载荷格式、时间精度创建解析器
+func NewFormatParser(format string, c ClientConfig) (FormatParser, error) {
+	switch format {
+	case "fctsdb", "influxdbv2":
+		precision := PrecisionDuration(c.Precision)
+		if precision == 0 {
+			return nil, fmt.Errorf("unsupported precision %s", c.Precision)
+		}
+		return &lineParser{precision: precision}, nil
+	case "opentsdb":
+		return &opentsdbParser{}, nil
+	case "elasticsearch":
+		return &elasticsearchParser{es: NewElasticsearchClient(c)}, nil
+	case "iotdb":
+		return &iotdbParser{iotdb: NewIotdbClient(c)}, nil
+	case "mqtt":
+		m, err := NewMqttClient(c)
+		if err != nil {
+			return nil, err
+		}
+		return &mqttParser{mqtt: m, line: &lineParser{precision: time.Nanosecond}}, nil
+	case "mysql":
+		switch c.IngestMode {
+		case "", MysqlIngestInsert:
+			return &sqlParser{timeLayout: sqlTimeLayout, quote: '"'}, nil
+		case MysqlIngestPrepare, MysqlIngestLoadData:
+			return &sqlParser{timeLayout: sqlTimeLayout, tsv: true}, nil
+		}
+		return nil, fmt.Errorf("unsupported mysql ingest mode %s", c.IngestMode)
+	case "matrixdb":
+		switch c.IngestMode {
+		case "", MatrixdbIngestMxgate:
+			return &sqlParser{tablePrefix: "public.", csv: true}, nil
+		case MatrixdbIngestCopy:
+			return &sqlParser{tablePrefix: "public.", timeLayout: sqlTimeLayout, tsv: true}, nil
+		case MatrixdbIngestInsert:
+			return &sqlParser{tablePrefix: "public.", timeLayout: sqlTimeLayout, quote: '\''}, nil
+		}
+		return nil, fmt.Errorf("unsupported matrixdb ingest mode %s", c.IngestMode)
+	}
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// CompareCells 排序后比较两组cell，数值统一格式后比较，返回最多limit条不一致的描述
+func CompareCells(expected, actual []Cell, limit int) []string {
+	for _, cells := range [][]Cell{expected, actual} {
+		for i := range cells {
+			cells[i].Value = canonicalValue(cells[i].Value)
+		}
+		sort.Slice(cells, func(i, j int) bool { return cellLess(cells[i], cells[j]) })
+	}
+	var diffs []string
+	i, j := 0, 0
+	for (i < len(expected) || j < len(actual)) && len(diffs) < limit {
+		switch {
+		case j >= len(actual) || (i < len(expected) && cellLess(expected[i], actual[j])):
+			diffs = append(diffs, "missing: "+expected[i].String())
+			i++
+		case i >= len(expected) || cellLess(actual[j], expected[i]):
+			diffs = append(diffs, "unexpected: "+actual[j].String())
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return diffs
+}
+
+func cellLess(a, b Cell) bool {
+	if a.Series != b.Series {
+		return a.Series < b.Series
+	}
+	if a.Field != b.Field {
+		return a.Field < b.Field
+	}
+	if a.Time != b.Time {
+		return a.Time < b.Time
+	}
+	return a.Value < b.Value
+}
+
+// canonicalValue 整数原样保留，值为整数的浮点数转换为整数，其他浮点数统一为10位有效数字，
+// 避免不同格式的小数位数不同导致误报，例如opentsdb中整数也以浮点数写入
+func canonicalValue(v string) string {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return v
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return strconv.FormatInt(int64(f), 10)
+		}
+		return strconv.FormatFloat(f, 'g', 10, 64)
+	}
+	return v
+}
+
+// formatValue 把field值转换为比较使用的字符串
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.Number:
+		return v.String()
+	case nil:
+		return "null"
+	}
+	return string(fastFormatAppend(v, nil, false))
+}
+
+// seriesKey measurement加上按名称排序的tag，例如cpu,host=a,region=b
+func seriesKey(measurement string, keys, values []string) string {
+	tags := make([]string, len(keys))
+	for i := range keys {
+		tags[i] = keys[i] + "=" + values[i]
+	}
+	sort.Strings(tags)
+	if len(tags) == 0 {
+		return measurement
+	}
+	return measurement + "," + strings.Join(tags, ",")
+}
+
+func pointSeriesKey(p *common.Point) string {
+	keys := make([]string, len(p.TagKeys))
+	values := make([]string, len(p.TagKeys))
+	for i := range p.TagKeys {
+		keys[i] = string(p.TagKeys[i])
+		values[i] = string(p.TagValues[i])
+	}
+	return seriesKey(string(p.MeasurementName), keys, values)
+}
+
+// appendPointFieldCells 把point的每个field展开为cell，缺失的字段没有cell
+func appendPointFieldCells(cells []Cell, p *common.Point, series string, t int64) []Cell {
+	for i := range p.FieldKeys {
+		if p.FieldIsNull(i) {
+			continue
+		}
+		cells = append(cells, Cell{Series: series, Field: string(p.FieldKeys[i]), Time: t, Value: formatValue(p.FieldValues[i])})
+	}
+	for i := range p.Int64FiledKeys {
+		if p.Int64FieldIsNull(i) {
+			continue
+		}
+		cells = append(cells, Cell{Series: series, Field: string(p.Int64FiledKeys[i]), Time: t, Value: strconv.FormatInt(p.Int64FiledValues[i], 10)})
+	}
+	return cells
+}
+
+// decodeJson 解析json并保留数值的原始文本
+func decodeJson(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// splitLines 按换行拆分请求体，忽略空行
+func splitLines(body []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range bytes.Split(body, []byte{'\n'}) {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// lineParser 使用influxdata/line-protocol解析行协议
+type lineParser struct {
+	precision time.Duration
+}
+
+func (l *lineParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	for _, p := range points {
+		t := p.Timestamp.UnixNano() / int64(l.precision) * int64(l.precision)
+		cells = appendPointFieldCells(cells, p, pointSeriesKey(p), t)
+	}
+	return cells
+}
+
+func (l *lineParser) Parse(body []byte) ([]Cell, error) {
+	handler := protocol.NewMetricHandler()
+	handler.SetTimePrecision(l.precision)
+	metrics, err := protocol.NewParser(handler).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	var cells []Cell
+	for _, m := range metrics {
+		var keys, values []string
+		for _, tag := range m.TagList() {
+			keys = append(keys, tag.Key)
+			values = append(values, tag.Value)
+		}
+		series := seriesKey(m.Name(), keys, values)
+		for _, field := range m.FieldList() {
+			cells = append(cells, Cell{Series: series, Field: field.Key, Time: m.Time().UnixNano(), Value: formatValue(field.Value)})
+		}
+	}
+	return cells, nil
+}
+
+// opentsdbParser 每个field为一个数据点，metric为measurement.field，只支持数值，其他类型写入0
+type opentsdbParser struct{}
+
+func (o *opentsdbParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	for _, p := range points {
+		keys := make([]string, len(p.TagKeys))
+		values := make([]string, len(p.TagKeys))
+		for i := range p.TagKeys {
+			keys[i] = string(appendOpentsdbName(nil, p.TagKeys[i]))
+			values[i] = string(appendOpentsdbName(nil, p.TagValues[i]))
+		}
+		series := seriesKey("", keys, values)
+		metricPrefix := string(appendOpentsdbName(nil, p.MeasurementName)) + "."
+		t := p.Timestamp.UTC().UnixNano() / 1e6
+		for i := range p.FieldKeys {
+			if p.FieldIsNull(i) {
+				continue
+			}
+			value := "0"
+			switch v := p.FieldValues[i].(type) {
+			case int, int64, float32, float64:
+				value = formatValue(v)
+			}
+			cells = append(cells, Cell{Series: series, Field: metricPrefix + string(appendOpentsdbName(nil, p.FieldKeys[i])), Time: t, Value: value})
+		}
+		for i := range p.Int64FiledKeys {
+			if p.Int64FieldIsNull(i) {
+				continue
+			}
+			cells = append(cells, Cell{Series: series, Field: metricPrefix + string(appendOpentsdbName(nil, p.Int64FiledKeys[i])), Time: t, Value: strconv.FormatInt(p.Int64FiledValues[i], 10)})
+		}
+	}
+	return cells
+}
+
+func (o *opentsdbParser) Parse(body []byte) ([]Cell, error) {
+	var points []struct {
+		Metric    string            `json:"metric"`
+		Timestamp int64             `json:"timestamp"`
+		Value     json.Number       `json:"value"`
+		Tags      map[string]string `json:"tags"`
+	}
+	if err := decodeJson(body, &points); err != nil {
+		return nil, err
+	}
+	var cells []Cell
+	for _, p := range points {
+		var keys, values []string
+		for k, v := range p.Tags {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		cells = append(cells, Cell{Series: seriesKey("", keys, values), Field: p.Metric, Time: p.Timestamp, Value: p.Value.String()})
+	}
+	return cells, nil
+}
+
+// elasticsearchParser bulk接口的NDJSON，文档中tag和field都是普通的属性
+type elasticsearchParser struct {
+	es *ElasticsearchClient
+}
+
+func (e *elasticsearchParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	for _, p := range points {
+		series := string(e.es.indexName(p.MeasurementName))
+		t := p.Timestamp.UTC().UnixNano() / int64(time.Millisecond)
+		for i := range p.TagKeys {
+			cells = append(cells, Cell{Series: series, Field: string(p.TagKeys[i]), Time: t, Value: string(p.TagValues[i])})
+		}
+		cells = appendPointFieldCells(cells, p, series, t)
+	}
+	return cells
+}
+
+func (e *elasticsearchParser) Parse(body []byte) ([]Cell, error) {
+	lines := splitLines(body)
+	if len(lines)%2 != 0 {
+		return nil, fmt.Errorf("the line count of bulk body is odd: %d", len(lines))
+	}
+	var cells []Cell
+	for i := 0; i < len(lines); i += 2 {
+		var action struct {
+			Index struct {
+				Index string `json:"_index"`
+			} `json:"index"`
+		}
+		if err := decodeJson(lines[i], &action); err != nil {
+			return nil, fmt.Errorf("parse action line %d error: %s", i+1, err.Error())
+		}
+		doc := make(map[string]interface{})
+		if err := decodeJson(lines[i+1], &doc); err != nil {
+			return nil, fmt.Errorf("parse document line %d error: %s", i+2, err.Error())
+		}
+		ts, ok := doc[string(esTimestampField)].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("document line %d has no %s", i+2, esTimestampField)
+		}
+		t, err := ts.Int64()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range doc {
+			if k == string(esTimestampField) {
+				continue
+			}
+			cells = append(cells, Cell{Series: action.Index.Index, Field: k, Time: t, Value: formatValue(v)})
+		}
+	}
+	return cells, nil
+}
+
+// iotdbParser insertTablet接口的请求体，每行一个设备，值按列组织
+type iotdbParser struct {
+	iotdb *IotdbClient
+}
+
+func (t *iotdbParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	for _, p := range points {
+		device := string(t.iotdb.appendDevicePath(nil, p))
+		cells = appendPointFieldCells(cells, p, device, p.Timestamp.UTC().UnixNano()/int64(time.Millisecond))
+	}
+	return cells
+}
+
+func (t *iotdbParser) Parse(body []byte) ([]Cell, error) {
+	var cells []Cell
+	for n, line := range splitLines(body) {
+		var tablet struct {
+			DeviceId     string          `json:"deviceId"`
+			Measurements []string        `json:"measurements"`
+			Timestamps   []int64         `json:"timestamps"`
+			Values       [][]interface{} `json:"values"`
+		}
+		if err := decodeJson(line, &tablet); err != nil {
+			return nil, fmt.Errorf("parse tablet line %d error: %s", n+1, err.Error())
+		}
+		if len(tablet.Values) != len(tablet.Measurements) {
+			return nil, fmt.Errorf("tablet %s has %d measurements but %d columns", tablet.DeviceId, len(tablet.Measurements), len(tablet.Values))
+		}
+		for i, column := range tablet.Values {
+			if len(column) != len(tablet.Timestamps) {
+				return nil, fmt.Errorf("tablet %s has %d timestamps but %d values", tablet.DeviceId, len(tablet.Timestamps), len(column))
+			}
+			for j, v := range column {
+				// null为缺失的字段
+				if v == nil {
+					continue
+				}
+				cells = append(cells, Cell{Series: tablet.DeviceId, Field: tablet.Measurements[i], Time: tablet.Timestamps[j], Value: formatValue(v)})
+			}
+		}
+	}
+	return cells, nil
+}
+
+// mqttParser 每个point两行，第一行为topic，第二行为json或者行协议载荷，series前加上topic
+type mqttParser struct {
+	mqtt *MqttClient
+	line *lineParser
+}
+
+func (m *mqttParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	for _, p := range points {
+		topic := string(m.mqtt.appendTopic(nil, p)) + " "
+		var pointCells []Cell
+		if m.mqtt.c.MqttPayload == "line" {
+			pointCells = m.line.Cells([]*common.Point{p})
+		} else {
+			pointCells = appendPointFieldCells(nil, p, pointSeriesKey(p), p.Timestamp.UTC().UnixNano())
+		}
+		for _, cell := range pointCells {
+			cell.Series = topic + cell.Series
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+func (m *mqttParser) Parse(body []byte) ([]Cell, error) {
+	lines := bytes.Split(bytes.TrimSuffix(body, []byte{'\n'}), []byte{'\n'})
+	if len(lines)%2 != 0 {
+		return nil, fmt.Errorf("the line count of mqtt body is odd: %d", len(lines))
+	}
+	var cells []Cell
+	for i := 0; i < len(lines); i += 2 {
+		topic := string(lines[i])
+		if strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("topic %s contains wildcard", topic)
+		}
+		var payloadCells []Cell
+		if m.mqtt.c.MqttPayload == "line" {
+			var err error
+			if payloadCells, err = m.line.Parse(lines[i+1]); err != nil {
+				return nil, fmt.Errorf("parse payload of topic %s error: %s", topic, err.Error())
+			}
+		} else {
+			var msg struct {
+				Measurement string                 `json:"measurement"`
+				Tags        map[string]string      `json:"tags"`
+				Fields      map[string]interface{} `json:"fields"`
+				Timestamp   int64                  `json:"timestamp"`
+			}
+			if err := decodeJson(lines[i+1], &msg); err != nil {
+				return nil, fmt.Errorf("parse payload of topic %s error: %s", topic, err.Error())
+			}
+			var keys, values []string
+			for k, v := range msg.Tags {
+				keys = append(keys, k)
+				values = append(values, v)
+			}
+			series := seriesKey(msg.Measurement, keys, values)
+			for k, v := range msg.Fields {
+				payloadCells = append(payloadCells, Cell{Series: series, Field: k, Time: msg.Timestamp, Value: formatValue(v)})
+			}
+		}
+		for _, cell := range payloadCells {
+			cell.Series = topic + " " + cell.Series
+			cells = append(cells, cell)
+		}
+	}
+	return cells, nil
+}
+
+const sqlTimeLayout = "2006-01-02 15:04:05.000"
+
+// sqlParser 解析insert语句、LOAD DATA/COPY的文本格式或者mxgate的csv格式，
+// 列没有名称，每列的Field为#加列序号，Time为行在表中的序号
+type sqlParser struct {
+	tablePrefix string
+	timeLayout  string // 时间列的格式，为空时为unix秒
+	quote       byte   // insert语句中字符串的引号，"使用反斜杠转义，'使用两个单引号转义
+	tsv         bool
+	csv         bool
+}
+
+func (s *sqlParser) Cells(points []*common.Point) []Cell {
+	var cells []Cell
+	rows := make(map[string]int64)
+	for _, p := range points {
+		table := s.tablePrefix + string(p.MeasurementName)
+		row := rows[table]
+		rows[table]++
+		var t string
+		if s.timeLayout == "" {
+			t = strconv.FormatInt(p.Timestamp.Unix(), 10)
+		} else {
+			t = p.Timestamp.Format(s.timeLayout)
+		}
+		values := []string{t}
+		for i := range p.TagValues {
+			values = append(values, string(p.TagValues[i]))
+		}
+		for i := range p.FieldValues {
+			if p.FieldIsNull(i) {
+				values = append(values, s.nullValue())
+				continue
+			}
+			values = append(values, formatValue(p.FieldValues[i]))
+		}
+		for i := range p.Int64FiledValues {
+			if p.Int64FieldIsNull(i) {
+				values = append(values, s.nullValue())
+				continue
+			}
+			values = append(values, strconv.FormatInt(p.Int64FiledValues[i], 10))
+		}
+		cells = appendRowCells(cells, table, row, values)
+	}
+	return cells
+}
+
+// nullValue 缺失的字段解析后的值，csv中为空，insert语句和文本格式中为NULL
+func (s *sqlParser) nullValue() string {
+	if s.csv {
+		return ""
+	}
+	return string(sqlNull)
+}
+
+func appendRowCells(cells []Cell, table string, row int64, values []string) []Cell {
+	for i, v := range values {
+		cells = append(cells, Cell{Series: table, Field: "#" + strconv.Itoa(i), Time: row, Value: v})
+	}
+	return cells
+}
+
+func (s *sqlParser) Parse(body []byte) ([]Cell, error) {
+	var cells []Cell
+	if s.quote != 0 {
+		return s.parseInsert(cells, body)
+	}
+	_, err := writeGroups(body, func(group []byte) (int64, error) {
+		i := bytes.IndexByte(group, '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("invalid rows body: %s", string(group))
+		}
+		table := string(group[:i])
+		if s.tsv {
+			_, columns, args, err := parseTsvRows(group, nil)
+			if err != nil {
+				return 0, err
+			}
+			for row := 0; row*columns < len(args); row++ {
+				values := make([]string, columns)
+				for j := range values {
+					if arg, ok := args[row*columns+j].(string); ok {
+						values[j] = arg
+					} else {
+						values[j] = string(sqlNull)
+					}
+				}
+				cells = appendRowCells(cells, table, int64(row), values)
+			}
+			return 0, nil
+		}
+		records, err := csv.NewReader(bytes.NewReader(group[i+1:])).ReadAll()
+		if err != nil {
+			return 0, err
+		}
+		for row, values := range records {
+			cells = appendRowCells(cells, table, int64(row), values)
+		}
+		return 0, nil
+	})
+	return cells, err
+}
+
+// parseInsert 解析insert into table values(...),(...);格式的语句
+func (s *sqlParser) parseInsert(cells []Cell, body []byte) ([]Cell, error) {
+	const head, values = "insert into ", " values"
+	rows := make(map[string]int64)
+	for len(body) > 0 {
+		if !bytes.HasPrefix(body, []byte(head)) {
+			return nil, fmt.Errorf("statement does not start with %q: %.32s", head, body)
+		}
+		body = body[len(head):]
+		i := bytes.Index(body, []byte(values))
+		if i < 0 {
+			return nil, fmt.Errorf("statement has no values")
+		}
+		table := string(body[:i])
+		body = body[i+len(values):]
+		for {
+			row, rest, err := s.parseTuple(body)
+			if err != nil {
+				return nil, fmt.Errorf("parse values of table %s error: %s", table, err.Error())
+			}
+			cells = appendRowCells(cells, table, rows[table], row)
+			rows[table]++
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("statement of table %s does not end with ;", table)
+			}
+			body = rest[1:]
+			if rest[0] == ';' {
+				break
+			}
+			if rest[0] != ',' {
+				return nil, fmt.Errorf("unexpected %q after values of table %s", rest[0], table)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// parseTuple 解析(v1,v2,...)，返回值和剩余的请求体
+func (s *sqlParser) parseTuple(body []byte) ([]string, []byte, error) {
+	if len(body) == 0 || body[0] != '(' {
+		return nil, body, fmt.Errorf("tuple does not start with (")
+	}
+	body = body[1:]
+	var row []string
+	for {
+		var value []byte
+		if len(body) > 0 && body[0] == s.quote {
+			i := 1
+			for ; i < len(body); i++ {
+				if body[i] == '\\' && s.quote == '"' && i+1 < len(body) {
+					i++
+					switch body[i] {
+					case 'n':
+						value = append(value, '\n')
+					case 'r':
+						value = append(value, '\r')
+					case '0':
+						value = append(value, 0)
+					default:
+						value = append(value, body[i])
+					}
+					continue
+				}
+				if body[i] == s.quote {
+					if s.quote == '\'' && i+1 < len(body) && body[i+1] == '\'' {
+						value = append(value, '\'')
+						i++
+						continue
+					}
+					break
+				}
+				value = append(value, body[i])
+			}
+			if i >= len(body) {
+				return nil, body, fmt.Errorf("unterminated string")
+			}
+			body = body[i+1:]
+		} else {
+			i := bytes.IndexAny(body, ",)")
+			if i < 0 {
+				return nil, body, fmt.Errorf("unterminated tuple")
+			}
+			value, body = body[:i], body[i:]
+		}
+		row = append(row, string(value))
+		if len(body) == 0 {
+			return nil, body, fmt.Errorf("unterminated tuple")
+		}
+		sep := body[0]
+		body = body[1:]
+		if sep == ')' {
+			return row, body, nil
+		}
+		if sep != ',' {
+			return nil, body, fmt.Errorf("unexpected %q in tuple", sep)
+		}
+	}
+}
@@ -3,25 +3,36 @@ package db_client
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
 	log "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 )
 
 var organization = "benchmark"
 
+// influxdbv2的查询语言
+const (
+	QueryLangInfluxql = "influxql" // 通过1.x兼容的/query接口发送InfluxQL
+	QueryLangFlux     = "flux"     // 通过/api/v2/query接口发送Flux，返回annotated CSV
+)
+
+var fluxDialect = []byte(`,"type":"flux","dialect":{"header":true,"annotations":["datatype","group","default"]}}`)
+
 // InfluxdbV2Client is a Writer that writes to a fctsdb HTTP server.
 type InfluxdbV2Client struct {
 	client   fasthttp.Client
 	c        ClientConfig
 	writeUrl []byte
 	queryUrl []byte
+	fluxUrl  []byte
 	host     []byte
 	buf      *bytes.Buffer
 	token    string
@@ -29,39 +40,49 @@ type InfluxdbV2Client struct {
 
 // NewInfluxdbV2Client returns a new HTTPWriter from the supplied HTTPWriterConfig.
 func NewInfluxdbV2Client(c ClientConfig) *InfluxdbV2Client {
+	c.Precision = checkPrecision(c.Precision)
 	var host []byte
+	var socketPath string
 	writeUrl := make([]byte, 0)
 	queryUrl := make([]byte, 0)
+	fluxUrl := make([]byte, 0)
 
 	if c.Host != "" {
-		if c.Host[len(c.Host)-1] == '/' {
-			host = []byte(c.Host)[:len(c.Host)-1]
-		} else {
-			host = []byte(c.Host)
-		}
+		host, socketPath = parseHttpHost(c.Host)
 		writeUrl = append(writeUrl, host...)
 		writeUrl = append(writeUrl, "/api/v2/write?bucket="...)
 		writeUrl = fasthttp.AppendQuotedArg(writeUrl, []byte(c.Database))
 		writeUrl = append(writeUrl, "&org="...)
 		writeUrl = append(writeUrl, organization...)
-		writeUrl = append(writeUrl, "&precision=ns"...)
+		writeUrl = append(writeUrl, "&precision="...)
+		if c.Precision != "" {
+			writeUrl = append(writeUrl, c.Precision...)
+		} else {
+			writeUrl = append(writeUrl, PrecisionNanosecond...)
+		}
 
 		queryUrl = append(queryUrl, host...)
 		queryUrl = append(queryUrl, "/query?db="...)
 		queryUrl = fasthttp.AppendQuotedArg(queryUrl, []byte(c.Database))
 		queryUrl = append(queryUrl, "&q="...)
+
+		fluxUrl = append(fluxUrl, host...)
+		fluxUrl = append(fluxUrl, "/api/v2/query?org="...)
+		fluxUrl = append(fluxUrl, organization...)
 	}
-	return &InfluxdbV2Client{
+	cli := &InfluxdbV2Client{
 		client: fasthttp.Client{
-			Name:                "influxdbv2",
-			MaxIdleConnDuration: DefaultIdleConnectionTimeout,
+			Name: "influxdbv2",
 		},
 		c:        c,
 		queryUrl: queryUrl,
+		fluxUrl:  fluxUrl,
 		writeUrl: writeUrl,
 		host:     host,
 		buf:      bytes.NewBuffer(make([]byte, 0, 8*1024)),
 	}
+	configureHttpClient(&cli.client, c, socketPath)
+	return cli
 }
 
 // Write writes the given byte slice to the HTTP server described in the Writer's HTTPWriterConfig.
@@ -99,6 +120,9 @@ func (f *InfluxdbV2Client) Write(body []byte) (int64, error) {
 }
 
 func (f *InfluxdbV2Client) Query(body []byte) (int64, error) {
+	if f.c.QueryLang == QueryLangFlux {
+		return f.queryFlux(body)
+	}
 	uri := fasthttp.AppendQuotedArg(f.queryUrl, body)
 	req := fasthttp.AcquireRequest()
 	req.Header.SetContentTypeBytes(textPlain)
@@ -141,6 +165,115 @@ func (f *InfluxdbV2Client) Query(body []byte) (int64, error) {
 	return lat, err
 }
 
+// QueryRows 使用v1兼容接口执行influxql查询并解析返回的json，flux返回的annotated CSV暂不支持
+func (f *InfluxdbV2Client) QueryRows(body []byte) (*QueryResult, error) {
+	if f.c.QueryLang == QueryLangFlux {
+		return nil, notSupported("influxdbv2", "query rows with flux")
+	}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetContentTypeBytes(textPlain)
+	req.Header.SetMethodBytes(get)
+	req.Header.SetRequestURIBytes(fasthttp.AppendQuotedArg(f.queryUrl, body))
+	req.Header.Add("Authorization", "Token "+f.token)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	if err := f.client.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if sc := resp.StatusCode(); sc != fasthttp.StatusOK {
+		return nil, fmt.Errorf("invalid query response (status %d, db %s): %s", sc, f.c.Database, string(resp.Body()))
+	}
+	return parseInfluxResult(resp.Body())
+}
+
+// queryFlux 发送Flux查询，模板中的{db}替换为bucket名称，返回结果为annotated CSV，结果中没有数据行时认为查询失败
+func (f *InfluxdbV2Client) queryFlux(body []byte) (int64, error) {
+	query := bytes.ReplaceAll(body, []byte("{db}"), []byte(f.c.Database))
+	reqBody := make([]byte, 0, len(query)+len(fluxDialect)+16)
+	reqBody = append(reqBody, `{"query":`...)
+	reqBody = appendJsonString(reqBody, query)
+	reqBody = append(reqBody, fluxDialect...)
+
+	req := fasthttp.AcquireRequest()
+	req.Header.SetContentTypeBytes(applicationJson)
+	req.Header.SetMethodBytes(post)
+	req.Header.SetRequestURIBytes(f.fluxUrl)
+	req.Header.Add("Authorization", "Token "+f.token)
+	req.Header.Add("Accept", "application/csv")
+	if f.c.Gzip > 0 {
+		req.Header.Add("Accept-Encoding", "gzip")
+	}
+	req.SetBody(reqBody)
+
+	log.Debug("Query flux:", string(query))
+
+	resp := fasthttp.AcquireResponse()
+	start := time.Now()
+	err := f.client.Do(req, resp)
+	lat := time.Since(start).Nanoseconds()
+	if err == nil {
+		sc := resp.StatusCode()
+		var body []byte
+		if string(resp.Header.Peek("Content-Encoding")) == "gzip" {
+			_, err := fasthttp.WriteGunzip(f.buf, resp.Body())
+			if err != nil {
+				log.Errorf("[ParseGzip] NewReader error: %v, maybe data is ungzip\n", err)
+			}
+			body = f.buf.Bytes()
+			f.buf.Reset()
+		} else {
+			body = resp.Body()
+		}
+
+		log.Debug("Query response body", string(body))
+
+		if sc != fasthttp.StatusOK {
+			err = fmt.Errorf("invalid query response (status %d, db %s): %s", sc, f.c.Database, string(body))
+		} else if rows, csvErr := countFluxRows(body); csvErr != nil {
+			err = fmt.Errorf("invalid query response (db %s): %s", f.c.Database, csvErr.Error())
+		} else if rows == 0 {
+			err = fmt.Errorf("query result is empty (db %s)", f.c.Database)
+		}
+	}
+	fasthttp.ReleaseResponse(resp)
+	fasthttp.ReleaseRequest(req)
+
+	return lat, err
+}
+
+// countFluxRows 统计annotated CSV中的数据行数。结果中每个表以#开头的注解行和一个表头行开始，表之间以空行分隔，
+// 查询出错时表头为",error,reference"，下一行为错误信息
+func countFluxRows(body []byte) (int, error) {
+	rows := 0
+	header := true
+	errorTable := false
+	for len(body) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			line, body = body[:i], body[i+1:]
+		} else {
+			line, body = body, nil
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		switch {
+		case len(line) == 0:
+			header = true
+		case line[0] == '#':
+			header = true
+		case header:
+			header = false
+			errorTable = bytes.HasPrefix(line, []byte(",error,"))
+		case errorTable:
+			return rows, fmt.Errorf("flux error: %s", string(line))
+		default:
+			rows++
+		}
+	}
+	return rows, nil
+}
+
 func (d *InfluxdbV2Client) InitUser() error {
 
 	client := influxdb2.NewClient(string(d.host), "")
@@ -217,7 +350,7 @@ func (d *InfluxdbV2Client) MapBucket() error {
 
 func (d *InfluxdbV2Client) CreateDatabase(name string, withEncryption bool) error {
 
-	existingDatabases, err := d.listDatabases()
+	existingDatabases, err := d.ListDatabases()
 	if err != nil {
 		return err
 	}
@@ -239,8 +372,8 @@ func (d *InfluxdbV2Client) CreateDatabase(name string, withEncryption bool) erro
 	return err
 }
 
-// listDatabases lists the existing databases in InfluxDB.
-func (d *InfluxdbV2Client) listDatabases() ([]string, error) {
+// ListDatabases lists the existing databases in InfluxDB.
+func (d *InfluxdbV2Client) ListDatabases() ([]string, error) {
 
 	client := influxdb2.NewClient(string(d.host), d.token)
 	defer client.Close()
@@ -261,6 +394,81 @@ func (f *InfluxdbV2Client) CreateMeasurement(p *common.Point) error {
 	return nil
 }
 
+func (d *InfluxdbV2Client) DropDatabase(name string) error {
+	log.Infof("drop database %s", name)
+	client := influxdb2.NewClient(string(d.host), d.token)
+	defer client.Close()
+	bucket, err := client.BucketsAPI().FindBucketByName(context.Background(), name)
+	if err != nil {
+		if isBucketNotFound(err) {
+			// bucket不存在时不需要删除
+			log.Warnf("bucket %s not found", name)
+			return nil
+		}
+		return err
+	}
+	return client.BucketsAPI().DeleteBucket(context.Background(), bucket)
+}
+
+// isBucketNotFound FindBucketByName在bucket不存在时返回"bucket 'xxx' not found"，或者服务端返回404
+func isBucketNotFound(err error) bool {
+	var httpErr *http.Error
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == fasthttp.StatusNotFound
+	}
+	return strings.HasSuffix(err.Error(), "not found")
+}
+
+// DropMeasurement 使用delete接口删除bucket中该measurement的所有数据
+func (d *InfluxdbV2Client) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	client := influxdb2.NewClient(string(d.host), d.token)
+	defer client.Close()
+	return client.DeleteAPI().DeleteWithName(context.Background(), organization, d.c.Database,
+		time.Unix(0, 0), time.Now().AddDate(100, 0, 0), fmt.Sprintf(`_measurement="%s"`, name))
+}
+
+// SeriesCount 使用flux的influxdb.cardinality函数统计bucket中的时间线数量
+func (d *InfluxdbV2Client) SeriesCount() (int64, error) {
+	client := influxdb2.NewClient(string(d.host), d.token)
+	defer client.Close()
+	query := fmt.Sprintf(`import "influxdata/influxdb" influxdb.cardinality(bucket: "%s", start: 1970-01-01T00:00:00Z)`, d.c.Database)
+	result, err := client.QueryAPI(organization).Query(context.Background(), query)
+	if err != nil {
+		return 0, err
+	}
+	defer result.Close()
+	var count int64
+	for result.Next() {
+		if v, ok := result.Record().Value().(int64); ok {
+			count += v
+		}
+	}
+	return count, result.Err()
+}
+
+// CreateRetentionPolicy influxdbv2中保留策略是bucket的属性，这里修改当前bucket的保留时间，name和isDefault不生效
+func (d *InfluxdbV2Client) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	log.Infof("set retention of bucket %s to %s", d.c.Database, duration)
+	client := influxdb2.NewClient(string(d.host), d.token)
+	defer client.Close()
+	bucket, err := client.BucketsAPI().FindBucketByName(context.Background(), d.c.Database)
+	if err != nil {
+		return err
+	}
+	bucket.RetentionRules = domain.RetentionRules{{
+		EverySeconds: int64(duration / time.Second),
+		Type:         domain.RetentionRuleTypeExpire,
+	}}
+	_, err = client.BucketsAPI().UpdateBucket(context.Background(), bucket)
+	return err
+}
+
+// Flush influxdbv2写入成功后数据即可查询，不需要额外刷新
+func (d *InfluxdbV2Client) Flush() error {
+	return nil
+}
+
 func (f *InfluxdbV2Client) CheckConnection(timeout time.Duration) bool {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
@@ -272,7 +480,7 @@ func (f *InfluxdbV2Client) CheckConnection(timeout time.Duration) bool {
 	defer fasthttp.ReleaseResponse(resp)
 
 	// client := http.Client{}
-	clientWithTimeout := fasthttp.Client{WriteTimeout: time.Second, ReadTimeout: time.Second, MaxConnWaitTimeout: time.Second}
+	clientWithTimeout := fasthttp.Client{WriteTimeout: time.Second, ReadTimeout: time.Second, MaxConnWaitTimeout: time.Second, Dial: f.client.Dial}
 	endTime := time.Now().Add(timeout)
 	log.Info("checking connection ")
 	fmt.Print("checking .")
@@ -303,61 +511,7 @@ func (m *InfluxdbV2Client) BeforeSerializePoints(buf []byte, p *common.Point) []
 }
 
 func (s *InfluxdbV2Client) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
-	// buf := make([]byte, 0, 4*1024)
-	buf = append(buf, p.MeasurementName...)
-
-	for i := 0; i < len(p.TagKeys); i++ {
-		buf = append(buf, ',')
-		buf = append(buf, p.TagKeys[i]...)
-		buf = append(buf, '=')
-		buf = append(buf, p.TagValues[i]...)
-	}
-
-	if len(p.FieldKeys)+len(p.Int64FiledKeys) > 0 {
-		buf = append(buf, ' ')
-	}
-
-	var i int
-	for i = 0; i < len(p.FieldKeys); i++ {
-		buf = append(buf, p.FieldKeys[i]...)
-		buf = append(buf, '=')
-
-		v := p.FieldValues[i]
-		buf = fastFormatAppend(v, buf, false)
-
-		// Influx uses 'i' to indicate integers:
-		switch v.(type) {
-		case int, int64:
-			buf = append(buf, 'i')
-		}
-
-		if i+1 < len(p.FieldKeys) {
-			buf = append(buf, ',')
-		}
-	}
-
-	if i > 0 && len(p.Int64FiledKeys) > 0 {
-		buf = append(buf, ',')
-	}
-
-	for i = 0; i < len(p.Int64FiledKeys); i++ {
-		buf = append(buf, p.Int64FiledKeys[i]...)
-		buf = append(buf, '=')
-
-		v := p.Int64FiledValues[i]
-		buf = strconv.AppendInt(buf, v, 10)
-		// Influx uses 'i' to indicate integers:
-		buf = append(buf, 'i')
-		if i+1 < len(p.Int64FiledKeys) {
-			buf = append(buf, ',')
-		}
-	}
-
-	buf = append(buf, ' ')
-	buf = fastFormatAppend(p.Timestamp.UTC().UnixNano(), buf, true)
-	buf = append(buf, '\n')
-
-	return buf
+	return appendLineProtocol(buf, p, s.c.Precision)
 }
 
 func (m *InfluxdbV2Client) AfterSerializePoints(buf []byte, p *common.Point) []byte {
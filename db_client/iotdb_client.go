@@ -0,0 +1,592 @@
+package db_client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	iotdbDatabasePlaceholder = []byte("{db}")
+	iotdbSuccess             = []byte(`"code":200`)
+)
+
+// IotdbClient 通过REST接口写入和查询apache iotdb。
+// point映射为iotdb的设备/物理量模型：设备路径为root.<database>.<measurement>.<tag1 value>...<tagN value>，
+// 每个field为设备下的一个物理量。写入时一个batch按设备拆分为多个tablet，使用insertTablet接口按列写入。
+// 查询模板中的{db}会被替换为database名称，例如：select last * from root.{db}.vehicle.`{vin}`
+type IotdbClient struct {
+	client    fasthttp.Client
+	c         ClientConfig
+	host      []byte
+	insertUrl []byte
+	queryUrl  []byte
+	authValue []byte
+	database  []byte
+
+	// 序列化时按设备缓存的tablet，AfterSerializePoints时输出
+	tablets     map[string]*iotdbTablet
+	tabletOrder []*iotdbTablet
+	tabletPool  []*iotdbTablet
+	buffered    int   // 缓存的tablet的字节数(估算)，用于按字节数分批
+	err         error // 序列化时的错误，例如不支持的字段类型，在Write时返回
+}
+
+// iotdbTablet 一个设备在一个batch中的数据，按字段名称对应列，
+// 同一设备的point字段不同时(例如回放数据中的空值)增加列，缺少的列填null
+type iotdbTablet struct {
+	device       []byte
+	measurements [][]byte
+	dataTypes    []string
+	columns      map[string]int // 字段名称对应的列
+	timestamps   []int64
+	values       [][]byte // 每一列的json值，逗号分隔
+	rows         []int    // 每一列已经填入的值的个数
+}
+
+func NewIotdbClient(c ClientConfig) *IotdbClient {
+	var host []byte
+	if c.Host != "" {
+		host = []byte(strings.TrimSuffix(c.Host, "/"))
+	}
+	// example: http://localhost:18080/rest/v1/insertTablet
+	insertUrl := make([]byte, 0)
+	insertUrl = append(insertUrl, host...)
+	insertUrl = append(insertUrl, "/rest/v1/insertTablet"...)
+
+	// example: http://localhost:18080/rest/v1/query
+	queryUrl := make([]byte, 0)
+	queryUrl = append(queryUrl, host...)
+	queryUrl = append(queryUrl, "/rest/v1/query"...)
+
+	// iotdb的REST接口必须认证，默认使用root/root
+	user, password := c.User, c.Password
+	if user == "" {
+		user, password = "root", "root"
+	}
+	authValue := []byte("Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+
+	return &IotdbClient{
+		client: fasthttp.Client{
+			Name:                "iotdb",
+			MaxIdleConnDuration: DefaultIdleConnectionTimeout,
+		},
+		c:         c,
+		host:      host,
+		insertUrl: insertUrl,
+		queryUrl:  queryUrl,
+		authValue: authValue,
+		database:  []byte(c.Database),
+		tablets:   make(map[string]*iotdbTablet),
+	}
+}
+
+func (t *IotdbClient) post(uri []byte, body []byte) (int64, int, []byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetContentTypeBytes(applicationJson)
+	req.Header.SetMethodBytes(post)
+	req.Header.SetRequestURIBytes(uri)
+	req.Header.SetBytesV("Authorization", t.authValue)
+	if t.c.Gzip > 0 {
+		req.Header.Add("Accept-Encoding", "gzip")
+	}
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	start := time.Now()
+	err := t.client.Do(req, resp)
+	lat := time.Since(start).Nanoseconds()
+	if err != nil {
+		return lat, 0, nil, err
+	}
+	respBody := resp.Body()
+	if string(resp.Header.Peek("Content-Encoding")) == "gzip" {
+		respBody, err = resp.BodyGunzip()
+		if err != nil {
+			return lat, 0, nil, err
+		}
+	}
+	return lat, resp.StatusCode(), append([]byte{}, respBody...), nil
+}
+
+// Write 一个batch被序列化为多行，每行是一个设备的tablet，逐个调用insertTablet写入，返回总延时
+func (t *IotdbClient) Write(body []byte) (int64, error) {
+	log.Debug("Write body", string(body))
+	if t.err != nil {
+		// 序列化这个batch时出错，数据不完整
+		err := t.err
+		t.err = nil
+		return 0, err
+	}
+	var total int64
+	for len(body) > 0 {
+		var tablet []byte
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			tablet, body = body[:i], body[i+1:]
+		} else {
+			tablet, body = body, nil
+		}
+		lat, sc, respBody, err := t.post(t.insertUrl, tablet)
+		total += lat
+		if err != nil {
+			return total, err
+		}
+		if sc != fasthttp.StatusOK || !bytes.Contains(respBody, iotdbSuccess) {
+			return total, fmt.Errorf("invalid write response (status %d): %s", sc, string(respBody))
+		}
+	}
+	return total, nil
+}
+
+func (t *IotdbClient) Query(body []byte) (int64, error) {
+	sql := bytes.ReplaceAll(body, iotdbDatabasePlaceholder, t.database)
+	log.Debug("Query sql:", string(sql))
+	reqBody := make([]byte, 0, len(sql)+16)
+	reqBody = append(reqBody, `{"sql":`...)
+	reqBody = appendJsonString(reqBody, sql)
+	reqBody = append(reqBody, '}')
+
+	lat, sc, respBody, err := t.post(t.queryUrl, reqBody)
+	if err == nil {
+		log.Debug("Query response body", string(respBody))
+		// 查询成功时返回结果集，失败时返回{"code":xxx,"message":"..."}
+		if sc != fasthttp.StatusOK || bytes.Contains(respBody, []byte(`"code":`)) {
+			err = fmt.Errorf("invalid query response (status %d, db %s): %s", sc, t.c.Database, string(respBody))
+		}
+	}
+	return lat, err
+}
+
+// nonQuery 执行DDL等非查询语句
+func (t *IotdbClient) nonQuery(sql string) error {
+	log.Debug("Execute sql:", sql)
+	reqBody := []byte(`{"sql":`)
+	reqBody = appendJsonString(reqBody, []byte(sql))
+	reqBody = append(reqBody, '}')
+
+	uri := make([]byte, 0)
+	uri = append(uri, t.host...)
+	uri = append(uri, "/rest/v1/nonQuery"...)
+	_, sc, respBody, err := t.post(uri, reqBody)
+	if err != nil {
+		return err
+	}
+	if sc != fasthttp.StatusOK || !bytes.Contains(respBody, iotdbSuccess) {
+		return fmt.Errorf("execute %s failed (status %d): %s", sql, sc, string(respBody))
+	}
+	return nil
+}
+
+// query 执行查询语句并解析结果，iotdb REST接口的结果按列返回，例如：
+// {"expressions":null,"columnNames":["count(timeseries)"],"timestamps":null,"values":[[12]]}
+func (t *IotdbClient) query(sql string) ([][]interface{}, error) {
+	log.Debug("Query sql:", sql)
+	reqBody := []byte(`{"sql":`)
+	reqBody = appendJsonString(reqBody, []byte(sql))
+	reqBody = append(reqBody, '}')
+	_, sc, respBody, err := t.post(t.queryUrl, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if sc != fasthttp.StatusOK || bytes.Contains(respBody, []byte(`"code":`)) {
+		return nil, fmt.Errorf("execute %s failed (status %d): %s", sql, sc, string(respBody))
+	}
+	var result struct {
+		Values [][]interface{} `json:"values"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal result of %s error: %s", sql, err.Error())
+	}
+	return result.Values, nil
+}
+
+func (t *IotdbClient) InitUser() error {
+	return nil
+}
+
+func (t *IotdbClient) LoginUser() error {
+	return nil
+}
+
+func (t *IotdbClient) CreateDatabase(name string, withEncryption bool) error {
+	log.Infof("create database root.%s", name)
+	if withEncryption {
+		log.Warn("iotdb does not support create database with encryption, ignore it")
+	}
+	// iotdb 1.x使用CREATE DATABASE，0.13及以前版本使用SET STORAGE GROUP
+	err := t.nonQuery("CREATE DATABASE root." + name)
+	if err != nil {
+		err = t.nonQuery("SET STORAGE GROUP TO root." + name)
+	}
+	if err != nil && strings.Contains(err.Error(), "already") {
+		log.Warnf("The following database \"%s\" already exist in the data store, do'not need create.", name)
+		return nil
+	}
+	return err
+}
+
+// CreateMeasurement 根据point的field创建元数据模板，并挂载到root.<database>.<measurement>上，
+// 该measurement下的所有设备在首次写入时按模板创建时间序列。
+func (t *IotdbClient) CreateMeasurement(p *common.Point) error {
+	templateName := fmt.Sprintf("%s_%s", t.c.Database, p.MeasurementName)
+	columns := make([]string, 0, len(p.FieldKeys)+len(p.Int64FiledKeys))
+	for i, fieldKey := range p.FieldKeys {
+		dataType, err := iotdbDataType(p.FieldValues[i])
+		if err != nil {
+			return err
+		}
+		columns = append(columns, fmt.Sprintf("%s %s", iotdbQuoteNode(fieldKey), dataType))
+	}
+	for _, fieldKey := range p.Int64FiledKeys {
+		columns = append(columns, fmt.Sprintf("%s INT64", iotdbQuoteNode(fieldKey)))
+	}
+	log.Infof("create schema template %s", templateName)
+	err := t.nonQuery(fmt.Sprintf("CREATE SCHEMA TEMPLATE %s (%s)", templateName, strings.Join(columns, ", ")))
+	if err != nil && !strings.Contains(err.Error(), "already") {
+		return err
+	}
+	err = t.nonQuery(fmt.Sprintf("SET SCHEMA TEMPLATE %s TO root.%s.%s", templateName, t.c.Database, p.MeasurementName))
+	if err != nil && !strings.Contains(err.Error(), "already") {
+		return err
+	}
+	return nil
+}
+
+func (t *IotdbClient) ListDatabases() ([]string, error) {
+	// iotdb 1.x使用SHOW DATABASES，0.13及以前版本使用SHOW STORAGE GROUP
+	values, err := t.query("SHOW DATABASES")
+	if err != nil {
+		values, err = t.query("SHOW STORAGE GROUP")
+	}
+	if err != nil {
+		return nil, err
+	}
+	databases := make([]string, 0)
+	if len(values) > 0 {
+		for _, v := range values[0] {
+			if name, ok := v.(string); ok {
+				databases = append(databases, strings.TrimPrefix(name, "root."))
+			}
+		}
+	}
+	log.Info("The following databases already exist in the data store: ", strings.Join(databases, ", "))
+	return databases, nil
+}
+
+func (t *IotdbClient) DropDatabase(name string) error {
+	log.Infof("drop database root.%s", name)
+	err := t.nonQuery("DELETE DATABASE root." + name)
+	if err != nil {
+		err = t.nonQuery("DELETE STORAGE GROUP root." + name)
+	}
+	if err != nil && strings.Contains(err.Error(), "not exist") {
+		return nil
+	}
+	return err
+}
+
+// DropMeasurement 删除measurement下的所有时间线，时间线由元数据模板创建时需要先解除模板激活
+func (t *IotdbClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	path := fmt.Sprintf("root.%s.%s.**", t.c.Database, name)
+	err := t.nonQuery("DELETE TIMESERIES " + path)
+	if err != nil {
+		err = t.nonQuery(fmt.Sprintf("DEACTIVATE SCHEMA TEMPLATE %s_%s FROM %s", t.c.Database, name, path))
+	}
+	if err != nil && strings.Contains(err.Error(), "not exist") {
+		return nil
+	}
+	return err
+}
+
+// SeriesCount 统计database下的时间线数量，iotdb中每个设备的每个物理量是一条时间线
+func (t *IotdbClient) SeriesCount() (int64, error) {
+	values, err := t.query(fmt.Sprintf("COUNT TIMESERIES root.%s.**", t.c.Database))
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 || len(values[0]) == 0 {
+		return 0, nil
+	}
+	count, ok := values[0][0].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid count timeseries result: %v", values)
+	}
+	return int64(count), nil
+}
+
+// CreateRetentionPolicy iotdb中使用database的TTL作为保留策略，name和isDefault不生效
+func (t *IotdbClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	log.Infof("set ttl of root.%s to %s", t.c.Database, duration)
+	if duration <= 0 {
+		return t.nonQuery(fmt.Sprintf("UNSET TTL TO root.%s", t.c.Database))
+	}
+	return t.nonQuery(fmt.Sprintf("SET TTL TO root.%s %d", t.c.Database, duration.Milliseconds()))
+}
+
+// Flush 把database的内存表刷到磁盘
+func (t *IotdbClient) Flush() error {
+	return t.nonQuery(fmt.Sprintf("FLUSH root.%s", t.c.Database))
+}
+
+func (t *IotdbClient) CheckConnection(timeout time.Duration) bool {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethodBytes(get)
+	req.Header.SetRequestURI(fmt.Sprintf("%s/ping", t.host))
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second}
+
+	endTime := time.Now().Add(timeout)
+	log.Info("checking connection ")
+	fmt.Print("checking .")
+	defer fmt.Println()
+	for time.Now().Before(endTime) {
+		err := clientWithTimeout.Do(req, resp)
+		if err == nil && resp.StatusCode() == fasthttp.StatusOK {
+			return true
+		}
+		time.Sleep(2 * time.Second)
+		fmt.Print(".")
+	}
+	return false
+}
+
+func (t *IotdbClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+// SerializeAndAppendPoint 把point按设备缓存到tablet中，不修改buf，
+// 由AfterSerializePoints把整个batch输出为按列组织的tablet
+func (t *IotdbClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+	device := t.appendDevicePath(make([]byte, 0, 128), p)
+	tablet, ok := t.tablets[string(device)]
+	if !ok {
+		tablet = t.newTablet(device)
+		t.tablets[string(device)] = tablet
+		t.tabletOrder = append(t.tabletOrder, tablet)
+		t.buffered += len(device)
+	}
+	row := len(tablet.timestamps)
+	tablet.timestamps = append(tablet.timestamps, p.Timestamp.UTC().UnixNano()/int64(time.Millisecond))
+	t.buffered += 14 // 毫秒时间戳
+	for i := range p.FieldKeys {
+		if p.FieldIsNull(i) {
+			continue
+		}
+		dataType, err := iotdbDataType(p.FieldValues[i])
+		if err != nil {
+			t.err = err
+			continue
+		}
+		col, err := t.column(tablet, p.FieldKeys[i], dataType, row)
+		if err != nil {
+			t.err = err
+			continue
+		}
+		n := len(tablet.values[col])
+		tablet.values[col] = appendIotdbValue(tablet.values[col], row > 0, p.FieldValues[i])
+		tablet.rows[col]++
+		t.buffered += len(tablet.values[col]) - n
+	}
+	for i := range p.Int64FiledKeys {
+		if p.Int64FieldIsNull(i) {
+			continue
+		}
+		col, err := t.column(tablet, p.Int64FiledKeys[i], "INT64", row)
+		if err != nil {
+			t.err = err
+			continue
+		}
+		n := len(tablet.values[col])
+		if row > 0 {
+			tablet.values[col] = append(tablet.values[col], ',')
+		}
+		tablet.values[col] = strconv.AppendInt(tablet.values[col], p.Int64FiledValues[i], 10)
+		tablet.rows[col]++
+		t.buffered += len(tablet.values[col]) - n
+	}
+	// 这个point缺少的列填null
+	for col := range tablet.values {
+		t.buffered += tablet.fillNull(col, row+1)
+	}
+	return buf
+}
+
+// column 返回字段对应的列，不存在时增加一列，并为之前的行填null，
+// 同一个字段的数据类型变化时返回错误
+func (t *IotdbClient) column(tablet *iotdbTablet, field []byte, dataType string, row int) (int, error) {
+	if col, ok := tablet.columns[string(field)]; ok {
+		if tablet.dataTypes[col] != dataType {
+			return 0, fmt.Errorf("the type of field %s in %s changed from %s to %s", field, tablet.device, tablet.dataTypes[col], dataType)
+		}
+		return col, nil
+	}
+	col := len(tablet.measurements)
+	tablet.columns[string(field)] = col
+	tablet.measurements = append(tablet.measurements, field)
+	tablet.dataTypes = append(tablet.dataTypes, dataType)
+	if col < cap(tablet.values) {
+		tablet.values = tablet.values[:col+1]
+		tablet.values[col] = tablet.values[col][:0]
+	} else {
+		tablet.values = append(tablet.values, nil)
+	}
+	tablet.rows = append(tablet.rows, 0)
+	t.buffered += len(field) + 12 // 加上数据类型
+	t.buffered += tablet.fillNull(col, row)
+	return col, nil
+}
+
+// fillNull 为列填null直到有rows个值，返回增加的字节数
+func (tablet *iotdbTablet) fillNull(col, rows int) int {
+	n := len(tablet.values[col])
+	for tablet.rows[col] < rows {
+		tablet.values[col] = appendIotdbValue(tablet.values[col], tablet.rows[col] > 0, nil)
+		tablet.rows[col]++
+	}
+	return len(tablet.values[col]) - n
+}
+
+// AfterSerializePoints 输出insertTablet接口的请求体，每个设备一行，例如：
+// {"deviceId":"root.benchmark_db.vehicle.`LSVNV2182E0200001`","measurements":["value1"],"dataTypes":["DOUBLE"],"timestamps":[1514764800000],"values":[[1.5]],"isAligned":false}
+func (t *IotdbClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
+	for _, tablet := range t.tabletOrder {
+		buf = append(buf, `{"deviceId":`...)
+		buf = appendJsonString(buf, tablet.device)
+		buf = append(buf, `,"measurements":[`...)
+		for i, m := range tablet.measurements {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJsonString(buf, m)
+		}
+		buf = append(buf, `],"dataTypes":[`...)
+		for i, dataType := range tablet.dataTypes {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, '"')
+			buf = append(buf, dataType...)
+			buf = append(buf, '"')
+		}
+		buf = append(buf, `],"timestamps":[`...)
+		for i, ts := range tablet.timestamps {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendInt(buf, ts, 10)
+		}
+		buf = append(buf, `],"values":[`...)
+		for i, column := range tablet.values {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, '[')
+			buf = append(buf, column...)
+			buf = append(buf, ']')
+		}
+		buf = append(buf, "],\"isAligned\":false}\n"...)
+	}
+
+	// 重置缓存的tablet，供下一个batch复用
+	for k := range t.tablets {
+		delete(t.tablets, k)
+	}
+	t.tabletPool = append(t.tabletPool, t.tabletOrder...)
+	t.tabletOrder = t.tabletOrder[:0]
+	t.buffered = 0
+	return buf
+}
+
+func (t *IotdbClient) BufferedBytes() int {
+	return t.buffered
+}
+
+func (t *IotdbClient) newTablet(device []byte) *iotdbTablet {
+	var tablet *iotdbTablet
+	if n := len(t.tabletPool); n > 0 {
+		tablet = t.tabletPool[n-1]
+		t.tabletPool = t.tabletPool[:n-1]
+	} else {
+		tablet = &iotdbTablet{columns: make(map[string]int)}
+	}
+	tablet.device = device
+	tablet.timestamps = tablet.timestamps[:0]
+	tablet.measurements = tablet.measurements[:0]
+	tablet.dataTypes = tablet.dataTypes[:0]
+	tablet.values = tablet.values[:0]
+	tablet.rows = tablet.rows[:0]
+	for k := range tablet.columns {
+		delete(tablet.columns, k)
+	}
+	return tablet
+}
+
+// appendDevicePath 生成设备路径root.<database>.<measurement>.<tag values>，tag值使用反引号包裹
+func (t *IotdbClient) appendDevicePath(buf []byte, p *common.Point) []byte {
+	buf = append(buf, "root."...)
+	buf = append(buf, t.database...)
+	buf = append(buf, '.')
+	buf = append(buf, p.MeasurementName...)
+	for _, tagValue := range p.TagValues {
+		buf = append(buf, '.')
+		buf = append(buf, iotdbQuoteNode(tagValue)...)
+	}
+	return buf
+}
+
+func (t *IotdbClient) Close() {}
+
+func iotdbDataType(v interface{}) (string, error) {
+	switch v.(type) {
+	case float64:
+		return "DOUBLE", nil
+	case float32:
+		return "FLOAT", nil
+	case int, int64:
+		return "INT64", nil
+	case bool:
+		return "BOOLEAN", nil
+	case string, []byte:
+		return "TEXT", nil
+	default:
+		return "", fmt.Errorf("unknown field type for %v", v)
+	}
+}
+
+// iotdbQuoteNode 使用反引号包裹路径节点，节点中的反引号使用两个反引号转义
+func iotdbQuoteNode(node []byte) string {
+	return "`" + strings.ReplaceAll(string(node), "`", "``") + "`"
+}
+
+func appendIotdbValue(buf []byte, needComma bool, v interface{}) []byte {
+	if needComma {
+		buf = append(buf, ',')
+	}
+	switch v := v.(type) {
+	case nil:
+		// 缺失的字段
+		return append(buf, jsonNull...)
+	case string:
+		return appendJsonString(buf, []byte(v))
+	case []byte:
+		return appendJsonString(buf, v)
+	default:
+		return fastFormatAppend(v, buf, false)
+	}
+}
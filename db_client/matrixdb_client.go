@@ -18,6 +18,15 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
+// matrixdb的写入方式
+const (
+	MatrixdbIngestMxgate = "mxgate" // 通过mxgate的http接口写入，需要在数据库主机上启动mxgate
+	MatrixdbIngestCopy   = "copy"   // 通过lib/pq连接使用COPY FROM STDIN写入
+	MatrixdbIngestInsert = "insert" // 通过lib/pq连接使用多行insert语句写入
+)
+
+const DefaultMxgatePort = 8086
+
 // MatrixdbWithMxgateClient is a Writer that writes to a fctsdb HTTP server.
 type MatrixdbWithMxgateClient struct {
 	httpclient fasthttp.Client
@@ -25,18 +34,32 @@ type MatrixdbWithMxgateClient struct {
 	writeUrl   []byte
 	buf        *bytes.Buffer
 	sqlDB      *sql.DB
+
+	ingest string
+	args   []interface{}
+	groups *pointGroups
 }
 
 // NewMatrixdbClient returns a new HTTPWriter from the supplied HTTPWriterConfig.
 func NewMatrixdbClient(c ClientConfig) *MatrixdbWithMxgateClient {
 
 	// mxgate api: http://localhost:8086/
+	port := c.MxgatePort
+	if port <= 0 {
+		port = DefaultMxgatePort
+	}
 	writeUrl := make([]byte, 0)
 	writeUrl = append(writeUrl, "http://"...)
 	writeUrl = append(writeUrl, c.Host...)
-	writeUrl = append(writeUrl, ":8086"...)
+	writeUrl = append(writeUrl, ':')
+	writeUrl = strconv.AppendInt(writeUrl, int64(port), 10)
 	writeUrl = append(writeUrl, "/"...)
 
+	ingest := c.IngestMode
+	if ingest == "" {
+		ingest = MatrixdbIngestMxgate
+	}
+
 	return &MatrixdbWithMxgateClient{
 		httpclient: fasthttp.Client{
 			Name:                "fctsdb",
@@ -45,6 +68,8 @@ func NewMatrixdbClient(c ClientConfig) *MatrixdbWithMxgateClient {
 		c:        c,
 		writeUrl: writeUrl,
 		buf:      bytes.NewBuffer(make([]byte, 0, 8*1024)),
+		ingest:   ingest,
+		groups:   newPointGroups(),
 	}
 }
 
@@ -52,6 +77,18 @@ func NewMatrixdbClient(c ClientConfig) *MatrixdbWithMxgateClient {
 // It returns the latency in nanoseconds and any error received while sending the data over HTTP,
 // or it returns a new error if the HTTP response isn't as expected.
 func (f *MatrixdbWithMxgateClient) Write(body []byte) (int64, error) {
+	switch f.ingest {
+	case MatrixdbIngestCopy:
+		return writeGroups(body, f.writeCopy)
+	case MatrixdbIngestInsert:
+		// 多张表的insert语句一次执行
+		return f.exec(body)
+	}
+	return writeGroups(body, f.writeMxgate)
+}
+
+// writeMxgate 通过mxgate的http接口写入一张表的数据
+func (f *MatrixdbWithMxgateClient) writeMxgate(body []byte) (int64, error) {
 	log.Debug("Write body", string(body))
 	req := fasthttp.AcquireRequest()
 	req.Header.SetContentTypeBytes(textPlain)
@@ -81,8 +118,77 @@ func (f *MatrixdbWithMxgateClient) Write(body []byte) (int64, error) {
 	return lat, err
 }
 
+// writeCopy 解析serializeTsvRow生成的文本，在一个事务中使用COPY FROM STDIN写入
+func (f *MatrixdbWithMxgateClient) writeCopy(body []byte) (int64, error) {
+	table, columns, args, err := parseTsvRows(body, f.args[:0])
+	f.args = args
+	if err != nil || columns == 0 {
+		return 0, err
+	}
+	db, err := f.db()
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	txn, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// 表名已经包含schema，并且建表时列名没有加引号，这里不使用pq.CopyIn避免列名大小写不一致
+	stmt, err := txn.Prepare("COPY " + table + " FROM STDIN")
+	if err != nil {
+		txn.Rollback()
+		return time.Since(start).Nanoseconds(), err
+	}
+	for i := 0; i < len(args); i += columns {
+		if _, err = stmt.Exec(args[i : i+columns]...); err != nil {
+			stmt.Close()
+			txn.Rollback()
+			return time.Since(start).Nanoseconds(), err
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		txn.Rollback()
+		return time.Since(start).Nanoseconds(), err
+	}
+	stmt.Close()
+	err = txn.Commit()
+	return time.Since(start).Nanoseconds(), err
+}
+
+func (f *MatrixdbWithMxgateClient) exec(body []byte) (int64, error) {
+	db, err := f.db()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	log.Debug(string(body))
+	start := time.Now()
+	_, err = conn.ExecContext(context.Background(), string(body))
+	return time.Since(start).Nanoseconds(), err
+}
+
+// db 返回连接到测试数据库的连接池，没有调用LoginUser时在第一次使用时创建
+func (f *MatrixdbWithMxgateClient) db() (*sql.DB, error) {
+	if f.sqlDB == nil {
+		if err := f.LoginUser(); err != nil {
+			return nil, err
+		}
+	}
+	return f.sqlDB, nil
+}
+
 func (f *MatrixdbWithMxgateClient) Query(body []byte) (int64, error) {
-	conn, err := f.sqlDB.Conn(context.Background())
+	db, err := f.db()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn(context.Background())
 	if err != nil {
 		return 0, err
 	}
@@ -107,6 +213,20 @@ func (f *MatrixdbWithMxgateClient) Query(body []byte) (int64, error) {
 	return lat, err
 }
 
+// QueryRows 执行查询并读取所有行，用于比较不同数据库的查询结果
+func (f *MatrixdbWithMxgateClient) QueryRows(body []byte) (*QueryResult, error) {
+	db, err := f.db()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(string(body))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSqlRows(rows)
+}
+
 func (f *MatrixdbWithMxgateClient) InitUser() error {
 	return nil
 }
@@ -138,7 +258,7 @@ func (f *MatrixdbWithMxgateClient) DropDatabase(name string) error {
 	defer db.Close()
 
 	log.Infof("drop database %s", name)
-	existingDatabases, err := f.listDatabases()
+	existingDatabases, err := f.ListDatabases()
 	if err != nil {
 		return err
 	}
@@ -171,7 +291,7 @@ func (f *MatrixdbWithMxgateClient) CreateDatabase(name string, withEncryption bo
 	}
 	defer db.Close()
 
-	existingDatabases, err := f.listDatabases()
+	existingDatabases, err := f.ListDatabases()
 	if err != nil {
 		return err
 	}
@@ -191,8 +311,8 @@ func (f *MatrixdbWithMxgateClient) CreateDatabase(name string, withEncryption bo
 	return nil
 }
 
-// listDatabases lists the existing databases in InfluxDB.
-func (f *MatrixdbWithMxgateClient) listDatabases() ([]string, error) {
+// ListDatabases lists the existing databases in InfluxDB.
+func (f *MatrixdbWithMxgateClient) ListDatabases() ([]string, error) {
 
 	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable", f.c.Host, 5432, f.c.User, f.c.Password)
 	db, err := sql.Open("postgres", psqlInfo)
@@ -326,6 +446,29 @@ func (f *MatrixdbWithMxgateClient) CreateMeasurement(p *common.Point) error {
 	return err
 }
 
+func (f *MatrixdbWithMxgateClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	db, err := f.db()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS public.%s;", name))
+	return err
+}
+
+func (f *MatrixdbWithMxgateClient) SeriesCount() (int64, error) {
+	return 0, notSupported("matrixdb", "series count")
+}
+
+func (f *MatrixdbWithMxgateClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	return notSupported("matrixdb", "retention policy")
+}
+
+// Flush mxgate写入的数据由mxgate定时提交，copy和insert方式提交事务后即可查询，都不需要额外刷新
+func (f *MatrixdbWithMxgateClient) Flush() error {
+	return nil
+}
+
 func (f *MatrixdbWithMxgateClient) CheckConnection(timeout time.Duration) bool {
 	endTime := time.Now().Add(timeout)
 	log.Info("checking connection ")
@@ -343,37 +486,75 @@ func (f *MatrixdbWithMxgateClient) CheckConnection(timeout time.Duration) bool {
 }
 
 func (m *MatrixdbWithMxgateClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte {
-	buf = append(buf, "public."...)
+	return buf
+}
+
+// SerializeAndAppendPoint 把point按表缓存，不修改buf，由AfterSerializePoints每张表输出一条语句或者一组数据
+func (m *MatrixdbWithMxgateClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+	switch m.ingest {
+	case MatrixdbIngestCopy:
+		m.groups.add(p, appendPublicTableLine, serializeTsvRow)
+	case MatrixdbIngestInsert:
+		m.groups.add(p, appendPublicInsertHead, m.serializeValues)
+	default:
+		m.groups.add(p, appendPublicTableLine, m.serializeMxgateRow)
+	}
+	return buf
+}
+
+// AfterSerializePoints insert方式每张表输出一条insert语句，mxgate和copy方式第一行为表名，之后每行一个point，每张表前面加上字节数
+func (m *MatrixdbWithMxgateClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
+	if m.ingest == MatrixdbIngestInsert {
+		return m.groups.flush(buf, appendStatementEnd)
+	}
+	return m.groups.flushFramed(buf)
+}
+
+func (m *MatrixdbWithMxgateClient) BufferedBytes() int {
+	return m.groups.buffered
+}
+
+func appendPublicInsertHead(buf []byte, p *common.Point) []byte {
+	buf = append(buf, "insert into public."...)
 	buf = append(buf, p.MeasurementName...)
-	buf = append(buf, "\n"...)
+	buf = append(buf, " values"...)
 	return buf
 }
 
-func (s *MatrixdbWithMxgateClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+func appendPublicTableLine(buf []byte, p *common.Point) []byte {
+	buf = append(buf, "public."...)
+	buf = append(buf, p.MeasurementName...)
+	buf = append(buf, '\n')
+	return buf
+}
 
+// serializeMxgateRow 序列化为mxgate的csv格式的一行，字符串按csv规则转义，缺失的字段为空，例如：
+// 1514764800,DEV000000001,23,1.5
+func (s *MatrixdbWithMxgateClient) serializeMxgateRow(buf []byte, p *common.Point) []byte {
 	// add the timestamp
 
 	buf = strconv.AppendInt(buf, p.Timestamp.Unix(), 10)
 
 	for i := 0; i < len(p.TagKeys); i++ {
 		buf = append(buf, ',')
-		buf = append(buf, p.TagValues[i]...)
-
+		buf = appendCsvValue(buf, p.TagValues[i])
 	}
 	buf = append(buf, ',')
 
 	var i int
 	for i = 0; i < len(p.FieldKeys); i++ {
-		v := p.FieldValues[i]
-		buf = fastFormatAppend(v, buf, false)
+		if !p.FieldIsNull(i) {
+			buf = appendSqlValue(buf, p.FieldValues[i], appendCsvValue)
+		}
 		if i+1 < len(p.FieldKeys) || len(p.Int64FiledKeys) != 0 {
 			buf = append(buf, ',')
 		}
 	}
 
 	for i = 0; i < len(p.Int64FiledKeys); i++ {
-		v := p.Int64FiledValues[i]
-		buf = strconv.AppendInt(buf, v, 10)
+		if !p.Int64FieldIsNull(i) {
+			buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+		}
 		if i+1 < len(p.Int64FiledKeys) {
 			buf = append(buf, ',')
 		}
@@ -383,7 +564,31 @@ func (s *MatrixdbWithMxgateClient) SerializeAndAppendPoint(buf []byte, p *common
 	return buf
 }
 
-func (m *MatrixdbWithMxgateClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
-
-	return buf
+// serializeValues 序列化为insert语句中的一行，例如：
+// ('2018-01-01 00:00:00.000','DEV000000001',23,1.5),
+func (s *MatrixdbWithMxgateClient) serializeValues(buf []byte, p *common.Point) []byte {
+	buf = append(buf, "('"...)
+	buf = append(buf, p.Timestamp.Format("2006-01-02 15:04:05.000")...)
+	buf = append(buf, '\'')
+	for i := 0; i < len(p.TagKeys); i++ {
+		buf = append(buf, ',')
+		buf = appendPgString(buf, p.TagValues[i])
+	}
+	for i := 0; i < len(p.FieldKeys); i++ {
+		buf = append(buf, ',')
+		if p.FieldIsNull(i) {
+			buf = append(buf, sqlNull...)
+			continue
+		}
+		buf = appendSqlValue(buf, p.FieldValues[i], appendPgString)
+	}
+	for i := 0; i < len(p.Int64FiledKeys); i++ {
+		buf = append(buf, ',')
+		if p.Int64FieldIsNull(i) {
+			buf = append(buf, sqlNull...)
+			continue
+		}
+		buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+	}
+	return append(buf, "),"...)
 }
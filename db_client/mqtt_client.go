@@ -0,0 +1,349 @@
+package db_client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+	"git.querycap.com/falcontsdb/fctsdb-bench/util/mqtt"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultMqttTopic = "fcbench/{measurement}"
+
+var mqttClientCount int64
+
+// MqttClient 把point发布到MQTT broker，topic由tag按照topic模板生成，例如"airq/{province}/{site_id}"，
+// 载荷可以是json或者行协议，可以每个point发布一条消息，也可以把一个batch中相同topic的point合并为一条消息。
+// Write返回的延时为发布开始到所有消息按QoS确认完成的时间。
+type MqttClient struct {
+	c       ClientConfig
+	addr    string
+	qos     byte
+	topic   *common.SqlTemplate
+	lp      *FctsdbClient
+	client  *mqtt.Client
+	msgs    []mqtt.Message
+	payload map[string]int
+	err     error // 序列化时发现point缺少topic中的tag，在Write时返回
+}
+
+func NewMqttClient(c ClientConfig) (*MqttClient, error) {
+	if c.MqttQos < 0 || c.MqttQos > 2 {
+		return nil, fmt.Errorf("unsupported mqtt qos %d", c.MqttQos)
+	}
+	switch c.MqttPayload {
+	case "", "json", "line":
+	default:
+		return nil, fmt.Errorf("unsupported mqtt payload %s, choices: json, line", c.MqttPayload)
+	}
+	topicPattern := c.MqttTopic
+	if topicPattern == "" {
+		topicPattern = DefaultMqttTopic
+	}
+	topic, err := common.NewSqlTemplate(topicPattern)
+	if err != nil {
+		return nil, fmt.Errorf("parse mqtt topic error: %s", err.Error())
+	}
+	// example: tcp://localhost:1883
+	addr := c.Host
+	for _, scheme := range []string{"tcp://", "mqtt://"} {
+		addr = strings.TrimPrefix(addr, scheme)
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "1883")
+	}
+	return &MqttClient{
+		c:       c,
+		addr:    addr,
+		qos:     byte(c.MqttQos),
+		topic:   topic,
+		lp:      NewFctsdbClient(ClientConfig{}),
+		payload: make(map[string]int),
+	}, nil
+}
+
+func (m *MqttClient) connect() error {
+	if m.client != nil {
+		return nil
+	}
+	clientID := fmt.Sprintf("fcbench-%d-%d", time.Now().UnixNano(), atomic.AddInt64(&mqttClientCount, 1))
+	client, err := mqtt.Dial(m.addr, clientID, m.c.User, m.c.Password, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	m.client = client
+	return nil
+}
+
+// Write 解析SerializeAndAppendPoint生成的"topic\npayload\n"格式的消息并发布
+func (m *MqttClient) Write(body []byte) (int64, error) {
+	if m.err != nil {
+		err := m.err
+		m.err = nil
+		return 0, err
+	}
+	if err := m.connect(); err != nil {
+		return 0, err
+	}
+	m.msgs = m.msgs[:0]
+	for len(body) > 0 {
+		i := bytes.IndexByte(body, '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("invalid mqtt message body: %s", string(body))
+		}
+		topic := body[:i]
+		body = body[i+1:]
+		j := bytes.IndexByte(body, '\n')
+		if j < 0 {
+			return 0, fmt.Errorf("invalid mqtt message body: %s", string(body))
+		}
+		m.msgs = append(m.msgs, mqtt.Message{Topic: topic, Payload: body[:j]})
+		body = body[j+1:]
+	}
+	if m.c.MqttPerBatch {
+		m.msgs = m.mergeByTopic(m.msgs)
+	}
+
+	start := time.Now()
+	err := m.client.Publish(m.msgs, m.qos)
+	lat := time.Since(start).Nanoseconds()
+	if err != nil {
+		// 连接出错后重新建立连接
+		m.client.Close()
+		m.client = nil
+	}
+	return lat, err
+}
+
+// mergeByTopic 把相同topic的消息合并成一条，json载荷合并为数组，行协议载荷按行合并
+func (m *MqttClient) mergeByTopic(msgs []mqtt.Message) []mqtt.Message {
+	for k := range m.payload {
+		delete(m.payload, k)
+	}
+	merged := make([]mqtt.Message, 0)
+	for _, msg := range msgs {
+		if i, ok := m.payload[string(msg.Topic)]; ok {
+			if m.c.MqttPayload == "line" {
+				merged[i].Payload = append(merged[i].Payload, '\n')
+			} else {
+				merged[i].Payload = append(merged[i].Payload, ',')
+			}
+			merged[i].Payload = append(merged[i].Payload, msg.Payload...)
+			continue
+		}
+		m.payload[string(msg.Topic)] = len(merged)
+		payload := make([]byte, 0, len(msg.Payload)*4)
+		if m.c.MqttPayload != "line" {
+			payload = append(payload, '[')
+		}
+		merged = append(merged, mqtt.Message{Topic: msg.Topic, Payload: append(payload, msg.Payload...)})
+	}
+	if m.c.MqttPayload != "line" {
+		for i := range merged {
+			merged[i].Payload = append(merged[i].Payload, ']')
+		}
+	}
+	return merged
+}
+
+func (m *MqttClient) Query(body []byte) (int64, error) {
+	return 0, fmt.Errorf("mqtt does not support query")
+}
+
+func (m *MqttClient) InitUser() error {
+	return nil
+}
+
+func (m *MqttClient) LoginUser() error {
+	return nil
+}
+
+func (m *MqttClient) CreateDatabase(name string, withEncryption bool) error {
+	log.Infof("mqtt does not need to create database %s", name)
+	return nil
+}
+
+func (m *MqttClient) CreateMeasurement(p *common.Point) error {
+	return nil
+}
+
+func (m *MqttClient) ListDatabases() ([]string, error) {
+	return nil, notSupported("mqtt", "list databases")
+}
+
+func (m *MqttClient) DropDatabase(name string) error {
+	return notSupported("mqtt", "drop database")
+}
+
+func (m *MqttClient) DropMeasurement(name string) error {
+	return notSupported("mqtt", "drop measurement")
+}
+
+func (m *MqttClient) SeriesCount() (int64, error) {
+	return 0, notSupported("mqtt", "count series")
+}
+
+func (m *MqttClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	return notSupported("mqtt", "create retention policy")
+}
+
+// Flush mqtt消息发出后即由broker负责转发，不需要刷盘
+func (m *MqttClient) Flush() error {
+	return nil
+}
+
+func (m *MqttClient) CheckConnection(timeout time.Duration) bool {
+	endTime := time.Now().Add(timeout)
+	log.Info("checking connection ")
+	fmt.Print("checking .")
+	defer fmt.Println()
+	for time.Now().Before(endTime) {
+		conn, err := net.DialTimeout("tcp", m.addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		time.Sleep(2 * time.Second)
+		fmt.Print(".")
+	}
+	return false
+}
+
+func (m *MqttClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+// SerializeAndAppendPoint 每个point序列化为两行，第一行为topic，第二行为载荷，例如：
+// airq/北京市/DEV000000001
+// {"measurement":"city_air_quality","tags":{"province":"北京市","site_id":"DEV000000001"},"fields":{"aqi":23},"timestamp":1514764800000000000}
+func (m *MqttClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+	buf = m.appendTopic(buf, p)
+	buf = append(buf, '\n')
+	if m.c.MqttPayload == "line" {
+		// 行协议序列化结果自带换行符
+		return m.lp.SerializeAndAppendPoint(buf, p)
+	}
+
+	buf = append(buf, `{"measurement":`...)
+	buf = appendJsonString(buf, p.MeasurementName)
+	buf = append(buf, `,"tags":{`...)
+	for i := 0; i < len(p.TagKeys); i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJsonString(buf, p.TagKeys[i])
+		buf = append(buf, ':')
+		buf = appendJsonString(buf, p.TagValues[i])
+	}
+	buf = append(buf, `},"fields":{`...)
+	first := true
+	for i := 0; i < len(p.FieldKeys); i++ {
+		if p.FieldIsNull(i) {
+			continue
+		}
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = appendJsonString(buf, p.FieldKeys[i])
+		buf = append(buf, ':')
+		switch v := p.FieldValues[i].(type) {
+		case string:
+			buf = appendJsonString(buf, []byte(v))
+		case []byte:
+			buf = appendJsonString(buf, v)
+		default:
+			buf = fastFormatAppend(v, buf, false)
+		}
+	}
+	for i := 0; i < len(p.Int64FiledKeys); i++ {
+		if p.Int64FieldIsNull(i) {
+			continue
+		}
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = appendJsonString(buf, p.Int64FiledKeys[i])
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+	}
+	buf = append(buf, `},"timestamp":`...)
+	buf = strconv.AppendInt(buf, p.Timestamp.UTC().UnixNano(), 10)
+	buf = append(buf, "}\n"...)
+	return buf
+}
+
+// CheckTopic 检查topic模板中的关键字，关键字只能是measurement或者point中的tag名称
+func (m *MqttClient) CheckTopic(p *common.Point) error {
+	for _, key := range m.topic.KeyWords {
+		if key != "measurement" && topicTagIndex(p, key) < 0 {
+			return fmt.Errorf("unknown keyword {%s} in mqtt topic, must be measurement or a tag of %s", key, p.MeasurementName)
+		}
+	}
+	return nil
+}
+
+// appendTopic 根据topic模板生成topic，模板中的关键字为tag名称或者measurement
+func (m *MqttClient) appendTopic(buf []byte, p *common.Point) []byte {
+	for i := range m.topic.Base {
+		buf = append(buf, m.topic.Base[i]...)
+		if i >= len(m.topic.KeyWords) {
+			continue
+		}
+		key := m.topic.KeyWords[i]
+		if key == "measurement" {
+			buf = appendTopicLevel(buf, p.MeasurementName)
+			continue
+		}
+		j := topicTagIndex(p, key)
+		if j < 0 {
+			if m.err == nil {
+				m.err = fmt.Errorf("the point of %s has no tag '%s' in mqtt topic", p.MeasurementName, key)
+			}
+			continue
+		}
+		buf = appendTopicLevel(buf, p.TagValues[j])
+	}
+	return buf
+}
+
+// topicTagIndex 模板关键字已经转为小写，tag名称不区分大小写，没有该tag时返回-1
+func topicTagIndex(p *common.Point, key string) int {
+	for j := range p.TagKeys {
+		if strings.EqualFold(key, string(p.TagKeys[j])) {
+			return j
+		}
+	}
+	return -1
+}
+
+// appendTopicLevel topic中的/是层级分隔符，+和#是通配符，换行会破坏Write解析的消息格式，这些字符替换为_
+func appendTopicLevel(buf []byte, s []byte) []byte {
+	for _, b := range s {
+		switch b {
+		case '/', '+', '#', '\n', 0:
+			b = '_'
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+func (m *MqttClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+func (m *MqttClient) Close() {
+	if m.client != nil {
+		m.client.Close()
+		m.client = nil
+	}
+}
@@ -1,23 +1,45 @@
 package db_client
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 )
 
+// mysql的写入方式
+const (
+	MysqlIngestInsert   = "insert"    // 拼接insert into ... values (...),(...)语句
+	MysqlIngestPrepare  = "prepare"   // 使用占位符的多行prepared statement
+	MysqlIngestLoadData = "load-data" // 使用LOAD DATA LOCAL INFILE从内存中流式导入
+)
+
+// mysql单条语句中占位符的最大个数
+const mysqlMaxPlaceholders = 65535
+
+var mysqlReaderCount int64
+
 // MysqlWrite is a Writer that writes to a mysql server.
 type MysqlClient struct {
 	DB *sql.DB
 	c  ClientConfig
+
+	ingest     string
+	readerName string
+	stmts      map[string]*sql.Stmt // 写入和查询使用的prepared statement缓存
+	args       []interface{}
+	groups     *pointGroups
 }
 
 // NewMysqlClient returns a new DBClient of Mysql .
@@ -30,17 +52,45 @@ func NewMysqlClient(c ClientConfig) (*MysqlClient, error) {
 	db.SetConnMaxLifetime(0) //最大连接周期，超过时间的连接就close
 	db.SetMaxOpenConns(100)  //设置最大连接数
 	db.SetMaxIdleConns(100)  //设置闲置连接数
+	ingest := c.IngestMode
+	if ingest == "" {
+		ingest = MysqlIngestInsert
+	}
+	switch ingest {
+	case MysqlIngestInsert, MysqlIngestPrepare, MysqlIngestLoadData:
+	default:
+		db.Close()
+		return nil, fmt.Errorf("unsupported mysql ingest mode %s, choices: insert, prepare, load-data", ingest)
+	}
 	return &MysqlClient{
-		DB: db,
-		c:  c,
+		DB:         db,
+		c:          c,
+		ingest:     ingest,
+		readerName: fmt.Sprintf("fcbench_%d", atomic.AddInt64(&mysqlReaderCount, 1)),
+		stmts:      make(map[string]*sql.Stmt),
+		groups:     newPointGroups(),
 	}, nil
 }
 
 func (m *MysqlClient) Close() {
+	for _, stmt := range m.stmts {
+		stmt.Close()
+	}
 	m.DB.Close()
 }
 
 func (m *MysqlClient) Write(body []byte) (int64, error) {
+	switch m.ingest {
+	case MysqlIngestPrepare:
+		return writeGroups(body, m.writePrepared)
+	case MysqlIngestLoadData:
+		return writeGroups(body, m.writeLoadData)
+	}
+	// 多张表的insert语句通过multiStatements一次执行
+	return m.exec(body)
+}
+
+func (m *MysqlClient) exec(body []byte) (int64, error) {
 	conn, err := m.DB.Conn(context.Background())
 	if err != nil {
 		return 0, err
@@ -54,6 +104,9 @@ func (m *MysqlClient) Write(body []byte) (int64, error) {
 }
 
 func (m *MysqlClient) Query(lines []byte) (int64, error) {
+	if m.c.PrepareQuery {
+		return m.queryPrepared(lines)
+	}
 	conn, err := m.DB.Conn(context.Background())
 	if err != nil {
 		return 0, err
@@ -67,6 +120,16 @@ func (m *MysqlClient) Query(lines []byte) (int64, error) {
 	return executeTime, err
 }
 
+// QueryRows 执行查询并读取所有行，用于比较不同数据库的查询结果
+func (m *MysqlClient) QueryRows(body []byte) (*QueryResult, error) {
+	rows, err := m.DB.Query(string(body))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSqlRows(rows)
+}
+
 func (m *MysqlClient) InitUser() error {
 	return nil
 }
@@ -78,7 +141,7 @@ func (m *MysqlClient) LoginUser() error {
 func (m *MysqlClient) CreateDatabase(name string, withEncryption bool) error {
 
 	log.Infof("create database %s", name)
-	existingDatabases, err := m.listDatabases()
+	existingDatabases, err := m.ListDatabases()
 	if err != nil {
 		return err
 	}
@@ -107,7 +170,7 @@ func (m *MysqlClient) CreateDatabase(name string, withEncryption bool) error {
 	return err
 }
 
-func (m *MysqlClient) listDatabases() ([]string, error) {
+func (m *MysqlClient) ListDatabases() ([]string, error) {
 	dsn := fmt.Sprintf("%s:%s@%s(%s)/", m.c.User, m.c.Password, "tcp", m.c.Host)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -131,6 +194,42 @@ func (m *MysqlClient) listDatabases() ([]string, error) {
 	return databases, nil
 }
 
+// manageExec 在不指定database的连接上执行管理语句
+func (m *MysqlClient) manageExec(query string) error {
+	dsn := fmt.Sprintf("%s:%s@%s(%s)/", m.c.User, m.c.Password, "tcp", m.c.Host)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	log.Debug(query)
+	_, err = db.Exec(query)
+	return err
+}
+
+func (m *MysqlClient) DropDatabase(name string) error {
+	log.Infof("drop database %s", name)
+	return m.manageExec(fmt.Sprintf("drop database if exists %s;", name))
+}
+
+func (m *MysqlClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	return m.manageExec(fmt.Sprintf("drop table if exists %s.%s;", m.c.Database, name))
+}
+
+func (m *MysqlClient) SeriesCount() (int64, error) {
+	return 0, notSupported("mysql", "series count")
+}
+
+func (m *MysqlClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	return notSupported("mysql", "retention policy")
+}
+
+// Flush mysql写入的事务提交后即可查询，不需要额外刷新
+func (m *MysqlClient) Flush() error {
+	return nil
+}
+
 func (m *MysqlClient) CheckConnection(timeout time.Duration) bool {
 	endTime := time.Now().Add(timeout)
 	log.Info("checking connection ")
@@ -204,12 +303,38 @@ func (m *MysqlClient) CreateMeasurement(p *common.Point) error {
 	buf = append(buf, ");"...)
 
 	// 写入表
-	_, err := m.Write(buf)
+	_, err := m.exec(buf)
 	return err
 
 }
 
 func (m *MysqlClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte {
+	return buf
+}
+
+// SerializeAndAppendPoint 把point按表缓存，不修改buf，由AfterSerializePoints每张表输出一条语句
+func (m *MysqlClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
+	if m.ingest != MysqlIngestInsert {
+		m.groups.add(p, appendTableLine, serializeTsvRow)
+	} else {
+		m.groups.add(p, m.appendInsertHead, m.appendInsertRow)
+	}
+	return buf
+}
+
+// AfterSerializePoints insert方式每张表输出一条insert语句，prepare和load-data方式第一行为表名，之后每行一个point，每张表前面加上字节数
+func (m *MysqlClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
+	if m.ingest != MysqlIngestInsert {
+		return m.groups.flushFramed(buf)
+	}
+	return m.groups.flush(buf, appendStatementEnd)
+}
+
+func (m *MysqlClient) BufferedBytes() int {
+	return m.groups.buffered
+}
+
+func (m *MysqlClient) appendInsertHead(buf []byte, p *common.Point) []byte {
 	buf = append(buf, "insert into "...)
 	buf = append(buf, p.MeasurementName...)
 	buf = append(buf, " values"...)
@@ -217,11 +342,7 @@ func (m *MysqlClient) BeforeSerializePoints(buf []byte, p *common.Point) []byte
 }
 
 // insert into table values ( "xxx","xxx")
-func (s *MysqlClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
-	// buf := scratchBufPool.Get().([]byte)
-	// buf := make([]byte, 0, 4*1024)
-	//buf = append(buf, "insert into "...)
-	//buf = append(buf, p.MeasurementName...)
+func (m *MysqlClient) appendInsertRow(buf []byte, p *common.Point) []byte {
 	buf = append(buf, "("...)
 
 	// add the timestamp
@@ -231,24 +352,28 @@ func (s *MysqlClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byt
 
 	for i := 0; i < len(p.TagKeys); i++ {
 		buf = append(buf, ',')
-		buf = append(buf, '"')
-		buf = append(buf, p.TagValues[i]...)
-		buf = append(buf, '"')
+		buf = appendMysqlString(buf, p.TagValues[i])
 	}
 	buf = append(buf, ',')
 
 	var i int
 	for i = 0; i < len(p.FieldKeys); i++ {
-		v := p.FieldValues[i]
-		buf = fastFormatAppend(v, buf, false)
+		if p.FieldIsNull(i) {
+			buf = append(buf, sqlNull...)
+		} else {
+			buf = appendSqlValue(buf, p.FieldValues[i], appendMysqlString)
+		}
 		if i+1 < len(p.FieldKeys) || len(p.Int64FiledKeys) != 0 {
 			buf = append(buf, ',')
 		}
 	}
 
 	for i = 0; i < len(p.Int64FiledKeys); i++ {
-		v := p.Int64FiledValues[i]
-		buf = strconv.AppendInt(buf, v, 10)
+		if p.Int64FieldIsNull(i) {
+			buf = append(buf, sqlNull...)
+		} else {
+			buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+		}
 		if i+1 < len(p.Int64FiledKeys) {
 			buf = append(buf, ',')
 		}
@@ -259,7 +384,264 @@ func (s *MysqlClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byt
 	return buf
 }
 
-func (m *MysqlClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
-	buf = buf[:len(buf)-1]
-	return append(buf, ';')
+// appendTableLine 表名加数据行格式的第一行
+func appendTableLine(buf []byte, p *common.Point) []byte {
+	buf = append(buf, p.MeasurementName...)
+	return append(buf, '\n')
+}
+
+// serializeTsvRow 序列化为LOAD DATA默认的文本格式，这也是postgresql COPY的text格式，字段以\t分隔，行以\n结束，
+// 字段中的\、\t、\n使用反斜杠转义，缺失的字段为\N，例如：
+// 2018-01-01 00:00:00.000	DEV000000001	23	1.5
+func serializeTsvRow(buf []byte, p *common.Point) []byte {
+	buf = append(buf, p.Timestamp.Format("2006-01-02 15:04:05.000")...)
+	for i := 0; i < len(p.TagKeys); i++ {
+		buf = append(buf, '\t')
+		buf = appendTsvValue(buf, p.TagValues[i])
+	}
+	for i := 0; i < len(p.FieldKeys); i++ {
+		buf = append(buf, '\t')
+		if p.FieldIsNull(i) {
+			buf = append(buf, tsvNull...)
+			continue
+		}
+		switch v := p.FieldValues[i].(type) {
+		case string:
+			buf = appendTsvValue(buf, []byte(v))
+		case []byte:
+			buf = appendTsvValue(buf, v)
+		default:
+			buf = fastFormatAppend(v, buf, false)
+		}
+	}
+	for i := 0; i < len(p.Int64FiledKeys); i++ {
+		buf = append(buf, '\t')
+		if p.Int64FieldIsNull(i) {
+			buf = append(buf, tsvNull...)
+			continue
+		}
+		buf = strconv.AppendInt(buf, p.Int64FiledValues[i], 10)
+	}
+	return append(buf, '\n')
+}
+
+func appendTsvValue(buf []byte, v []byte) []byte {
+	for _, b := range v {
+		switch b {
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// parseTsvRows 解析serializeTsvRow生成的文本，返回表名、列数和所有行的值
+func parseTsvRows(body []byte, args []interface{}) (string, int, []interface{}, error) {
+	i := bytes.IndexByte(body, '\n')
+	if i < 0 {
+		return "", 0, args, fmt.Errorf("invalid mysql rows body: %s", string(body))
+	}
+	table := string(body[:i])
+	body = body[i+1:]
+	columns := 0
+	for len(body) > 0 {
+		var line []byte
+		if i = bytes.IndexByte(body, '\n'); i >= 0 {
+			line, body = body[:i], body[i+1:]
+		} else {
+			line, body = body, nil
+		}
+		fields := bytes.Split(line, []byte{'\t'})
+		if columns == 0 {
+			columns = len(fields)
+		} else if columns != len(fields) {
+			return "", 0, args, fmt.Errorf("the column count of rows in table %s is different", table)
+		}
+		for _, field := range fields {
+			if bytes.Equal(field, tsvNull) {
+				args = append(args, nil)
+				continue
+			}
+			if bytes.IndexByte(field, '\\') < 0 {
+				args = append(args, string(field))
+				continue
+			}
+			value := make([]byte, 0, len(field))
+			for k := 0; k < len(field); k++ {
+				if field[k] == '\\' && k+1 < len(field) {
+					k++
+					switch field[k] {
+					case 't':
+						value = append(value, '\t')
+					case 'n':
+						value = append(value, '\n')
+					default:
+						value = append(value, field[k])
+					}
+					continue
+				}
+				value = append(value, field[k])
+			}
+			args = append(args, string(value))
+		}
+	}
+	return table, columns, args, nil
+}
+
+// writePrepared 使用占位符的多行insert语句写入，语句按表名、行数和列数缓存，
+// 超过占位符个数限制时拆分成多条语句执行
+func (m *MysqlClient) writePrepared(body []byte) (int64, error) {
+	table, columns, args, err := parseTsvRows(body, m.args[:0])
+	m.args = args
+	if err != nil || columns == 0 {
+		return 0, err
+	}
+	rows := len(args) / columns
+	maxRows := mysqlMaxPlaceholders / columns
+	var executeTime int64
+	for start := 0; start < rows; start += maxRows {
+		n := rows - start
+		if n > maxRows {
+			n = maxRows
+		}
+		stmt, err := m.prepare(fmt.Sprintf("insert:%s:%d:%d", table, n, columns), func() string {
+			row := "(" + strings.TrimSuffix(strings.Repeat("?,", columns), ",") + ")"
+			return "insert into " + table + " values " + strings.TrimSuffix(strings.Repeat(row+",", n), ",")
+		})
+		if err != nil {
+			return executeTime, err
+		}
+		startTime := time.Now()
+		_, err = stmt.Exec(args[start*columns : (start+n)*columns]...)
+		executeTime += time.Since(startTime).Nanoseconds()
+		if err != nil {
+			return executeTime, err
+		}
+	}
+	return executeTime, nil
+}
+
+// writeLoadData 使用LOAD DATA LOCAL INFILE导入，数据通过注册的Reader从内存中读取，需要服务端开启local_infile
+func (m *MysqlClient) writeLoadData(body []byte) (int64, error) {
+	i := bytes.IndexByte(body, '\n')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid mysql rows body: %s", string(body))
+	}
+	table, rows := string(body[:i]), body[i+1:]
+	mysql.RegisterReaderHandler(m.readerName, func() io.Reader {
+		return bytes.NewReader(rows)
+	})
+	defer mysql.DeregisterReaderHandler(m.readerName)
+	return m.exec([]byte(fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s", m.readerName, table)))
+}
+
+// queryPrepared 把查询语句中的字符串常量替换为占位符，使用服务端prepared statement执行，
+// 相同查询模板生成的语句复用同一个prepared statement。prepared statement只能包含一条语句，
+// batch中;拼接的多条语句依次执行
+func (m *MysqlClient) queryPrepared(lines []byte) (int64, error) {
+	var executeTime int64
+	for _, statement := range splitSqlStatements(string(lines)) {
+		query, args := parameterizeSql(statement)
+		stmt, err := m.prepare("query:"+query, func() string { return query })
+		if err != nil {
+			return executeTime, err
+		}
+		startTime := time.Now()
+		rows, err := stmt.Query(args...)
+		if err == nil {
+			rows.Close()
+		}
+		executeTime += time.Since(startTime).Nanoseconds()
+		if err != nil {
+			return executeTime, err
+		}
+	}
+	return executeTime, nil
+}
+
+// splitSqlStatements 按引号外的;分割多条sql语句，忽略空语句
+func splitSqlStatements(query string) []string {
+	statements := make([]string, 0, 1)
+	start := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ';':
+			if statement := strings.TrimSpace(query[start:i]); statement != "" {
+				statements = append(statements, statement)
+			}
+			start = i + 1
+		}
+	}
+	if statement := strings.TrimSpace(query[start:]); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+func (m *MysqlClient) prepare(key string, query func() string) (*sql.Stmt, error) {
+	if stmt, ok := m.stmts[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := m.DB.Prepare(query())
+	if err != nil {
+		return nil, err
+	}
+	m.stmts[key] = stmt
+	return stmt, nil
+}
+
+// parameterizeSql 把sql中单引号包裹的字符串常量替换为?，返回替换后的语句和常量值，例如：
+// select * from vehicle where VIN in ('a','b') 替换为 select * from vehicle where VIN in (?,?)
+func parameterizeSql(query string) (string, []interface{}) {
+	var sb strings.Builder
+	args := make([]interface{}, 0)
+	for i := 0; i < len(query); i++ {
+		if query[i] != '\'' {
+			sb.WriteByte(query[i])
+			continue
+		}
+		var value strings.Builder
+		closed := false
+		for i++; i < len(query); i++ {
+			c := query[i]
+			if c == '\\' && i+1 < len(query) {
+				i++
+				value.WriteByte(query[i])
+				continue
+			}
+			if c == '\'' {
+				if i+1 < len(query) && query[i+1] == '\'' {
+					i++
+					value.WriteByte('\'')
+					continue
+				}
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			// 引号不匹配时不做替换
+			return query, nil
+		}
+		sb.WriteByte('?')
+		args = append(args, value.String())
+	}
+	return sb.String(), args
 }
@@ -4,17 +4,21 @@ package db_client
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
+	"unicode/utf8"
 
 	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 )
 
-var applicationJsonHeader = []byte("application/json")
+var (
+	applicationJsonHeader = []byte("application/json")
+	opentsdbMustContain   = []byte(`"dps"`)
+)
 
 // OpentsdbClient is a Writer that writes to a fctsdb HTTP server.
 type OpentsdbClient struct {
@@ -28,12 +32,7 @@ type OpentsdbClient struct {
 
 // NewOpentsdbClient returns a new HTTPWriter from the supplied HTTPWriterConfig.
 func NewOpentsdbClient(c ClientConfig) *OpentsdbClient {
-	var host []byte
-	if c.Host[len(c.Host)-1] == '/' {
-		host = []byte(c.Host)[:len(c.Host)-1]
-	} else {
-		host = []byte(c.Host)
-	}
+	host, socketPath := parseHttpHost(c.Host)
 
 	// example: http://localhost:8086/api/put
 	writeUrl := append(host, "/api/put"...)
@@ -41,10 +40,9 @@ func NewOpentsdbClient(c ClientConfig) *OpentsdbClient {
 	// example: http://localhost:8086/api/query
 	queryUrl := append(host, "/api/query"...)
 
-	return &OpentsdbClient{
+	cli := &OpentsdbClient{
 		client: fasthttp.Client{
-			Name:                "opentsdb",
-			MaxIdleConnDuration: DefaultIdleConnectionTimeout,
+			Name: "opentsdb",
 		},
 		config:   c,
 		queryUrl: queryUrl,
@@ -52,6 +50,8 @@ func NewOpentsdbClient(c ClientConfig) *OpentsdbClient {
 		host:     host,
 		buf:      bytes.NewBuffer(make([]byte, 0, 8*1024)),
 	}
+	configureHttpClient(&cli.client, c, socketPath)
+	return cli
 }
 
 // Write writes the given byte slice to the HTTP server described in the Writer's HTTPWriterConfig.
@@ -89,17 +89,19 @@ func (f *OpentsdbClient) Write(body []byte) (int64, error) {
 	return lat, err
 }
 
+// Query 把查询模板生成的json通过POST发送到/api/query，返回结果中没有数据点时认为查询失败
 func (f *OpentsdbClient) Query(body []byte) (int64, error) {
-	uri := fasthttp.AppendQuotedArg(f.queryUrl, body)
+	body = appendOpentsdbAscii(make([]byte, 0, len(body)), body)
 	req := fasthttp.AcquireRequest()
 	req.Header.SetContentTypeBytes(applicationJsonHeader)
-	req.Header.SetMethodBytes(get)
-	req.Header.SetRequestURIBytes(uri)
+	req.Header.SetMethodBytes(post)
+	req.Header.SetRequestURIBytes(f.queryUrl)
 	if f.config.Gzip > 0 {
 		req.Header.Add("Accept-Encoding", "gzip")
 	}
+	req.SetBody(body)
 
-	log.Debug("Query url:", string(uri))
+	log.Debug("Query body:", string(body))
 
 	resp := fasthttp.AcquireResponse()
 	start := time.Now()
@@ -121,7 +123,7 @@ func (f *OpentsdbClient) Query(body []byte) (int64, error) {
 
 		log.Debug("Query response body", string(body))
 
-		if sc != fasthttp.StatusOK || !bytes.Contains(body, responseMustContain) {
+		if sc != fasthttp.StatusOK || !bytes.Contains(body, opentsdbMustContain) {
 			err = fmt.Errorf("invalid query response (status %d, db %s): %s", sc, f.config.Database, string(body))
 		}
 	}
@@ -131,6 +133,46 @@ func (f *OpentsdbClient) Query(body []byte) (int64, error) {
 	return lat, err
 }
 
+// appendOpentsdbAscii 把非ASCII字符转换为和写入时一致的形式，写入时tag值经过strconv.QuoteToASCII转义并去掉了反斜杠，
+// 例如"北京市"写入后为"u5317u4eacu5e02"，查询中的tag值需要做同样的转换
+func appendOpentsdbAscii(buf []byte, s []byte) []byte {
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		switch {
+		case r < utf8.RuneSelf:
+			buf = append(buf, s[0])
+		case r > 0xFFFF:
+			buf = append(buf, fmt.Sprintf("U%08x", r)...)
+		default:
+			buf = append(buf, fmt.Sprintf("u%04x", r)...)
+		}
+		s = s[size:]
+	}
+	return buf
+}
+
+// appendOpentsdbName opentsdb的metric和tag只允许a-z、A-Z、0-9、-、_、.、/和unicode字母，
+// 非ASCII字符按appendOpentsdbAscii转换，其他ASCII字符同样转换为u加4位十六进制，例如空格转换为u0020
+func appendOpentsdbName(buf []byte, s []byte) []byte {
+	for len(s) > 0 {
+		b := s[0]
+		switch {
+		case b >= utf8.RuneSelf:
+			_, size := utf8.DecodeRune(s)
+			buf = appendOpentsdbAscii(buf, s[:size])
+			s = s[size:]
+			continue
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '/':
+			buf = append(buf, b)
+		default:
+			buf = append(buf, fmt.Sprintf("u%04x", b)...)
+		}
+		s = s[1:]
+	}
+	return buf
+}
+
 func (f *OpentsdbClient) InitUser() error {
 	return nil
 }
@@ -147,6 +189,113 @@ func (f *OpentsdbClient) CreateMeasurement(p *common.Point) error {
 	return nil
 }
 
+func (f *OpentsdbClient) otherQuery(method []byte, path string, body []byte) (int, []byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetContentTypeBytes(applicationJsonHeader)
+	req.Header.SetMethodBytes(method)
+	req.Header.SetRequestURI(string(f.host) + path)
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	err := f.client.Do(req, resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode(), append([]byte{}, resp.Body()...), nil
+}
+
+// listMetrics 使用/api/suggest查询以prefix开头的所有metric
+func (f *OpentsdbClient) listMetrics(prefix string) ([]string, error) {
+	path := "/api/suggest?type=metrics&max=100000&q=" + string(fasthttp.AppendQuotedArg(nil, []byte(prefix)))
+	statusCode, response, err := f.otherQuery(get, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != fasthttp.StatusOK {
+		return nil, fmt.Errorf("list metrics returned status code: %d, body: %s", statusCode, string(response))
+	}
+	metrics := make([]string, 0)
+	if err := json.Unmarshal(response, &metrics); err != nil {
+		return nil, fmt.Errorf("list metrics unmarshal error: %s", err.Error())
+	}
+	return metrics, nil
+}
+
+// deleteMetrics 使用/api/query的delete参数删除metric的所有数据，需要tsd开启tsd.http.query.allow_delete
+func (f *OpentsdbClient) deleteMetrics(metrics []string) error {
+	for _, metric := range metrics {
+		body := fmt.Sprintf(`{"start":0,"delete":true,"queries":[{"metric":"%s","aggregator":"none"}]}`, metric)
+		statusCode, response, err := f.otherQuery(post, "/api/query", []byte(body))
+		if err != nil {
+			return err
+		}
+		// 没有数据时返回404，说明已经删除
+		if statusCode != fasthttp.StatusOK && statusCode != fasthttp.StatusNotFound {
+			return fmt.Errorf("delete metric %s returned status code: %d, body: %s", metric, statusCode, string(response))
+		}
+	}
+	return nil
+}
+
+func (f *OpentsdbClient) ListDatabases() ([]string, error) {
+	return nil, notSupported("opentsdb", "list databases")
+}
+
+// DropDatabase opentsdb中没有database的概念，为了不误删其他数据不支持删除所有metric，需要通过DropMeasurement删除测试写入的数据
+func (f *OpentsdbClient) DropDatabase(name string) error {
+	return notSupported("opentsdb", "drop database")
+}
+
+// DropMeasurement 删除<measurement>.<field>形式的所有metric的数据
+func (f *OpentsdbClient) DropMeasurement(name string) error {
+	log.Infof("drop measurement %s", name)
+	metrics, err := f.listMetrics(string(appendOpentsdbName(nil, []byte(name))) + ".")
+	if err != nil {
+		return err
+	}
+	return f.deleteMetrics(metrics)
+}
+
+// SeriesCount 使用/api/search/lookup统计所有metric的时间线数量之和，需要tsd开启tsd.core.meta.enable_realtime_ts
+func (f *OpentsdbClient) SeriesCount() (int64, error) {
+	metrics, err := f.listMetrics("")
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, metric := range metrics {
+		body := fmt.Sprintf(`{"metric":"%s","limit":1}`, metric)
+		statusCode, response, err := f.otherQuery(post, "/api/search/lookup", []byte(body))
+		if err != nil {
+			return 0, err
+		}
+		if statusCode != fasthttp.StatusOK {
+			return 0, fmt.Errorf("lookup metric %s returned status code: %d, body: %s", metric, statusCode, string(response))
+		}
+		var lookup struct {
+			TotalResults int64 `json:"totalResults"`
+		}
+		if err := json.Unmarshal(response, &lookup); err != nil {
+			return 0, fmt.Errorf("lookup metric %s unmarshal error: %s", metric, err.Error())
+		}
+		count += lookup.TotalResults
+	}
+	return count, nil
+}
+
+func (f *OpentsdbClient) CreateRetentionPolicy(name string, duration time.Duration, isDefault bool) error {
+	return notSupported("opentsdb", "retention policy")
+}
+
+// Flush opentsdb的/api/put返回204时数据已经写入hbase，不需要额外刷新
+func (f *OpentsdbClient) Flush() error {
+	return nil
+}
+
 func (f *OpentsdbClient) CheckConnection(timeout time.Duration) bool {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
@@ -157,7 +306,7 @@ func (f *OpentsdbClient) CheckConnection(timeout time.Duration) bool {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second}
+	clientWithTimeout := fasthttp.Client{ReadTimeout: time.Second, WriteTimeout: time.Second, Dial: f.client.Dial}
 
 	endTime := time.Now().Add(timeout)
 	log.Info("checking connection ")
@@ -190,6 +339,9 @@ func (m *OpentsdbClient) BeforeSerializePoints(buf []byte, p *common.Point) []by
 func (s *OpentsdbClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []byte {
 
 	for i := 0; i < len(p.FieldKeys); i++ {
+		if p.FieldIsNull(i) {
+			continue
+		}
 		var value float64
 		switch x := p.FieldValues[i].(type) {
 		case int:
@@ -203,55 +355,42 @@ func (s *OpentsdbClient) SerializeAndAppendPoint(buf []byte, p *common.Point) []
 		default:
 			// panic("bad numeric value for OpenTSDB serialization")
 		}
-
-		buf = append(buf, []byte(`{"metric":"`)...)
-		buf = append(buf, p.MeasurementName...)
-		buf = append(buf, '.')
-		buf = append(buf, p.FieldKeys[i]...)
-		buf = append(buf, []byte(`","timestamp":`)...)
-		buf = strconv.AppendInt(buf, p.Timestamp.UTC().UnixNano()/1e6, 10)
-		buf = append(buf, []byte(`,"value":`)...)
-		buf = strconv.AppendFloat(buf, value, 'f', 16, 64)
-		buf = append(buf, []byte(`,"tags":{`)...)
-		for i := 0; i < len(p.TagKeys); i++ {
-			buf = append(buf, []byte(`"`)...)
-			buf = append(buf, p.TagKeys[i]...)
-			buf = append(buf, []byte(`":`)...)
-			buf = append(buf, strings.ReplaceAll(strconv.QuoteToASCII(string(p.TagValues[i])), "\\", "")...)
-			// buf = append(buf, []byte(`"`)...)
-			if i+1 != len(p.TagValues) {
-				buf = append(buf, ',')
-			}
-		}
-		buf = append(buf, "}},\n"...)
+		buf = appendOpentsdbDataPoint(buf, p, p.FieldKeys[i], value)
 	}
 	for i := 0; i < len(p.Int64FiledKeys); i++ {
-
-		value := float64(p.Int64FiledValues[i])
-		buf = append(buf, []byte(`{"metric":"`)...)
-		buf = append(buf, p.MeasurementName...)
-		buf = append(buf, '.')
-		buf = append(buf, p.Int64FiledKeys[i]...)
-		buf = append(buf, []byte(`","timestamp":`)...)
-		buf = strconv.AppendInt(buf, p.Timestamp.UTC().UnixNano()/1e6, 10)
-		buf = append(buf, []byte(`,"value":`)...)
-		buf = strconv.AppendFloat(buf, value, 'f', 16, 64)
-		buf = append(buf, []byte(`,"tags":{`)...)
-		for i := 0; i < len(p.TagKeys); i++ {
-			buf = append(buf, []byte(`"`)...)
-			buf = append(buf, p.TagKeys[i]...)
-			buf = append(buf, []byte(`":"`)...)
-			buf = append(buf, p.TagValues[i]...)
-			buf = append(buf, []byte(`"`)...)
-			if i+1 != len(p.TagValues) {
-				buf = append(buf, ',')
-			}
+		if p.Int64FieldIsNull(i) {
+			continue
 		}
-		buf = append(buf, "}},\n"...)
+		buf = appendOpentsdbDataPoint(buf, p, p.Int64FiledKeys[i], float64(p.Int64FiledValues[i]))
 	}
 	return buf
 }
 
+// appendOpentsdbDataPoint 序列化一个field对应的数据点，metric为measurement.field，
+// metric、tag名称和tag值都经过appendOpentsdbName转换
+func appendOpentsdbDataPoint(buf []byte, p *common.Point, field []byte, value float64) []byte {
+	buf = append(buf, `{"metric":"`...)
+	buf = appendOpentsdbName(buf, p.MeasurementName)
+	buf = append(buf, '.')
+	buf = appendOpentsdbName(buf, field)
+	buf = append(buf, `","timestamp":`...)
+	buf = strconv.AppendInt(buf, p.Timestamp.UTC().UnixNano()/1e6, 10)
+	buf = append(buf, `,"value":`...)
+	buf = strconv.AppendFloat(buf, value, 'f', 16, 64)
+	buf = append(buf, `,"tags":{`...)
+	for i := 0; i < len(p.TagKeys); i++ {
+		buf = append(buf, '"')
+		buf = appendOpentsdbName(buf, p.TagKeys[i])
+		buf = append(buf, `":"`...)
+		buf = appendOpentsdbName(buf, p.TagValues[i])
+		buf = append(buf, '"')
+		if i+1 != len(p.TagValues) {
+			buf = append(buf, ',')
+		}
+	}
+	return append(buf, "}},\n"...)
+}
+
 func (m *OpentsdbClient) AfterSerializePoints(buf []byte, p *common.Point) []byte {
 	buf = buf[:len(buf)-2]
 	return append(buf, "]\n"...)
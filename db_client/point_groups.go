@@ -0,0 +1,137 @@
+package db_client
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"git.querycap.com/falcontsdb/fctsdb-bench/data_generator/common"
+)
+
+// pointGroups 把一个batch中的point按measurement和列分组缓存，AfterSerializePoints时每组输出为一条语句。
+// sql类数据库一条insert语句只能写入一张表，devops、universal等包含多个measurement的场景需要按表分组
+type pointGroups struct {
+	groups   map[string]*pointGroup
+	order    []*pointGroup // 按分组第一次出现的顺序输出
+	pool     []*pointGroup
+	key      []byte
+	buffered int // 已缓存数据的字节数
+}
+
+type pointGroup struct {
+	head []byte // 语句头，例如insert into vehicle values
+	rows []byte
+}
+
+func newPointGroups() *pointGroups {
+	return &pointGroups{
+		groups: make(map[string]*pointGroup),
+	}
+}
+
+// add 把point追加到所属的分组中，新的分组使用appendHead生成语句头，appendRow序列化一行
+func (g *pointGroups) add(p *common.Point, appendHead, appendRow func(buf []byte, p *common.Point) []byte) {
+	g.key = appendGroupKey(g.key[:0], p)
+	group, ok := g.groups[string(g.key)]
+	if !ok {
+		if n := len(g.pool); n > 0 {
+			group = g.pool[n-1]
+			g.pool = g.pool[:n-1]
+		} else {
+			group = &pointGroup{}
+		}
+		group.head = appendHead(group.head[:0], p)
+		group.rows = group.rows[:0]
+		g.groups[string(g.key)] = group
+		g.order = append(g.order, group)
+		g.buffered += len(group.head)
+	}
+	n := len(group.rows)
+	group.rows = appendRow(group.rows, p)
+	g.buffered += len(group.rows) - n
+}
+
+// flush 依次输出每个分组的语句头和所有行，appendTail处理每组的结尾，例如把最后的','替换为';'，然后清空缓存
+func (g *pointGroups) flush(buf []byte, appendTail func(buf []byte) []byte) []byte {
+	for _, group := range g.order {
+		buf = append(buf, group.head...)
+		buf = append(buf, group.rows...)
+		buf = appendTail(buf)
+	}
+	g.reset()
+	return buf
+}
+
+// flushFramed 输出表名加数据行格式的分组，每组前面加上"<字节数>\n"，由writeGroups拆分。
+// 数据行的字符串中可能包含空行等任意内容，不能使用分隔符拆分
+func (g *pointGroups) flushFramed(buf []byte) []byte {
+	for _, group := range g.order {
+		buf = strconv.AppendInt(buf, int64(len(group.head)+len(group.rows)), 10)
+		buf = append(buf, '\n')
+		buf = append(buf, group.head...)
+		buf = append(buf, group.rows...)
+	}
+	g.reset()
+	return buf
+}
+
+func (g *pointGroups) reset() {
+	for k := range g.groups {
+		delete(g.groups, k)
+	}
+	g.pool = append(g.pool, g.order...)
+	g.order = g.order[:0]
+	g.buffered = 0
+}
+
+// appendGroupKey 分组的key为measurement和tag、field名称，列不同的point不能写入同一条语句
+func appendGroupKey(buf []byte, p *common.Point) []byte {
+	buf = append(buf, p.MeasurementName...)
+	for _, key := range p.TagKeys {
+		buf = append(buf, ',')
+		buf = append(buf, key...)
+	}
+	buf = append(buf, ' ')
+	for _, key := range p.FieldKeys {
+		buf = append(buf, ',')
+		buf = append(buf, key...)
+	}
+	buf = append(buf, ' ')
+	for _, key := range p.Int64FiledKeys {
+		buf = append(buf, ',')
+		buf = append(buf, key...)
+	}
+	return buf
+}
+
+// writeGroups 拆分flushFramed输出的多个分组，依次调用write写入，返回累计的写入时间。
+// 用于表名加数据行格式的请求体，例如mxgate、COPY和LOAD DATA，一次请求只能写入一张表
+func writeGroups(body []byte, write func(group []byte) (int64, error)) (int64, error) {
+	var lat int64
+	for len(body) > 0 {
+		i := bytes.IndexByte(body, '\n')
+		if i < 0 {
+			return lat, fmt.Errorf("invalid group body: %s", string(body))
+		}
+		size, err := strconv.Atoi(string(body[:i]))
+		if err != nil || size < 0 || size > len(body)-i-1 {
+			return lat, fmt.Errorf("invalid group size: %s", string(body[:i]))
+		}
+		group := body[i+1 : i+1+size]
+		body = body[i+1+size:]
+		groupLat, err := write(group)
+		lat += groupLat
+		if err != nil {
+			return lat, err
+		}
+	}
+	return lat, nil
+}
+
+// appendStatementEnd 把insert语句最后一行的','替换为';'
+func appendStatementEnd(buf []byte) []byte {
+	if len(buf) > 0 && buf[len(buf)-1] == ',' {
+		buf = buf[:len(buf)-1]
+	}
+	return append(buf, ';')
+}
@@ -0,0 +1,217 @@
+package db_client
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryResult 查询返回的数据，compare-results比较不同数据库的查询结果时使用。
+// influxql的结果按series分组，sql类数据库的结果只有一个没有名称和tag的series
+type QueryResult struct {
+	Series []ResultSeries
+}
+
+type ResultSeries struct {
+	Name    string
+	Tags    map[string]string
+	Columns []string
+	Values  [][]interface{}
+}
+
+// RowQuerier 可以返回查询结果的客户端，DBClient.Query只统计延时，不读取结果
+type RowQuerier interface {
+	QueryRows(body []byte) (*QueryResult, error)
+}
+
+// parseInfluxResult 解析influxql查询返回的json，多条语句的结果合并在一起，数值保留为json.Number
+func parseInfluxResult(body []byte) (*QueryResult, error) {
+	var response struct {
+		Error   string
+		Results []struct {
+			Error  string
+			Series []ResultSeries
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("unmarshal result error: %s", err.Error())
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("query error: %s", response.Error)
+	}
+	result := &QueryResult{}
+	for _, r := range response.Results {
+		if r.Error != "" {
+			return nil, fmt.Errorf("query error: %s", r.Error)
+		}
+		result.Series = append(result.Series, r.Series...)
+	}
+	return result, nil
+}
+
+// scanSqlRows 读取sql查询的所有行，[]byte转换为string
+func scanSqlRows(rows *sql.Rows) (*QueryResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	series := ResultSeries{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		series.Values = append(series.Values, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &QueryResult{Series: []ResultSeries{series}}, nil
+}
+
+// ResultRow 归一化后的一行，series的tag也作为列，列按名称排序
+type ResultRow []ResultCell
+
+// ResultCell 归一化后的值，可以转换为数值的值为float64，时间统一为UTC的RFC3339Nano格式，null为"null"
+type ResultCell struct {
+	Column string
+	Value  interface{}
+}
+
+func (r ResultRow) String() string {
+	cells := make([]string, len(r))
+	for i, cell := range r {
+		if f, ok := cell.Value.(float64); ok {
+			cells[i] = cell.Column + "=" + strconv.FormatFloat(f, 'g', 6, 64)
+		} else {
+			cells[i] = fmt.Sprintf("%s=%v", cell.Column, cell.Value)
+		}
+	}
+	return strings.Join(cells, ",")
+}
+
+// Rows 把查询结果归一化为排序后的行，忽略series名称、列顺序和行顺序的差异，
+// 不同数据库对同一个查询返回的series划分、列顺序、时间格式都可能不同
+func (r *QueryResult) Rows() []ResultRow {
+	var rows []ResultRow
+	for _, series := range r.Series {
+		for _, values := range series.Values {
+			row := make(ResultRow, 0, len(series.Tags)+len(values))
+			for k, v := range series.Tags {
+				row = append(row, ResultCell{Column: k, Value: normalizeResultValue(k, v)})
+			}
+			for i, v := range values {
+				if i < len(series.Columns) {
+					row = append(row, ResultCell{Column: series.Columns[i], Value: normalizeResultValue(series.Columns[i], v)})
+				}
+			}
+			sort.Slice(row, func(i, j int) bool { return row[i].Column < row[j].Column })
+			rows = append(rows, row)
+		}
+	}
+	keys := make([]string, len(rows))
+	for i := range rows {
+		keys[i] = rows[i].String()
+	}
+	sort.Sort(rowsByKey{rows, keys})
+	return rows
+}
+
+type rowsByKey struct {
+	rows []ResultRow
+	keys []string
+}
+
+func (r rowsByKey) Len() int           { return len(r.rows) }
+func (r rowsByKey) Less(i, j int) bool { return r.keys[i] < r.keys[j] }
+func (r rowsByKey) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.keys[i], r.keys[j] = r.keys[j], r.keys[i]
+}
+
+// resultTimeLayouts sql类数据库没有解析时间类型时返回的时间格式
+var resultTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"}
+
+func normalizeResultValue(column string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	}
+	s := fmt.Sprintf("%v", v)
+	if column == "time" {
+		for _, layout := range resultTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// CompareResults 比较两个归一化后的查询结果，数值的相对误差不超过tolerance时认为相等，
+// 结果一致时返回空字符串，否则返回第一处差异的描述
+func CompareResults(a, b *QueryResult, tolerance float64) string {
+	rowsA, rowsB := a.Rows(), b.Rows()
+	if len(rowsA) != len(rowsB) {
+		return fmt.Sprintf("row count %d != %d", len(rowsA), len(rowsB))
+	}
+	for i := range rowsA {
+		if !rowEqual(rowsA[i], rowsB[i], tolerance) {
+			return fmt.Sprintf("row %d: %s != %s", i, rowsA[i], rowsB[i])
+		}
+	}
+	return ""
+}
+
+func rowEqual(a, b ResultRow, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Column != b[i].Column {
+			return false
+		}
+		fa, okA := a[i].Value.(float64)
+		fb, okB := b[i].Value.(float64)
+		if okA && okB {
+			if math.Abs(fa-fb) > tolerance*math.Max(1, math.Max(math.Abs(fa), math.Abs(fb))) {
+				return false
+			}
+			continue
+		}
+		if a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
@@ -7,6 +7,7 @@ require (
 	github.com/StackExchange/wmi v1.2.1 // indirect
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/influxdata/influxdb-client-go/v2 v2.9.2
+	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839
 	github.com/lib/pq v1.10.6
 	github.com/pelletier/go-toml v1.9.3
 	github.com/shirou/gopsutil v3.21.8+incompatible
@@ -10,24 +10,37 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "查询某个站点最新的一条数据",
 		RawSql:  "select * from city_air_quality where site_id = '{site_id}' order by time desc limit 1;",
+		Dsl:     `{"size":1,"query":{"term":{"site_id":"{site_id}"}},"sort":[{"timestamp":"desc"}]}`,
+		Iotdb:   "select last * from root.{db}.city_air_quality.*.*.*.*.`{site_id}`",
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "city_air_quality" and r.site_id == "{site_id}") |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id}","groupBy":true}]}]}`,
 		Comment: "业务用途：实时查看站点空气质量监\n控数据库能力：指定tag按时间排序取最新数据",
 	})
 	// case 2.1
 	AirQuality.Regist(&QueryType{
 		Name:    "查询一批站点最新的一条数据(10)",
 		RawSql:  "select * from city_air_quality where site_id in ('{site_id*10}') group by site_id order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"site_id":["{site_id*10}"]}},"aggs":{"site":{"terms":{"field":"site_id","size":10},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "city_air_quality" and contains(value: r.site_id, set: ["{site_id*10}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id*10:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批站点的实时监控数据，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 	})
 	// case 2.2
 	AirQuality.Regist(&QueryType{
 		Name:    "查询一批站点最新的一条数据(100)",
 		RawSql:  "select * from city_air_quality where site_id in ('{site_id*100}') group by site_id order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"site_id":["{site_id*100}"]}},"aggs":{"site":{"terms":{"field":"site_id","size":100},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "city_air_quality" and contains(value: r.site_id, set: ["{site_id*100}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id*100:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批站点的实时监控数据，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 	})
 	// case 2.3
 	AirQuality.Regist(&QueryType{
 		Name:    "查询一批站点最新的一条数据(1000)",
 		RawSql:  "select * from city_air_quality where site_id in ('{site_id*1000}') group by site_id order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"site_id":["{site_id*1000}"]}},"aggs":{"site":{"terms":{"field":"site_id","size":1000},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "city_air_quality" and contains(value: r.site_id, set: ["{site_id*1000}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id*1000:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批站点的实时监控数据，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 	})
 
@@ -36,6 +49,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "分页查询某个站点最近一天的空气质量数据(查询总数)",
 		RawSql:  "select count(aqi) from city_air_quality where site_id = '{site_id}' and time > '{now}'-1d;",
+		Dsl:     `{"size":0,"track_total_hits":true,"query":{"bool":{"filter":[{"term":{"site_id":"{site_id}"}},{"range":{"timestamp":{"gt":"{now}||-1d"}}}]}},"aggs":{"count":{"value_count":{"field":"aqi"}}}}`,
+		Iotdb:   "select count(aqi) from root.{db}.city_air_quality.*.*.*.*.`{site_id}` where time > {now} - 1d",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 1d, from: {now})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r._field == "aqi" and r.site_id == "{site_id}") |> count()`,
+		Tsdb:    `{"start":{now-1d_ms},"end":{now_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-count","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id}","groupBy":true}]}]}`,
 		Comment: "业务用途：用于统计分析查询\n数据库能力：指定tag和时间段，分页查看数据",
 	})
 
@@ -44,6 +61,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "分页查询某个站点最近一天的空气质量数据(分页查询)",
 		RawSql:  "select * from city_air_quality where site_id = '{site_id}' and time > '{now}'-1d order by time desc limit 100 offset 0;",
+		Dsl:     `{"from":0,"size":100,"query":{"bool":{"filter":[{"term":{"site_id":"{site_id}"}},{"range":{"timestamp":{"gt":"{now}||-1d"}}}]}},"sort":[{"timestamp":"desc"}]}`,
+		Iotdb:   "select * from root.{db}.city_air_quality.*.*.*.*.`{site_id}` where time > {now} - 1d order by time desc limit 100 offset 0",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 1d, from: {now})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r.site_id == "{site_id}") |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value") |> group() |> sort(columns: ["_time"], desc: true) |> limit(n: 100, offset: 0)`,
+		Tsdb:    `{"start":{now-1d_ms},"end":{now_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id}","groupBy":true}]}]}`,
 		Comment: "业务用途：用于统计分析查询\n数据库能力：指定tag和时间段，分页查看数据",
 	})
 
@@ -51,6 +72,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "统计查询最近一个月某站点新条数据",
 		RawSql:  "select count(aqi) from city_air_quality where site_id = '{site_id}' and time > '{now}'-30d;",
+		Dsl:     `{"size":0,"query":{"bool":{"filter":[{"term":{"site_id":"{site_id}"}},{"range":{"timestamp":{"gt":"{now}||-30d"}}}]}},"aggs":{"count":{"value_count":{"field":"aqi"}}}}`,
+		Iotdb:   "select count(aqi) from root.{db}.city_air_quality.*.*.*.*.`{site_id}` where time > {now} - 30d",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r._field == "aqi" and r.site_id == "{site_id}") |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"none","downsample":"0all-count","filters":[{"type":"literal_or","tagk":"site_id","filter":"{site_id}","groupBy":true}]}]}`,
 		Comment: "业务用途：通常用于统计分析或者每月计费等\n数据库能力：指定tag和一个月时间段，计算某个field的count数",
 	})
 
@@ -58,6 +83,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "统计查询最近一个月所有站点总共新增了多少条数据",
 		RawSql:  "select count(aqi) from city_air_quality where time > '{now}'-30d;",
+		Dsl:     `{"size":0,"query":{"range":{"timestamp":{"gt":"{now}||-30d"}}},"aggs":{"count":{"value_count":{"field":"aqi"}}}}`,
+		Iotdb:   "select count(aqi) from root.{db}.city_air_quality.** where time > {now} - 30d group by level = 2",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r._field == "aqi") |> group() |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"sum","downsample":"0all-count","filters":[]}]}`,
 		Comment: "业务用途：通常用于统计分析，每月生成报表等\n数据库能力：指定一个月时间段，计算某个field的count数",
 	})
 
@@ -65,6 +94,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "在某个城市里，按区县分组，统计查询最近一个月城市里所有区县新增了多少数据",
 		RawSql:  "select count(aqi) from city_air_quality where city = '{city}' and time > '{now}'-30d group by county;",
+		Dsl:     `{"size":0,"query":{"bool":{"filter":[{"term":{"city":"{city}"}},{"range":{"timestamp":{"gt":"{now}||-30d"}}}]}},"aggs":{"county":{"terms":{"field":"county","size":1000},"aggs":{"count":{"value_count":{"field":"aqi"}}}}}}`,
+		Iotdb:   "select count(aqi) from root.{db}.city_air_quality.*.`{city}`.** where time > {now} - 30d group by level = 5",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r._field == "aqi" and r.city == "{city}") |> group(columns: ["county"]) |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"sum","downsample":"0all-count","filters":[{"type":"literal_or","tagk":"city","filter":"{city}","groupBy":false},{"type":"wildcard","tagk":"county","filter":"*","groupBy":true}]}]}`,
 		Comment: "业务用途：通常用于统计分析，每月生成报表等\n数据库能力：指定一个月时间段，并按tag分组，计算某个field的count数",
 	})
 
@@ -169,6 +202,10 @@ func init() {
 	AirQuality.Regist(&QueryType{
 		Name:    "查看某城市过去某月按天分组的某污染物平均值",
 		RawSql:  "select mean(aqi) as aqi from city_air_quality where city = '{city}' and time > '{start}' and time < '{start}'+30d group by time(1d) ",
+		Dsl:     `{"size":0,"query":{"bool":{"filter":[{"term":{"city":"{city}"}},{"range":{"timestamp":{"gt":"{start}","lt":"{start}||+30d"}}}]}},"aggs":{"day":{"date_histogram":{"field":"timestamp","fixed_interval":"1d"},"aggs":{"aqi":{"avg":{"field":"aqi"}}}}}}`,
+		Iotdb:   "select avg(aqi) from root.{db}.city_air_quality.*.`{city}`.** group by ([{start}, {start} + 30d), 1d), level = 4",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: {start}, stop: experimental.addDuration(d: 30d, to: {start})) |> filter(fn: (r) => r._measurement == "city_air_quality" and r._field == "aqi" and r.city == "{city}") |> group() |> aggregateWindow(every: 1d, fn: mean, createEmpty: false)`,
+		Tsdb:    `{"start":{start_ms},"end":{start+30d_ms},"queries":[{"metric":"city_air_quality.aqi","aggregator":"avg","downsample":"1d-avg","filters":[{"type":"literal_or","tagk":"city","filter":"{city}","groupBy":false}]}]}`,
 		Comment: "业务用途：用于历史统计，作为污染日历展示\n数据库能力：指定中层级tag和一个月时间段，并按1天为时间窗口分组，查询某字段平均值",
 	})
 
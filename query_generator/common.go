@@ -13,21 +13,63 @@ var bufPool = sync.Pool{
 type QueryType struct {
 	Name    string
 	RawSql  string
+	Dsl     string // elasticsearch Query DSL模板，为空表示该查询类型不支持elasticsearch
+	Iotdb   string // iotdb SQL模板，{db}会被替换为database名称，为空表示该查询类型不支持iotdb
+	Flux    string // influxdbv2 Flux模板，{db}会被替换为bucket名称，为空表示该查询类型不支持flux
+	Tsdb    string // opentsdb /api/query的json模板，metric为measurement.field，为空表示该查询类型不支持opentsdb
 	Comment string
 }
 
+// Template 返回指定数据库格式和查询语言下使用的查询模板，返回空字符串表示不支持该格式
+func (q *QueryType) Template(format, lang string) string {
+	if format == "influxdbv2" && lang == "flux" {
+		return q.Flux
+	}
+	switch format {
+	case "elasticsearch":
+		return q.Dsl
+	case "iotdb":
+		return q.Iotdb
+	case "opentsdb":
+		return q.Tsdb
+	default:
+		return q.RawSql
+	}
+}
+
 type QueryCase struct {
 	CaseName string
 	Types    map[int]*QueryType
 	Count    int
 }
 
+// cases 所有内置场景的查询语句，按注册顺序排列
+var cases []*QueryCase
+
+// NewQueryCase 创建一个场景的查询语句并注册，场景名称与--use-case一致
 func NewQueryCase(caseName string) *QueryCase {
-	return &QueryCase{
+	qc := &QueryCase{
 		Count:    0,
 		CaseName: caseName,
 		Types:    make(map[int]*QueryType),
 	}
+	cases = append(cases, qc)
+	return qc
+}
+
+// LookupCase 根据场景名称查找注册的查询语句，没有时返回nil
+func LookupCase(caseName string) *QueryCase {
+	for _, qc := range cases {
+		if qc.CaseName == caseName {
+			return qc
+		}
+	}
+	return nil
+}
+
+// Cases 返回所有注册的场景
+func Cases() []*QueryCase {
+	return cases
 }
 
 func (qs *QueryCase) Regist(q *QueryType) {
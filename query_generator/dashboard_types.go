@@ -0,0 +1,43 @@
+package query_generator
+
+var (
+	Dashboard = NewQueryCase("dashboard")
+)
+
+func init() {
+
+	// case 1
+	Dashboard.Regist(&QueryType{
+		Name:    "查询某个集群最近一小时每分钟的平均cpu使用率",
+		RawSql:  "select mean(usage_user) from cpu where cluster_id = '{cluster_id}' and time > '{now}'-1h group by time(1m);",
+		Comment: "业务用途：集群监控大屏的cpu曲线\n数据库能力：指定tag和时间段，按时间窗口聚合",
+	})
+
+	// case 2
+	Dashboard.Regist(&QueryType{
+		Name:    "查询某个集群所有主机的最新内存使用率",
+		RawSql:  "select last(used_percent) from mem where cluster_id = '{cluster_id}' group by hostname;",
+		Comment: "业务用途：集群监控大屏的主机列表\n数据库能力：指定tag，并按另一个tag分组取最新数据",
+	})
+
+	// case 3
+	Dashboard.Regist(&QueryType{
+		Name:    "查询某台主机最近一小时的系统负载",
+		RawSql:  "select load1, load5, load15 from system where cluster_id = '{cluster_id}' and hostname = '{hostname}' and time > '{now}'-1h;",
+		Comment: "业务用途：查看单台主机的负载详情\n数据库能力：指定多个tag和时间段查询原始数据",
+	})
+
+	// case 4
+	Dashboard.Regist(&QueryType{
+		Name:    "统计最近一小时每个集群服务不可用的次数",
+		RawSql:  "select count(service_up) from status where service_up = 0 and time > '{now}'-1h group by cluster_id;",
+		Comment: "业务用途：可用性报表\n数据库能力：按field值过滤后按tag分组统计",
+	})
+
+	// case 5
+	Dashboard.Regist(&QueryType{
+		Name:    "查询最近五分钟cpu使用率最高的10台主机",
+		RawSql:  "select top(usage_user, 10), cluster_id, hostname from (select mean(usage_user) as usage_user from cpu where time > '{now}'-5m group by cluster_id, hostname)",
+		Comment: "业务用途：告警面板展示热点主机\n数据库能力：子查询聚合后排序取前N",
+	})
+}
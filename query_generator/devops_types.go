@@ -0,0 +1,93 @@
+package query_generator
+
+var (
+	Devops = NewQueryCase("devops")
+)
+
+// devops场景的查询来源于influxdb-comparisons，名称中的数字依次为指标数量、主机数量、时间范围(小时)
+func init() {
+
+	// case 1 single-groupby-1-1-1
+	Devops.Regist(&QueryType{
+		Name:    "single-groupby-1-1-1: 一台主机一个指标最近一小时每5分钟的最大值",
+		RawSql:  "select max(usage_user) from cpu where hostname = '{hostname}' and time > '{now}'-1h group by time(5m);",
+		Comment: "业务用途：查看单台主机的cpu曲线\n数据库能力：指定tag和时间段，按时间窗口聚合",
+	})
+
+	// case 2 single-groupby-1-1-12
+	Devops.Regist(&QueryType{
+		Name:    "single-groupby-1-1-12: 一台主机一个指标最近12小时每5分钟的最大值",
+		RawSql:  "select max(usage_user) from cpu where hostname = '{hostname}' and time > '{now}'-12h group by time(5m);",
+		Comment: "业务用途：查看单台主机较长时间的cpu曲线\n数据库能力：指定tag和较长的时间段，按时间窗口聚合",
+	})
+
+	// case 3 single-groupby-1-8-1
+	Devops.Regist(&QueryType{
+		Name:    "single-groupby-1-8-1: 8台主机一个指标最近一小时每5分钟的最大值",
+		RawSql:  "select max(usage_user) from cpu where hostname in ('{hostname*8}') and time > '{now}'-1h group by time(5m);",
+		Comment: "业务用途：查看一组主机的cpu曲线\n数据库能力：指定一批tag和时间段，按时间窗口聚合",
+	})
+
+	// case 4 single-groupby-5-1-1
+	Devops.Regist(&QueryType{
+		Name:    "single-groupby-5-1-1: 一台主机5个指标最近一小时每5分钟的最大值",
+		RawSql:  "select max(usage_user), max(usage_system), max(usage_idle), max(usage_nice), max(usage_iowait) from cpu where hostname = '{hostname}' and time > '{now}'-1h group by time(5m);",
+		Comment: "业务用途：查看单台主机的多个cpu指标\n数据库能力：多个field同时按时间窗口聚合",
+	})
+
+	// case 5 single-groupby-5-8-1
+	Devops.Regist(&QueryType{
+		Name:    "single-groupby-5-8-1: 8台主机5个指标最近一小时每5分钟的最大值",
+		RawSql:  "select max(usage_user), max(usage_system), max(usage_idle), max(usage_nice), max(usage_iowait) from cpu where hostname in ('{hostname*8}') and time > '{now}'-1h group by time(5m);",
+		Comment: "业务用途：查看一组主机的多个cpu指标\n数据库能力：指定一批tag，多个field同时按时间窗口聚合",
+	})
+
+	// case 6 double-groupby-1
+	Devops.Regist(&QueryType{
+		Name:    "double-groupby-1: 所有主机一个指标最近12小时按主机和小时分组的平均值",
+		RawSql:  "select mean(usage_user) from cpu where time > '{now}'-12h group by time(1h), hostname;",
+		Comment: "业务用途：全局监控大屏的主机cpu热力图\n数据库能力：按时间窗口和tag两个维度分组聚合",
+	})
+
+	// case 7 double-groupby-5
+	Devops.Regist(&QueryType{
+		Name:    "double-groupby-5: 所有主机5个指标最近12小时按主机和小时分组的平均值",
+		RawSql:  "select mean(usage_user), mean(usage_system), mean(usage_idle), mean(usage_nice), mean(usage_iowait) from cpu where time > '{now}'-12h group by time(1h), hostname;",
+		Comment: "业务用途：全局监控大屏的主机cpu热力图\n数据库能力：多个field按时间窗口和tag两个维度分组聚合",
+	})
+
+	// case 8 high-cpu-1
+	Devops.Regist(&QueryType{
+		Name:    "high-cpu-1: 一台主机最近12小时cpu使用率超过90%的数据",
+		RawSql:  "select * from cpu where usage_user > 90.0 and hostname = '{hostname}' and time > '{now}'-12h;",
+		Comment: "业务用途：排查单台主机的cpu告警\n数据库能力：指定tag和时间段，按field值过滤",
+	})
+
+	// case 9 high-cpu-all
+	Devops.Regist(&QueryType{
+		Name:    "high-cpu-all: 所有主机最近12小时cpu使用率超过90%的数据",
+		RawSql:  "select * from cpu where usage_user > 90.0 and time > '{now}'-12h;",
+		Comment: "业务用途：排查全部主机的cpu告警\n数据库能力：指定时间段，按field值过滤，返回的数据量较大",
+	})
+
+	// case 10 lastpoint
+	Devops.Regist(&QueryType{
+		Name:    "lastpoint: 所有主机的最新cpu数据",
+		RawSql:  "select last(*) from cpu group by hostname;",
+		Comment: "业务用途：主机列表展示每台主机的实时状态\n数据库能力：按tag分组取最新数据",
+	})
+
+	// case 11 groupby-orderby-limit
+	Devops.Regist(&QueryType{
+		Name:    "groupby-orderby-limit: 某个时间点之前最近5分钟每分钟的最大cpu使用率",
+		RawSql:  "select max(usage_user) from cpu where time < '{now}' group by time(1m) order by time desc limit 5;",
+		Comment: "业务用途：查看最近几个时间窗口的峰值\n数据库能力：按时间窗口聚合后倒序取前N个窗口",
+	})
+
+	// case 12 region
+	Devops.Regist(&QueryType{
+		Name:    "某个区域所有主机最近一小时每分钟的平均内存使用率",
+		RawSql:  "select mean(used_percent) from mem where region = '{region}' and time > '{now}'-1h group by time(1m), hostname;",
+		Comment: "业务用途：按区域查看主机的内存曲线\n数据库能力：指定tag和时间段，按时间窗口和另一个tag分组聚合",
+	})
+}
@@ -0,0 +1,50 @@
+package query_generator
+
+var (
+	Iot = NewQueryCase("iot")
+)
+
+func init() {
+
+	// case 1
+	Iot.Regist(&QueryType{
+		Name:    "查询某个家庭所有房间的最新空气质量",
+		RawSql:  "select * from air_quality_room where home_id = '{home_id}' group by room_id order by time desc limit 1;",
+		Comment: "业务用途：智能家居app首页展示各房间的实时环境数据\n数据库能力：指定tag，并按另一个tag分组时间排序取最新数据",
+	})
+
+	// case 2
+	Iot.Regist(&QueryType{
+		Name:    "查询一批家庭(10个)的门状态",
+		RawSql:  "select last(state) from door_state where home_id in ('{home_id*10}') group by home_id, door_id;",
+		Comment: "业务用途：安防平台批量查看家庭门锁的开关状态\n数据库能力：指定一批tag，并按多个tag分组取最新数据",
+	})
+
+	// case 3
+	Iot.Regist(&QueryType{
+		Name:    "查询某个家庭某个房间最近一天按小时的平均温度",
+		RawSql:  "select mean(temperature) from air_condition_room where home_id = '{home_id}' and room_id = '{room_id}' and time > '{now}'-1d group by time(1h);",
+		Comment: "业务用途：展示房间温度的变化曲线\n数据库能力：指定多个tag和时间段，按时间窗口聚合",
+	})
+
+	// case 4
+	Iot.Regist(&QueryType{
+		Name:    "统计最近一天所有家庭二氧化碳浓度超标的次数",
+		RawSql:  "select count(co2_level) from air_quality_room where co2_level > 1000 and time > '{now}'-1d group by home_id;",
+		Comment: "业务用途：统计分析空气质量告警\n数据库能力：按field值过滤后按tag分组统计",
+	})
+
+	// case 5
+	Iot.Regist(&QueryType{
+		Name:    "查询最近一小时电池电压最低的100个门磁传感器",
+		RawSql:  "select bottom(battery_voltage, 100), home_id, sensor_id from (select last(battery_voltage) as battery_voltage from door_state where time > '{now}'-1h group by home_id, sensor_id)",
+		Comment: "业务用途：运维平台提醒用户更换电池\n数据库能力：子查询取最新数据后排序取前N",
+	})
+
+	// case 6
+	Iot.Regist(&QueryType{
+		Name:    "查询某个家庭最近一天的摄像头识别记录",
+		RawSql:  "select object_type, object_kind from camera_detection where home_id = '{home_id}' and time > '{now}'-1d order by time desc limit 100 offset 0;",
+		Comment: "业务用途：app中分页查看摄像头识别到的人、车、动物\n数据库能力：指定tag和时间段，分页查看字符串数据",
+	})
+}
@@ -0,0 +1,51 @@
+package query_generator
+
+var (
+	LiveCharge = NewQueryCase("live")
+)
+
+// live场景中每个站点(site_id)是一个计量设备，water、power、gas为累计读数
+func init() {
+
+	// case 1
+	LiveCharge.Regist(&QueryType{
+		Name:    "查询某个站点的最新读数",
+		RawSql:  "select * from chengdu_cast where site_id = '{site_id}' order by time desc limit 1;",
+		Comment: "业务用途：app中查看设备的实时读数\n数据库能力：指定tag按时间排序取最新数据",
+	})
+
+	// case 2
+	LiveCharge.Regist(&QueryType{
+		Name:    "查询一批站点(100个)的最新读数",
+		RawSql:  "select * from chengdu_cast where site_id in ('{site_id*100}') group by site_id order by time desc limit 1;",
+		Comment: "业务用途：运营大屏展示一批设备的实时读数\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
+	})
+
+	// case 3
+	LiveCharge.Regist(&QueryType{
+		Name:    "查询某个站点最近一天每小时的充电量",
+		RawSql:  "select spread(power) as power from chengdu_cast where site_id = '{site_id}' and time > '{now}'-1d group by time(1h);",
+		Comment: "业务用途：展示单个充电站的用电曲线，累计读数的差值即为时间段内的充电量\n数据库能力：指定tag和时间段，按时间窗口计算差值",
+	})
+
+	// case 4
+	LiveCharge.Regist(&QueryType{
+		Name:    "统计某个区县最近一天每个站点的充电次数",
+		RawSql:  "select count(power) from chengdu_cast where county = '{county}' and time > '{now}'-1d group by site_id;",
+		Comment: "业务用途：按站点统计充电会话数量，用于运营分析\n数据库能力：指定tag和时间段，按另一个tag分组统计",
+	})
+
+	// case 5
+	LiveCharge.Regist(&QueryType{
+		Name:    "统计某个城市最近10分钟在线的设备数",
+		RawSql:  "select count(power) from (select last(power) as power from chengdu_cast where city = '{city}' and time > '{now}'-10m group by site_id);",
+		Comment: "业务用途：计算设备在线率，在线设备数除以设备总数\n数据库能力：子查询按tag分组取最新数据后统计",
+	})
+
+	// case 6
+	LiveCharge.Regist(&QueryType{
+		Name:    "统计某个城市最近一天各区县的总充电量",
+		RawSql:  "select sum(power) from (select spread(power) as power from chengdu_cast where city = '{city}' and time > '{now}'-1d group by county, site_id) group by county;",
+		Comment: "业务用途：按区县汇总充电量，用于电网负荷分析\n数据库能力：子查询按tag分组计算差值后再按另一个tag汇总",
+	})
+}
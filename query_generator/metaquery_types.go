@@ -0,0 +1,43 @@
+package query_generator
+
+var (
+	Metaquery = NewQueryCase("metaquery")
+)
+
+func init() {
+
+	// case 1
+	Metaquery.Regist(&QueryType{
+		Name:    "查询所有的measurement",
+		RawSql:  "show measurements;",
+		Comment: "业务用途：数据浏览工具展示表结构\n数据库能力：元数据查询",
+	})
+
+	// case 2
+	Metaquery.Regist(&QueryType{
+		Name:    "查询tag X的所有值",
+		RawSql:  `show tag values from example_measurement with key = "X";`,
+		Comment: "业务用途：数据浏览工具生成tag过滤条件的下拉框\n数据库能力：元数据查询，tag值数量为scale-var",
+	})
+
+	// case 3
+	Metaquery.Regist(&QueryType{
+		Name:    "查询X为某个值时tag Y的所有值",
+		RawSql:  `show tag values from example_measurement with key = "Y" where X = '{x}';`,
+		Comment: "业务用途：级联下拉框\n数据库能力：带过滤条件的元数据查询",
+	})
+
+	// case 4
+	Metaquery.Regist(&QueryType{
+		Name:    "查询series的数量",
+		RawSql:  "show series cardinality from example_measurement;",
+		Comment: "业务用途：监控时间线数量\n数据库能力：时间线基数统计",
+	})
+
+	// case 5
+	Metaquery.Regist(&QueryType{
+		Name:    "查询X为某个值的所有series的最新数据",
+		RawSql:  "select last(val) from example_measurement where X = '{x}' group by Y;",
+		Comment: "业务用途：按一个tag过滤后查看所有时间线的最新值\n数据库能力：按tag过滤并按另一个tag分组取最新数据",
+	})
+}
@@ -0,0 +1,31 @@
+package query_generator
+
+var (
+	Replay = NewQueryCase("replay")
+)
+
+// replay场景的measurement和tag来自--replay指定的数据文件，{measurement}为数据中的measurement，
+// {tag_key}为--replay-tag指定的tag名称，{tag}为该tag的取值(包含复制出的设备)
+func init() {
+
+	// case 1
+	Replay.Regist(&QueryType{
+		Name:    "查询某个设备的最新数据",
+		RawSql:  "select * from {measurement} where {tag_key} = '{tag}' order by time desc limit 1;",
+		Comment: "业务用途：查看回放数据中单个设备的实时数据\n数据库能力：指定tag按时间排序取最新数据",
+	})
+
+	// case 2
+	Replay.Regist(&QueryType{
+		Name:    "查询某个设备最近一小时的原始数据",
+		RawSql:  "select * from {measurement} where {tag_key} = '{tag}' and time > '{now}'-1h;",
+		Comment: "业务用途：查看回放数据中单个设备的历史记录\n数据库能力：指定tag和时间段查询原始数据",
+	})
+
+	// case 3
+	Replay.Regist(&QueryType{
+		Name:    "统计一批设备(10个)最近一小时的数据条数",
+		RawSql:  "select count(*) from {measurement} where {tag_key} in ('{tag*10}') and time > '{now}'-1h group by {tag_key};",
+		Comment: "业务用途：检查一批设备的数据上报情况\n数据库能力：指定一批tag和时间段，按tag分组统计",
+	})
+}
@@ -0,0 +1,44 @@
+package query_generator
+
+var (
+	Scene = NewQueryCase("scene")
+)
+
+// scene场景中每条series是一个实验室(f_lab_name)中的一个测点(f_point_id)
+func init() {
+
+	// case 1
+	Scene.Regist(&QueryType{
+		Name:    "查询某个测点的最新值",
+		RawSql:  "select * from t_neimeng_label_name_v1 where f_point_id = '{f_point_id}' order by time desc limit 1;",
+		Comment: "业务用途：实验室监控页面展示测点的实时数据\n数据库能力：指定tag按时间排序取最新数据",
+	})
+
+	// case 2
+	Scene.Regist(&QueryType{
+		Name:    "查询一批测点(100个)的最新值",
+		RawSql:  "select * from t_neimeng_label_name_v1 where f_point_id in ('{f_point_id*100}') group by f_point_id order by time desc limit 1;",
+		Comment: "业务用途：监控大屏批量展示测点的实时数据\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
+	})
+
+	// case 3
+	Scene.Regist(&QueryType{
+		Name:    "查询某个实验室所有测点的最新值",
+		RawSql:  "select last(f_max), last(f_min) from t_neimeng_label_name_v1 where f_lab_name = '{f_lab_name}' group by f_point_id;",
+		Comment: "业务用途：按实验室查看测点状态\n数据库能力：指定tag，并按另一个tag分组取最新数据",
+	})
+
+	// case 4
+	Scene.Regist(&QueryType{
+		Name:    "查询某个测点最近一小时的原始数据",
+		RawSql:  "select * from t_neimeng_label_name_v1 where f_point_id = '{f_point_id}' and time > '{now}'-1h order by time desc limit 100 offset 0;",
+		Comment: "业务用途：分页查看测点的历史记录，包含字符串描述字段\n数据库能力：指定tag和时间段，分页查看数据",
+	})
+
+	// case 5
+	Scene.Regist(&QueryType{
+		Name:    "查询某个测点最近一天每小时的最大值和最小值",
+		RawSql:  "select max(f_max), min(f_min) from t_neimeng_label_name_v1 where f_point_id = '{f_point_id}' and time > '{now}'-1d group by time(1h);",
+		Comment: "业务用途：展示测点的波动范围曲线\n数据库能力：指定tag和时间段，多个field按时间窗口聚合",
+	})
+}
@@ -0,0 +1,24 @@
+package query_generator
+
+var (
+	Schema = NewQueryCase("schema")
+)
+
+// schema场景的measurement和tag来自--schema指定的toml文件，内置查询只使用{measurement}，
+// 需要按tag过滤时使用--sql-template，以tag名称作为关键字
+func init() {
+
+	// case 1
+	Schema.Regist(&QueryType{
+		Name:    "查询某张表的最新数据",
+		RawSql:  "select * from {measurement} order by time desc limit 1;",
+		Comment: "业务用途：查看schema描述的数据的实时状态\n数据库能力：按时间排序取最新数据",
+	})
+
+	// case 2
+	Schema.Regist(&QueryType{
+		Name:    "统计某张表最近一小时的数据条数",
+		RawSql:  "select count(*) from {measurement} where time > '{now}'-1h;",
+		Comment: "业务用途：检查数据的上报情况\n数据库能力：指定时间段统计数据条数",
+	})
+}
@@ -0,0 +1,66 @@
+package query_generator
+
+var (
+	VehicleTelemetry = NewQueryCase("vehicle-telemetry")
+)
+
+// vehicle-telemetry场景中每辆车(VIN)上报经纬度、车速、里程、油量(电量)和发动机状态，
+// {lat_min}、{lat_max}、{lon_min}、{lon_max}为某个城市中心附近约6km见方的区域，{brand}、{model}为某辆车的品牌和车型
+func init() {
+
+	// case 1
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "查询某辆车的最新位置",
+		RawSql:  "select lat, lon, speed, heading from vehicle_telemetry where VIN='{vin}' order by time desc limit 1;",
+		Comment: "业务用途：地图上展示车辆的实时位置\n数据库能力：指定tag按时间排序取最新数据",
+	})
+
+	// case 2
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "查询某辆车最近一小时的轨迹",
+		RawSql:  "select lat, lon, speed, heading from vehicle_telemetry where VIN='{vin}' and time > '{now}'-1h;",
+		Comment: "业务用途：轨迹回放\n数据库能力：指定tag和时间段，查询多个字段的原始数据",
+	})
+
+	// case 3
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "查询某个区域内最近10分钟出现过的车辆",
+		RawSql:  "select last(lat), last(lon) from vehicle_telemetry where lat > {lat_min} and lat < {lat_max} and lon > {lon_min} and lon < {lon_max} and time > '{now}'-10m group by VIN;",
+		Comment: "业务用途：电子围栏，统计进入某个区域的车辆\n数据库能力：按字段值范围过滤，并按tag分组取最新数据",
+	})
+
+	// case 4
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "统计某个区域内最近一小时每5分钟行驶中车辆的平均车速",
+		RawSql:  "select mean(speed) from vehicle_telemetry where lat > {lat_min} and lat < {lat_max} and lon > {lon_min} and lon < {lon_max} and engine_state = 2 and time > '{now}'-1h group by time(5m);",
+		Comment: "业务用途：分析区域的路况拥堵情况\n数据库能力：按多个字段值过滤，按时间窗口聚合",
+	})
+
+	// case 5
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "统计某辆车最近一天每小时的行驶里程和最高车速",
+		RawSql:  "select spread(odometer) as mileage, max(speed) as max_speed from vehicle_telemetry where VIN='{vin}' and time > '{now}'-1d group by time(1h);",
+		Comment: "业务用途：车辆的行程统计，累计里程的差值即为时间段内的行驶里程\n数据库能力：指定tag和时间段，按时间窗口计算差值和最大值",
+	})
+
+	// case 6
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "统计某个车型最近一天每辆车的行驶里程",
+		RawSql:  "select spread(odometer) as mileage from vehicle_telemetry where model = '{model}' and time > '{now}'-1d group by VIN;",
+		Comment: "业务用途：按车型统计车辆的使用强度\n数据库能力：指定tag和时间段，按另一个tag分组计算差值",
+	})
+
+	// case 7
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "统计某辆车最近一天的行驶时长和平均车速",
+		RawSql:  "select count(speed), mean(speed) from vehicle_telemetry where VIN='{vin}' and engine_state = 2 and time > '{now}'-1d;",
+		Comment: "业务用途：驾驶行为分析，行驶中的点数乘以采样间隔即为行驶时长\n数据库能力：指定tag、字段值和时间段，计算数量和平均值",
+	})
+
+	// case 8
+	VehicleTelemetry.Regist(&QueryType{
+		Name:    "查询某个品牌最近一小时电量低于20%的车辆",
+		RawSql:  "select last(soc) from vehicle_telemetry where brand = '{brand}' and soc < 20 and time > '{now}'-1h group by VIN;",
+		Comment: "业务用途：提醒用户充电，燃油车的soc缺失，不会出现在结果中\n数据库能力：指定tag和字段值范围过滤，按tag分组取最新数据",
+	})
+}
@@ -10,6 +10,10 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "查询某辆车的最新状态",
 		RawSql:  "select * from vehicle where VIN='{vin}' order by time desc limit 1;",
+		Dsl:     `{"size":1,"query":{"term":{"VIN":"{vin}"}},"sort":[{"timestamp":"desc"}]}`,
+		Iotdb:   "select last * from root.{db}.vehicle.`{vin}`",
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "vehicle" and r.VIN == "{vin}") |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控车辆的实时运行状态\n数据库能力：指定tag按时间排序取最新数据",
 		// Generator: &OneCarNewest{},
 	})
@@ -18,6 +22,9 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "查询一批辆车（10辆）的最新状态",
 		RawSql:  "select * from vehicle where VIN in ('{vin*10}') group by VIN order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"VIN":["{vin*10}"]}},"aggs":{"vin":{"terms":{"field":"VIN","size":10},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "vehicle" and contains(value: r.VIN, set: ["{vin*10}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin*10:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批车辆的实时运行状态，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 		// Generator: &CarsNewest{count: 10},
 	})
@@ -26,6 +33,9 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "查询一批辆车（100辆）的最新状态",
 		RawSql:  "select * from vehicle where VIN in ('{vin*100}') group by VIN order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"VIN":["{vin*100}"]}},"aggs":{"vin":{"terms":{"field":"VIN","size":100},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "vehicle" and contains(value: r.VIN, set: ["{vin*100}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin*100:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批车辆的实时运行状态，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 		// Generator: &CarsNewest{count: 100},
 	})
@@ -34,6 +44,9 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "查询一批辆车（500辆）的最新状态",
 		RawSql:  "select * from vehicle where VIN in ('{vin*500}') group by VIN order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"VIN":["{vin*500}"]}},"aggs":{"vin":{"terms":{"field":"VIN","size":500},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "vehicle" and contains(value: r.VIN, set: ["{vin*500}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin*500:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批车辆的实时运行状态，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 		// Generator: &CarsNewest{count: 500},
 	})
@@ -42,6 +55,9 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "查询一批辆车(1000辆)的最新状态",
 		RawSql:  "select * from vehicle where VIN in ('{vin*1000}') group by VIN order by time desc limit 1;",
+		Dsl:     `{"size":0,"query":{"terms":{"VIN":["{vin*1000}"]}},"aggs":{"vin":{"terms":{"field":"VIN","size":1000},"aggs":{"last":{"top_hits":{"size":1,"sort":[{"timestamp":"desc"}]}}}}}}`,
+		Flux:    `from(bucket: "{db}") |> range(start: {start}) |> filter(fn: (r) => r._measurement == "vehicle" and contains(value: r.VIN, set: ["{vin*1000}"])) |> last()`,
+		Tsdb:    `{"start":{start_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-last","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin*1000:|}","groupBy":true}]}]}`,
 		Comment: "业务用途：监控一批车辆的实时运行状态，通常用于大屏监控等\n数据库能力：指定一批tag，并按tag分组时间排序取最新数据",
 		// Generator: &CarsNewest{count: 1000},
 	})
@@ -50,6 +66,10 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "分页查询某辆车的最近一天的状态变化",
 		RawSql:  "select * from vehicle where VIN='{vin}' and time > '{now}'-1d order by time desc limit 100 offset 0;",
+		Dsl:     `{"from":0,"size":100,"query":{"bool":{"filter":[{"term":{"VIN":"{vin}"}},{"range":{"timestamp":{"gt":"{now}||-1d"}}}]}},"sort":[{"timestamp":"desc"}]}`,
+		Iotdb:   "select * from root.{db}.vehicle.`{vin}` where time > {now} - 1d order by time desc limit 100 offset 0",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 1d, from: {now})) |> filter(fn: (r) => r._measurement == "vehicle" and r.VIN == "{vin}") |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value") |> group() |> sort(columns: ["_time"], desc: true) |> limit(n: 100, offset: 0)`,
+		Tsdb:    `{"start":{now-1d_ms},"end":{now_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin}","groupBy":true}]}]}`,
 		Comment: "业务用途：用于展示查看一段时间车辆的状态变化\n数据库能力：指定tag和时间段，分页查看数据",
 		// Generator: &CarPaging{},
 	})
@@ -58,6 +78,10 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "统计查询最近一个月某辆车新增了多少条数据",
 		RawSql:  "select count(value1) from vehicle where VIN='{vin}' and time > '{now}'-30d;",
+		Dsl:     `{"size":0,"query":{"bool":{"filter":[{"term":{"VIN":"{vin}"}},{"range":{"timestamp":{"gt":"{now}||-30d"}}}]}},"aggs":{"count":{"value_count":{"field":"value1"}}}}`,
+		Iotdb:   "select count(value1) from root.{db}.vehicle.`{vin}` where time > {now} - 30d",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "vehicle" and r._field == "value1" and r.VIN == "{vin}") |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-count","filters":[{"type":"literal_or","tagk":"VIN","filter":"{vin}","groupBy":true}]}]}`,
 		Comment: "业务用途：通常用于统计分析或者每月计费等\n指定tag和一个月时间段，计算某个field的count数",
 		// Generator: &OneCarMessageCountMonth{},
 	})
@@ -66,6 +90,10 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "统计查询最近一个月所有车辆总共新增了多少条数据",
 		RawSql:  "select count(value1) from vehicle where time > '{now}'-30d;",
+		Dsl:     `{"size":0,"query":{"range":{"timestamp":{"gt":"{now}||-30d"}}},"aggs":{"count":{"value_count":{"field":"value1"}}}}`,
+		Iotdb:   "select count(value1) from root.{db}.vehicle.* where time > {now} - 30d group by level = 2",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "vehicle" and r._field == "value1") |> group() |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"vehicle.value1","aggregator":"sum","downsample":"0all-count","filters":[]}]}`,
 		Comment: "业务用途：通常用于统计分析，每月生成报表等\n数据库能力：指定一个月时间段，计算某个field的count数",
 		// Generator: &CarsMessageCountMonth{},
 	})
@@ -74,6 +102,10 @@ func init() {
 	Vehicle.Regist(&QueryType{
 		Name:    "按车辆分组，统计查询最近一个月所有车辆分别新增了多少数据",
 		RawSql:  "select count(value1) from vehicle where time > '{now}'-30d group by VIN;",
+		Dsl:     `{"size":0,"query":{"range":{"timestamp":{"gt":"{now}||-30d"}}},"aggs":{"vin":{"terms":{"field":"VIN","size":10000},"aggs":{"count":{"value_count":{"field":"value1"}}}}}}`,
+		Iotdb:   "select count(value1) from root.{db}.vehicle.* where time > {now} - 30d",
+		Flux:    `import "experimental" from(bucket: "{db}") |> range(start: experimental.subDuration(d: 30d, from: {now})) |> filter(fn: (r) => r._measurement == "vehicle" and r._field == "value1") |> group(columns: ["VIN"]) |> count()`,
+		Tsdb:    `{"start":{now-30d_ms},"end":{now_ms},"queries":[{"metric":"vehicle.value1","aggregator":"none","downsample":"0all-count","filters":[{"type":"wildcard","tagk":"VIN","filter":"*","groupBy":true}]}]}`,
 		Comment: "业务用途：通常用于统计分析，每月生成报表等\n数据库能力：指定一个月时间段，并按tag分组，计算某个field的count数",
 		// Generator: &CarsGroupMessageCountMonth{},
 	})
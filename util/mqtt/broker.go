@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Broker 是一个最小化的MQTT broker，用于在没有真实broker时测试mqtt写入能力。
+// 支持QoS 0/1/2的发布确认和简单的订阅转发（转发时统一使用QoS 0），不支持session保持和保留消息。
+type Broker struct {
+	mu            sync.RWMutex
+	subscriptions map[*brokerConn][][]byte
+
+	received int64
+}
+
+type brokerConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+	w    *bufio.Writer
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscriptions: make(map[*brokerConn][][]byte)}
+}
+
+// Received 返回broker收到的PUBLISH报文总数
+func (b *Broker) Received() int64 {
+	return atomic.LoadInt64(&b.received)
+}
+
+func (b *Broker) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go b.serve(conn)
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	bc := &brokerConn{conn: conn, w: bufio.NewWriterSize(conn, 64*1024)}
+	defer func() {
+		b.mu.Lock()
+		delete(b.subscriptions, bc)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, 1024*1024)
+	var readBuf, buf []byte
+	connected := false
+	for {
+		pkt, err := ReadPacket(r, readBuf)
+		if err != nil {
+			return
+		}
+		readBuf = pkt.Body[:0]
+		buf = buf[:0]
+
+		if !connected && pkt.Type != CONNECT {
+			log.Println("mqtt: first packet is not connect, close the connection")
+			return
+		}
+		switch pkt.Type {
+		case CONNECT:
+			if _, err := pkt.Connect(); err != nil {
+				return
+			}
+			connected = true
+			buf = AppendConnack(buf, 0)
+		case PUBLISH:
+			topic, qos, id, payload, err := pkt.Publish()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&b.received, 1)
+			b.forward(topic, payload)
+			switch qos {
+			case 1:
+				buf = AppendAck(buf, PUBACK, id)
+			case 2:
+				buf = AppendAck(buf, PUBREC, id)
+			}
+		case PUBREL:
+			buf = AppendAck(buf, PUBCOMP, pkt.PacketID())
+		case SUBSCRIBE:
+			id, filters, qos, err := pkt.Subscribe()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			for _, filter := range filters {
+				b.subscriptions[bc] = append(b.subscriptions[bc], append([]byte{}, filter...))
+			}
+			b.mu.Unlock()
+			for i := range qos {
+				qos[i] = 0
+			}
+			buf = AppendSuback(buf, id, qos)
+		case UNSUBSCRIBE:
+			buf = AppendAck(buf, UNSUBACK, pkt.PacketID())
+		case PINGREQ:
+			buf = AppendEmpty(buf, PINGRESP)
+		case DISCONNECT:
+			return
+		}
+
+		if len(buf) > 0 {
+			bc.mu.Lock()
+			bc.w.Write(buf)
+			// 客户端批量发送时，等读缓存处理完再统一刷新
+			if r.Buffered() == 0 {
+				err = bc.w.Flush()
+			}
+			bc.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *Broker) forward(topic, payload []byte) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.subscriptions) == 0 {
+		return
+	}
+	var buf []byte
+	for sub, filters := range b.subscriptions {
+		for _, filter := range filters {
+			if MatchTopic(filter, topic) {
+				if buf == nil {
+					buf, _ = AppendPublish(nil, topic, payload, 0, 0)
+				}
+				sub.mu.Lock()
+				sub.w.Write(buf)
+				sub.w.Flush()
+				sub.mu.Unlock()
+				break
+			}
+		}
+	}
+}
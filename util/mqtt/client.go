@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Message 是一条待发布的消息
+type Message struct {
+	Topic   []byte
+	Payload []byte
+}
+
+// Client 是一个同步的MQTT发布客户端，不是协程安全的，每个worker使用各自的Client
+type Client struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	w        *bufio.Writer
+	buf      []byte
+	readBuf  []byte
+	nextID   uint16
+	inflight map[uint16]byte // 等待确认的报文标识符和下一步期望收到的报文类型
+}
+
+// Dial 连接broker并完成CONNECT握手
+func Dial(addr, clientID, user, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:     conn,
+		r:        bufio.NewReaderSize(conn, 64*1024),
+		w:        bufio.NewWriterSize(conn, 1024*1024),
+		inflight: make(map[uint16]byte),
+	}
+	c.buf = AppendConnect(c.buf[:0], clientID, user, password, 0)
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := c.w.Write(c.buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	pkt, err := ReadPacket(c.r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if pkt.Type != CONNACK || len(pkt.Body) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: expect connack, got packet type %d", pkt.Type)
+	}
+	if pkt.Body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused, return code %d", pkt.Body[1])
+	}
+	return c, nil
+}
+
+func (c *Client) packetID() uint16 {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+// Publish 发布一批消息，并等待所有消息按QoS完成确认。
+// QoS 1等待PUBACK，QoS 2依次完成PUBREC、PUBREL、PUBCOMP的交互。
+func (c *Client) Publish(msgs []Message, qos byte) error {
+	var err error
+	for _, msg := range msgs {
+		var id uint16
+		if qos > 0 {
+			id = c.packetID()
+			if qos == 1 {
+				c.inflight[id] = PUBACK
+			} else {
+				c.inflight[id] = PUBREC
+			}
+		}
+		c.buf, err = AppendPublish(c.buf[:0], msg.Topic, msg.Payload, qos, id)
+		if err != nil {
+			return err
+		}
+		if _, err = c.w.Write(c.buf); err != nil {
+			return err
+		}
+	}
+	if err = c.w.Flush(); err != nil {
+		return err
+	}
+
+	for len(c.inflight) > 0 {
+		// 读缓存为空时下一次读取可能阻塞，先把待发送的PUBREL发出去，减少系统调用的同时避免死锁
+		if c.r.Buffered() == 0 && c.w.Buffered() > 0 {
+			if err = c.w.Flush(); err != nil {
+				return err
+			}
+		}
+		pkt, err := ReadPacket(c.r, c.readBuf)
+		if err != nil {
+			return err
+		}
+		c.readBuf = pkt.Body[:0]
+		id := pkt.PacketID()
+		expect, ok := c.inflight[id]
+		if !ok || expect != pkt.Type {
+			return fmt.Errorf("mqtt: unexpected packet type %d for packet id %d", pkt.Type, id)
+		}
+		switch pkt.Type {
+		case PUBACK, PUBCOMP:
+			delete(c.inflight, id)
+		case PUBREC:
+			c.inflight[id] = PUBCOMP
+			c.buf = AppendAck(c.buf[:0], PUBREL, id)
+			if _, err = c.w.Write(c.buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) Close() error {
+	c.buf = AppendEmpty(c.buf[:0], DISCONNECT)
+	c.w.Write(c.buf)
+	c.w.Flush()
+	return c.conn.Close()
+}
@@ -0,0 +1,88 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"airq/+/DEV001", "airq/北京市/DEV001", true},
+		{"airq/#", "airq/北京市/DEV001", true},
+		{"airq/#", "airq", true},
+		{"airq/+", "airq/北京市/DEV001", false},
+		{"airq/北京市/DEV001", "airq/北京市/DEV001", true},
+		{"airq/北京市/DEV002", "airq/北京市/DEV001", false},
+	}
+	for _, c := range cases {
+		if MatchTopic([]byte(c.filter), []byte(c.topic)) != c.match {
+			t.Errorf("match %s with %s, expect %v", c.filter, c.topic, c.match)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := NewBroker()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	defer ln.Close()
+
+	// 订阅者
+	sub, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	subReader := bufio.NewReader(sub)
+	sub.Write(AppendConnect(nil, "sub", "", "", 0))
+	if pkt, err := ReadPacket(subReader, nil); err != nil || pkt.Type != CONNACK {
+		t.Fatal("connect failed", err)
+	}
+	sub.Write(AppendSubscribe(nil, 1, "airq/#", 0))
+	if pkt, err := ReadPacket(subReader, nil); err != nil || pkt.Type != SUBACK {
+		t.Fatal("subscribe failed", err)
+	}
+
+	client, err := Dial(ln.Addr().String(), "pub", "", "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	msgs := []Message{
+		{Topic: []byte("airq/北京市/DEV001"), Payload: []byte(`{"aqi":1}`)},
+		{Topic: []byte("vehicle/LSVNV2182E0000001"), Payload: []byte(`{"value1":1}`)},
+	}
+	for qos := byte(0); qos <= 2; qos++ {
+		if err := client.Publish(msgs, qos); err != nil {
+			t.Fatalf("publish with qos %d error: %v", qos, err)
+		}
+		sub.SetReadDeadline(time.Now().Add(time.Second))
+		pkt, err := ReadPacket(subReader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic, _, _, payload, err := pkt.Publish()
+		if err != nil || string(topic) != "airq/北京市/DEV001" || string(payload) != `{"aqi":1}` {
+			t.Fatalf("forward message error: %s %s %v", topic, payload, err)
+		}
+	}
+	if broker.Received() != 6 {
+		t.Fatalf("broker received %d messages, expect 6", broker.Received())
+	}
+}
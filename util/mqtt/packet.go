@@ -0,0 +1,265 @@
+// mqtt 一个最小化的MQTT 3.1.1协议实现，仅包含压测需要的发布、确认、订阅等报文，
+// 供mqtt写入客户端和mock命令中内嵌的broker使用。
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 报文类型
+const (
+	CONNECT     byte = 1
+	CONNACK     byte = 2
+	PUBLISH     byte = 3
+	PUBACK      byte = 4
+	PUBREC      byte = 5
+	PUBREL      byte = 6
+	PUBCOMP     byte = 7
+	SUBSCRIBE   byte = 8
+	SUBACK      byte = 9
+	UNSUBSCRIBE byte = 10
+	UNSUBACK    byte = 11
+	PINGREQ     byte = 12
+	PINGRESP    byte = 13
+	DISCONNECT  byte = 14
+)
+
+const maxRemainingLength = 268435455
+
+var ErrMalformedPacket = errors.New("mqtt: malformed packet")
+
+// Packet 是一个未解析可变头和载荷的原始报文
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// ReadPacket 从r中读取一个完整的报文，buf用于复用内存，可以为nil
+func ReadPacket(r *bufio.Reader, buf []byte) (*Packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i >= 4 {
+			return nil, ErrMalformedPacket
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&127) * multiplier
+		multiplier *= 128
+		if b&128 == 0 {
+			break
+		}
+	}
+	if cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return &Packet{Type: header >> 4, Flags: header & 0x0F, Body: buf}, nil
+}
+
+// PacketID 返回PUBACK、PUBREC、PUBREL、PUBCOMP、SUBSCRIBE等报文中的报文标识符
+func (p *Packet) PacketID() uint16 {
+	if len(p.Body) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(p.Body)
+}
+
+// Publish 解析PUBLISH报文，返回主题、QoS、报文标识符和载荷
+func (p *Packet) Publish() (topic []byte, qos byte, id uint16, payload []byte, err error) {
+	if p.Type != PUBLISH {
+		return nil, 0, 0, nil, fmt.Errorf("mqtt: packet type %d is not publish", p.Type)
+	}
+	qos = (p.Flags >> 1) & 0x03
+	body := p.Body
+	topic, body, err = readString(body)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	if qos > 0 {
+		if len(body) < 2 {
+			return nil, 0, 0, nil, ErrMalformedPacket
+		}
+		id = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	return topic, qos, id, body, nil
+}
+
+// Connect 解析CONNECT报文中的客户端标识
+func (p *Packet) Connect() (clientID []byte, err error) {
+	body := p.Body
+	if _, body, err = readString(body); err != nil { // 协议名
+		return nil, err
+	}
+	// 协议级别(1) + 连接标志(1) + 保持连接(2)
+	if len(body) < 4 {
+		return nil, ErrMalformedPacket
+	}
+	clientID, _, err = readString(body[4:])
+	return clientID, err
+}
+
+// Subscribe 解析SUBSCRIBE报文中的订阅主题和QoS
+func (p *Packet) Subscribe() (id uint16, filters [][]byte, qos []byte, err error) {
+	if len(p.Body) < 2 {
+		return 0, nil, nil, ErrMalformedPacket
+	}
+	id = binary.BigEndian.Uint16(p.Body)
+	body := p.Body[2:]
+	for len(body) > 0 {
+		var filter []byte
+		filter, body, err = readString(body)
+		if err != nil || len(body) < 1 {
+			return 0, nil, nil, ErrMalformedPacket
+		}
+		filters = append(filters, filter)
+		qos = append(qos, body[0]&0x03)
+		body = body[1:]
+	}
+	return id, filters, qos, nil
+}
+
+func readString(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, ErrMalformedPacket
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, ErrMalformedPacket
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
+
+func appendString(buf []byte, s []byte) []byte {
+	buf = append(buf, byte(len(s)>>8), byte(len(s)))
+	return append(buf, s...)
+}
+
+func appendFixedHeader(buf []byte, header byte, length int) []byte {
+	buf = append(buf, header)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 128
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			return buf
+		}
+	}
+}
+
+// AppendConnect 添加一个clean session的CONNECT报文，keepAlive单位为秒，0表示不启用保活
+func AppendConnect(buf []byte, clientID, user, password string, keepAlive uint16) []byte {
+	var flags byte = 0x02 // clean session
+	length := 10 + 2 + len(clientID)
+	if user != "" {
+		flags |= 0x80
+		length += 2 + len(user)
+		if password != "" {
+			flags |= 0x40
+			length += 2 + len(password)
+		}
+	}
+	buf = appendFixedHeader(buf, CONNECT<<4, length)
+	buf = appendString(buf, []byte("MQTT"))
+	buf = append(buf, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	buf = appendString(buf, []byte(clientID))
+	if user != "" {
+		buf = appendString(buf, []byte(user))
+		if password != "" {
+			buf = appendString(buf, []byte(password))
+		}
+	}
+	return buf
+}
+
+// AppendConnack 添加一个CONNACK报文，returnCode为0表示连接成功
+func AppendConnack(buf []byte, returnCode byte) []byte {
+	return append(buf, CONNACK<<4, 2, 0, returnCode)
+}
+
+// AppendPublish 添加一个PUBLISH报文，qos为0时忽略id
+func AppendPublish(buf []byte, topic, payload []byte, qos byte, id uint16) ([]byte, error) {
+	length := 2 + len(topic) + len(payload)
+	if qos > 0 {
+		length += 2
+	}
+	if length > maxRemainingLength {
+		return buf, fmt.Errorf("mqtt: publish packet too large (%d bytes)", length)
+	}
+	buf = appendFixedHeader(buf, PUBLISH<<4|qos<<1, length)
+	buf = appendString(buf, topic)
+	if qos > 0 {
+		buf = append(buf, byte(id>>8), byte(id))
+	}
+	return append(buf, payload...), nil
+}
+
+// AppendAck 添加PUBACK、PUBREC、PUBREL、PUBCOMP、UNSUBACK等只包含报文标识符的报文
+func AppendAck(buf []byte, packetType byte, id uint16) []byte {
+	var flags byte
+	if packetType == PUBREL {
+		flags = 0x02
+	}
+	return append(buf, packetType<<4|flags, 2, byte(id>>8), byte(id))
+}
+
+// AppendSubscribe 添加一个SUBSCRIBE报文
+func AppendSubscribe(buf []byte, id uint16, filter string, qos byte) []byte {
+	buf = appendFixedHeader(buf, SUBSCRIBE<<4|0x02, 2+2+len(filter)+1)
+	buf = append(buf, byte(id>>8), byte(id))
+	buf = appendString(buf, []byte(filter))
+	return append(buf, qos)
+}
+
+// AppendSuback 添加一个SUBACK报文
+func AppendSuback(buf []byte, id uint16, grantedQos []byte) []byte {
+	buf = appendFixedHeader(buf, SUBACK<<4, 2+len(grantedQos))
+	buf = append(buf, byte(id>>8), byte(id))
+	return append(buf, grantedQos...)
+}
+
+// AppendEmpty 添加PINGREQ、PINGRESP、DISCONNECT等没有可变头的报文
+func AppendEmpty(buf []byte, packetType byte) []byte {
+	return append(buf, packetType<<4, 0)
+}
+
+// MatchTopic 判断topic是否匹配订阅的filter，支持+和#通配符
+func MatchTopic(filter, topic []byte) bool {
+	fi, ti := 0, 0
+	for fi < len(filter) {
+		switch filter[fi] {
+		case '#':
+			return true
+		case '+':
+			for ti < len(topic) && topic[ti] != '/' {
+				ti++
+			}
+			fi++
+		default:
+			if ti >= len(topic) || filter[fi] != topic[ti] {
+				// "a/#"可以匹配"a"
+				return ti == len(topic) && fi+2 == len(filter) && filter[fi] == '/' && filter[fi+1] == '#'
+			}
+			fi++
+			ti++
+		}
+	}
+	return ti == len(topic)
+}